@@ -0,0 +1,258 @@
+package api
+
+import (
+	"backend/auth"
+	"backend/db"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export formats of GetAuditLog.
+const (
+	AUDIT_FORMAT_JSON string = "json"
+	AUDIT_FORMAT_CSV  string = "csv"
+)
+
+// Columns of the CSV export of the audit log.
+var auditColumns []string = []string{
+	"id", "created_at", "user_id", "actor", "action", "target",
+	"source_ip", "outcome", "detail", "previous_hash", "hash",
+}
+
+// audit records a successful action of the caller in the audit log.
+//
+// Parameters:
+//   - r: Request of the caller, its client address is recorded
+//   - action: Dotted event name, e.g. "user.promote"
+//   - target: Object acted on as "kind:key", e.g. "user:5", empty if there is none
+//   - detail: Event specific fields, serialized as JSON object
+func audit(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	r *http.Request,
+	action string,
+	target string,
+	detail any,
+) error {
+	return db.AddAuditEntry(db_handle, db.AuditEvent{
+		UserID:   auth_result.ID,
+		Action:   action,
+		Target:   target,
+		SourceIP: auth.ClientAddress(r),
+		Detail:   detail,
+	})
+}
+
+// GetAuditLog lists or exports the audit log (permission view_audit_log).
+//
+// Query parameters (all optional):
+//   - actor: Email of the user who caused the events
+//   - action: Event name, also matches the events below it ("user" matches "user.delete")
+//   - target: Object acted on, e.g. "user:5"
+//   - outcome: "success", "failure" or "denied"
+//   - from, to: Date range as YYYY-MM-DD (UTC), both days included
+//   - order: "desc" (default, newest first) or "asc"
+//   - page: 1-based page number, default 1
+//   - per_page: Entries per page, default 50, at most 200
+//   - format: "json" or "csv" to download every matching entry as a file,
+//     page and per_page are ignored then
+//
+// Exports are recorded in the audit log themselves (action "audit.export").
+// In CSV exports, cells starting with =, +, - or @ are prefixed with ' so
+// spreadsheets do not evaluate them; use the JSON export to verify hashes.
+//
+// Responses:
+//   - 200 OK: JSON array of db.AuditEntry (the number of matching entries across
+//     all pages in the X-Total-Count header), or the export as attachment
+//   - 400 Bad Request: Malformed query parameter
+//   - 500 Internal Server Error: Database failure
+//
+// Example Response:
+//
+//	[
+//	  {
+//	    "ID": 42,
+//	    "CreatedAt": 1760000000,
+//	    "UserID": 1,
+//	    "Actor": "admin@example.com",
+//	    "Action": "user.promote",
+//	    "Target": "user:5",
+//	    "SourceIP": "10.0.0.7",
+//	    "Outcome": "success",
+//	    "Detail": {"Role": "admin"},
+//	    "PreviousHash": "5d41402a...",
+//	    "Hash": "7c211433..."
+//	  }
+//	]
+func GetAuditLog(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	query, err := audit_query(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var format string = r.URL.Query().Get("format")
+
+	if format != "" && format != AUDIT_FORMAT_JSON && format != AUDIT_FORMAT_CSV {
+		http.Error(w, `format must be "json" or "csv"`, http.StatusBadRequest)
+		return
+	}
+
+	if format != "" {
+		query.Limit = 0
+		query.Offset = 0
+	}
+
+	entries, total, err := db.GetAuditEntries(db_handle, query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if format == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(entries)
+		return
+	}
+
+	detail := map[string]any{"Format": format, "Entries": len(entries), "Query": r.URL.RawQuery}
+
+	if err := audit(auth_result, db_handle, r, "audit.export", "", detail); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var filename string = fmt.Sprintf("audit_log_%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	if format == AUDIT_FORMAT_JSON {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(entries)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+	writer.Write(auditColumns)
+
+	for _, entry := range entries {
+		writer.Write([]string{
+			strconv.FormatInt(entry.ID, 10),
+			time.Unix(entry.CreatedAt, 0).UTC().Format(time.RFC3339),
+			strconv.FormatInt(entry.UserID, 10),
+			csv_cell(entry.Actor),
+			entry.Action,
+			csv_cell(entry.Target),
+			entry.SourceIP,
+			entry.Outcome,
+			csv_cell(string(entry.Detail)),
+			entry.PreviousHash,
+			entry.Hash,
+		})
+	}
+
+	writer.Flush()
+}
+
+// audit_query parses the query parameters of GetAuditLog.
+func audit_query(r *http.Request) (db.AuditQuery, error) {
+	var parameters = r.URL.Query()
+	var query db.AuditQuery = db.AuditQuery{
+		Actor:   strings.TrimSpace(parameters.Get("actor")),
+		Action:  strings.TrimSpace(parameters.Get("action")),
+		Target:  strings.TrimSpace(parameters.Get("target")),
+		Outcome: parameters.Get("outcome"),
+	}
+
+	if query.Outcome != "" && !slices.Contains([]string{db.AUDIT_SUCCESS, db.AUDIT_FAILURE, db.AUDIT_DENIED}, query.Outcome) {
+		return db.AuditQuery{}, errors.New(`outcome must be "success", "failure" or "denied"`)
+	}
+
+	switch parameters.Get("order") {
+	case "", "desc":
+		query.Descending = true
+	case "asc":
+		query.Descending = false
+	default:
+		return db.AuditQuery{}, errors.New(`order must be "asc" or "desc"`)
+	}
+
+	if from := parameters.Get("from"); from != "" {
+		day, err := time.Parse(time.DateOnly, from)
+		if err != nil {
+			return db.AuditQuery{}, errors.New("from must be a date as YYYY-MM-DD")
+		}
+		query.From = day.Unix()
+	}
+
+	if to := parameters.Get("to"); to != "" {
+		day, err := time.Parse(time.DateOnly, to)
+		if err != nil {
+			return db.AuditQuery{}, errors.New("to must be a date as YYYY-MM-DD")
+		}
+		query.To = day.AddDate(0, 0, 1).Unix()
+	}
+
+	page, err := positive_parameter(parameters.Get("page"), 1)
+	if err != nil {
+		return db.AuditQuery{}, fmt.Errorf("page %w", err)
+	}
+
+	query.Limit, err = positive_parameter(parameters.Get("per_page"), DEFAULT_PAGE_SIZE)
+	if err != nil {
+		return db.AuditQuery{}, fmt.Errorf("per_page %w", err)
+	}
+
+	query.Limit = min(query.Limit, MAX_PAGE_SIZE)
+	query.Offset = (page - 1) * query.Limit
+
+	return query, nil
+}
+
+// csv_cell keeps spreadsheets from evaluating a user supplied value as formula.
+func csv_cell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// VerifyAuditLog recomputes the hash chain of the audit log (permission view_audit_log).
+//
+// Responses:
+//   - 200 OK: JSON object with db.AuditVerification structure
+//   - 500 Internal Server Error: Database failure
+//
+// Example Response:
+//
+//	{"Valid": false, "Entries": 1204, "Unchained": 97, "BrokenAt": 815, "Reason": "entry 815 does not match its hash"}
+func VerifyAuditLog(db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
+	verification, err := db.VerifyAuditLog(db_handle)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(verification)
+}
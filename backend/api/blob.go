@@ -0,0 +1,130 @@
+package api
+
+import (
+	"backend/db"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Original files of documents, stored once per content under blobPath/<first two hex digits>/<sha256>.
+// Rendered thumbnails are cached below blobPath/thumbnails/<sha256>/.
+// Set by ConfigureBlobs.
+var (
+	blobPath         string = "./data/blobs"
+	thumbnailCommand string = "pdftoppm"
+)
+
+// Serializes storing and collecting blob files, so content uploaded again while
+// its previous copy is collected is not removed.
+var blobMutex sync.Mutex
+
+// ConfigureBlobs sets where original files are stored and the command rendering PDF thumbnails.
+//
+// Must be called before the server starts handling requests, it is not synchronized.
+//
+// Parameters:
+//   - path: Directory of the blob store
+//   - thumbnail_command: Name or path of poppler's pdftoppm
+func ConfigureBlobs(path string, thumbnail_command string) {
+	blobPath = path
+	thumbnailCommand = thumbnail_command
+}
+
+// blob_file returns the path of the stored original with the given content hash.
+func blob_file(sha256 string) string {
+	return filepath.Join(blobPath, sha256[:2], sha256)
+}
+
+// thumbnail_directory returns the directory of the cached thumbnails of a blob.
+func thumbnail_directory(sha256 string) string {
+	return filepath.Join(blobPath, "thumbnails", sha256)
+}
+
+// store_blob moves a spooled file into the blob store, unless the content is stored already.
+//
+// The spooled file is moved or left in place (the caller removes it either way).
+// The document referencing the blob must be recorded before, otherwise a
+// concurrent collect_blobs may remove the stored file again.
+func store_blob(spooled string, sha256 string) error {
+	blobMutex.Lock()
+	defer blobMutex.Unlock()
+
+	var target string = blob_file(sha256)
+
+	if _, err := os.Stat(target); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+		return err
+	}
+
+	if err := os.Rename(spooled, target); err == nil {
+		return nil
+	}
+
+	// Spool and blob directories may be on different file systems
+	return copy_file(spooled, target)
+}
+
+// copy_file copies source to target through a temporary file, so target never holds a partial copy.
+func copy_file(source string, target string) error {
+	input, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	output, err := os.CreateTemp(filepath.Dir(target), ".copy-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(output.Name())
+
+	if _, err := io.Copy(output, input); err != nil {
+		output.Close()
+		return fmt.Errorf("failed to copy %s: %w", source, err)
+	}
+
+	if err := output.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(output.Name(), target)
+}
+
+// collect_blobs removes the files and thumbnails of blobs no document references anymore.
+//
+// Called after documents or users were deleted and at startup; failures are only logged,
+// the hashes are not recorded again, so files of failed removals remain.
+func collect_blobs(db_handle *sql.DB) {
+	blobMutex.Lock()
+	defer blobMutex.Unlock()
+
+	hashes, err := db.TakeBlobGarbage(db_handle)
+	if err != nil {
+		slog.Error("Failed to collect blobs", "error", err)
+		return
+	}
+
+	for _, sha256 := range hashes {
+		if err := os.Remove(blob_file(sha256)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Error("Failed to remove blob", "sha256", sha256, "error", err)
+		}
+
+		if err := os.RemoveAll(thumbnail_directory(sha256)); err != nil {
+			slog.Error("Failed to remove thumbnails of blob", "sha256", sha256, "error", err)
+		}
+	}
+}
+
+// CollectBlobs removes the files of blobs whose documents were deleted while the server was down.
+func CollectBlobs(db_handle *sql.DB) {
+	collect_blobs(db_handle)
+}
@@ -0,0 +1,278 @@
+package api
+
+import (
+	"backend/auth"
+	"backend/db"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const DEFAULT_CONVERSATION_TITLE string = "New conversation"
+
+type ConversationRename struct {
+	ID    int64
+	Title string
+}
+
+type ConversationArchive struct {
+	ID       int64
+	Archived bool
+}
+
+// requested_conversation reads the optional "Conversation" header of a request.
+//
+// Returns:
+//   - int64: The conversation ID, 0 if the header is absent (legacy single chat)
+//   - int: HTTP status to answer with if the error is not nil
+//   - error: Malformed header or conversation not owned by the caller
+func requested_conversation(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	r *http.Request,
+) (int64, int, error) {
+	var header string = r.Header.Get(conversationHeader)
+
+	if header == "" {
+		return 0, http.StatusOK, nil
+	}
+
+	conversation_id, err := strconv.ParseInt(header, 10, 64)
+	if err != nil || conversation_id <= 0 {
+		return 0, http.StatusBadRequest, fmt.Errorf("invalid %s header", conversationHeader)
+	}
+
+	_, err = db.GetConversation(db_handle, conversation_id, auth_result.ID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, http.StatusNotFound, errors.New("conversation not found")
+	} else if err != nil {
+		return 0, http.StatusInternalServerError, err
+	}
+
+	return conversation_id, http.StatusOK, nil
+}
+
+// CreateConversation starts a new conversation for the authenticated user.
+//
+// Expects the title as plain text in the request body; an empty body creates a
+// conversation titled DEFAULT_CONVERSATION_TITLE.
+//
+// Responses:
+//   - 200 OK: JSON object of the created conversation (see db.Conversation)
+//   - 400 Bad Request: Body cannot be read
+//   - 500 Internal Server Error: Database operation failed
+func CreateConversation(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	data, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var title string = strings.TrimSpace(string(data[:]))
+
+	if title == "" {
+		title = DEFAULT_CONVERSATION_TITLE
+	}
+
+	conversation, err := db.AddConversation(db_handle, auth_result.ID, title)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(conversation)
+}
+
+// GetConversations lists the conversations of the authenticated user, most recently used first.
+//
+// Archived conversations are only included with the query parameter "archived=true".
+//
+// Example Response:
+//
+//	[
+//	  {
+//		"ID": int,
+//		"UserID": int,
+//		"Title": string,
+//		"CreatedAt": int,
+//		"UpdatedAt": int,
+//		"Archived": bool
+//	  }
+//	]
+func GetConversations(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	var include_archived bool = r.URL.Query().Get("archived") == "true"
+
+	conversations, err := db.GetConversations(db_handle, auth_result.ID, include_archived)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(conversations)
+}
+
+// RenameConversation changes the title of a conversation.
+//
+// Expects a JSON payload with ConversationRename structure.
+//
+// Responses:
+//   - 200 OK: Conversation renamed
+//   - 400 Bad Request: Invalid JSON or empty title
+//   - 404 Not Found: Conversation does not exist or belongs to another user
+//   - 500 Internal Server Error: Database operation failed
+func RenameConversation(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	data, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var rename ConversationRename
+	if err := json.Unmarshal(data, &rename); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	rename.Title = strings.TrimSpace(rename.Title)
+
+	if rename.Title == "" {
+		http.Error(w, "title must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	err = db.RenameConversation(db_handle, rename.ID, auth_result.ID, rename.Title)
+	write_conversation_result(w, err)
+}
+
+// ArchiveConversation archives or restores a conversation.
+//
+// Expects a JSON payload with ConversationArchive structure.
+//
+// Responses:
+//   - 200 OK: Archive state updated
+//   - 400 Bad Request: Invalid JSON
+//   - 404 Not Found: Conversation does not exist or belongs to another user
+//   - 500 Internal Server Error: Database operation failed
+func ArchiveConversation(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	data, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var archive ConversationArchive
+	if err := json.Unmarshal(data, &archive); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	err = db.SetConversationArchived(db_handle, archive.ID, auth_result.ID, archive.Archived)
+	write_conversation_result(w, err)
+}
+
+// DeleteConversation deletes a conversation together with its message history.
+//
+// Expects the conversation ID as plain text in the request body. The history is
+// deleted in the ML pipeline first; the conversation record is only removed once
+// that succeeded, so a failed deletion can be retried.
+//
+// Responses:
+//   - 200 OK: Conversation deleted
+//   - 400 Bad Request: Invalid conversation ID
+//   - 404 Not Found: Conversation does not exist or belongs to another user
+//   - 500 Internal Server Error: ML pipeline or database failure
+func DeleteConversation(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	data, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	conversation_id, err := strconv.ParseInt(strings.TrimSpace(string(data[:])), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid conversation id", http.StatusBadRequest)
+		return
+	}
+
+	_, err = db.GetConversation(db_handle, conversation_id, auth_result.ID)
+	if err != nil {
+		write_conversation_result(w, err)
+		return
+	}
+
+	response, err := MLDeleteChat(r.Context(), auth_result.ID, conversation_id)
+
+	if err != nil {
+		http.Error(w, "Sending to ML-Pipeline failed", http.StatusInternalServerError)
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(response.Body)
+		http.Error(w, fmt.Sprintf("ML pipeline error: %s", string(body)), response.StatusCode)
+		return
+	}
+
+	err = db.DeleteConversation(db_handle, conversation_id, auth_result.ID)
+	write_conversation_result(w, err)
+}
+
+// write_conversation_result answers a conversation update, mapping sql.ErrNoRows to 404.
+func write_conversation_result(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "conversation not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte{})
+}
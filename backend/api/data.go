@@ -29,11 +29,32 @@ type Message struct {
 //     Modifying this field can drastically alter the AI Agent’s behavior and responses.
 //     Handle with care and ensure appropriate access controls.
 //     Incorrect use may lead to unexpected or undesirable outcomes.
+//   - SharedDocuments are documents of other users shared with the user for retrieval
+//     (see db.SHARE_RETRIEVE), searched in addition to the user's own uploads. If the
+//     user opted into the shared legal library, its documents are included with
+//     OwnerID LEGAL_LIBRARY_COLLECTION.
 type MLMessage struct {
-	Kind      int
-	Message   string
-	Model     string
-	Preprompt string
+	Kind            int
+	Message         string
+	Model           string
+	Preprompt       string
+	SharedDocuments []db.SharedSource
+}
+
+// LLMResponse is the answer of the ML pipeline to an inference request.
+//
+//   - Response is the generated text. In a stream every chunk carries the next
+//     piece of text; the final event sent to the client carries the full text.
+//   - Done marks the last chunk of a stream.
+//   - The remaining fields are optional generation statistics forwarded from the
+//     model backend when the pipeline provides them.
+type LLMResponse struct {
+	Response        string `json:"response"`
+	Done            bool   `json:"done"`
+	Model           string `json:"model,omitempty"`
+	TotalDuration   int64  `json:"total_duration,omitempty"`
+	PromptEvalCount int64  `json:"prompt_eval_count,omitempty"`
+	EvalCount       int64  `json:"eval_count,omitempty"`
 }
 
 type LegalLibary struct {
@@ -79,6 +100,7 @@ var (
 //
 // Parameters:
 //
+//	path: The file the prompt is persisted to (config default_prompt_path).
 //	new: The new default pre-prompt string to set.
 //
 // Returns:
@@ -86,12 +108,12 @@ var (
 //	error: An error if writing the prompt to disk fails; nil otherwise.
 //
 // **Legal Note:** This function modifies a global variable and writes to a file.  Proper error handling and consideration of potential race conditions should be implemented in the calling code.
-func SetDefaultPrompt(new string) error {
+func SetDefaultPrompt(path string, new string) error {
 	defaultPromptMutex.Lock()
 	defer defaultPromptMutex.Unlock()
 	DEFAULT_PREPROMPT = new
 
-	return Write_default_prompt("./data/default_prompt.txt", new)
+	return Write_default_prompt(path, new)
 }
 
 // getDefaultPrompt retrieves the current default prompt string.
@@ -3,14 +3,19 @@ package api
 import (
 	"backend/auth"
 	"backend/db"
+	"backend/logging"
 	"database/sql"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 )
 
 // DeleteSignupRequest removes a pending signup request from the database.
 //
 // Parameters:
+//   - auth_result: Authorization of the administrator, recorded in the audit log
 //   - db_handle: Active database connection
 //   - w: HTTP response writer
 //   - r: HTTP request containing the email to delete
@@ -30,7 +35,8 @@ import (
 //
 // Security:
 //   - Email matching is case-sensitive
-func DeleteSignupRequest(db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
+//   - The rejection is recorded in the audit log (action "signup.reject")
+func DeleteSignupRequest(auth_result auth.AuthorizationResult, db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
 	data, err := io.ReadAll(r.Body)
 	defer r.Body.Close()
 
@@ -38,13 +44,18 @@ func DeleteSignupRequest(db_handle *sql.DB, w http.ResponseWriter, r *http.Reque
 		http.Error(w, err.Error(), http.StatusBadRequest)
 	}
 
-	_, err = db.DeleteSignupRequest(db_handle, string(data[:]))
+	entry, err := db.DeleteSignupRequest(db_handle, string(data[:]))
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if err := audit(auth_result, db_handle, r, "signup.reject", "signup:"+entry.Email, map[string]string{"Name": entry.Name, "Email": entry.Email}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte{})
 }
@@ -54,10 +65,12 @@ func DeleteSignupRequest(db_handle *sql.DB, w http.ResponseWriter, r *http.Reque
 // This endpoint performs a cascading deletion that:
 //  1. Reads the user's email from the request body
 //  2. Deletes the user record from the database (which cascades to linked documents)
-//  3. Sends a deletion request to the ML pipeline for the user
-//  4. Returns the ML pipeline's response to the client
+//  3. Revokes all sessions of the user
+//  4. Sends a deletion request to the ML pipeline for the user
+//  5. Returns the ML pipeline's response to the client
 //
 // Parameters:
+//   - auth_result: Authorization of the administrator, recorded in the audit log
 //   - db_handle: Database connection handle
 //   - w: HTTP response writer
 //   - r: HTTP request containing the user's email in its body
@@ -76,7 +89,10 @@ func DeleteSignupRequest(db_handle *sql.DB, w http.ResponseWriter, r *http.Reque
 // ML Pipeline Integration:
 //   - Forwards the deletion request to maintain consistency across all services
 //   - Returns whatever response the ML pipeline provides
-func DeleteUser(db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
+//
+// The deletion is recorded in the audit log (action "user.delete") once the
+// user record is gone, whatever the ML pipeline answers.
+func DeleteUser(auth_result auth.AuthorizationResult, db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
 	data, err := io.ReadAll(r.Body)
 	defer r.Body.Close()
 
@@ -95,7 +111,20 @@ func DeleteUser(db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response, err := MLDeleteUser(user.ID)
+	if err := audit(auth_result, db_handle, r, "user.delete", fmt.Sprintf("user:%d", user.ID), map[string]string{"Email": email}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Tokens of the deleted user are already rejected because their session no
+	// longer joins a user row, revoking keeps the sessions table consistent.
+	if _, err := db.RevokeUserSessions(db_handle, user.ID); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to revoke sessions of deleted user", "user", user.ID, "error", err)
+	}
+
+	collect_blobs(db_handle)
+
+	response, err := MLDeleteUser(r.Context(), user.ID)
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -113,6 +142,61 @@ func DeleteUser(db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
 	w.Write(body)
 }
 
+// RevokeSessions signs a user out everywhere by revoking all of their sessions.
+//
+// Expects the user's email as raw bytes in the request body. Access tokens of the
+// user are rejected by auth.Authorization from the next request on and their
+// refresh tokens can no longer be used. The revocation is recorded in the audit
+// log (action "session.revoke").
+//
+// Responses:
+//   - 200 OK: Number of revoked sessions as plain text
+//   - 400 Bad Request: Body cannot be read
+//   - 404 Not Found: No user with the given email
+//   - 405 Method Not Allowed: Non-DELETE requests
+//   - 500 Internal Server Error: Database operation failed
+func RevokeSessions(auth_result auth.AuthorizationResult, db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user_id, err := db.GetUserID(db_handle, string(data[:]))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "no user found with this email", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	revoked, err := db.RevokeUserSessions(db_handle, user_id)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("Revoked sessions", "user", user_id, "count", revoked)
+
+	if err := audit(auth_result, db_handle, r, "session.revoke", fmt.Sprintf("user:%d", user_id), map[string]int64{"Revoked": revoked}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(strconv.FormatInt(revoked, 10)))
+}
+
 // DeleteDocument handles the deletion of a document from the system architecture.
 //
 // This endpoint performs the following operations:
@@ -149,7 +233,7 @@ func DeleteDocument(
 		return
 	}
 
-	response, err := MLDeleteDocument(auth_result.ID, string(data[:]))
+	response, err := MLDeleteDocument(r.Context(), auth_result.ID, string(data[:]))
 
 	if err != nil {
 		http.Error(w, "Sending to ML-Pipeline failed", http.StatusInternalServerError)
@@ -178,6 +262,8 @@ func DeleteDocument(
 		return
 	}
 
+	collect_blobs(db_handle)
+
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte{})
 }
@@ -190,21 +276,36 @@ func DeleteDocument(
 //
 // Parameters:
 //   - auth_result: Authorization context containing user ID
+//   - db_handle: Database connection handle (conversation ownership)
 //   - w: HTTP response writer
 //   - r: HTTP request (unused body, but closed automatically)
 //
 // Behavior:
+//   - The optional "Conversation" header selects the conversation whose history is cleared
+//   - Returns 404 Not Found if the conversation belongs to another user
 //   - Returns 500 Internal Server Error if ML pipeline communication fails
 //   - Propagates the ML pipeline's error status code if deletion fails there
 //   - Returns 200 OK on successful deletion
 //
 // Note:
-//   - Unlike DeleteDocument, this only interacts with the ML pipeline and not the database
+//   - The conversation itself is kept, use DeleteConversation to remove it
 //   - The function closes all request/response bodies automatically via defer statements
-func DeleteChat(auth_result auth.AuthorizationResult, w http.ResponseWriter, r *http.Request) {
+func DeleteChat(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
 	defer r.Body.Close()
 
-	response, err := MLDeleteChat(auth_result.ID)
+	conversation_id, status, err := requested_conversation(auth_result, db_handle, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	response, err := MLDeleteChat(r.Context(), auth_result.ID, conversation_id)
 
 	if err != nil {
 		http.Error(w, "Sending to ML-Pipeline failed", http.StatusInternalServerError)
@@ -0,0 +1,270 @@
+package api
+
+import (
+	"backend/auth"
+	"backend/db"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page size of GetDocuments if per_page is not given, and its upper bound.
+const (
+	DEFAULT_PAGE_SIZE int64 = 50
+	MAX_PAGE_SIZE     int64 = 200
+)
+
+// Upper bound of tags per document.
+const MAX_TAGS int = 20
+
+// Tags are lower case words of letters, digits, '-', '_', '.' and inner spaces.
+var tagPattern = regexp.MustCompile(`^[\p{Ll}\p{Lo}\p{N}_.-]([\p{Ll}\p{Lo}\p{N}_. -]{0,30}[\p{Ll}\p{Lo}\p{N}_.-])?$`)
+
+// DocumentTags is the request body of UpdateDocumentTags.
+type DocumentTags struct {
+	StorageName string
+	Tags        []string
+}
+
+// GetDocuments lists the documents of the authenticated user and the documents shared
+// with the user, a page at a time.
+//
+// Query parameters (all optional):
+//   - scope: "own" or "shared" to list only one kind, both if omitted
+//   - q: Case-insensitive substring of the file name or title
+//   - tag: Only documents carrying this tag, may be repeated (all must match)
+//   - from, to: Upload date range as YYYY-MM-DD (UTC), both days included
+//   - sort: "uploaded_at" (default), "name", "title" or "size"
+//   - order: "desc" (default for uploaded_at) or "asc" (default otherwise)
+//   - page: 1-based page number, default 1
+//   - per_page: Documents per page, default 50, at most 200
+//
+// Responses:
+//   - 200 OK: JSON array of documents (empty past the last page), the number of
+//     matching documents across all pages in the X-Total-Count header
+//   - 400 Bad Request: Malformed query parameter
+//   - 500 Internal Server Error: Database failure
+//
+// Example Response:
+//
+//	[
+//	  {
+//	    "OriginalName": "ruling.pdf",
+//	    "StorageName": "1/9f86d0...",
+//	    "Title": "Ruling 2024",
+//	    "Size": 482113,
+//	    "MimeType": "application/pdf",
+//	    "PageCount": 12,
+//	    "UploadedAt": 1760000000,
+//	    "SHA256": "9f86d0...",
+//	    "Tags": ["civil law", "ruling"],
+//	    "OwnerID": 1,
+//	    "Owner": "Admin",
+//	    "Access": "owner"
+//	  }
+//	]
+func GetDocuments(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusBadRequest)
+		return
+	}
+
+	query, err := document_query(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	documents, total, err := db.GetDocuments(db_handle, auth_result.ID, query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(documents)
+}
+
+// document_query parses the query parameters of GetDocuments.
+func document_query(r *http.Request) (db.DocumentQuery, error) {
+	var parameters = r.URL.Query()
+	var query db.DocumentQuery = db.DocumentQuery{
+		Scope:  parameters.Get("scope"),
+		Search: strings.TrimSpace(parameters.Get("q")),
+		Sort:   parameters.Get("sort"),
+	}
+
+	if query.Sort == "" {
+		query.Sort = db.DOCUMENT_SORT_UPLOADED_AT
+	}
+
+	switch parameters.Get("order") {
+	case "":
+		query.Descending = query.Sort == db.DOCUMENT_SORT_UPLOADED_AT
+	case "asc":
+		query.Descending = false
+	case "desc":
+		query.Descending = true
+	default:
+		return db.DocumentQuery{}, errors.New(`order must be "asc" or "desc"`)
+	}
+
+	if !slices.Contains([]string{db.DOCUMENT_SCOPE_ALL, db.DOCUMENT_SCOPE_OWN, db.DOCUMENT_SCOPE_SHARED}, query.Scope) {
+		return db.DocumentQuery{}, errors.New(`scope must be "own" or "shared"`)
+	}
+
+	if !slices.Contains([]string{db.DOCUMENT_SORT_NAME, db.DOCUMENT_SORT_TITLE, db.DOCUMENT_SORT_UPLOADED_AT, db.DOCUMENT_SORT_SIZE}, query.Sort) {
+		return db.DocumentQuery{}, errors.New(`sort must be "uploaded_at", "name", "title" or "size"`)
+	}
+
+	tags, err := parse_tags(parameters["tag"])
+	if err != nil {
+		return db.DocumentQuery{}, err
+	}
+	query.Tags = tags
+
+	if from := parameters.Get("from"); from != "" {
+		day, err := time.Parse(time.DateOnly, from)
+		if err != nil {
+			return db.DocumentQuery{}, errors.New("from must be a date as YYYY-MM-DD")
+		}
+		query.From = day.Unix()
+	}
+
+	if to := parameters.Get("to"); to != "" {
+		day, err := time.Parse(time.DateOnly, to)
+		if err != nil {
+			return db.DocumentQuery{}, errors.New("to must be a date as YYYY-MM-DD")
+		}
+		query.To = day.AddDate(0, 0, 1).Unix()
+	}
+
+	page, err := positive_parameter(parameters.Get("page"), 1)
+	if err != nil {
+		return db.DocumentQuery{}, fmt.Errorf("page %w", err)
+	}
+
+	query.Limit, err = positive_parameter(parameters.Get("per_page"), DEFAULT_PAGE_SIZE)
+	if err != nil {
+		return db.DocumentQuery{}, fmt.Errorf("per_page %w", err)
+	}
+
+	query.Limit = min(query.Limit, MAX_PAGE_SIZE)
+	query.Offset = (page - 1) * query.Limit
+
+	return query, nil
+}
+
+// positive_parameter parses an optional positive integer query parameter.
+func positive_parameter(value string, fallback int64) (int64, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || parsed <= 0 || parsed > 1<<31 {
+		return 0, errors.New("must be a positive integer")
+	}
+
+	return parsed, nil
+}
+
+// UpdateDocumentTags replaces the tags of a document.
+//
+// Expects a JSON payload with DocumentTags structure. Tags are trimmed and lower
+// cased; duplicates are dropped and an empty list removes all tags.
+//
+// Responses:
+//   - 200 OK: Tags replaced
+//   - 400 Bad Request: Invalid JSON or tag
+//   - 404 Not Found: The user has no document with this storage name
+//   - 500 Internal Server Error: Database operation failed
+func UpdateDocumentTags(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	data, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var request DocumentTags
+	if err := json.Unmarshal(data, &request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	tags, err := parse_tags(request.Tags)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = db.SetDocumentTags(db_handle, auth_result.ID, request.StorageName, tags)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "document not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// parse_tags normalizes and validates tags given by a user.
+//
+// Returns:
+//   - []string: Trimmed, lower cased tags without duplicates, in the given order
+//   - error: A tag is invalid, or there are more than MAX_TAGS
+func parse_tags(values []string) ([]string, error) {
+	var tags []string = []string{}
+
+	for _, value := range values {
+		var tag string = strings.ToLower(strings.TrimSpace(value))
+
+		if !tagPattern.MatchString(tag) {
+			return nil, fmt.Errorf("invalid tag %q: use 1-32 letters, digits, spaces, '-', '_' or '.'", value)
+		}
+
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	if len(tags) > MAX_TAGS {
+		return nil, fmt.Errorf("a document can have at most %d tags", MAX_TAGS)
+	}
+
+	return tags, nil
+}
+
+// header_tags parses the comma separated Tags header of an upload.
+func header_tags(r *http.Request) ([]string, error) {
+	var header string = r.Header.Get("Tags")
+	if strings.TrimSpace(header) == "" {
+		return []string{}, nil
+	}
+
+	return parse_tags(strings.Split(header, ","))
+}
@@ -0,0 +1,274 @@
+package api
+
+import (
+	"backend/auth"
+	"backend/db"
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+const (
+	DEFAULT_THUMBNAIL_WIDTH int64 = 256
+	MIN_THUMBNAIL_WIDTH     int64 = 16
+	MAX_THUMBNAIL_WIDTH     int64 = 1024
+
+	// Upper bound for rendering a single page, including the wait for a rendering slot
+	THUMBNAIL_TIMEOUT time.Duration = 30 * time.Second
+)
+
+// Rendering slots, bounds the thumbnail command processes running at the same time.
+var thumbnailSlots chan struct{} = make(chan struct{}, max(runtime.NumCPU()/2, 1))
+
+// Content hashes are lower-case hex SHA-256 digests
+var hashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// DownloadDocument streams the original file of a document the caller owns or that is shared with the caller.
+//
+// Downloads of shared documents are recorded in the audit log (action "share.download").
+// Range requests, If-Range and If-None-Match are answered by http.ServeContent.
+// The file is served as attachment unless inline=true is given; either way the
+// browser is told not to sniff or run it, since users upload arbitrary HTML.
+//
+// Path parameter:
+//   - sha256: Content hash of the document (see GET /api/documents)
+//
+// Query parameter:
+//   - inline: "true" to display the file in the browser instead of saving it
+//
+// Responses:
+//   - 200 OK / 206 Partial Content: File content with the stored media type
+//   - 400 Bad Request: Malformed hash
+//   - 404 Not Found: No such document accessible to the caller, or it was uploaded before originals were kept
+//   - 500 Internal Server Error: Database or file system failure
+func DownloadDocument(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	stored, file, status, err := open_document(auth_result, db_handle, r.PathValue("sha256"))
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	defer file.Close()
+
+	if stored.Access != db.DOCUMENT_OWNER {
+		detail := map[string]any{"OwnerID": stored.OwnerID, "StorageName": stored.StorageName}
+
+		if err := audit(auth_result, db_handle, r, "share.download", "document:"+stored.SHA256, detail); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var media_type string = stored.MimeType
+	if media_type == "" {
+		media_type = "application/octet-stream"
+	}
+
+	var disposition string = "attachment"
+	if r.URL.Query().Get("inline") == "true" {
+		disposition = "inline"
+	}
+
+	w.Header().Set("Content-Type", media_type)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": stored.OriginalName}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("Cache-Control", "private")
+	w.Header().Set("ETag", `"`+stored.SHA256+`"`)
+
+	http.ServeContent(w, r, stored.OriginalName, time.Unix(stored.UploadedAt, 0), file)
+}
+
+// DocumentThumbnail renders a page of a PDF document accessible to the caller as PNG.
+//
+// Rendered pages are cached next to the original and removed with it.
+//
+// Path parameter:
+//   - sha256: Content hash of the document
+//
+// Query parameters:
+//   - page: Page number starting at 1 (default 1), smaller numbers are raised to 1
+//   - width: Width in pixels, clamped to 16-1024 (default 256)
+//
+// Responses:
+//   - 200 OK: image/png
+//   - 400 Bad Request: Malformed hash, page or width, or page beyond the document
+//   - 404 Not Found: No such document accessible to the caller, or its original is not stored
+//   - 415 Unsupported Media Type: Document is not a PDF
+//   - 422 Unprocessable Entity: Page could not be rendered
+//   - 501 Not Implemented: thumbnail_command is not installed
+//   - 503 Service Unavailable: No rendering slot became free in time
+//   - 500 Internal Server Error: Database or file system failure
+func DocumentThumbnail(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	page, err := strconv.ParseInt(cmp.Or(r.URL.Query().Get("page"), "1"), 10, 64)
+	if err != nil {
+		http.Error(w, "page must be an integer", http.StatusBadRequest)
+		return
+	}
+	page = max(page, 1)
+
+	width, err := positive_parameter(r.URL.Query().Get("width"), DEFAULT_THUMBNAIL_WIDTH)
+	if err != nil {
+		http.Error(w, "width "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	width = min(max(width, MIN_THUMBNAIL_WIDTH), MAX_THUMBNAIL_WIDTH)
+
+	stored, file, status, err := open_document(auth_result, db_handle, r.PathValue("sha256"))
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	file.Close()
+
+	if stored.MimeType != "application/pdf" {
+		http.Error(w, "thumbnails are only available for PDF documents", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if stored.PageCount > 0 && page > stored.PageCount {
+		http.Error(w, fmt.Sprintf("page must not exceed %d", stored.PageCount), http.StatusBadRequest)
+		return
+	}
+
+	thumbnail, status, err := render_thumbnail(r.Context(), stored.SHA256, page, width)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	defer thumbnail.Close()
+
+	info, err := thumbnail.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+
+	http.ServeContent(w, r, "", info.ModTime(), thumbnail)
+}
+
+// open_document looks up a document accessible to the caller by content hash and opens its stored original.
+//
+// Returns:
+//   - db.DocumentRecord: Metadata of the document
+//   - *os.File: Original file, to be closed by the caller
+//   - int: HTTP status classifying the error
+//   - error: Malformed hash, unknown document, missing original or database failure
+func open_document(auth_result auth.AuthorizationResult, db_handle *sql.DB, sha256 string) (db.DocumentRecord, *os.File, int, error) {
+	if !hashPattern.MatchString(sha256) {
+		return db.DocumentRecord{}, nil, http.StatusBadRequest, errors.New("invalid document hash")
+	}
+
+	stored, err := db.GetAccessibleDocument(db_handle, auth_result.ID, sha256)
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.DocumentRecord{}, nil, http.StatusNotFound, errors.New("document not found")
+	} else if err != nil {
+		return db.DocumentRecord{}, nil, http.StatusInternalServerError, err
+	}
+
+	file, err := os.Open(blob_file(sha256))
+	if errors.Is(err, os.ErrNotExist) {
+		return db.DocumentRecord{}, nil, http.StatusNotFound, errors.New("original file is not stored, upload the document again")
+	} else if err != nil {
+		return db.DocumentRecord{}, nil, http.StatusInternalServerError, err
+	}
+
+	return stored, file, http.StatusOK, nil
+}
+
+// render_thumbnail returns the cached rendering of a page, rendering it with thumbnailCommand first if needed.
+//
+// Renderings take one of the thumbnailSlots; waiting for a slot and rendering
+// together are bounded by THUMBNAIL_TIMEOUT, the command is killed when it expires.
+//
+// Returns:
+//   - *os.File: PNG file, to be closed by the caller
+//   - int: HTTP status classifying the error
+//   - error: No free slot, command missing, rendering or file system failure
+func render_thumbnail(ctx context.Context, sha256 string, page int64, width int64) (*os.File, int, error) {
+	var directory string = thumbnail_directory(sha256)
+	var cached string = filepath.Join(directory, fmt.Sprintf("%d-%d.png", page, width))
+
+	if file, err := os.Open(cached); err == nil {
+		return file, http.StatusOK, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, THUMBNAIL_TIMEOUT)
+	defer cancel()
+
+	select {
+	case thumbnailSlots <- struct{}{}:
+		defer func() { <-thumbnailSlots }()
+	case <-ctx.Done():
+		return nil, http.StatusServiceUnavailable, errors.New("too many thumbnails are being rendered, try again later")
+	}
+
+	// A concurrent request may have rendered the page while this one waited
+	if file, err := os.Open(cached); err == nil {
+		return file, http.StatusOK, nil
+	}
+
+	if err := os.MkdirAll(directory, 0o700); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	// pdftoppm appends ".png" to the output prefix
+	prefix, err := os.CreateTemp(directory, ".render-*")
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	prefix.Close()
+	os.Remove(prefix.Name())
+
+	var rendered string = prefix.Name() + ".png"
+	defer os.Remove(rendered)
+
+	var page_number string = strconv.FormatInt(page, 10)
+
+	command := exec.CommandContext(ctx, thumbnailCommand,
+		"-png", "-f", page_number, "-l", page_number,
+		"-scale-to", strconv.FormatInt(width, 10),
+		"-singlefile", blob_file(sha256), prefix.Name(),
+	)
+
+	output, err := command.CombinedOutput()
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+		return nil, http.StatusNotImplemented, errors.New("thumbnail rendering is not available on this server")
+	} else if err != nil {
+		return nil, http.StatusUnprocessableEntity, fmt.Errorf("rendering page %d failed: %v: %s", page, err, output)
+	}
+
+	if err := os.Rename(rendered, cached); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	file, err := os.Open(cached)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return file, http.StatusOK, nil
+}
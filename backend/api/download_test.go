@@ -0,0 +1,138 @@
+package api
+
+import (
+	"backend/auth"
+	"backend/db"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useFakeRenderer stores a PDF document of three pages and renders thumbnails with
+// a script that logs its arguments.
+//
+// Returns the database, its admin, the document's hash and the path of the log.
+func useFakeRenderer(t *testing.T) (*sql.DB, auth.AuthorizationResult, string, string) {
+	t.Helper()
+
+	db_handle, auth_result := openTestDatabase(t)
+
+	directory := t.TempDir()
+	var log string = filepath.Join(directory, "calls")
+	var script string = filepath.Join(directory, "pdftoppm")
+
+	// The last argument is the output prefix
+	err := os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" >> '"+log+"'\nfor prefix; do :; done\nprintf png > \"$prefix.png\"\n"), 0o700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous_path, previous_command := blobPath, thumbnailCommand
+	t.Cleanup(func() { blobPath, thumbnailCommand = previous_path, previous_command })
+	ConfigureBlobs(filepath.Join(directory, "blobs"), script)
+
+	var content []byte = []byte("%PDF-1.7 three pages")
+	digest := sha256.Sum256(content)
+	var hash string = hex.EncodeToString(digest[:])
+
+	if err := os.MkdirAll(filepath.Dir(blob_file(hash)), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(blob_file(hash), content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.AddDocument(db_handle, auth_result.ID, db.DocumentRecord{
+		OriginalName: "ruling.pdf",
+		StorageName:  "ruling.pdf",
+		Title:        "Ruling",
+		Size:         int64(len(content)),
+		MimeType:     "application/pdf",
+		PageCount:    3,
+		SHA256:       hash,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db_handle, auth_result, hash, log
+}
+
+func thumbnail(ctx context.Context, db_handle *sql.DB, auth_result auth.AuthorizationResult, hash string, query string) *httptest.ResponseRecorder {
+	request := httptest.NewRequestWithContext(ctx, http.MethodGet, "/api/get/thumbnail/"+hash+"?"+query, nil)
+	request.SetPathValue("sha256", hash)
+
+	recorder := httptest.NewRecorder()
+	DocumentThumbnail(auth_result, db_handle, recorder, request)
+	return recorder
+}
+
+func TestDocumentThumbnailPages(t *testing.T) {
+	db_handle, auth_result, hash, log := useFakeRenderer(t)
+
+	for _, query := range []string{"page=0", "page=-4", ""} {
+		recorder := thumbnail(context.Background(), db_handle, auth_result, hash, query)
+
+		if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "image/png" {
+			t.Errorf("%q: status %d, %s", query, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	if recorder := thumbnail(context.Background(), db_handle, auth_result, hash, "page=4"); recorder.Code != http.StatusBadRequest {
+		t.Errorf("page beyond the document: status %d, want 400", recorder.Code)
+	}
+
+	if recorder := thumbnail(context.Background(), db_handle, auth_result, hash, "page=first"); recorder.Code != http.StatusBadRequest {
+		t.Errorf("malformed page: status %d, want 400", recorder.Code)
+	}
+
+	calls, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// All requests were for page 1, rendered once and then served from the cache
+	lines := strings.Split(strings.TrimSpace(string(calls)), "\n")
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "-png -f 1 -l 1 ") {
+		t.Errorf("renderer called with %q", lines)
+	}
+}
+
+func TestDocumentThumbnailWaitsForSlot(t *testing.T) {
+	db_handle, auth_result, hash, log := useFakeRenderer(t)
+
+	// Every slot is taken by another rendering
+	for range cap(thumbnailSlots) {
+		thumbnailSlots <- struct{}{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	recorder := thumbnail(ctx, db_handle, auth_result, hash, "page=2")
+
+	for range cap(thumbnailSlots) {
+		<-thumbnailSlots
+	}
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("status %d, want 503", recorder.Code)
+	}
+
+	if _, err := os.Stat(log); err == nil {
+		t.Error("renderer ran without a free slot")
+	}
+
+	if recorder := thumbnail(context.Background(), db_handle, auth_result, hash, "page=2"); recorder.Code != http.StatusOK {
+		t.Errorf("after the slots were freed: status %d, %s", recorder.Code, recorder.Body.String())
+	}
+}
@@ -18,19 +18,34 @@ import (
 //
 // Behavior:
 //   - Requires successful authorization via auth_result
+//   - The optional "Conversation" header selects the conversation
 //   - Proxies the request to GetMessageHistory service
 //   - Returns the exact status code and body from the history service
 //
 // Error Responses:
+//   - 400 Bad Request: Malformed Conversation header
+//   - 404 Not Found: Conversation does not exist or belongs to another user
 //   - 500 Internal Server Error: If history retrieval fails
 //   - Propagates any error from GetMessageHistory service
-func GetHistory(auth_result auth.AuthorizationResult, w http.ResponseWriter, r *http.Request) {
+func GetHistory(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
 	if r.Method != "GET" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	response, err := GetMessageHistory(auth_result.ID)
+	conversation_id, status, err := requested_conversation(auth_result, db_handle, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	response, err := GetMessageHistory(r.Context(), auth_result.ID, conversation_id)
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -96,6 +111,7 @@ func GetSignupRequests(db_handle *sql.DB, w http.ResponseWriter, r *http.Request
 //	  {
 //		"Email": string
 //		"IsAdmin": bool
+//		"Role": string
 //	  }
 //	]
 func GetUser(db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
@@ -115,64 +131,26 @@ func GetUser(db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(user_info)
 }
 
-// GetDocuments retrieves all documents for the authenticated user.
-//
-// This endpoint:
-//   - Requires authentication (via auth_result)
-//   - Returns a JSON array of document objects
-//   - Returns 500 Internal Server Error for database failures
-//   - Returns 200 OK with document data on success
-//
-// Response Format:
-//
-//	The response body contains a JSON array of document objects.
-//	Refer to the Document struct in the db package for the exact field structure.
-//
-// Example Response:
-//
-//		[
-//		  {
-//			"OriginalName": string
-//	     	"StorageName": string
-//		  }
-//		]
-func GetDocuments(
-	auth_result auth.AuthorizationResult,
-	db_handle *sql.DB,
-	w http.ResponseWriter,
-	r *http.Request,
-) {
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusBadRequest)
-		return
-	}
-
-	documents, err := db.GetDocuments(db_handle, auth_result.ID)
-
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(documents)
-}
-
-// GetModels handles HTTP requests to retrieve available AI models from the ML service.
+// GetModels handles HTTP requests to retrieve the models of all providers.
 //
 // This is a GET-only endpoint that:
-// - Proxies the request to the ML service
-// - Returns the model list as a JSON response
-// - Maintains the original status code from the ML service
+// - Merges the model lists of the built-in Ollama provider and the registered providers
+// - Tags every model with its provider and whether the provider is local
+// - Still answers if some providers are unreachable, listing them under "errors"
 //
 // Parameters:
 //   - w: HTTP response writer
 //   - r: HTTP request object
 //
 // Responses:
-//   - 200 OK: JSON array of available models
+//   - 200 OK: JSON ModelCatalogue
 //   - 400 Bad Request: If called with non-GET method
-//   - 5xx: Propagates any error from the ML service
+//   - 502 Bad Gateway: No models are available because providers could not be reached
+//
+// Example Response:
+//
+//	{"models": [{"name": "gemma3:12b", "model": "gemma3:12b", "provider": "ollama", "local": true},
+//	            {"name": "vllm/mistral-7b", "model": "mistral-7b", "provider": "vllm", "local": false}]}
 func GetModels(
 	w http.ResponseWriter,
 	r *http.Request,
@@ -182,48 +160,46 @@ func GetModels(
 		return
 	}
 
-	response, err := MLGetModels()
-
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	models, err := providers.Catalogue(r.Context())
 
-	body, err := io.ReadAll(response.Body)
-	defer response.Body.Close()
+	var catalogue ModelCatalogue = ModelCatalogue{Models: models}
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	println(string(body[:])) // Prints out correctly a JSON-Object
-
-	if response.StatusCode != 200 {
-		http.Error(w, string(body[:]), response.StatusCode)
-		return
+		if len(models) == 0 {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		for _, problem := range err.(interface{ Unwrap() []error }).Unwrap() {
+			catalogue.Errors = append(catalogue.Errors, problem.Error())
+		}
 	}
 
-	println("Why does it not send the JSON body")
-
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	w.Write(body)
+	json.NewEncoder(w).Encode(catalogue)
 }
 
-// GetCurrentModel handles HTTP requests to retrieve the currently selected AI model.
+// GetCurrentModel handles HTTP requests to retrieve the globally selected AI model.
 //
 // This endpoint:
 // - Returns the model name as plain text
-// - Does not require any parameters
+// - Reports the global selection, users may be answered by a role or user override
 //
 // Parameters:
+//   - db_handle: Database connection handle
 //   - w: HTTP response writer
 //
 // Responses:
 //   - 200 OK: Plain text response with the current model name
-func GetCurrentModel(w http.ResponseWriter) {
-	var current_llm string = db.GetModel()
+//   - 500 Internal Server Error: Database operation failure
+func GetCurrentModel(db_handle *sql.DB, w http.ResponseWriter) {
+	current_llm, err := db.GetGlobalModel(db_handle)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(current_llm))
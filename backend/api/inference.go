@@ -3,56 +3,183 @@ package api
 import (
 	"backend/auth"
 	"backend/db"
+	"backend/metrics"
+	"backend/provider"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 )
 
-func Inference(
+// inferenceRequest is a validated inference request.
+//
+// Models of the default provider are answered by the ML pipeline using data, the
+// serialized MLMessage. For models of other providers, backend is set and chat is
+// sent to it directly.
+type inferenceRequest struct {
+	conversation_id int64
+	deep_think      string
+	data            []byte
+	backend         provider.Provider
+	chat            provider.ChatRequest
+}
+
+// prepare_inference validates an inference request and builds the request for the pipeline or the provider.
+//
+// Returns:
+//   - inferenceRequest: Conversation, Deep_think header and the MLMessage or chat request
+//   - int: HTTP status to answer with if the error is not nil
+//   - error: Missing Deep_think header, deep think without the use_deep_think permission,
+//     bad conversation, invalid JSON, database failure or the request was refused by
+//     local-only mode (see route_inference)
+func prepare_inference(
 	auth_result auth.AuthorizationResult,
 	db_handle *sql.DB,
-	w http.ResponseWriter,
 	r *http.Request,
-) {
+) (inferenceRequest, int, error) {
+	var deep_think_header string = r.Header.Get("Deep_think")
+
+	if deep_think_header == "" {
+		return inferenceRequest{}, http.StatusBadRequest, errors.New("Deep think header is missing")
+	}
+
+	if deep_think_header == "True" && !auth_result.HasPermission(db.PERMISSION_USE_DEEP_THINK) {
+		return inferenceRequest{}, http.StatusForbidden, errors.New("deep think requires the use_deep_think permission")
+	}
+
+	conversation_id, status, err := requested_conversation(auth_result, db_handle, r)
+
+	if err != nil {
+		return inferenceRequest{}, status, err
+	}
+
 	data, err := io.ReadAll(r.Body)
 	defer r.Body.Close()
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		return inferenceRequest{}, http.StatusBadRequest, err
 	}
 
 	var message Message
 	err = json.Unmarshal(data, &message)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		return inferenceRequest{}, http.StatusBadRequest, err
 	}
 
 	preprompt, err := db.GetPrompt(db_handle, auth_result.ID)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return inferenceRequest{}, http.StatusInternalServerError, err
+	}
+
+	model, err := db.GetModel(db_handle, auth_result.ID)
+
+	if err != nil {
+		return inferenceRequest{}, http.StatusInternalServerError, err
+	}
+
+	settings, err := db.GetUserSettings(db_handle, auth_result.ID)
+
+	if err != nil {
+		return inferenceRequest{}, http.StatusInternalServerError, err
+	}
+
+	backend, provider_model := providers.Lookup(model)
+
+	status, err = route_inference(auth_result, db_handle, model, backend, settings, r)
+
+	if err != nil {
+		return inferenceRequest{}, status, err
+	}
+
+	if backend.Name() != DEFAULT_PROVIDER {
+		chat, err := direct_chat(r.Context(), auth_result.ID, conversation_id, provider_model, preprompt, message)
+
+		if err != nil {
+			return inferenceRequest{}, http.StatusBadGateway, err
+		}
+
+		return inferenceRequest{conversation_id: conversation_id, deep_think: deep_think_header, backend: backend, chat: chat}, http.StatusOK, nil
+	}
+
+	shared, err := db.GetRetrievalSources(db_handle, auth_result.ID, settings.LegalLibrary)
+
+	if err != nil {
+		return inferenceRequest{}, http.StatusInternalServerError, err
 	}
 
 	var ml_message MLMessage = MLMessage{
-		Kind:      message.Kind,
-		Message:   message.Message,
-		Model:     db.GetModel(),
-		Preprompt: preprompt,
+		Kind:            message.Kind,
+		Message:         message.Message,
+		Model:           model,
+		Preprompt:       preprompt,
+		SharedDocuments: shared,
 	}
 
 	data, err = json.Marshal(&ml_message)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		return inferenceRequest{}, http.StatusBadRequest, err
+	}
+
+	return inferenceRequest{conversation_id: conversation_id, deep_think: deep_think_header, data: data}, http.StatusOK, nil
+}
+
+// Inference sends a chat message to the ML pipeline and returns the complete LLMResponse.
+//
+// Requires the "Deep_think" header (True/False), "True" only for roles with the
+// use_deep_think permission (403 Forbidden otherwise); the optional "Conversation"
+// header selects the conversation. The response is only written once the model
+// has finished, see InferenceStream for incremental delivery. Models of registered
+// providers are asked directly (see direct_chat), the answer has the same format.
+// Valid requests count against the deep think budget and the quota of the user
+// (see consume_inference), exceeding either is answered with 429 Too Many Requests.
+//
+// Neither path stores the question or the answer: the client uploads both to
+// /api/upload/message (MessageUpload) once the answer is complete, so the history
+// is kept the same way for pipeline and provider answers.
+func Inference(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	usage_settings UsageSettings,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	request, status, err := prepare_inference(auth_result, db_handle, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if !consume_inference(auth_result, db_handle, usage_settings, request.deep_think == "True", w) {
+		return
+	}
+
+	metrics.InferenceInFlight.Inc()
+	defer metrics.InferenceInFlight.Dec()
+
+	if request.backend != nil {
+		answer, err := request.backend.Chat(r.Context(), request.chat)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		if request.conversation_id != 0 {
+			db.TouchConversation(db_handle, request.conversation_id)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(llm_response(answer))
 		return
 	}
 
-	response, err := InferenceMessage(auth_result.ID, r.Header.Get("Deep_think"), data)
+	response, err := InferenceMessage(r.Context(), auth_result.ID, request.conversation_id, request.deep_think, request.data)
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -67,6 +194,21 @@ func Inference(
 		return
 	}
 
+	if request.conversation_id != 0 && response.StatusCode == http.StatusOK {
+		db.TouchConversation(db_handle, request.conversation_id)
+	}
+
 	w.WriteHeader(response.StatusCode)
 	w.Write(body)
 }
+
+// llm_response converts the answer of a provider into the pipeline's response format.
+func llm_response(answer provider.ChatResponse) LLMResponse {
+	return LLMResponse{
+		Response:        answer.Content,
+		Done:            true,
+		Model:           answer.Model,
+		PromptEvalCount: answer.PromptTokens,
+		EvalCount:       answer.CompletionTokens,
+	}
+}
@@ -0,0 +1,316 @@
+package api
+
+import (
+	"backend/auth"
+	"backend/db"
+	"backend/document"
+	"backend/logging"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// How often idle workers look for due jobs, retries become due without a wake-up.
+const ingestPollInterval time.Duration = time.Second
+
+// IngestSettings configures the ingestion worker pool.
+//
+//   - Workers:  Number of documents processed concurrently
+//   - Attempts: Maximum processing attempts of a job before it fails
+//   - Backoff:  Delay before the first retry, doubled for every further retry
+type IngestSettings struct {
+	Workers  int
+	Attempts int64
+	Backoff  time.Duration
+}
+
+// IngestionStatus is the state of an upload as reported to its uploader.
+//
+//   - State:       "queued", "processing", "ready" or "failed"
+//   - Error:       Why the last attempt failed, empty if none did
+//   - StorageName: Identifier of the document once ready, as listed by /api/get/documents
+type IngestionStatus struct {
+	ID          int64
+	State       string
+	Filename    string
+	Title       string
+	Attempts    int64
+	Error       string
+	StorageName string
+	CreatedAt   int64
+	UpdatedAt   int64
+}
+
+// Wakes an idle worker when a job is queued.
+var ingestWake chan struct{} = make(chan struct{}, 1)
+
+// StartIngestion starts the workers processing queued uploads.
+//
+// Jobs left processing by a previous run are queued again first.
+//
+// Returns:
+//   - error: Database failure while requeueing
+func StartIngestion(db_handle *sql.DB, settings IngestSettings) error {
+	requeued, err := db.RequeueInterruptedJobs(db_handle)
+	if err != nil {
+		return err
+	}
+
+	if requeued > 0 {
+		slog.Info("Requeued interrupted ingestion jobs", "count", requeued)
+	}
+
+	for range settings.Workers {
+		go ingest_worker(db_handle, settings)
+	}
+
+	return nil
+}
+
+// GetDocumentStatus reports the processing state of an upload.
+//
+// Path parameter:
+//   - id: Job ID returned by the upload
+//
+// Responses:
+//   - 200 OK: JSON IngestionStatus
+//   - 400 Bad Request: Malformed ID
+//   - 404 Not Found: Unknown job, job of another user or expired job
+//   - 500 Internal Server Error: Database failure
+//
+// Example Response:
+//
+//	{
+//	  "ID": 12,
+//	  "State": "failed",
+//	  "Filename": "ruling.pdf",
+//	  "Title": "Ruling",
+//	  "Attempts": 3,
+//	  "Error": "upload failed: request failed: ...",
+//	  "StorageName": "",
+//	  "CreatedAt": 1760000000,
+//	  "UpdatedAt": 1760000090
+//	}
+func GetDocumentStatus(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	job, err := db.GetJob(db_handle, id, auth_result.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ingestion_status(job))
+}
+
+func ingestion_status(job db.IngestionJob) IngestionStatus {
+	return IngestionStatus{
+		ID:          job.ID,
+		State:       job.State,
+		Filename:    job.Filename,
+		Title:       job.Title,
+		Attempts:    job.Attempts,
+		Error:       job.Error,
+		StorageName: job.StorageName,
+		CreatedAt:   job.CreatedAt,
+		UpdatedAt:   job.UpdatedAt,
+	}
+}
+
+// accept_job answers an upload with 202, the job status and its URL in the Location header.
+func accept_job(w http.ResponseWriter, job db.IngestionJob) {
+	w.Header().Set("Location", fmt.Sprintf("/api/documents/%d/status", job.ID))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(ingestion_status(job))
+}
+
+// enqueue_document queues a spooled document for the workers.
+//
+// Content the collection already holds is rejected up front; the worker checks
+// again, since an identical upload may be queued at the same time. Finished jobs
+// older than the upload expiry are removed on the way.
+//
+// Parameters:
+//   - job: UserID, CollectionID, Filename, Title, Path, SHA256 and Size of the upload
+//
+// Returns:
+//   - db.IngestionJob: The queued job
+//   - int: HTTP status to answer with if the error is not nil
+//   - error: Duplicate or database failure
+func enqueue_document(db_handle *sql.DB, settings UploadSettings, job db.IngestionJob) (db.IngestionJob, int, error) {
+	duplicate, err := find_duplicate(db_handle, job.CollectionID, job.SHA256)
+	if err == nil {
+		return db.IngestionJob{}, http.StatusConflict, fmt.Errorf("already uploaded as %q", duplicate)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return db.IngestionJob{}, http.StatusInternalServerError, fmt.Errorf("database error: %w", err)
+	}
+
+	if err := db.DeleteFinishedJobs(db_handle, time.Now().Add(-settings.Expiry).UTC().Unix()); err != nil {
+		slog.Error("Failed to expire ingestion jobs", "error", err)
+	}
+
+	job, err = db.CreateJob(db_handle, job)
+	if err != nil {
+		return db.IngestionJob{}, http.StatusInternalServerError, err
+	}
+
+	select {
+	case ingestWake <- struct{}{}:
+	default: // A wake-up is pending already
+	}
+
+	return job, http.StatusAccepted, nil
+}
+
+func ingest_worker(db_handle *sql.DB, settings IngestSettings) {
+	for {
+		job, err := db.ClaimJob(db_handle)
+
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				slog.Error("Failed to claim ingestion job", "error", err)
+			}
+
+			select {
+			case <-ingestWake:
+			case <-time.After(ingestPollInterval):
+			}
+			continue
+		}
+
+		process_job(db_handle, settings, job)
+	}
+}
+
+// process_job runs one attempt of a job and records its outcome.
+//
+// Errors a retry cannot fix (status below 500: invalid document, duplicate) fail
+// the job at once, others are retried with exponential backoff until the
+// configured attempts are used up. The spooled file is removed once the job is
+// ready or failed.
+//
+// Each attempt runs under the request ID "ingest-<job ID>", which is logged and
+// sent to the ML pipeline like the ID of a client request.
+func process_job(db_handle *sql.DB, settings IngestSettings, job db.IngestionJob) {
+	ctx := logging.WithRequestID(context.Background(), "ingest-"+strconv.FormatInt(job.ID, 10))
+	logger := logging.FromContext(ctx).With("job", job.ID)
+
+	storage_name, status, err := ingest_document(ctx, db_handle, job)
+
+	switch {
+	case err == nil:
+		err = db.FinishJob(db_handle, job.ID, storage_name)
+
+	case status < http.StatusInternalServerError || job.Attempts >= settings.Attempts:
+		logger.Warn("Ingestion job failed", "attempts", job.Attempts, "error", err)
+		err = db.FailJob(db_handle, job.ID, err.Error())
+
+	default:
+		var delay time.Duration = settings.Backoff << (job.Attempts - 1)
+		logger.Warn("Ingestion job failed, retrying", "attempts", job.Attempts, "delay", delay, "error", err)
+
+		if err := db.RetryJob(db_handle, job.ID, err.Error(), time.Now().Add(delay).UTC().Unix()); err != nil {
+			logger.Error("Failed to requeue ingestion job", "error", err)
+		}
+		return
+	}
+
+	if err != nil {
+		logger.Error("Failed to record outcome of ingestion job", "error", err)
+	}
+
+	if err := os.Remove(job.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Error("Failed to remove spooled file of ingestion job", "error", err)
+	}
+}
+
+// ingest_document hands the spooled file of a job to the ML pipeline and records the document.
+//
+// Returns:
+//   - string: Identifier of the document in the ML pipeline
+//   - int: HTTP status classifying the error (see store_document)
+//   - error: Duplicate, invalid document, pipeline or database failure
+func ingest_document(ctx context.Context, db_handle *sql.DB, job db.IngestionJob) (string, int, error) {
+	file, err := os.Open(job.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", http.StatusGone, errors.New("spooled file is missing, upload the document again")
+	} else if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	defer file.Close()
+
+	storage_name, status, err := store_document(ctx, db_handle, job.CollectionID, job.Filename, job.Title, file, job.Size, job.SHA256)
+	if err != nil {
+		return "", status, err
+	}
+
+	format, err := document.Lookup(job.Filename)
+	if err != nil {
+		return "", http.StatusUnsupportedMediaType, err
+	}
+
+	if job.CollectionID == LEGAL_LIBRARY_COLLECTION {
+		err = db.AddLibraryDocument(db_handle, job.Filename, storage_name, job.Title, job.UserID, job.SHA256, job.Size)
+	} else {
+		err = db.AddDocument(db_handle, job.CollectionID, db.DocumentRecord{
+			OriginalName: job.Filename,
+			StorageName:  storage_name,
+			Title:        job.Title,
+			Size:         job.Size,
+			MimeType:     format.MediaType,
+			PageCount:    count_pages(ctx, format, file, job),
+			UploadedAt:   job.CreatedAt,
+			SHA256:       job.SHA256,
+			Tags:         job.Tags,
+		})
+	}
+
+	if err != nil {
+		return "", http.StatusInternalServerError, fmt.Errorf("database error: %w", err)
+	}
+
+	// The document is usable without its original, it just cannot be downloaded
+	if err := store_blob(job.Path, job.SHA256); err != nil {
+		logging.FromContext(ctx).Warn("Failed to store original of ingestion job", "job", job.ID, "error", err)
+	}
+
+	return storage_name, http.StatusOK, nil
+}
+
+// count_pages returns the page count of a spooled document, 0 if the format has
+// no pages or counting failed. Failures are only logged, the count is informational.
+func count_pages(ctx context.Context, format document.Format, file *os.File, job db.IngestionJob) int64 {
+	if format.Pages == nil {
+		return 0
+	}
+
+	pages, err := format.Pages(file, job.Size)
+	if err != nil {
+		logging.FromContext(ctx).Warn("Failed to count pages of ingestion job", "job", job.ID, "error", err)
+		return 0
+	}
+
+	return pages
+}
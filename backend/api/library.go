@@ -0,0 +1,171 @@
+package api
+
+import (
+	"backend/auth"
+	"backend/db"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ID under which documents of the shared legal library are filed in the ML pipeline.
+// User IDs start at 1, so the collection cannot collide with a user's own documents.
+const LEGAL_LIBRARY_COLLECTION int64 = 0
+
+// GetLegalLibary returns whether the authenticated user opted into the shared legal library.
+//
+// Example Response:
+//
+//	{"Legal_library": bool}
+func GetLegalLibary(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	settings, err := db.GetUserSettings(db_handle, auth_result.ID)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(LegalLibary{Legal_library: settings.LegalLibrary})
+}
+
+// LibraryUpload adds a document to the shared legal library (permission manage_library).
+//
+// Same requirements and responses as FileUpload; the document is filed under
+// LEGAL_LIBRARY_COLLECTION instead of the uploader's ID and becomes available
+// to every user who enabled the legal library once its job is ready. The job
+// belongs to the uploader. The upload is recorded in the audit
+// log (action "library.upload").
+func LibraryUpload(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	settings UploadSettings,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	job, ok := receive_document(db_handle, LEGAL_LIBRARY_COLLECTION, auth_result.ID, settings, w, r)
+	if !ok {
+		return
+	}
+
+	if err := audit(auth_result, db_handle, r, "library.upload", fmt.Sprintf("job:%d", job.ID), map[string]string{"Filename": job.Filename, "SHA256": job.SHA256}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	accept_job(w, job)
+}
+
+// GetLibraryDocuments lists the documents of the shared legal library.
+//
+// Example Response:
+//
+//	[
+//	  {
+//		"ID": int,
+//		"OriginalName": string,
+//		"StorageName": string,
+//		"Title": string,
+//		"UploadedBy": int,
+//		"CreatedAt": int
+//	  }
+//	]
+func GetLibraryDocuments(db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
+	documents, err := db.GetLibraryDocuments(db_handle)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(documents)
+}
+
+// DeleteLibraryDocument removes a document from the shared legal library (permission manage_library).
+//
+// Expects the storage name as plain text in the request body. The document is
+// deleted in the ML pipeline first, the record only once that succeeded. The
+// deletion is recorded in the audit log (action "library.delete").
+//
+// Responses:
+//   - 200 OK: Document deleted
+//   - 400 Bad Request: Body cannot be read
+//   - 404 Not Found: No library document has the storage name
+//   - 500 Internal Server Error: ML pipeline or database failure
+func DeleteLibraryDocument(auth_result auth.AuthorizationResult, db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var storage_name string = strings.TrimSpace(string(data[:]))
+
+	documents, err := db.GetLibraryDocuments(db_handle)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !contains_library_document(documents, storage_name) {
+		http.Error(w, "library document not found", http.StatusNotFound)
+		return
+	}
+
+	response, err := MLDeleteDocument(r.Context(), LEGAL_LIBRARY_COLLECTION, storage_name)
+
+	if err != nil {
+		http.Error(w, "Sending to ML-Pipeline failed", http.StatusInternalServerError)
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(response.Body)
+		http.Error(w, fmt.Sprintf("ML pipeline error: %s", string(body)), response.StatusCode)
+		return
+	}
+
+	err = db.DeleteLibraryDocument(db_handle, storage_name)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "library document not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	collect_blobs(db_handle)
+
+	if err := audit(auth_result, db_handle, r, "library.delete", "library:"+storage_name, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte{})
+}
+
+func contains_library_document(documents []db.LibraryDocument, storage_name string) bool {
+	for _, document := range documents {
+		if document.StorageName == storage_name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"backend/db"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestInferenceRetrievesFromLegalLibrary(t *testing.T) {
+	db_handle, auth_result := openTestDatabase(t)
+
+	if err := db.AddLibraryDocument(db_handle, "statute.pdf", "statute.pdf", "Statute", auth_result.ID, "statute", 10); err != nil {
+		t.Fatal(err)
+	}
+
+	var received [][]db.SharedSource
+
+	useFakePipeline(t, func(w http.ResponseWriter, r *http.Request) {
+		var message MLMessage
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		received = append(received, message.SharedDocuments)
+		fmt.Fprint(w, `{"response": "ok"}`)
+	})
+
+	inference := func() {
+		request := httptest.NewRequest(http.MethodPost, "/api/message/inference", strings.NewReader(`{"Kind": 1, "Message": "Hallo?"}`))
+		request.Header.Set("Deep_think", "False")
+
+		recorder := httptest.NewRecorder()
+		Inference(auth_result, db_handle, UsageSettings{}, recorder, request)
+
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("status %d, %s", recorder.Code, recorder.Body.String())
+		}
+	}
+
+	inference()
+
+	if err := db.SetLegalLibrary(db_handle, auth_result.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	inference()
+
+	if len(received) != 2 {
+		t.Fatalf("pipeline called %d times, want 2", len(received))
+	}
+
+	if len(received[0]) != 0 {
+		t.Errorf("library searched without opt-in: %+v", received[0])
+	}
+
+	var library db.SharedSource = db.SharedSource{OwnerID: LEGAL_LIBRARY_COLLECTION, StorageName: "statute.pdf"}
+
+	if !slices.Equal(received[1], []db.SharedSource{library}) {
+		t.Errorf("with opt-in: %+v, want %+v", received[1], []db.SharedSource{library})
+	}
+}
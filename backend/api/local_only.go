@@ -0,0 +1,191 @@
+package api
+
+import (
+	"backend/auth"
+	"backend/db"
+	"backend/provider"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// LocalOnlyState is the local-only mode as seen by a user.
+//
+//   - Local_only: Whether the user's inference is restricted to local model backends
+//   - Enforced:   Whether an administrator enforces the mode for everyone,
+//     in which case Local_only is always true
+type LocalOnlyState struct {
+	Local_only bool
+	Enforced   bool
+}
+
+// LocalOnlyEnforcement is the payload of UpdateLocalOnlyEnforced.
+type LocalOnlyEnforcement struct {
+	Enforced bool
+}
+
+// RoutingDecision is recorded in the audit log for every inference request local-only
+// mode applies to (action "inference.route").
+//
+//   - Model:     Model the request was to be answered with
+//   - Local:     Whether the model's provider is local and confirmed to serve the model
+//   - LocalOnly: Local-only setting of the user
+//   - Enforced:  Global local-only override
+//   - Allowed:   Whether the request was forwarded
+//   - Reason:    Why the model could not be verified, empty otherwise
+type RoutingDecision struct {
+	Model     string
+	Local     bool
+	LocalOnly bool
+	Enforced  bool
+	Allowed   bool
+	Reason    string `json:",omitempty"`
+}
+
+// route_inference decides whether an inference request may be forwarded and records the decision.
+//
+// Local-only mode is opt-in: unless the user enabled it or an administrator
+// enforces it, every request is forwarded without a check or audit entry.
+//
+// If local-only mode applies, the model must be served by a provider marked as
+// local (see ConfigureProviders and provider.Endpoint). The check fails closed:
+// the provider's model list must contain the model, so a name that only falls
+// back to the built-in provider, or a provider that cannot be reached, is refused
+// instead of being assumed local.
+//
+// Returns:
+//   - int: HTTP status to answer with if the error is not nil
+//   - error: Request refused, or the decision could not be recorded
+func route_inference(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	model string,
+	backend provider.Provider,
+	settings db.UserSettings,
+	r *http.Request,
+) (int, error) {
+	enforced, err := db.GetLocalOnlyEnforced(db_handle)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if !settings.LocalOnly && !enforced {
+		return http.StatusOK, nil
+	}
+
+	var decision RoutingDecision = RoutingDecision{
+		Model:     model,
+		LocalOnly: settings.LocalOnly,
+		Enforced:  enforced,
+	}
+
+	decision.Local = backend.Local()
+
+	if decision.Local {
+		if _, _, err := providers.Resolve(r.Context(), model); err != nil {
+			decision.Local, decision.Reason = false, err.Error()
+		}
+	}
+
+	decision.Allowed = decision.Local
+
+	var event db.AuditEvent = db.AuditEvent{
+		UserID:   auth_result.ID,
+		Action:   "inference.route",
+		Target:   "model:" + model,
+		SourceIP: auth.ClientAddress(r),
+		Detail:   decision,
+	}
+
+	if !decision.Allowed {
+		event.Outcome = db.AUDIT_DENIED
+	}
+
+	if err := db.AddAuditEntry(db_handle, event); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if !decision.Allowed {
+		if decision.Reason != "" {
+			return http.StatusForbidden, fmt.Errorf("local-only mode is active and model %q could not be verified as local: %s", model, decision.Reason)
+		}
+		return http.StatusForbidden, fmt.Errorf("local-only mode is active and model %q is not served locally", model)
+	}
+
+	return http.StatusOK, nil
+}
+
+// GetLocalOnly returns the local-only mode of the authenticated user.
+//
+// Example Response:
+//
+//	{"Local_only": bool, "Enforced": bool}
+func GetLocalOnly(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	settings, err := db.GetUserSettings(db_handle, auth_result.ID)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	enforced, err := db.GetLocalOnlyEnforced(db_handle)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(LocalOnlyState{Local_only: settings.LocalOnly || enforced, Enforced: enforced})
+}
+
+// UpdateLocalOnlyEnforced enables or lifts the global local-only override (permission change_models).
+//
+// Expects a JSON payload with LocalOnlyEnforcement structure. The change is recorded
+// in the audit log (action "local_only.enforce").
+//
+// Responses:
+//   - 200 OK: Override updated
+//   - 400 Bad Request: Invalid JSON
+//   - 500 Internal Server Error: Database operation failed
+func UpdateLocalOnlyEnforced(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	data, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var enforcement LocalOnlyEnforcement
+	if err := json.Unmarshal(data, &enforcement); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := db.SetLocalOnlyEnforced(db_handle, enforcement.Enforced); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := audit(auth_result, db_handle, r, "local_only.enforce", "", enforcement); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte{})
+}
@@ -0,0 +1,245 @@
+package api
+
+import (
+	"backend/auth"
+	"backend/db"
+	"backend/provider"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func inference(db_handle *sql.DB, auth_result auth.AuthorizationResult) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/api/message/inference", strings.NewReader(`{"Kind": 1, "Message": "Hallo?"}`))
+	request.Header.Set("Deep_think", "False")
+
+	recorder := httptest.NewRecorder()
+	Inference(auth_result, db_handle, UsageSettings{}, recorder, request)
+	return recorder
+}
+
+// lastDecision returns the most recent routing decision of the audit log.
+func lastDecision(t *testing.T, db_handle *sql.DB) (string, RoutingDecision) {
+	t.Helper()
+
+	var outcome, detail string
+	err := db_handle.QueryRow(`SELECT outcome, detail FROM audit_log WHERE action = 'inference.route' ORDER BY id DESC LIMIT 1`).Scan(&outcome, &detail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decision RoutingDecision
+	if err := json.Unmarshal([]byte(detail), &decision); err != nil {
+		t.Fatal(err)
+	}
+
+	return outcome, decision
+}
+
+func TestLocalOnlyVerifiesModel(t *testing.T) {
+	db_handle, auth_result := openTestDatabase(t)
+
+	useFakePipeline(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"response": "ok"}`)
+	})
+
+	if err := db.SetLocalOnly(db_handle, auth_result.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if recorder := inference(db_handle, auth_result); recorder.Code != http.StatusOK {
+		t.Fatalf("listed model: status %d, %s", recorder.Code, recorder.Body.String())
+	}
+
+	if outcome, decision := lastDecision(t, db_handle); outcome != db.AUDIT_SUCCESS || !decision.Local || decision.Reason != "" {
+		t.Errorf("listed model: %s %+v", outcome, decision)
+	}
+
+	// A name Ollama does not list only falls back to the built-in provider
+	if err := db.SetModel(db_handle, db.MODEL_SCOPE_USER, fmt.Sprint(auth_result.ID), "vllm/mistral"); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := inference(db_handle, auth_result)
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("unlisted model: status %d, want 403", recorder.Code)
+	}
+
+	if outcome, decision := lastDecision(t, db_handle); outcome != db.AUDIT_DENIED || decision.Local || !strings.Contains(decision.Reason, "unknown model") {
+		t.Errorf("unlisted model: %s %+v", outcome, decision)
+	}
+
+	// Without local-only mode the model is not verified before forwarding
+	if err := db.SetLocalOnly(db_handle, auth_result.ID, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if recorder := inference(db_handle, auth_result); recorder.Code != http.StatusOK {
+		t.Errorf("local-only disabled: status %d, %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestLocalOnlyIsOptIn(t *testing.T) {
+	db_handle, auth_result := openTestDatabase(t)
+
+	useFakePipeline(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"response": "ok"}`)
+	})
+
+	settings, err := db.GetUserSettings(db_handle, auth_result.ID)
+	if err != nil || settings.LocalOnly {
+		t.Fatalf("default settings %+v, %v", settings, err)
+	}
+
+	// Ollama cannot be reached, a check of the model list would refuse the request
+	providers = provider.NewRegistry(provider.NewOllama(provider.Endpoint{Name: DEFAULT_PROVIDER, BaseURL: "http://127.0.0.1:1", Local: true}, nil), 0)
+
+	if recorder := inference(db_handle, auth_result); recorder.Code != http.StatusOK {
+		t.Fatalf("status %d, %s", recorder.Code, recorder.Body.String())
+	}
+
+	var decisions int
+	if err := db_handle.QueryRow(`SELECT COUNT(*) FROM audit_log WHERE action = 'inference.route'`).Scan(&decisions); err != nil {
+		t.Fatal(err)
+	}
+
+	if decisions != 0 {
+		t.Errorf("%d routing decisions audited without local-only mode, want 0", decisions)
+	}
+}
+
+func TestLocalOnlyFailsClosed(t *testing.T) {
+	db_handle, auth_result := openTestDatabase(t)
+
+	var forwarded bool
+	useFakePipeline(t, func(w http.ResponseWriter, r *http.Request) {
+		forwarded = true
+		fmt.Fprint(w, `{"response": "ok"}`)
+	})
+
+	// Ollama cannot be reached, so the model list cannot be checked
+	providers = provider.NewRegistry(provider.NewOllama(provider.Endpoint{Name: DEFAULT_PROVIDER, BaseURL: "http://127.0.0.1:1", Local: true}, nil), 0)
+
+	if err := db.SetLocalOnlyEnforced(db_handle, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.SetLocalOnly(db_handle, auth_result.ID, false); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := inference(db_handle, auth_result)
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want 403", recorder.Code)
+	}
+
+	if forwarded {
+		t.Error("request was forwarded to the pipeline")
+	}
+
+	if outcome, decision := lastDecision(t, db_handle); outcome != db.AUDIT_DENIED || !decision.Enforced || decision.Reason == "" {
+		t.Errorf("%s %+v", outcome, decision)
+	}
+}
+
+func TestDirectChatLeavesStorageToClient(t *testing.T) {
+	db_handle, auth_result := openTestDatabase(t)
+
+	var pipeline_paths []string
+	useFakePipeline(t, func(w http.ResponseWriter, r *http.Request) {
+		pipeline_paths = append(pipeline_paths, r.URL.Path)
+
+		if r.URL.Path != messageHistory {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+
+		fmt.Fprint(w, `[{"Kind": 1, "Message": "Earlier?"}, {"Kind": 0, "Message": "Earlier."}]`)
+	})
+
+	var chat struct {
+		Model    string
+		Messages []provider.ChatMessage
+	}
+
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&chat); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"model": "llama", "message": {"role": "assistant", "content": "Hallo!"}, "done": true}`)
+	}))
+	t.Cleanup(remote.Close)
+
+	if err := providers.Register(provider.NewOllama(provider.Endpoint{Name: "remote", BaseURL: remote.URL}, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.SetModel(db_handle, db.MODEL_SCOPE_USER, fmt.Sprint(auth_result.ID), "remote/llama"); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := inference(db_handle, auth_result)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status %d, %s", recorder.Code, recorder.Body.String())
+	}
+
+	var answer LLMResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&answer); err != nil || answer.Response != "Hallo!" {
+		t.Errorf("answer %+v, %v", answer, err)
+	}
+
+	var roles []string
+	for _, message := range chat.Messages {
+		roles = append(roles, message.Role)
+	}
+
+	want := []string{provider.ROLE_SYSTEM, provider.ROLE_USER, provider.ROLE_ASSISTANT, provider.ROLE_USER}
+	if chat.Model != "llama" || !slices.Equal(roles, want) || chat.Messages[3].Content != "Hallo?" {
+		t.Errorf("provider received %+v", chat)
+	}
+
+	// The client uploads question and answer, as for pipeline answers
+	if !slices.Equal(pipeline_paths, []string{messageHistory}) {
+		t.Errorf("pipeline calls %v, want only the history", pipeline_paths)
+	}
+}
+
+func TestBuiltinProviderLocality(t *testing.T) {
+	db_handle, auth_result := openTestDatabase(t)
+
+	useFakePipeline(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"response": "ok"}`)
+	})
+
+	// ollama_url points to a hosted service
+	if err := ConfigureProviders(db_handle, 5*time.Second, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.SetLocalOnly(db_handle, auth_result.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if recorder := inference(db_handle, auth_result); recorder.Code != http.StatusForbidden {
+		t.Errorf("local-only user: status %d, want 403", recorder.Code)
+	}
+
+	recorder := httptest.NewRecorder()
+	GetProviders(db_handle, recorder, httptest.NewRequest(http.MethodGet, "/api/get/providers", nil))
+
+	var infos []ProviderInfo
+	if err := json.NewDecoder(recorder.Body).Decode(&infos); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(infos) != 1 || !infos[0].Builtin || infos[0].Local {
+		t.Errorf("providers %+v, want the built-in provider as not local", infos)
+	}
+}
@@ -1,79 +1,208 @@
 package api
 
 import (
+	"backend/logging"
+	"backend/metrics"
 	"bytes"
+	"context"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
-	"net/http/httputil"
 	"strconv"
+	"strings"
 	"time"
 )
 
-const documentUpload string = "http://ml_pipeline:3030/api/document/upload"
-const messageUpload string = "http://ml_pipeline:3030/api/message/upload"
-const messageInference string = "http://ml_pipeline:3030/api/message/inference"
-const messageHistory string = "http://ml_pipeline:3030/api/message/history"
-const messageDeletion string = "http://ml_pipeline:3030/api/delete/history"
-const userDeletion string = "http://ml_pipeline:3030/api/delete/user"
-const documentDeletion string = "http://ml_pipeline:3030/api/delete/document"
-const modelListing string = "http://ollama:11434/api/tags"
+// Endpoint paths, relative to pipelineURL.
+const documentUpload string = "/api/document/upload"
+const documentTextUpload string = "/api/document/upload_text"
+const documentLink string = "/api/document/link"
+const messageUpload string = "/api/message/upload"
+const messageInference string = "/api/message/inference"
+const messageHistory string = "/api/message/history"
+const messageDeletion string = "/api/delete/history"
+const userDeletion string = "/api/delete/user"
+const documentDeletion string = "/api/delete/document"
+
+// Base URLs of the upstream services, set by ConfigurePipeline.
+var (
+	pipelineURL string = "http://ml_pipeline:3030"
+	ollamaURL   string = "http://ollama:11434"
+)
+
+// Header carrying the conversation ID to the ML pipeline.
+// Requests without it address the user's legacy single chat.
+const conversationHeader string = "Conversation"
 
 var client *http.Client = &http.Client{
 	Timeout: 1200 * time.Second, // Always set a timeout
 }
 
+// Client for streamed responses. A total timeout would cut off long generations,
+// instead the request context bounds the call and is cancelled when the caller disconnects.
+var streamClient *http.Client = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: 1200 * time.Second,
+	},
+}
+
+// ConfigurePipeline sets the upstream base URLs and the timeout of pipeline calls.
+//
+// Must be called before the server starts handling requests, it is not synchronized.
+//
+// Parameters:
+//   - ml_pipeline_url: Base URL of the ML pipeline, e.g. "http://ml_pipeline:3030"
+//   - ollama_url: Base URL of Ollama, the built-in model provider (see ConfigureProviders)
+//   - timeout: Total timeout of buffered calls; time to first byte of streamed calls
+func ConfigurePipeline(ml_pipeline_url string, ollama_url string, timeout time.Duration) {
+	pipelineURL = strings.TrimRight(ml_pipeline_url, "/")
+	ollamaURL = strings.TrimRight(ollama_url, "/")
+	client.Timeout = timeout
+	streamClient.Transport.(*http.Transport).ResponseHeaderTimeout = timeout
+}
+
+// SendToMLPipeline performs a buffered call to the ML pipeline.
+//
+// Only method, path, status and duration are logged (at debug level, failed calls
+// at warn level) under the request ID of the request's context. Bodies and headers
+// are never logged, they carry documents, messages and prompts. Count and latency
+// are recorded per endpoint (see metrics.PipelineRequests).
 func SendToMLPipeline(request *http.Request) (*http.Response, error) {
-	// Debug: Log the outgoing request
-	if dump, err := httputil.DumpRequestOut(request, true); err == nil {
-		log.Printf("Sending request:\n%s", dump)
-	}
+	return send(client, request)
+}
+
+// send performs a call to the ML pipeline with the given client and logs it, see SendToMLPipeline.
+func send(http_client *http.Client, request *http.Request) (*http.Response, error) {
+	var logger *slog.Logger = logging.FromContext(request.Context())
+	var start time.Time = time.Now()
+
+	response, err := http_client.Do(request)
+	var duration time.Duration = time.Since(start)
+
+	metrics.PipelineDuration.Observe(duration.Seconds(), request.URL.Path)
 
-	response, err := client.Do(request)
 	if err != nil {
-		log.Printf("Request failed: %v", err)
+		metrics.PipelineRequests.Inc(request.URL.Path, "error")
+		logger.Warn("ML pipeline request failed", "method", request.Method, "path", request.URL.Path, "error", err)
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
 
-	// Debug: Log the response
-	if dump, err := httputil.DumpResponse(response, true); err == nil {
-		log.Printf("Received response:\n%s", dump)
-	}
+	metrics.PipelineRequests.Inc(request.URL.Path, strconv.Itoa(response.StatusCode))
+	logger.Debug("ML pipeline request",
+		"method", request.Method,
+		"path", request.URL.Path,
+		"status", response.StatusCode,
+		"duration_ms", duration.Milliseconds(),
+	)
 
 	return response, nil
 }
 
-func UploadDocument(id int64, title string, storage_name string, data []byte) (*http.Response, error) {
-	if len(data) == 0 {
+// newPipelineRequest creates a buffered request to an endpoint of the ML pipeline.
+//
+// The request carries the request ID of ctx (see logging.RequestID) in the X-Request-ID
+// header. Cancellation of ctx is ignored: buffered calls change state in the pipeline
+// and run to completion even if the client disconnects, bounded by the client timeout.
+func newPipelineRequest(ctx context.Context, method string, path string, body io.Reader) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(context.WithoutCancel(ctx), method, pipelineURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	setRequestID(request)
+	return request, nil
+}
+
+// setRequestID forwards the request ID of the request's context to the pipeline.
+func setRequestID(request *http.Request) {
+	if request_id := logging.RequestID(request.Context()); request_id != "" {
+		request.Header.Set(logging.REQUEST_ID_HEADER, request_id)
+	}
+}
+
+// UploadDocument streams a PDF document to the ML pipeline.
+//
+// The body is passed through without being buffered, so memory use does not grow
+// with the file size.
+//
+// Parameters:
+//   - body: Document content, read until EOF
+//   - length: Size of the document in bytes, -1 if unknown (sent chunked)
+func UploadDocument(ctx context.Context, id int64, title string, storage_name string, body io.Reader, length int64) (*http.Response, error) {
+	if length == 0 {
 		return nil, fmt.Errorf("empty data provided")
 	}
 
-	request, err := http.NewRequest("POST", documentUpload, bytes.NewReader(data))
+	request, err := newPipelineRequest(ctx, "POST", documentUpload, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set required headers
+	request.ContentLength = length
 	request.Header.Set("Title", title)
 	request.Header.Set("X-Filename", storage_name)
 	request.Header.Set("ID", strconv.FormatInt(id, 10))
 	request.Header.Set("Content-Type", "application/octet-stream") // Important for binary data
-	request.Header.Set("Content-Length", strconv.Itoa(len(data)))
 
 	return SendToMLPipeline(request)
 }
 
-func UploadMessage(id int64, data []byte) (*http.Response, error) {
+// UploadDocumentText sends the extracted text of a document that is not a PDF.
+//
+// Sets the same headers as UploadDocument; the pipeline chunks and embeds the
+// UTF-8 body directly instead of parsing a PDF.
+func UploadDocumentText(ctx context.Context, id int64, title string, storage_name string, text string) (*http.Response, error) {
+	if len(text) == 0 {
+		return nil, fmt.Errorf("empty text provided")
+	}
+
+	request, err := newPipelineRequest(ctx, "POST", documentTextUpload, strings.NewReader(text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	request.Header.Set("Title", title)
+	request.Header.Set("X-Filename", storage_name)
+	request.Header.Set("ID", strconv.FormatInt(id, 10))
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	request.Header.Set("Content-Length", strconv.Itoa(len(text)))
+
+	return SendToMLPipeline(request)
+}
+
+// LinkDocument files a copy of an already processed document under another ID and storage name.
+//
+// The pipeline copies the chunks and embeddings of source instead of processing
+// the content again. It answers 404 if source is unknown to it.
+func LinkDocument(ctx context.Context, id int64, title string, storage_name string, source string) (*http.Response, error) {
+	request, err := newPipelineRequest(ctx, "POST", documentLink, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	request.Header.Set("Title", title)
+	request.Header.Set("X-Filename", storage_name)
+	request.Header.Set("ID", strconv.FormatInt(id, 10))
+	request.Header.Set("Source", source)
+
+	return SendToMLPipeline(request)
+}
+
+func UploadMessage(ctx context.Context, id int64, conversation_id int64, data []byte) (*http.Response, error) {
 	if len(data) == 0 {
 		return nil, fmt.Errorf("empty data provided")
 	}
 
-	request, err := http.NewRequest("POST", messageUpload, bytes.NewReader(data))
+	request, err := newPipelineRequest(ctx, "POST", messageUpload, bytes.NewReader(data))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	request.Header.Set("ID", strconv.FormatInt(id, 10))
+	setConversation(request, conversation_id)
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("Content-Length", strconv.Itoa(len(data)))
 
@@ -83,18 +212,20 @@ func UploadMessage(id int64, data []byte) (*http.Response, error) {
 // Sends a message to be processed by the LLM
 // Ensures that the message has the appropriate headers set
 //   - Custom header: Deep_think: True or False
-func InferenceMessage(id int64, deep_think_header string, data []byte) (*http.Response, error) {
+//   - Custom header: Conversation: conversation ID (omitted for the legacy chat)
+func InferenceMessage(ctx context.Context, id int64, conversation_id int64, deep_think_header string, data []byte) (*http.Response, error) {
 	if len(data) == 0 {
 		return nil, fmt.Errorf("empty data provided")
 	}
 
-	request, err := http.NewRequest("GET", messageInference, bytes.NewReader(data))
+	request, err := newPipelineRequest(ctx, "GET", messageInference, bytes.NewReader(data))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	//request.Header.Set("Model", model)
 	request.Header.Set("ID", strconv.FormatInt(id, 10))
+	setConversation(request, conversation_id)
 	request.Header.Set("Deep_think", deep_think_header)
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("Content-Length", strconv.Itoa(len(data)))
@@ -102,56 +233,91 @@ func InferenceMessage(id int64, deep_think_header string, data []byte) (*http.Re
 	return SendToMLPipeline(request)
 }
 
-func GetMessageHistory(id int64) (*http.Response, error) {
-	request, err := http.NewRequest("GET", messageHistory, bytes.NewBuffer([]byte{}))
+// Sends a message to be processed by the LLM and requests a streamed answer.
+//
+// Sets the same headers as InferenceMessage plus "Stream: True". A streaming
+// pipeline answers with newline delimited LLMResponse chunks
+// (Content-Type application/x-ndjson), the last one having Done set; a pipeline
+// without streaming support answers with a single LLMResponse JSON object.
+//
+// The request is bound to ctx, cancelling ctx aborts the upstream call.
+func InferenceMessageStream(
+	ctx context.Context,
+	id int64,
+	conversation_id int64,
+	deep_think_header string,
+	data []byte,
+) (*http.Response, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty data provided")
+	}
 
+	request, err := http.NewRequestWithContext(ctx, "GET", pipelineURL+messageInference, bytes.NewReader(data))
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
+	setRequestID(request)
 	request.Header.Set("ID", strconv.FormatInt(id, 10))
-	return SendToMLPipeline(request)
+	setConversation(request, conversation_id)
+	request.Header.Set("Deep_think", deep_think_header)
+	request.Header.Set("Stream", "True")
+	request.Header.Set("Accept", "application/x-ndjson")
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Content-Length", strconv.Itoa(len(data)))
+
+	return send(streamClient, request)
 }
 
-func MLDeleteUser(id int64) (*http.Response, error) {
-	request, err := http.NewRequest("DELETE", userDeletion, bytes.NewBuffer([]byte{}))
+func GetMessageHistory(ctx context.Context, id int64, conversation_id int64) (*http.Response, error) {
+	request, err := newPipelineRequest(ctx, "GET", messageHistory, bytes.NewBuffer([]byte{}))
 
 	if err != nil {
 		return nil, err
 	}
 
 	request.Header.Set("ID", strconv.FormatInt(id, 10))
+	setConversation(request, conversation_id)
 	return SendToMLPipeline(request)
 }
 
-func MLDeleteDocument(id int64, storage_name string) (*http.Response, error) {
-	request, err := http.NewRequest("DELETE", documentDeletion, bytes.NewBuffer([]byte{}))
+func MLDeleteUser(ctx context.Context, id int64) (*http.Response, error) {
+	request, err := newPipelineRequest(ctx, "DELETE", userDeletion, bytes.NewBuffer([]byte{}))
 
 	if err != nil {
 		return nil, err
 	}
+
 	request.Header.Set("ID", strconv.FormatInt(id, 10))
-	request.Header.Set("X-Filename", storage_name)
 	return SendToMLPipeline(request)
 }
 
-func MLDeleteChat(id int64) (*http.Response, error) {
-	request, err := http.NewRequest("DELETE", messageDeletion, bytes.NewBuffer([]byte{}))
+func MLDeleteDocument(ctx context.Context, id int64, storage_name string) (*http.Response, error) {
+	request, err := newPipelineRequest(ctx, "DELETE", documentDeletion, bytes.NewBuffer([]byte{}))
 
 	if err != nil {
 		return nil, err
 	}
 	request.Header.Set("ID", strconv.FormatInt(id, 10))
-
+	request.Header.Set("X-Filename", storage_name)
 	return SendToMLPipeline(request)
 }
 
-func MLGetModels() (*http.Response, error) {
-	request, err := http.NewRequest("GET", modelListing, bytes.NewBuffer([]byte{}))
+func MLDeleteChat(ctx context.Context, id int64, conversation_id int64) (*http.Response, error) {
+	request, err := newPipelineRequest(ctx, "DELETE", messageDeletion, bytes.NewBuffer([]byte{}))
 
 	if err != nil {
 		return nil, err
 	}
+	request.Header.Set("ID", strconv.FormatInt(id, 10))
+	setConversation(request, conversation_id)
 
 	return SendToMLPipeline(request)
 }
+
+// setConversation adds the conversation header unless the legacy chat (ID 0) is addressed.
+func setConversation(request *http.Request, conversation_id int64) {
+	if conversation_id != 0 {
+		request.Header.Set(conversationHeader, strconv.FormatInt(conversation_id, 10))
+	}
+}
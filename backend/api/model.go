@@ -0,0 +1,173 @@
+package api
+
+import (
+	"backend/auth"
+	"backend/db"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+)
+
+// ModelSelectionRequest assigns a model to a scope.
+//
+//   - Scope: "global", "role" or "user" (db.MODEL_SCOPE_*), defaults to "global"
+//   - Role:  One of db.ROLES, required for the role scope
+//   - Email: Email of the user, required for the user scope
+//   - Model: Model name as listed by /api/get/models, ignored when deleting
+type ModelSelectionRequest struct {
+	Scope string
+	Role  string
+	Email string
+	Model string
+}
+
+// UserModels describes the models applying to the caller.
+//
+//   - Model:      The model requests are currently answered with
+//   - Selections: Every applicable selection, most specific first (see db.GetModelSelections)
+type UserModels struct {
+	Model      string
+	Selections []db.ModelSelection
+}
+
+// parse_model_selection reads a ModelSelectionRequest and resolves its subject.
+//
+// For backwards compatibility a body that is not a JSON object is taken as the
+// model name of the global selection.
+//
+// Returns:
+//   - ModelSelectionRequest: The request with Scope filled in
+//   - string: Subject of the scope (see db.ModelSelection)
+//   - int: HTTP status to answer with if the error is not nil
+//   - error: Unknown scope or role, unknown user or unreadable body
+func parse_model_selection(db_handle *sql.DB, r *http.Request) (ModelSelectionRequest, string, int, error) {
+	data, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		return ModelSelectionRequest{}, "", http.StatusBadRequest, err
+	}
+
+	var selection ModelSelectionRequest
+	if err := json.Unmarshal(data, &selection); err != nil {
+		selection = ModelSelectionRequest{Scope: db.MODEL_SCOPE_GLOBAL, Model: string(data[:])}
+	}
+
+	switch selection.Scope {
+	case "", db.MODEL_SCOPE_GLOBAL:
+		selection.Scope = db.MODEL_SCOPE_GLOBAL
+		return selection, "", http.StatusOK, nil
+	case db.MODEL_SCOPE_ROLE:
+		if !slices.Contains(db.ROLES, selection.Role) {
+			return selection, "", http.StatusBadRequest, fmt.Errorf("unknown role %q", selection.Role)
+		}
+		return selection, selection.Role, http.StatusOK, nil
+	case db.MODEL_SCOPE_USER:
+		user_id, err := db.GetUserID(db_handle, selection.Email)
+		if errors.Is(err, sql.ErrNoRows) {
+			return selection, "", http.StatusNotFound, errors.New("user not found")
+		} else if err != nil {
+			return selection, "", http.StatusInternalServerError, err
+		}
+		return selection, db.UserSubject(user_id), http.StatusOK, nil
+	default:
+		return selection, "", http.StatusBadRequest, fmt.Errorf("unknown scope %q", selection.Scope)
+	}
+}
+
+// model_selection_target is the audit target of a model selection, e.g. "model_selection:role:premium".
+func model_selection_target(scope string, subject string) string {
+	if subject == "" {
+		return "model_selection:" + scope
+	}
+	return "model_selection:" + scope + ":" + subject
+}
+
+// GetModelSelections lists all stored model selections (permission change_models).
+//
+// The last entry is always the configured default model (scope "default").
+//
+// Example Response:
+//
+//	[
+//	  {"Scope": "global", "Subject": "", "Model": "gemma3:12b", "UpdatedAt": 1718000000},
+//	  {"Scope": "role", "Subject": "premium", "Model": "gemma3:27b", "UpdatedAt": 1718000000},
+//	  {"Scope": "user", "Subject": "42", "Model": "llama3.1:8b", "UpdatedAt": 1718000000},
+//	  {"Scope": "default", "Subject": "", "Model": "gemma3:12b", "UpdatedAt": 0}
+//	]
+func GetModelSelections(db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
+	selections, err := db.GetAllModelSelections(db_handle)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(selections)
+}
+
+// GetMyModels returns the models that apply to the authenticated user ("models I may use").
+//
+// Responses:
+//   - 200 OK: JSON object with UserModels structure
+//   - 500 Internal Server Error: Database operation failed
+func GetMyModels(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	selections, err := db.GetModelSelections(db_handle, auth_result.ID)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(UserModels{Model: selections[0].Model, Selections: selections})
+}
+
+// DeleteModelSelection removes a model selection so the next less specific one applies (permission change_models).
+//
+// Expects a JSON payload with ModelSelectionRequest structure, Model is ignored.
+// The removal is recorded in the audit log (action "model.unselect").
+//
+// Responses:
+//   - 200 OK: Selection removed
+//   - 400 Bad Request: Unknown scope or role
+//   - 404 Not Found: Unknown user or no selection stored for the scope
+//   - 500 Internal Server Error: Database operation failed
+func DeleteModelSelection(auth_result auth.AuthorizationResult, db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
+	selection, subject, status, err := parse_model_selection(db_handle, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	err = db.DeleteModelSelection(db_handle, selection.Scope, subject)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "no model selection stored for this scope", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := audit(auth_result, db_handle, r, "model.unselect", model_selection_target(selection.Scope, subject), nil); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte{})
+}
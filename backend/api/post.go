@@ -1,6 +1,7 @@
 package api
 
 import (
+	"backend/auth"
 	"backend/db"
 	"database/sql"
 	"encoding/json"
@@ -21,7 +22,8 @@ import (
 // The handler performs these steps:
 //  1. Validates the input JSON structure
 //  2. Verifies the email isn't already registered
-//  3. Adds the signup request to the database using AddSignupRequest
+//  3. Hashes the password with auth.HashPassword
+//  4. Adds the signup request to the database using AddSignupRequest
 //
 // Possible error responses:
 //   - 400 Bad Request: Invalid JSON or missing required fields
@@ -46,16 +48,24 @@ func HandleSignUpRequest(db_handler *sql.DB, w http.ResponseWriter, r *http.Requ
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if signup_request.Email == "" || signup_request.Password == "" {
+		http.Error(w, "email and password are required", http.StatusBadRequest)
+		return
 	}
 
 	user_exists, err := db.ExistsEmailInUser(db_handler, signup_request.Email)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	signup_exists, err := db.ExistsEmailInSignUp(db_handler, signup_request.Email)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	if signup_exists || user_exists {
@@ -63,6 +73,13 @@ func HandleSignUpRequest(db_handler *sql.DB, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	signup_request.Password, err = auth.HashPassword(signup_request.Password)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	err = db.AddSignupRequest(db_handler, signup_request)
 
 	if err != nil {
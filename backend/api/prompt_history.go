@@ -0,0 +1,264 @@
+package api
+
+import (
+	"backend/auth"
+	"backend/db"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Owner ID under which the history of the global default prompt is stored.
+const defaultPromptOwner int64 = 0
+
+// GetPromptHistory lists the versions of the authenticated user's prompt, newest first.
+//
+// Example Response:
+//
+//	[
+//	  {
+//		"ID": int,
+//		"UserID": int,
+//		"Prompt": string,
+//		"AuthorID": int,
+//		"Author": string,
+//		"CreatedAt": int
+//	  }
+//	]
+func GetPromptHistory(auth_result auth.AuthorizationResult, db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
+	write_prompt_history(db_handle, auth_result.ID, w)
+}
+
+// GetDefaultPromptHistory lists the versions of the global default prompt (permission edit_default_prompt).
+//
+// Same response format as GetPromptHistory, UserID is 0.
+func GetDefaultPromptHistory(db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
+	write_prompt_history(db_handle, defaultPromptOwner, w)
+}
+
+// GetPromptDiff compares two versions of the authenticated user's prompt.
+//
+// Query parameters:
+//   - from: Version ID of the old side
+//   - to:   Version ID of the new side, omitted to compare against the current prompt
+//
+// Responses:
+//   - 200 OK: Line diff as plain text (see diff_lines)
+//   - 400 Bad Request: Missing or malformed version IDs
+//   - 404 Not Found: Version does not exist or belongs to another prompt
+func GetPromptDiff(auth_result auth.AuthorizationResult, db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
+	current, err := db.GetPrompt(db_handle, auth_result.ID)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	write_prompt_diff(db_handle, auth_result.ID, current, w, r)
+}
+
+// GetDefaultPromptDiff compares two versions of the global default prompt (permission edit_default_prompt).
+//
+// Same parameters and responses as GetPromptDiff.
+func GetDefaultPromptDiff(db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
+	write_prompt_diff(db_handle, defaultPromptOwner, getDefaultPrompt(), w, r)
+}
+
+// RestorePrompt sets the authenticated user's prompt back to a previous version.
+//
+// Expects the version ID as plain text in the request body. Restoring records
+// a new version, so the restore itself can be undone.
+//
+// Responses:
+//   - 200 OK: Prompt restored
+//   - 400 Bad Request: Malformed version ID
+//   - 404 Not Found: Version does not exist or belongs to another prompt
+//   - 500 Internal Server Error: Database operation failed
+func RestorePrompt(auth_result auth.AuthorizationResult, db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
+	version, status, err := requested_prompt_version(db_handle, auth_result.ID, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	err = db.ChangePrompt(db_handle, auth_result.ID, version.Prompt, auth_result.ID)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte{})
+}
+
+// RestoreDefaultPrompt sets the global default prompt back to a previous version (permission edit_default_prompt).
+//
+// Same request and responses as RestorePrompt. The change is recorded in the
+// audit log (action "prompt.default.restore").
+func RestoreDefaultPrompt(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	prompt_path string,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	version, status, err := requested_prompt_version(db_handle, defaultPromptOwner, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	err = change_default_prompt(auth_result, db_handle, prompt_path, version.Prompt)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := audit(auth_result, db_handle, r, "prompt.default.restore", "", map[string]int64{"Version": version.ID}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte{})
+}
+
+// change_default_prompt replaces the global default prompt and records the change.
+func change_default_prompt(auth_result auth.AuthorizationResult, db_handle *sql.DB, prompt_path string, prompt string) error {
+	var previous string = getDefaultPrompt()
+
+	if err := SetDefaultPrompt(prompt_path, prompt); err != nil {
+		return err
+	}
+
+	return db.RecordDefaultPromptChange(db_handle, previous, prompt, auth_result.ID)
+}
+
+func write_prompt_history(db_handle *sql.DB, user_id int64, w http.ResponseWriter) {
+	versions, err := db.GetPromptHistory(db_handle, user_id)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(versions)
+}
+
+func write_prompt_diff(db_handle *sql.DB, user_id int64, current string, w http.ResponseWriter, r *http.Request) {
+	from, status, err := prompt_version_parameter(db_handle, user_id, r.URL.Query().Get("from"))
+
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	var to_label string = "current"
+	var to_prompt string = current
+
+	if r.URL.Query().Has("to") {
+		to, status, err := prompt_version_parameter(db_handle, user_id, r.URL.Query().Get("to"))
+
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		to_label = "version " + strconv.FormatInt(to.ID, 10)
+		to_prompt = to.Prompt
+	}
+
+	var diff strings.Builder
+	fmt.Fprintf(&diff, "--- version %d\n+++ %s\n", from.ID, to_label)
+	diff.WriteString(diff_lines(from.Prompt, to_prompt))
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(diff.String()))
+}
+
+// requested_prompt_version reads a version ID from the request body and loads it.
+func requested_prompt_version(db_handle *sql.DB, user_id int64, r *http.Request) (db.PromptVersion, int, error) {
+	data, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		return db.PromptVersion{}, http.StatusBadRequest, err
+	}
+
+	return prompt_version_parameter(db_handle, user_id, strings.TrimSpace(string(data[:])))
+}
+
+// prompt_version_parameter parses a version ID and loads the version if it belongs to the prompt.
+func prompt_version_parameter(db_handle *sql.DB, user_id int64, parameter string) (db.PromptVersion, int, error) {
+	id, err := strconv.ParseInt(parameter, 10, 64)
+	if err != nil {
+		return db.PromptVersion{}, http.StatusBadRequest, fmt.Errorf("invalid version %q", parameter)
+	}
+
+	version, err := db.GetPromptVersion(db_handle, user_id, id)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.PromptVersion{}, http.StatusNotFound, errors.New("version not found")
+	} else if err != nil {
+		return db.PromptVersion{}, http.StatusInternalServerError, err
+	}
+
+	return version, http.StatusOK, nil
+}
+
+// diff_lines produces a line diff of two texts based on their longest common subsequence.
+//
+// Every line is prefixed with "  " (unchanged), "- " (only in old) or "+ " (only in new).
+// Prompts are short, so the quadratic table is not a concern.
+func diff_lines(old string, new string) string {
+	old_lines := strings.Split(old, "\n")
+	new_lines := strings.Split(new, "\n")
+
+	// common[i][j] is the LCS length of old_lines[i:] and new_lines[j:]
+	common := make([][]int, len(old_lines)+1)
+	for i := range common {
+		common[i] = make([]int, len(new_lines)+1)
+	}
+
+	for i := len(old_lines) - 1; i >= 0; i-- {
+		for j := len(new_lines) - 1; j >= 0; j-- {
+			if old_lines[i] == new_lines[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	var diff strings.Builder
+	i, j := 0, 0
+
+	for i < len(old_lines) || j < len(new_lines) {
+		switch {
+		case i < len(old_lines) && j < len(new_lines) && old_lines[i] == new_lines[j]:
+			diff.WriteString("  " + old_lines[i] + "\n")
+			i++
+			j++
+		case i < len(old_lines) && (j == len(new_lines) || common[i+1][j] >= common[i][j+1]):
+			diff.WriteString("- " + old_lines[i] + "\n")
+			i++
+		default:
+			diff.WriteString("+ " + new_lines[j] + "\n")
+			j++
+		}
+	}
+
+	return diff.String()
+}
@@ -0,0 +1,326 @@
+package api
+
+import (
+	"backend/auth"
+	"backend/db"
+	"backend/logging"
+	"backend/provider"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Name of the built-in provider backed by the configured Ollama instance.
+// Its models are answered through the ML pipeline and keep their plain names.
+const DEFAULT_PROVIDER string = "ollama"
+
+// How long the model list of a provider is reused before it is asked again.
+const modelCacheLifetime time.Duration = 30 * time.Second
+
+// Whether the built-in provider runs on the premises, set by ConfigureProviders.
+// Until then it is not trusted with local-only requests.
+var builtinLocal bool = false
+
+// providers holds the built-in provider and those registered by administrators, set by ConfigureProviders.
+var providers *provider.Registry = provider.NewRegistry(builtin_provider(nil), modelCacheLifetime)
+
+// Client of registered providers, timeout bounded like streamClient.
+var providerClient *http.Client = provider.DefaultClient(1200 * time.Second)
+
+// ProviderRequest registers a model provider (see provider.Endpoint).
+//
+//   - Name:    Prefix of the provider's models, e.g. "vllm" for "vllm/mistral-7b"
+//   - Kind:    "ollama" or "openai"
+//   - BaseURL: Root of the API, including "/v1" for OpenAI compatible servers
+//   - APIKey:  Optional bearer token
+//   - Local:   Whether the provider runs on the premises and may serve local-only users
+type ProviderRequest struct {
+	Name    string
+	Kind    string
+	BaseURL string
+	APIKey  string
+	Local   bool
+}
+
+// ProviderInfo describes a provider in GetProviders. API keys are never returned.
+//
+//   - Builtin: The provider configured by ollama_url, it cannot be removed
+//   - HasKey:  Whether an API key is stored
+type ProviderInfo struct {
+	Name    string
+	Kind    string
+	BaseURL string
+	Local   bool
+	Builtin bool
+	HasKey  bool
+}
+
+// ModelCatalogue is the response of GetModels.
+//
+//   - Models: Models of all providers; "name" is the value to use for model selections
+//   - Errors: Providers that could not be reached, omitted if all answered
+type ModelCatalogue struct {
+	Models []provider.Model `json:"models"`
+	Errors []string         `json:"errors,omitempty"`
+}
+
+// ConfigureProviders sets up the built-in provider and registers the providers stored in the database.
+//
+// Must be called after ConfigurePipeline and before the server starts handling requests.
+// Stored providers that fail validation are logged and skipped instead of preventing startup.
+//
+// Parameters:
+//   - db_handle: Database connection handle
+//   - timeout: Time to first byte of provider calls
+//   - ollama_local: Whether the built-in provider runs on the premises (config ollama_local)
+func ConfigureProviders(db_handle *sql.DB, timeout time.Duration, ollama_local bool) error {
+	providerClient = provider.DefaultClient(timeout)
+	builtinLocal = ollama_local
+
+	providers = provider.NewRegistry(builtin_provider(providerClient), modelCacheLifetime)
+
+	stored, err := db.GetModelProviders(db_handle)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range stored {
+		backend, err := provider.New(endpoint(entry), providerClient)
+		if err == nil {
+			err = providers.Register(backend)
+		}
+
+		if err != nil {
+			slog.Warn("Skipping model provider", "provider", entry.Name, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// builtin_provider creates the provider of the configured Ollama instance.
+func builtin_provider(client *http.Client) provider.Provider {
+	return provider.NewOllama(provider.Endpoint{Name: DEFAULT_PROVIDER, BaseURL: ollamaURL, Local: builtinLocal}, client)
+}
+
+// endpoint converts a stored provider into its endpoint description.
+func endpoint(entry db.ModelProvider) provider.Endpoint {
+	return provider.Endpoint{
+		Name:    entry.Name,
+		Kind:    entry.Kind,
+		BaseURL: entry.BaseURL,
+		APIKey:  entry.APIKey,
+		Local:   entry.Local,
+	}
+}
+
+// GetProviders lists the model providers (permission change_models).
+//
+// Example Response:
+//
+//	[{"Name": "ollama", "Kind": "ollama", "BaseURL": "http://ollama:11434", "Local": true, "Builtin": true, "HasKey": false}, ...]
+func GetProviders(db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
+	stored, err := db.GetModelProviders(db_handle)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var infos []ProviderInfo = []ProviderInfo{{
+		Name:    DEFAULT_PROVIDER,
+		Kind:    provider.KIND_OLLAMA,
+		BaseURL: ollamaURL,
+		Local:   providers.Default().Local(),
+		Builtin: true,
+	}}
+
+	for _, entry := range stored {
+		infos = append(infos, ProviderInfo{
+			Name:    entry.Name,
+			Kind:    entry.Kind,
+			BaseURL: entry.BaseURL,
+			Local:   entry.Local,
+			HasKey:  entry.APIKey != "",
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(infos)
+}
+
+// AddProvider registers a model provider (permission change_models).
+//
+// Expects a JSON payload with ProviderRequest structure. The provider is stored
+// and its models appear in /api/get/models immediately. The registration is
+// recorded in the audit log (action "provider.add", without the API key).
+//
+// Responses:
+//   - 200 OK: Provider registered
+//   - 400 Bad Request: Invalid JSON, name, kind or URL
+//   - 409 Conflict: A provider with the name exists
+//   - 500 Internal Server Error: Database operation failed
+func AddProvider(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	data, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var request ProviderRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var entry db.ModelProvider = db.ModelProvider{
+		Name:    request.Name,
+		Kind:    request.Kind,
+		BaseURL: request.BaseURL,
+		APIKey:  request.APIKey,
+		Local:   request.Local,
+	}
+
+	backend, err := provider.New(endpoint(entry), providerClient)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := providers.Register(backend); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if err := db.AddModelProvider(db_handle, entry); err != nil {
+		providers.Remove(entry.Name)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	entry.APIKey = ""
+	if err := audit(auth_result, db_handle, r, "provider.add", "provider:"+entry.Name, entry); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte{})
+}
+
+// DeleteProvider removes a registered model provider (permission change_models).
+//
+// Expects the provider name as plain text body. Model selections naming the
+// provider's models are kept but can no longer be answered, change them first.
+//
+// Responses:
+//   - 200 OK: Provider removed
+//   - 400 Bad Request: Body cannot be read, or the built-in provider was named
+//   - 404 Not Found: No provider has the name
+//   - 500 Internal Server Error: Database operation failed
+func DeleteProvider(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	data, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var name string = string(data)
+
+	if name == DEFAULT_PROVIDER {
+		http.Error(w, "the built-in provider cannot be removed", http.StatusBadRequest)
+		return
+	}
+
+	err = db.DeleteModelProvider(db_handle, name)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, fmt.Sprintf("provider %q does not exist", name), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := providers.Remove(name); err != nil {
+		logging.FromContext(r.Context()).Warn("Provider was stored but not registered", "provider", name, "error", err)
+	}
+
+	if err := audit(auth_result, db_handle, r, "provider.delete", "provider:"+name, map[string]string{"Name": name}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte{})
+}
+
+// direct_chat builds the chat request for a provider that is called directly instead of through the ML pipeline.
+//
+// The conversation is taken from the pipeline's message history, preceded by the
+// preprompt as system message. Retrieval over uploaded documents and the legal
+// library is done by the pipeline, so it is not available for these providers.
+// Like the pipeline's inference, the exchange is not stored here; the client
+// uploads question and answer afterwards (see Inference).
+func direct_chat(
+	ctx context.Context,
+	user_id int64,
+	conversation_id int64,
+	model string,
+	preprompt string,
+	message Message,
+) (provider.ChatRequest, error) {
+	response, err := GetMessageHistory(ctx, user_id, conversation_id)
+	if err != nil {
+		return provider.ChatRequest{}, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return provider.ChatRequest{}, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return provider.ChatRequest{}, fmt.Errorf("ML pipeline error: %s", string(body))
+	}
+
+	var history []Message
+	if err := json.Unmarshal(body, &history); err != nil {
+		return provider.ChatRequest{}, fmt.Errorf("invalid message history: %w", err)
+	}
+
+	var messages []provider.ChatMessage = []provider.ChatMessage{{Role: provider.ROLE_SYSTEM, Content: preprompt}}
+
+	for _, entry := range append(history, message) {
+		var role string = provider.ROLE_ASSISTANT
+		if entry.Kind == 1 {
+			role = provider.ROLE_USER
+		}
+		messages = append(messages, provider.ChatMessage{Role: role, Content: entry.Message})
+	}
+
+	return provider.ChatRequest{Model: model, Messages: messages}, nil
+}
@@ -3,22 +3,32 @@ package api
 import (
 	"backend/auth"
 	"backend/db"
+	"backend/logging"
+	"backend/provider"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 )
 
-// Legal_libary handles requests related to legal library operations.
+// Legal_libary persists whether the user opted into the shared legal library.
 //
 // Expects a JSON payload in the request body with LegalLibary structure.
-// Returns 200 OK with success status on valid requests.
+// Returns 200 OK with success status on valid requests. The setting is sent
+// to the ML pipeline with every inference request: the library documents are
+// added to MLMessage.SharedDocuments.
 //
 // Error responses:
 //   - 400 Bad Request: For body read errors or invalid JSON
-func Legal_libary(w http.ResponseWriter, r *http.Request) {
+//   - 500 Internal Server Error: Database operation failed
+func Legal_libary(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
 	if r.Method != "PUT" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -37,13 +47,16 @@ func Legal_libary(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	println(legal_library.Legal_library)
+	if err := db.SetLegalLibrary(db_handle, auth_result.ID, legal_library.Legal_library); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"status": "success"}`))
 }
 
-// Local_only handles requests to update local-only application state.
+// Local_only persists whether the user's inference is restricted to local model backends.
 //
 // Path: /api/update/local_only
 // Expects a JSON payload in the request body with LocalOnly structure.
@@ -51,7 +64,14 @@ func Legal_libary(w http.ResponseWriter, r *http.Request) {
 //
 // Error responses:
 //   - 400 Bad Request: For body read errors or invalid JSON
-func Local_only(w http.ResponseWriter, r *http.Request) {
+//   - 409 Conflict: Disabling while an administrator enforces local-only mode
+//   - 500 Internal Server Error: Database operation failed
+func Local_only(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
 	if r.Method != "PUT" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -70,9 +90,22 @@ func Local_only(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	println(local_only.Local_only)
+	enforced, err := db.GetLocalOnlyEnforced(db_handle)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if enforced && !local_only.Local_only {
+		http.Error(w, "local-only mode is enforced by an administrator", http.StatusConflict)
+		return
+	}
+
+	if err := db.SetLocalOnly(db_handle, auth_result.ID, local_only.Local_only); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	// 4. Success response
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"status": "success"}`))
 }
@@ -90,8 +123,10 @@ func Local_only(w http.ResponseWriter, r *http.Request) {
 //
 // Note:
 //   - New users are created with admin=false privileges
+//   - The password hash of the request is carried over unchanged
 //   - Logs errors but doesn't expose detailed error messages to client
-func AcceptSignupRequest(db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
+//   - The new account is recorded in the audit log (action "signup.accept")
+func AcceptSignupRequest(auth_result auth.AuthorizationResult, db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
 	if r.Method != "PUT" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -107,7 +142,7 @@ func AcceptSignupRequest(db_handle *sql.DB, w http.ResponseWriter, r *http.Reque
 
 	entry, err := db.DeleteSignupRequest(db_handle, string(data[:]))
 	if err != nil {
-		log.Println("Failed to delete user", err.Error())
+		logging.FromContext(r.Context()).Error("Failed to delete signup request", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -118,21 +153,26 @@ func AcceptSignupRequest(db_handle *sql.DB, w http.ResponseWriter, r *http.Reque
 	)
 
 	if err != nil {
-		log.Println("Failed to add user", err.Error())
+		logging.FromContext(r.Context()).Error("Failed to add user", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	user_id, err := db.GetUserID(db_handle, entry.Email)
 	if err != nil {
-		log.Println("Failed to get user", err.Error())
+		logging.FromContext(r.Context()).Error("Failed to get user", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	err = db.AddPrompt(db_handle, user_id, DEFAULT_PREPROMPT)
 	if err != nil {
-		log.Println("Failed to create promt for user", err.Error())
+		logging.FromContext(r.Context()).Error("Failed to create prompt for user", "user", user_id, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := audit(auth_result, db_handle, r, "signup.accept", fmt.Sprintf("user:%d", user_id), map[string]string{"Name": entry.Name, "Email": entry.Email}); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -164,7 +204,10 @@ func AcceptSignupRequest(db_handle *sql.DB, w http.ResponseWriter, r *http.Reque
 //
 // Security:
 // - Requires pre-authentication (handled by middleware)
-// - Uses parameterized queries via db.UpdatePrompt
+// - Uses parameterized queries via db.ChangePrompt
+//
+// Note:
+//   - Every change is recorded in the prompt history (see RestorePrompt)
 func UpdatePrompt(
 	auth_result auth.AuthorizationResult,
 	db_handle *sql.DB,
@@ -185,7 +228,7 @@ func UpdatePrompt(
 	}
 
 	if len(data) == 0 {
-		err = db.UpdatePrompt(db_handle, auth_result.ID, DEFAULT_PREPROMPT)
+		err = db.ChangePrompt(db_handle, auth_result.ID, getDefaultPrompt(), auth_result.ID)
 
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -194,7 +237,7 @@ func UpdatePrompt(
 	} else {
 		prompt := string(data[:])
 
-		err = db.UpdatePrompt(db_handle, auth_result.ID, prompt)
+		err = db.ChangePrompt(db_handle, auth_result.ID, prompt, auth_result.ID)
 
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -209,18 +252,27 @@ func UpdatePrompt(
 // UpdateDefaultPrompt handles HTTP requests to update the default system prompt.
 //
 // This endpoint expects a plain text request body containing the new prompt.
-// On success, it returns HTTP 200 with an empty body.
+// On success, it returns HTTP 200 with an empty body. The change is recorded in
+// the audit log (action "prompt.default"), the text itself in the prompt history.
 //
 // Parameters:
-//   - db_handle: Database connection handle (currently unused, preserved for future extensions)
+//   - auth_result: Authorization of the administrator, recorded as author of the change
+//   - db_handle: Database connection handle, the change is recorded in the prompt history
+//   - prompt_path: File the default prompt is persisted to
 //   - w: HTTP response writer
 //   - r: HTTP request containing the new prompt in its body
 //
 // Possible status codes:
 //   - 200 OK: Prompt updated successfully
 //   - 400 Bad Request: Invalid request body
-//   - 500 Internal Server Error: (future use for database operations)
-func UpdateDefaultPromt(db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
+//   - 500 Internal Server Error: Writing the prompt or recording the history failed
+func UpdateDefaultPromt(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	prompt_path string,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
 	data, err := io.ReadAll(r.Body)
 	defer r.Body.Close()
 
@@ -234,12 +286,17 @@ func UpdateDefaultPromt(db_handle *sql.DB, w http.ResponseWriter, r *http.Reques
 	if len(new_default_promt) == 0 {
 		new_default_promt = BACK_UP_PROMPT
 	}
-	err = SetDefaultPrompt(new_default_promt)
+	err = change_default_prompt(auth_result, db_handle, prompt_path, new_default_promt)
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+
+	if err := audit(auth_result, db_handle, r, "prompt.default", "", map[string]int{"Length": len(new_default_promt)}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte{})
 }
@@ -247,9 +304,11 @@ func UpdateDefaultPromt(db_handle *sql.DB, w http.ResponseWriter, r *http.Reques
 // PromoteUser handles HTTP requests to promote a user's privileges.
 //
 // This is a PUT-only endpoint that expects a user email in the request body.
-// It calls the database layer to perform the promotion operation.
+// The user gets the admin role, see UpdateUserRole for the other roles.
+// The promotion is recorded in the audit log (action "user.promote").
 //
 // Parameters:
+//   - auth_result: Authorization of the administrator, recorded in the audit log
 //   - db_handle: Database connection pool
 //   - w: HTTP response writer
 //   - r: HTTP request object
@@ -259,7 +318,7 @@ func UpdateDefaultPromt(db_handle *sql.DB, w http.ResponseWriter, r *http.Reques
 //   - 400 Bad Request: If body cannot be read
 //   - 405 Method Not Allowed: If request method isn't PUT
 //   - 500 Internal Server Error: If database operation fails
-func PromoteUser(db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
+func PromoteUser(auth_result auth.AuthorizationResult, db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
 	if r.Method != "PUT" {
 		http.Error(w, "Method not followed", http.StatusMethodNotAllowed)
 		return
@@ -273,46 +332,85 @@ func PromoteUser(db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = db.PromoteUser(db_handle, string(data[:])) // Email is in data
+	var email string = string(data[:])
+
+	err = db.PromoteUser(db_handle, email)
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	user_id, err := db.GetUserID(db_handle, email)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := audit(auth_result, db_handle, r, "user.promote", fmt.Sprintf("user:%d", user_id), map[string]string{"Role": db.ROLE_ADMIN}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte{})
 }
 
-// UpdateModelSelection handles HTTP requests to update the active AI model.
+// UpdateModelSelection handles HTTP requests to assign a model to a scope.
 //
-// This is a PUT-only endpoint that expects the model name in the request body.
-// It updates the application's selected model through the database layer.
+// This is a PUT-only endpoint that expects a JSON payload with ModelSelectionRequest
+// structure. A plain model name (not a JSON object) sets the global selection.
+// The model is only accepted if its provider lists it (names as returned by
+// /api/get/models); the selection is persisted and survives restarts.
+// The change is recorded in the audit log (action "model.select").
 //
 // Parameters:
+//   - auth_result: Authorization of the administrator, recorded in the audit log
+//   - db_handle: Database connection handle
 //   - w: HTTP response writer
 //   - r: HTTP request object
 //
 // Responses:
 //   - 200 OK: On successful model update
-//   - 400 Bad Request: If body cannot be read
+//   - 400 Bad Request: If body cannot be read, scope/role are unknown or no provider serves the model
+//   - 404 Not Found: User of a user scope selection does not exist
 //   - 405 Method Not Allowed: If request method isn't PUT
-func UpdateModelSelection(w http.ResponseWriter, r *http.Request) {
+//   - 502 Bad Gateway: The models of the provider could not be listed
+func UpdateModelSelection(auth_result auth.AuthorizationResult, db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
 	if r.Method != "PUT" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	data, err := io.ReadAll(r.Body)
-	defer r.Body.Close()
+	selection, subject, status, err := parse_model_selection(db_handle, r)
 
 	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	_, _, err = providers.Resolve(r.Context(), selection.Model)
+
+	if errors.Is(err, provider.ErrUnknownModel) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
 	}
 
-	var model_selection string = string(data[:])
-	db.SetModel(model_selection)
+	err = db.SetModel(db_handle, selection.Scope, subject, selection.Model)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := audit(auth_result, db_handle, r, "model.select", model_selection_target(selection.Scope, subject), map[string]string{"Model": selection.Model}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte{})
@@ -0,0 +1,505 @@
+package api
+
+import (
+	"backend/auth"
+	"backend/db"
+	"backend/document"
+	"backend/metrics"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Protocol version announced in the Tus-Resumable header. The protocol follows
+// tus 1.0 (creation, HEAD status, PATCH at offset, termination) but takes file
+// name and title from the X-Filename and Title headers like FileUpload, and
+// requires the SHA-256 of the complete file up front.
+const TUS_VERSION string = "1.0.0"
+
+// How often uploads are checked for expiry, see StartUploadExpiry.
+const uploadExpiryInterval time.Duration = 10 * time.Minute
+
+// Content type required for PATCH requests, as in tus.
+const offsetContentType string = "application/offset+octet-stream"
+
+// UploadSettings configures resumable uploads.
+//
+//   - Path:          Directory partial files and spooled uploads are kept in until processed
+//   - Expiry:        Uploads without new data for this long are removed (see StartUploadExpiry)
+//   - FileSizeLimit: Maximum upload length in bytes
+//   - LargeUploadSize: Maximum upload length for roles without the upload_large_documents permission
+type UploadSettings struct {
+	Path            string
+	Expiry          time.Duration
+	FileSizeLimit   int64
+	LargeUploadSize int64
+}
+
+// CreatedUpload is the response body of CreateUpload.
+type CreatedUpload struct {
+	ID       string
+	Location string
+}
+
+// Uploads a PATCH request is currently writing to, guards against concurrent writes.
+var (
+	activeUploadMutex sync.Mutex
+	activeUploads     map[string]bool = map[string]bool{}
+)
+
+// CreateUpload starts a resumable upload.
+//
+// Required headers:
+//   - X-Filename: Original file name (its extension must be a supported format)
+//   - Title: Document title
+//   - Upload-Length: Size of the complete file in bytes
+//   - Upload-SHA256: Hex encoded SHA-256 of the complete file, verified once all bytes arrived
+//
+// Optional headers:
+//   - Tags: Comma separated tags of the document (see UpdateDocumentTags)
+//
+// Responses:
+//   - 201 Created: Location and Upload-Offset headers, JSON CreatedUpload body
+//   - 400 Bad Request: Missing or malformed header
+//   - 409 Conflict: The user already uploaded a file with this SHA-256
+//   - 413 Request Entity Too Large: Upload-Length exceeds file_size_limit, or large_upload_size
+//     for roles without the upload_large_documents permission
+//   - 415 Unsupported Media Type: File extension of an unsupported format
+//   - 500 Internal Server Error: Database or file system failure
+func CreateUpload(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	settings UploadSettings,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	w.Header().Set("Tus-Resumable", TUS_VERSION)
+
+	settings = user_upload_settings(auth_result, settings)
+
+	var filename string = r.Header.Get("X-Filename")
+	var title string = r.Header.Get("Title")
+
+	if filename == "" || title == "" {
+		http.Error(w, "Missing X-Filename or Title header", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := document.Lookup(filename); err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	tags, err := header_tags(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		http.Error(w, "Upload-Length must be a positive integer", http.StatusBadRequest)
+		return
+	}
+
+	if length > settings.FileSizeLimit {
+		http.Error(w, fmt.Sprintf("Upload-Length exceeds the limit of %d bytes", settings.FileSizeLimit), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var checksum string = strings.ToLower(r.Header.Get("Upload-SHA256"))
+	if decoded, err := hex.DecodeString(checksum); err != nil || len(decoded) != sha256.Size {
+		http.Error(w, "Upload-SHA256 must be a hex encoded SHA-256 digest", http.StatusBadRequest)
+		return
+	}
+
+	if duplicate, err := find_duplicate(db_handle, auth_result.ID, checksum); err == nil {
+		http.Error(w, fmt.Sprintf("already uploaded as %q", duplicate), http.StatusConflict)
+		return
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := os.MkdirAll(settings.Path, 0o700); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	upload, err := db.CreateUpload(db_handle, auth_result.ID, filename, title, length, checksum, tags)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	file, err := os.OpenFile(upload_file(settings, upload.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		db.DeleteUpload(db_handle, upload.ID)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	file.Close()
+
+	var location string = "/api/upload/resumable/" + upload.ID
+
+	w.Header().Set("Location", location)
+	w.Header().Set("Upload-Offset", "0")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreatedUpload{ID: upload.ID, Location: location})
+}
+
+// UploadStatus reports the progress of a resumable upload (HEAD).
+//
+// Responses:
+//   - 200 OK: Upload-Offset (bytes received) and Upload-Length headers
+//   - 404 Not Found: Unknown upload or upload of another user
+func UploadStatus(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	w.Header().Set("Tus-Resumable", TUS_VERSION)
+	w.Header().Set("Cache-Control", "no-store")
+
+	upload, status, err := owned_upload(auth_result, db_handle, r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Received, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+// AppendUpload writes the next chunk of a resumable upload (PATCH).
+//
+// The Upload-Offset header must equal the bytes received so far, the body
+// (Content-Type application/offset+octet-stream) is appended. If the connection
+// breaks, everything received is kept and the client resumes from the offset
+// reported by UploadStatus.
+//
+// Once all bytes arrived, the SHA-256 of the file is verified and the document is
+// queued for ingestion like a FileUpload. If queueing fails because of a server
+// error the upload is kept, and a PATCH with an empty body at the final offset
+// retries it.
+//
+// Responses:
+//   - 202 Accepted: Upload complete and queued, JSON IngestionStatus, Location header of the status
+//   - 204 No Content: Chunk stored, Upload-Offset header carries the new offset
+//   - 400 Bad Request: Malformed Upload-Offset or interrupted body
+//   - 404 Not Found: Unknown upload or upload of another user
+//   - 409 Conflict: Offset does not match, or another request is writing to the upload
+//   - 413 Request Entity Too Large: Body extends beyond Upload-Length
+//   - 415 Unsupported Media Type: Wrong Content-Type
+//   - 422 Unprocessable Entity: Checksum mismatch, the upload is discarded
+//   - 5xx: Storage, database or pipeline failure
+func AppendUpload(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	settings UploadSettings,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	w.Header().Set("Tus-Resumable", TUS_VERSION)
+	defer r.Body.Close()
+
+	if r.Header.Get("Content-Type") != offsetContentType {
+		http.Error(w, "Content-Type must be "+offsetContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Upload-Offset must be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+
+	upload, status, err := owned_upload(auth_result, db_handle, r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if !lock_upload(upload.ID) {
+		http.Error(w, "Upload is being written by another request", http.StatusConflict)
+		return
+	}
+	defer unlock_upload(upload.ID)
+
+	// Re-read under the lock, a concurrent request may have advanced the offset
+	upload, err = db.GetUpload(db_handle, upload.ID, auth_result.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if offset != upload.Received {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Received, 10))
+		http.Error(w, fmt.Sprintf("Upload-Offset %d does not match the received %d bytes", offset, upload.Received), http.StatusConflict)
+		return
+	}
+
+	written, write_err := append_chunk(settings, upload, http.MaxBytesReader(w, r.Body, upload.Length-upload.Received))
+	upload.Received += written
+	metrics.UploadBytes.Add(float64(written), "resumable")
+
+	if written > 0 {
+		if err := db.SetUploadReceived(db_handle, upload.ID, upload.Received); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Received, 10))
+
+	if write_err != nil {
+		http.Error(w, write_err.Error(), body_error_status(write_err, http.StatusBadRequest))
+		return
+	}
+
+	if upload.Received < upload.Length {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	job, status, err := complete_upload(db_handle, settings, upload)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	accept_job(w, job)
+}
+
+// CancelUpload discards a resumable upload and its partial file (DELETE).
+//
+// Responses:
+//   - 204 No Content: Upload removed
+//   - 404 Not Found: Unknown upload or upload of another user
+//   - 409 Conflict: A request is writing to the upload
+func CancelUpload(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	settings UploadSettings,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	w.Header().Set("Tus-Resumable", TUS_VERSION)
+
+	upload, status, err := owned_upload(auth_result, db_handle, r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if !lock_upload(upload.ID) {
+		http.Error(w, "Upload is being written by another request", http.StatusConflict)
+		return
+	}
+	defer unlock_upload(upload.ID)
+
+	if err := discard_upload(db_handle, settings, upload.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// owned_upload loads the upload named by the {id} path segment if it belongs to the caller.
+func owned_upload(auth_result auth.AuthorizationResult, db_handle *sql.DB, r *http.Request) (db.Upload, int, error) {
+	upload, err := db.GetUpload(db_handle, r.PathValue("id"), auth_result.ID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.Upload{}, http.StatusNotFound, errors.New("upload not found")
+	} else if err != nil {
+		return db.Upload{}, http.StatusInternalServerError, err
+	}
+
+	return upload, http.StatusOK, nil
+}
+
+// append_chunk writes body to the partial file at the upload's offset.
+//
+// Bytes beyond the offset left by an interrupted earlier write are discarded first.
+//
+// Returns:
+//   - int64: Bytes written and synced to disk, also if an error occurred
+//   - error: Reading the body or writing the file failed
+func append_chunk(settings UploadSettings, upload db.Upload, body io.Reader) (int64, error) {
+	file, err := os.OpenFile(upload_file(settings, upload.ID), os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if err := file.Truncate(upload.Received); err != nil {
+		return 0, err
+	}
+
+	if _, err := file.Seek(upload.Received, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	written, copy_err := io.Copy(file, body)
+
+	if err := file.Sync(); err != nil {
+		return 0, err
+	}
+
+	return written, copy_err
+}
+
+// complete_upload verifies a fully received upload and queues it like FileUpload.
+//
+// The partial file becomes the spooled file of the job, only the upload record is
+// removed. The upload is discarded on errors that a retry cannot fix (checksum
+// mismatch, duplicate); on server errors it is kept for a retry.
+//
+// Returns:
+//   - db.IngestionJob: The queued job
+//   - int: HTTP status to answer with if the error is not nil
+//   - error: Checksum mismatch, duplicate, file system or database failure
+func complete_upload(db_handle *sql.DB, settings UploadSettings, upload db.Upload) (db.IngestionJob, int, error) {
+	var path string = upload_file(settings, upload.ID)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return db.IngestionJob{}, http.StatusInternalServerError, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return db.IngestionJob{}, http.StatusInternalServerError, err
+	}
+
+	if checksum := hex.EncodeToString(hash.Sum(nil)); checksum != upload.SHA256 {
+		discard_upload(db_handle, settings, upload.ID)
+		return db.IngestionJob{}, http.StatusUnprocessableEntity, fmt.Errorf("checksum mismatch: received file has SHA-256 %s, announced was %s", checksum, upload.SHA256)
+	}
+
+	job, status, err := enqueue_document(db_handle, settings, db.IngestionJob{
+		UserID:       upload.UserID,
+		CollectionID: upload.UserID,
+		Filename:     upload.Filename,
+		Title:        upload.Title,
+		Path:         path,
+		SHA256:       upload.SHA256,
+		Size:         upload.Length,
+		Tags:         upload.Tags,
+	})
+
+	if err != nil {
+		if status < http.StatusInternalServerError {
+			discard_upload(db_handle, settings, upload.ID)
+		}
+		return db.IngestionJob{}, status, err
+	}
+
+	if err := db.DeleteUpload(db_handle, upload.ID); err != nil {
+		slog.Error("Failed to remove completed upload", "upload", upload.ID, "error", err)
+	}
+
+	return job, status, nil
+}
+
+// StartUploadExpiry removes expired uploads now and then every uploadExpiryInterval.
+func StartUploadExpiry(db_handle *sql.DB, settings UploadSettings) {
+	expire_uploads(db_handle, settings)
+
+	go func() {
+		ticker := time.NewTicker(uploadExpiryInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			expire_uploads(db_handle, settings)
+		}
+	}()
+}
+
+// expire_uploads removes uploads idle for longer than the configured expiry, errors are only logged.
+//
+// Each upload is removed under its lock (see lock_upload), so a PATCH writing to it
+// is not cut off; uploads being written or that received data after they were
+// listed are kept.
+func expire_uploads(db_handle *sql.DB, settings UploadSettings) {
+	var before int64 = time.Now().Add(-settings.Expiry).UTC().Unix()
+
+	ids, err := db.GetExpiredUploads(db_handle, before)
+	if err != nil {
+		slog.Error("Failed to expire uploads", "error", err)
+		return
+	}
+
+	for _, id := range ids {
+		if !lock_upload(id) {
+			continue
+		}
+
+		err := db.DeleteExpiredUpload(db_handle, id, before)
+
+		if err == nil {
+			err = os.Remove(upload_file(settings, id))
+		}
+
+		if err != nil && !errors.Is(err, sql.ErrNoRows) && !errors.Is(err, os.ErrNotExist) {
+			slog.Error("Failed to remove expired upload", "upload", id, "error", err)
+		}
+
+		unlock_upload(id)
+	}
+}
+
+// discard_upload deletes an upload record and its partial file.
+func discard_upload(db_handle *sql.DB, settings UploadSettings, id string) error {
+	if err := db.DeleteUpload(db_handle, id); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	if err := os.Remove(upload_file(settings, id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// upload_file returns the path of the partial file of an upload. IDs are hex, so they are safe file names.
+func upload_file(settings UploadSettings, id string) string {
+	return filepath.Join(settings.Path, id)
+}
+
+// lock_upload marks an upload as being written, false if it already is.
+func lock_upload(id string) bool {
+	activeUploadMutex.Lock()
+	defer activeUploadMutex.Unlock()
+
+	if activeUploads[id] {
+		return false
+	}
+
+	activeUploads[id] = true
+	return true
+}
+
+// unlock_upload releases an upload locked by lock_upload.
+func unlock_upload(id string) {
+	activeUploadMutex.Lock()
+	defer activeUploadMutex.Unlock()
+	delete(activeUploads, id)
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"backend/db"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExpireUploadsRespectsLock(t *testing.T) {
+	db_handle, auth_result := openTestDatabase(t)
+
+	var settings UploadSettings = UploadSettings{Path: t.TempDir(), Expiry: time.Hour}
+
+	create := func(idle time.Duration) db.Upload {
+		upload, err := db.CreateUpload(db_handle, auth_result.ID, "contract.pdf", "Contract", 10, "checksum", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := db_handle.Exec(`UPDATE uploads SET updated_at = ? WHERE id = ?`, time.Now().Add(-idle).Unix(), upload.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(filepath.Join(settings.Path, upload.ID), []byte("partial"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		return upload
+	}
+
+	exists := func(upload db.Upload) bool {
+		_, err := db.GetUpload(db_handle, upload.ID, auth_result.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			t.Fatal(err)
+		}
+
+		_, stat_err := os.Stat(filepath.Join(settings.Path, upload.ID))
+		if (err == nil) != (stat_err == nil) {
+			t.Errorf("upload %s: record and partial file out of sync (%v, %v)", upload.ID, err, stat_err)
+		}
+
+		return err == nil
+	}
+
+	active := create(0)
+	idle := create(2 * time.Hour)
+	writing := create(2 * time.Hour)
+
+	if !lock_upload(writing.ID) {
+		t.Fatal("upload already locked")
+	}
+
+	expire_uploads(db_handle, settings)
+
+	if !exists(active) {
+		t.Error("active upload was removed")
+	}
+
+	if exists(idle) {
+		t.Error("idle upload was kept")
+	}
+
+	if !exists(writing) {
+		t.Error("upload was removed while being written")
+	}
+
+	unlock_upload(writing.ID)
+	expire_uploads(db_handle, settings)
+
+	if exists(writing) {
+		t.Error("idle upload was kept after it was unlocked")
+	}
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"backend/auth"
+	"backend/db"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// UserRoleRequest is the request body of UpdateUserRole.
+//
+//   - Email: Email of the user
+//   - Role:  One of db.ROLES
+type UserRoleRequest struct {
+	Email string
+	Role  string
+}
+
+// RolePermissionsRequest is the request body of UpdateRolePermissions.
+//
+//   - Role:        One of db.ROLES except db.ROLE_ADMIN
+//   - Permissions: Complete list of permissions the role grants (see db.PERMISSIONS)
+type RolePermissionsRequest struct {
+	Role        string
+	Permissions []string
+}
+
+// GetRoles lists every role with the permissions it grants (permission manage_users).
+//
+// Example Response:
+//
+//	[
+//	  {"Name": "admin", "Permissions": ["change_models", "edit_default_prompt", "manage_users", ...]},
+//	  {"Name": "premium", "Permissions": ["upload_documents", "upload_large_documents", "use_deep_think"]},
+//	  {"Name": "standard", "Permissions": ["upload_documents"]},
+//	  {"Name": "auditor", "Permissions": ["view_audit_log"]},
+//	  {"Name": "read-only", "Permissions": []}
+//	]
+func GetRoles(db_handle *sql.DB, w http.ResponseWriter, r *http.Request) {
+	roles, err := db.GetRoles(db_handle)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(roles)
+}
+
+// UpdateUserRole assigns a role to a user (permission manage_users).
+//
+// Expects a JSON payload with UserRoleRequest structure. The new permissions apply
+// to the next request of the user, permissions are read from the database on every
+// request. Callers can only assign roles whose permissions they hold themselves, so
+// manage_users alone does not allow handing out the admin role. The change is
+// recorded in the audit log (action "role.assign").
+//
+// Responses:
+//   - 200 OK: Role assigned
+//   - 400 Bad Request: Invalid JSON or unknown role
+//   - 403 Forbidden: The role grants permissions the caller does not hold
+//   - 404 Not Found: No user with this email
+//   - 409 Conflict: The user is the last administrator
+//   - 500 Internal Server Error: Database operation failed
+func UpdateUserRole(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	data, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var request UserRoleRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if !slices.Contains(db.ROLES, request.Role) {
+		http.Error(w, fmt.Sprintf("unknown role %q", request.Role), http.StatusBadRequest)
+		return
+	}
+
+	granted, err := db.GetRolePermissions(db_handle, request.Role)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if missing := missing_permissions(auth_result, granted); len(missing) > 0 {
+		http.Error(w, fmt.Sprintf("role %q grants permissions you do not hold: %s", request.Role, strings.Join(missing, ", ")), http.StatusForbidden)
+		return
+	}
+
+	user_id, previous, err := db.SetUserRole(db_handle, strings.TrimSpace(request.Email), request.Role)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "no user found with this email", http.StatusNotFound)
+		return
+	} else if errors.Is(err, db.ErrLastAdmin) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	detail := map[string]any{"UserID": user_id, "Previous": previous, "Role": request.Role}
+
+	if err := audit(auth_result, db_handle, r, "role.assign", fmt.Sprintf("user:%d", user_id), detail); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte{})
+}
+
+// UpdateRolePermissions replaces the permissions of a role (permission manage_users).
+//
+// Expects a JSON payload with RolePermissionsRequest structure. The admin role
+// always grants every permission and cannot be changed, so the administration
+// cannot lock itself out. Callers can only grant permissions they hold themselves,
+// see UpdateUserRole. The change is recorded in the audit log
+// (action "role.permissions").
+//
+// Responses:
+//   - 200 OK: JSON object of the changed role (see db.Role)
+//   - 400 Bad Request: Invalid JSON, unknown role or permission, or the admin role
+//   - 403 Forbidden: A permission the caller does not hold
+//   - 500 Internal Server Error: Database operation failed
+func UpdateRolePermissions(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	data, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var request RolePermissionsRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if !slices.Contains(db.ROLES, request.Role) {
+		http.Error(w, fmt.Sprintf("unknown role %q", request.Role), http.StatusBadRequest)
+		return
+	}
+
+	if request.Role == db.ROLE_ADMIN {
+		http.Error(w, "the admin role always grants every permission", http.StatusBadRequest)
+		return
+	}
+
+	for _, permission := range request.Permissions {
+		if !slices.Contains(db.PERMISSIONS, permission) {
+			http.Error(w, fmt.Sprintf("unknown permission %q", permission), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var permissions []string = slices.Compact(slices.Sorted(slices.Values(request.Permissions)))
+	if permissions == nil {
+		permissions = []string{}
+	}
+
+	if missing := missing_permissions(auth_result, permissions); len(missing) > 0 {
+		http.Error(w, fmt.Sprintf("cannot grant permissions you do not hold: %s", strings.Join(missing, ", ")), http.StatusForbidden)
+		return
+	}
+
+	if err := db.SetRolePermissions(db_handle, request.Role, permissions); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	role := db.Role{Name: request.Role, Permissions: permissions}
+
+	if err := audit(auth_result, db_handle, r, "role.permissions", "role:"+role.Name, role); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(role)
+}
+
+// missing_permissions returns the permissions the caller would hand out without holding them.
+func missing_permissions(auth_result auth.AuthorizationResult, permissions []string) []string {
+	var missing []string
+
+	for _, permission := range permissions {
+		if !auth_result.HasPermission(permission) {
+			missing = append(missing, permission)
+		}
+	}
+
+	return missing
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"backend/auth"
+	"backend/db"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func updateRole(handler func(auth.AuthorizationResult, *sql.DB, http.ResponseWriter, *http.Request), db_handle *sql.DB, auth_result auth.AuthorizationResult, payload any) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(payload)
+
+	recorder := httptest.NewRecorder()
+	handler(auth_result, db_handle, recorder, httptest.NewRequest(http.MethodPut, "/api/update/role", strings.NewReader(string(body))))
+	return recorder
+}
+
+func TestRoleChangesRequireHeldPermissions(t *testing.T) {
+	db_handle, admin := openTestDatabase(t)
+
+	for _, email := range []string{"manager@example.com", "standard@example.com"} {
+		if err := db.AddUser(db_handle, db.User{Name: email, Password: "hash", Email: email}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manager_id, _ := db.GetUserID(db_handle, "manager@example.com")
+	manager := auth.AuthorizationResult{ID: manager_id, Role: db.ROLE_STANDARD, Permissions: []string{db.PERMISSION_MANAGE_USERS, db.PERMISSION_UPLOAD_DOCUMENTS}}
+
+	if recorder := updateRole(UpdateUserRole, db_handle, manager, UserRoleRequest{Email: "standard@example.com", Role: db.ROLE_ADMIN}); recorder.Code != http.StatusForbidden {
+		t.Errorf("manager assigns admin: status %d, want 403", recorder.Code)
+	}
+
+	if recorder := updateRole(UpdateUserRole, db_handle, manager, UserRoleRequest{Email: "manager@example.com", Role: db.ROLE_ADMIN}); recorder.Code != http.StatusForbidden {
+		t.Errorf("manager promotes themselves: status %d, want 403", recorder.Code)
+	}
+
+	// Nor can the manager add the missing permissions to a role they can assign
+	if recorder := updateRole(UpdateRolePermissions, db_handle, manager, RolePermissionsRequest{Role: db.ROLE_STANDARD, Permissions: []string{db.PERMISSION_UPLOAD_DOCUMENTS, db.PERMISSION_VIEW_AUDIT_LOG}}); recorder.Code != http.StatusForbidden {
+		t.Errorf("manager grants view_audit_log: status %d, want 403", recorder.Code)
+	}
+
+	if recorder := updateRole(UpdateUserRole, db_handle, manager, UserRoleRequest{Email: "standard@example.com", Role: db.ROLE_STANDARD}); recorder.Code != http.StatusOK {
+		t.Errorf("manager assigns standard: status %d, %s", recorder.Code, recorder.Body.String())
+	}
+
+	if recorder := updateRole(UpdateUserRole, db_handle, admin, UserRoleRequest{Email: "standard@example.com", Role: db.ROLE_ADMIN}); recorder.Code != http.StatusOK {
+		t.Errorf("admin assigns admin: status %d, %s", recorder.Code, recorder.Body.String())
+	}
+
+	var admins int
+	if err := db_handle.QueryRow(`SELECT COUNT(*) FROM users WHERE role = ?`, db.ROLE_ADMIN).Scan(&admins); err != nil {
+		t.Fatal(err)
+	}
+
+	if admins != 2 {
+		t.Errorf("%d admins, want 2", admins)
+	}
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"backend/auth"
+	"backend/db"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ShareRequest is the request body of ShareDocument.
+//
+//   - StorageName: Document of the caller to share
+//   - Email:       Share with this user, or
+//   - TeamID:      share with every member of this team (the caller must belong to it)
+//   - Permission:  db.SHARE_READ (default) or db.SHARE_RETRIEVE
+type ShareRequest struct {
+	StorageName string
+	Email       string
+	TeamID      int64
+	Permission  string
+}
+
+// ShareDocument grants a user or a team access to a document of the authenticated user.
+//
+// Sharing a document again with the same grantee changes the permission of the
+// existing share. With db.SHARE_READ the document appears in the grantee's document
+// list and can be downloaded; db.SHARE_RETRIEVE additionally lets the ML pipeline
+// retrieve from it when answering the grantee. The grant is recorded in the audit
+// log (action "share.grant").
+//
+// Expects a JSON payload with ShareRequest structure.
+//
+// Responses:
+//   - 200 OK: JSON object of the share (see db.DocumentShare)
+//   - 400 Bad Request: Invalid JSON, permission, both or neither grantee given,
+//     or the caller named themselves
+//   - 404 Not Found: Document, user or team (of the caller) does not exist
+//   - 500 Internal Server Error: Database operation failed
+func ShareDocument(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	data, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var request ShareRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if request.Permission == "" {
+		request.Permission = db.SHARE_READ
+	}
+
+	if request.Permission != db.SHARE_READ && request.Permission != db.SHARE_RETRIEVE {
+		http.Error(w, `permission must be "read" or "retrieve"`, http.StatusBadRequest)
+		return
+	}
+
+	request.Email = strings.TrimSpace(request.Email)
+
+	if (request.Email == "") == (request.TeamID == 0) {
+		http.Error(w, "either Email or TeamID must be given", http.StatusBadRequest)
+		return
+	}
+
+	user_id, status, err := share_grantee(auth_result, db_handle, request)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	share, err := db.ShareDocument(db_handle, auth_result.ID, request.StorageName, user_id, request.TeamID, request.Permission)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "document not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := audit(auth_result, db_handle, r, "share.grant", share_target(share), share_audit(share)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(share)
+}
+
+// share_grantee resolves the user a document is shared with and checks the team.
+//
+// Returns:
+//   - int64: ID of the user, 0 for team shares
+//   - int: HTTP status to answer with if the error is not nil
+//   - error: Unknown user, own email, team the caller does not belong to or database failure
+func share_grantee(auth_result auth.AuthorizationResult, db_handle *sql.DB, request ShareRequest) (int64, int, error) {
+	if request.TeamID != 0 {
+		_, err := db.GetTeamRole(db_handle, request.TeamID, auth_result.ID)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, http.StatusNotFound, errors.New("team not found")
+		} else if err != nil {
+			return 0, http.StatusInternalServerError, err
+		}
+
+		return 0, http.StatusOK, nil
+	}
+
+	user_id, err := db.GetUserID(db_handle, request.Email)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, http.StatusNotFound, errors.New("no user found with this email")
+	} else if err != nil {
+		return 0, http.StatusInternalServerError, err
+	}
+
+	if user_id == auth_result.ID {
+		return 0, http.StatusBadRequest, errors.New("documents cannot be shared with their owner")
+	}
+
+	return user_id, http.StatusOK, nil
+}
+
+// GetDocumentShares lists the shares the authenticated user granted.
+//
+// Query parameter:
+//   - storage_name: Only list the shares of this document (optional)
+//
+// Example Response:
+//
+//	[
+//	  {
+//	    "ID": 4,
+//	    "StorageName": "1/9f86d0...",
+//	    "Title": "Ruling 2024",
+//	    "UserID": 0,
+//	    "UserEmail": "",
+//	    "TeamID": 2,
+//	    "TeamName": "Litigation",
+//	    "Permission": "retrieve",
+//	    "CreatedAt": 1760000000
+//	  }
+//	]
+func GetDocumentShares(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	shares, err := db.GetDocumentShares(db_handle, auth_result.ID, r.URL.Query().Get("storage_name"))
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(shares)
+}
+
+// RevokeDocumentShare removes a share granted by the authenticated user.
+//
+// Expects the share ID as plain text in the request body. The grantee loses
+// access immediately, including retrieval in later inference requests. The
+// revocation is recorded in the audit log (action "share.revoke").
+//
+// Responses:
+//   - 200 OK: Share revoked
+//   - 400 Bad Request: Invalid share ID
+//   - 404 Not Found: The caller granted no share with this ID
+//   - 500 Internal Server Error: Database operation failed
+func RevokeDocumentShare(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	data, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	share_id, err := strconv.ParseInt(strings.TrimSpace(string(data[:])), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid share id", http.StatusBadRequest)
+		return
+	}
+
+	share, err := db.RevokeDocumentShare(db_handle, auth_result.ID, share_id)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "share not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := audit(auth_result, db_handle, r, "share.revoke", share_target(share), share_audit(share)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte{})
+}
+
+// share_target is the audit target of a granted or revoked share.
+func share_target(share db.DocumentShare) string {
+	return fmt.Sprintf("share:%d", share.ID)
+}
+
+// share_audit is the audit detail of a granted or revoked share.
+func share_audit(share db.DocumentShare) map[string]any {
+	return map[string]any{
+		"ShareID":     share.ID,
+		"StorageName": share.StorageName,
+		"UserID":      share.UserID,
+		"TeamID":      share.TeamID,
+		"Permission":  share.Permission,
+	}
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"backend/auth"
+	"backend/db"
+	"backend/logging"
+	"backend/metrics"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// InferenceStream is the streaming variant of Inference using Server-Sent Events.
+//
+// Accepts the same request as Inference. Instead of waiting for the complete
+// answer, every chunk produced by the ML pipeline is relayed as soon as it arrives:
+//
+//	event: token
+//	data: {"response": "<next piece of text>", "done": false}
+//
+//	event: done
+//	data: {"response": "<full text>", "done": true, "model": ..., ...}
+//
+// The final "done" event carries the complete LLMResponse including any metadata
+// of the last chunk. If the pipeline fails after the stream has started, an
+// "error" event with a JSON string message is sent instead of "done". This
+// includes streams that end before a chunk with "done": true arrived, e.g. when
+// the pipeline crashes or the connection is cut: the text so far is incomplete
+// and must not be stored as the answer.
+//
+// Behavior:
+//   - Errors before the stream starts are answered with regular HTTP status codes,
+//     including 429 Too Many Requests for exhausted budgets or quotas
+//   - The upstream request is bound to the request context: when the client
+//     disconnects, the call to the ML pipeline is cancelled
+//   - Pipelines without streaming support answer with a single LLMResponse,
+//     which is relayed as one token event followed by the done event
+//   - Models of registered providers are streamed from the provider directly
+func InferenceStream(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	usage_settings UsageSettings,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	request, status, err := prepare_inference(auth_result, db_handle, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if !consume_inference(auth_result, db_handle, usage_settings, request.deep_think == "True", w) {
+		return
+	}
+
+	metrics.InferenceInFlight.Inc()
+	defer metrics.InferenceInFlight.Dec()
+
+	var ctx = r.Context()
+
+	if request.backend != nil {
+		stream_direct(auth_result, db_handle, request, w, flusher, r)
+		return
+	}
+
+	response, err := InferenceMessageStream(ctx, auth_result.ID, request.conversation_id, request.deep_think, request.data)
+
+	if err != nil {
+		if ctx.Err() != nil {
+			logging.FromContext(ctx).Info("Client disconnected before inference started", "user", auth_result.ID)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(response.Body)
+		http.Error(w, fmt.Sprintf("ML pipeline error: %s", string(body)), response.StatusCode)
+		return
+	}
+
+	start_stream(w, flusher)
+
+	var full LLMResponse
+	var complete bool = false
+	decoder := json.NewDecoder(response.Body)
+
+	// Without NDJSON the pipeline answered with a single, complete LLMResponse
+	var streamed bool = strings.HasPrefix(response.Header.Get("Content-Type"), "application/x-ndjson")
+
+	for {
+		var chunk LLMResponse
+		err := decoder.Decode(&chunk)
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				logging.FromContext(ctx).Info("Client disconnected, inference cancelled", "user", auth_result.ID)
+				return
+			}
+
+			write_event(w, flusher, "error", err.Error())
+			return
+		}
+
+		full.Response += chunk.Response
+
+		if chunk.Response != "" {
+			if err := write_event(w, flusher, "token", LLMResponse{Response: chunk.Response}); err != nil {
+				return
+			}
+		}
+
+		if chunk.Done || !streamed {
+			full.Model = chunk.Model
+			full.TotalDuration = chunk.TotalDuration
+			full.PromptEvalCount = chunk.PromptEvalCount
+			full.EvalCount = chunk.EvalCount
+			complete = true
+			break
+		}
+	}
+
+	if !complete {
+		logging.FromContext(ctx).Warn("ML pipeline ended the stream before the answer was complete", "user", auth_result.ID)
+		write_event(w, flusher, "error", "ML pipeline ended the stream before the answer was complete")
+		return
+	}
+
+	full.Done = true
+
+	if request.conversation_id != 0 {
+		db.TouchConversation(db_handle, request.conversation_id)
+	}
+
+	write_event(w, flusher, "done", full)
+}
+
+// stream_direct relays the answer of a registered provider as Server-Sent Events.
+//
+// Provider errors before the first chunk are answered with 502, later ones with an error event.
+func stream_direct(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	request inferenceRequest,
+	w http.ResponseWriter,
+	flusher http.Flusher,
+	r *http.Request,
+) {
+	var ctx = r.Context()
+	var started bool = false
+
+	answer, err := request.backend.Stream(ctx, request.chat, func(chunk string) error {
+		if !started {
+			start_stream(w, flusher)
+			started = true
+		}
+		return write_event(w, flusher, "token", LLMResponse{Response: chunk})
+	})
+
+	if err != nil {
+		if ctx.Err() != nil {
+			logging.FromContext(ctx).Info("Client disconnected, inference cancelled", "user", auth_result.ID)
+			return
+		}
+
+		if !started {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		write_event(w, flusher, "error", err.Error())
+		return
+	}
+
+	if !started {
+		start_stream(w, flusher)
+	}
+
+	if request.conversation_id != 0 {
+		db.TouchConversation(db_handle, request.conversation_id)
+	}
+
+	write_event(w, flusher, "done", llm_response(answer))
+}
+
+// start_stream writes the headers of an event stream.
+func start_stream(w http.ResponseWriter, flusher http.Flusher) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering (nginx)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+}
+
+// write_event writes a single Server-Sent Event with a JSON payload and flushes it to the client.
+func write_event(w http.ResponseWriter, flusher http.Flusher, event string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+
+	flusher.Flush()
+	return nil
+}
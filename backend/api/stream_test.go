@@ -0,0 +1,269 @@
+package api
+
+import (
+	"backend/auth"
+	"backend/db"
+	"backend/provider"
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openTestDatabase creates a migrated database in a temporary directory and
+// returns it with the authorization of its admin, "admin@example.com".
+func openTestDatabase(t *testing.T) (*sql.DB, auth.AuthorizationResult) {
+	t.Helper()
+
+	db_handle, err := db.SetupSqlite(filepath.Join(t.TempDir(), "test.db"), db.CreateAdmin("Admin", "Admin", "admin@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db_handle.Close() })
+
+	id, err := db.GetUserID(db_handle, "admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	permissions, err := db.GetRolePermissions(db_handle, db.ROLE_ADMIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db_handle, auth.AuthorizationResult{ID: id, IsAdmin: true, IsPremium: true, Role: db.ROLE_ADMIN, Permissions: permissions}
+}
+
+// Model selected for every user by useFakePipeline and listed by its fake Ollama.
+const testModel string = "test-model"
+
+// useFakePipeline points the pipeline and Ollama URLs at a test server for the duration of the test.
+//
+// The server lists testModel at Ollama's /api/tags, every other request goes to handler.
+func useFakePipeline(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/tags" {
+			fmt.Fprintf(w, `{"models": [{"name": %q}]}`, testModel)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	previous_pipeline, previous_ollama, previous_providers, previous_local := pipelineURL, ollamaURL, providers, builtinLocal
+	t.Cleanup(func() {
+		pipelineURL, ollamaURL, providers, builtinLocal = previous_pipeline, previous_ollama, previous_providers, previous_local
+	})
+
+	ConfigurePipeline(server.URL, server.URL, 5*time.Second)
+	builtinLocal = true
+	providers = provider.NewRegistry(builtin_provider(nil), 0)
+
+	db.InitModelSelection(testModel)
+	t.Cleanup(func() { db.InitModelSelection("") })
+
+	return server
+}
+
+type event struct {
+	name string
+	data string
+}
+
+// readEvents parses a Server-Sent Events stream.
+func readEvents(t *testing.T, body string) []event {
+	t.Helper()
+
+	var events []event
+	var current event
+
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			if current.name != "" {
+				events = append(events, current)
+			}
+			current = event{}
+		case strings.HasPrefix(line, "event: "):
+			current.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.data = strings.TrimPrefix(line, "data: ")
+		default:
+			t.Fatalf("unexpected line in event stream: %q", line)
+		}
+	}
+
+	return events
+}
+
+func inferenceStream(db_handle *sql.DB, auth_result auth.AuthorizationResult) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/api/message/inference/stream", strings.NewReader(`{"Kind": 1, "Message": "Hallo?"}`))
+	request.Header.Set("Deep_think", "False")
+
+	recorder := httptest.NewRecorder()
+	InferenceStream(auth_result, db_handle, UsageSettings{}, recorder, request)
+	return recorder
+}
+
+func TestInferenceStreamRelaysChunks(t *testing.T) {
+	db_handle, auth_result := openTestDatabase(t)
+
+	useFakePipeline(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != messageInference || r.Header.Get("Stream") != "True" || r.Header.Get("Accept") != "application/x-ndjson" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+
+		if r.Header.Get("ID") != fmt.Sprint(auth_result.ID) {
+			http.Error(w, "wrong ID header", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+
+		// Chunked: every line is flushed on its own
+		for _, line := range []string{
+			`{"response": "Hal", "done": false}`,
+			`{"response": "lo", "done": false}`,
+			`{"response": "", "done": true, "model": "test-model", "eval_count": 2}`,
+		} {
+			fmt.Fprintln(w, line)
+			w.(http.Flusher).Flush()
+		}
+	})
+
+	recorder := inferenceStream(db_handle, auth_result)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status %d, %s", recorder.Code, recorder.Body.String())
+	}
+
+	if content_type := recorder.Header().Get("Content-Type"); content_type != "text/event-stream" {
+		t.Errorf("Content-Type %q", content_type)
+	}
+
+	events := readEvents(t, recorder.Body.String())
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3: %+v", len(events), events)
+	}
+
+	for index, text := range []string{"Hal", "lo"} {
+		var chunk LLMResponse
+		if err := json.Unmarshal([]byte(events[index].data), &chunk); err != nil {
+			t.Fatal(err)
+		}
+
+		if events[index].name != "token" || chunk.Response != text || chunk.Done {
+			t.Errorf("event %d: %s %+v, want token %q", index, events[index].name, chunk, text)
+		}
+	}
+
+	var done LLMResponse
+	if err := json.Unmarshal([]byte(events[2].data), &done); err != nil {
+		t.Fatal(err)
+	}
+
+	if events[2].name != "done" || done.Response != "Hallo" || !done.Done || done.Model != "test-model" || done.EvalCount != 2 {
+		t.Errorf("last event: %s %+v", events[2].name, done)
+	}
+}
+
+func TestInferenceStreamReportsBrokenStream(t *testing.T) {
+	db_handle, auth_result := openTestDatabase(t)
+
+	useFakePipeline(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprintln(w, `{"response": "Hal", "done": false}`)
+		w.(http.Flusher).Flush()
+
+		// The connection ends in the middle of a chunk
+		fmt.Fprint(w, `{"response": "l`)
+	})
+
+	recorder := inferenceStream(db_handle, auth_result)
+
+	events := readEvents(t, recorder.Body.String())
+	if len(events) != 2 || events[0].name != "token" || events[1].name != "error" {
+		t.Fatalf("got %+v, want a token and an error event", events)
+	}
+}
+
+func TestInferenceStreamReportsTruncatedStream(t *testing.T) {
+	db_handle, auth_result := openTestDatabase(t)
+
+	for name, end := range map[string]func(w http.ResponseWriter){
+		// The pipeline finishes the response without a done chunk, e.g. after a crash of the model
+		"closed": func(w http.ResponseWriter) {},
+		// The connection is cut between two chunks
+		"cut": func(w http.ResponseWriter) {
+			connection, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				connection.Close()
+			}
+		},
+	} {
+		useFakePipeline(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			fmt.Fprintln(w, `{"response": "Hal", "done": false}`)
+			w.(http.Flusher).Flush()
+			end(w)
+		})
+
+		recorder := inferenceStream(db_handle, auth_result)
+
+		events := readEvents(t, recorder.Body.String())
+		if len(events) != 2 || events[0].name != "token" || events[1].name != "error" {
+			t.Errorf("%s: got %+v, want a token and an error event", name, events)
+		}
+	}
+}
+
+func TestInferenceStreamAcceptsBufferedPipeline(t *testing.T) {
+	db_handle, auth_result := openTestDatabase(t)
+
+	useFakePipeline(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"response": "Hallo"}`)
+	})
+
+	recorder := inferenceStream(db_handle, auth_result)
+
+	events := readEvents(t, recorder.Body.String())
+	if len(events) != 2 || events[0].name != "token" || events[1].name != "done" {
+		t.Fatalf("got %+v, want a token and a done event", events)
+	}
+
+	var done LLMResponse
+	if err := json.Unmarshal([]byte(events[1].data), &done); err != nil {
+		t.Fatal(err)
+	}
+
+	if done.Response != "Hallo" || !done.Done {
+		t.Errorf("done event %+v", done)
+	}
+}
+
+func TestInferenceStreamForwardsPipelineErrors(t *testing.T) {
+	db_handle, auth_result := openTestDatabase(t)
+
+	useFakePipeline(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model not found", http.StatusNotFound)
+	})
+
+	recorder := inferenceStream(db_handle, auth_result)
+
+	if recorder.Code != http.StatusNotFound || !strings.Contains(recorder.Body.String(), "model not found") {
+		t.Errorf("status %d, %q", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,351 @@
+package api
+
+import (
+	"backend/auth"
+	"backend/db"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Upper bound of team name length in characters.
+const MAX_TEAM_NAME_LENGTH int = 100
+
+// TeamMemberRequest is the request body of AddTeamMember and RemoveTeamMember.
+//
+//   - TeamID: Team to change
+//   - Email:  Email of the user to add or remove
+//   - Role:   db.TEAM_OWNER or db.TEAM_MEMBER (default), ignored by RemoveTeamMember
+type TeamMemberRequest struct {
+	TeamID int64
+	Email  string
+	Role   string
+}
+
+// CreateTeam creates a team with the authenticated user as its owner.
+//
+// Expects the team name as plain text in the request body. The creation is
+// recorded in the audit log (action "team.create").
+//
+// Responses:
+//   - 200 OK: JSON object of the created team (see db.Team)
+//   - 400 Bad Request: Body cannot be read, empty or too long name
+//   - 409 Conflict: A team with the name exists
+//   - 500 Internal Server Error: Database operation failed
+func CreateTeam(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	data, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var name string = strings.TrimSpace(string(data[:]))
+
+	if name == "" || utf8.RuneCountInString(name) > MAX_TEAM_NAME_LENGTH {
+		http.Error(w, fmt.Sprintf("team name must have 1 to %d characters", MAX_TEAM_NAME_LENGTH), http.StatusBadRequest)
+		return
+	}
+
+	team, err := db.AddTeam(db_handle, name, auth_result.ID)
+
+	if errors.Is(err, db.ErrTeamExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := audit(auth_result, db_handle, r, "team.create", fmt.Sprintf("team:%d", team.ID), map[string]any{"TeamID": team.ID, "Name": team.Name}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(team)
+}
+
+// GetTeams lists the teams of the authenticated user with their members.
+//
+// Example Response:
+//
+//	[
+//	  {
+//	    "ID": 1,
+//	    "Name": "Litigation",
+//	    "CreatedAt": 1760000000,
+//	    "Role": "owner",
+//	    "Members": [
+//	      {"UserID": 1, "Name": "Admin", "Email": "admin@example.com", "Role": "owner", "AddedAt": 1760000000}
+//	    ]
+//	  }
+//	]
+func GetTeams(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	teams, err := db.GetTeams(db_handle, auth_result.ID)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(teams)
+}
+
+// AddTeamMember adds a user to a team or changes the role of a member (team owners only).
+//
+// Expects a JSON payload with TeamMemberRequest structure. The change is recorded
+// in the audit log (action "team.member.add").
+//
+// Responses:
+//   - 200 OK: Member added or role changed
+//   - 400 Bad Request: Invalid JSON or role
+//   - 403 Forbidden: The caller is no owner of the team
+//   - 404 Not Found: Team (of the caller) or user does not exist
+//   - 409 Conflict: The last owner would be demoted
+//   - 500 Internal Server Error: Database operation failed
+func AddTeamMember(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	request, status, err := team_member_request(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if request.Role == "" {
+		request.Role = db.TEAM_MEMBER
+	}
+
+	if request.Role != db.TEAM_OWNER && request.Role != db.TEAM_MEMBER {
+		http.Error(w, `role must be "owner" or "member"`, http.StatusBadRequest)
+		return
+	}
+
+	if status, err := require_team_owner(auth_result, db_handle, request.TeamID); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	user_id, err := db.GetUserID(db_handle, request.Email)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "no user found with this email", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = db.SetTeamMember(db_handle, request.TeamID, user_id, request.Role)
+
+	if errors.Is(err, db.ErrLastOwner) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	detail := map[string]any{"TeamID": request.TeamID, "UserID": user_id, "Role": request.Role}
+
+	if err := audit(auth_result, db_handle, r, "team.member.add", fmt.Sprintf("team:%d", request.TeamID), detail); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte{})
+}
+
+// RemoveTeamMember removes a user from a team.
+//
+// Owners may remove any member, other members only themselves (leaving the team).
+// Documents shared with the team are no longer accessible to the removed user.
+// The change is recorded in the audit log (action "team.member.remove").
+//
+// Expects a JSON payload with TeamMemberRequest structure.
+//
+// Responses:
+//   - 200 OK: Member removed
+//   - 400 Bad Request: Invalid JSON
+//   - 403 Forbidden: The caller is no owner and tried to remove someone else
+//   - 404 Not Found: Team (of the caller), user or membership does not exist
+//   - 409 Conflict: The user is the last owner of the team
+//   - 500 Internal Server Error: Database operation failed
+func RemoveTeamMember(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	request, status, err := team_member_request(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	user_id, err := db.GetUserID(db_handle, request.Email)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "no user found with this email", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if user_id != auth_result.ID {
+		if status, err := require_team_owner(auth_result, db_handle, request.TeamID); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+
+	err = db.RemoveTeamMember(db_handle, request.TeamID, user_id)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "user is no member of the team", http.StatusNotFound)
+		return
+	} else if errors.Is(err, db.ErrLastOwner) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	detail := map[string]any{"TeamID": request.TeamID, "UserID": user_id}
+
+	if err := audit(auth_result, db_handle, r, "team.member.remove", fmt.Sprintf("team:%d", request.TeamID), detail); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte{})
+}
+
+// DeleteTeam deletes a team with its memberships and all document shares with it (team owners only).
+//
+// Expects the team ID as plain text in the request body. The deletion is
+// recorded in the audit log (action "team.delete").
+//
+// Responses:
+//   - 200 OK: Team deleted
+//   - 400 Bad Request: Invalid team ID
+//   - 403 Forbidden: The caller is no owner of the team
+//   - 404 Not Found: Team (of the caller) does not exist
+//   - 500 Internal Server Error: Database operation failed
+func DeleteTeam(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	data, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	team_id, err := strconv.ParseInt(strings.TrimSpace(string(data[:])), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid team id", http.StatusBadRequest)
+		return
+	}
+
+	if status, err := require_team_owner(auth_result, db_handle, team_id); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	err = db.DeleteTeam(db_handle, team_id)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "team not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := audit(auth_result, db_handle, r, "team.delete", fmt.Sprintf("team:%d", team_id), map[string]int64{"TeamID": team_id}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte{})
+}
+
+// team_member_request reads the TeamMemberRequest body of a request.
+//
+// Returns:
+//   - int: HTTP status to answer with if the error is not nil
+func team_member_request(r *http.Request) (TeamMemberRequest, int, error) {
+	data, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		return TeamMemberRequest{}, http.StatusBadRequest, err
+	}
+
+	var request TeamMemberRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		return TeamMemberRequest{}, http.StatusBadRequest, fmt.Errorf("Invalid JSON: %v", err)
+	}
+
+	request.Email = strings.TrimSpace(request.Email)
+
+	return request, http.StatusOK, nil
+}
+
+// require_team_owner checks that the caller owns a team.
+//
+// Teams the caller does not belong to are reported as not found, so their IDs
+// do not reveal anything.
+//
+// Returns:
+//   - int: HTTP status to answer with if the error is not nil
+//   - error: Team not found, caller is no owner or database failure
+func require_team_owner(auth_result auth.AuthorizationResult, db_handle *sql.DB, team_id int64) (int, error) {
+	role, err := db.GetTeamRole(db_handle, team_id, auth_result.ID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusNotFound, errors.New("team not found")
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if role != db.TEAM_OWNER {
+		return http.StatusForbidden, errors.New("only team owners can do this")
+	}
+
+	return http.StatusOK, nil
+}
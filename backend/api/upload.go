@@ -3,7 +3,11 @@ package api
 import (
 	"backend/auth"
 	"backend/db"
+	"backend/document"
+	"backend/logging"
+	"backend/metrics"
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
@@ -11,134 +15,436 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"strconv"
+	"os"
 )
 
-const fileSizeLimit int64 = (1 << 20) * 200 // 200 MB
-
-// FileUpload handles document uploads with PDF validation and storage.
+// FileUpload accepts a document upload and queues it for processing.
 //
 // Requirements:
 //   - POST method only
 //   - X-Filename header must be present
 //   - Title header must be present
-//   - PDF file validation (signature and extension)
-//   - Maximum file size: 200MB
+//   - Optional Tags header: comma separated tags (see UpdateDocumentTags)
+//   - Supported format: PDF, Word (.docx), plain text (.txt, .md), HTML or email (.eml),
+//     with content matching the extension (see package document)
+//   - Maximum file size: file_size_limit bytes (config file_size_limit, default 200MB),
+//     large_upload_size bytes (default 20MB) for roles without the upload_large_documents permission
 //
 // Process flow:
-//  1. Validates headers and file type
-//  2. Generates unique storage name
-//  3. Uploads to document service
-//  4. Records metadata in database
+//  1. Validates headers
+//  2. Spools the body to upload_path while computing its SHA-256, checks that
+//     the beginning of the file matches the format of the extension
+//  3. Rejects content the user has already uploaded
+//  4. Queues an ingestion job and answers at once
+//
+// A worker then links content another upload already processed, or validates the
+// format, extracts the text of formats other than PDF and uploads to the document
+// service, and finally records the document. Its progress is reported by
+// GetDocumentStatus.
 //
 // Responses:
-//   - 200 OK: Upload successful
-//   - 400 Bad Request: Invalid headers, file type, or size
-//   - 500 Internal ServerError: Upload or database failure
+//   - 202 Accepted: Upload queued, JSON IngestionStatus, Location header of the status
+//   - 400 Bad Request: Invalid headers, content not matching the extension or interrupted body
+//   - 409 Conflict: The same content was already uploaded, body "already uploaded as <name>"
+//   - 413 Request Entity Too Large: File exceeds the maximum file size
+//   - 415 Unsupported Media Type: File extension of an unsupported format
+//   - 500 Internal ServerError: Storage or database failure
 //
 // Security:
-//   - Requires valid authentication
-//   - Uses SHA-256 hashed storage names
-func FileUpload(db_handle *sql.DB, auth_result auth.AuthorizationResult, w http.ResponseWriter, r *http.Request) {
+//   - Requires valid authentication and the upload_documents permission
+//   - Storage names are derived from the SHA-256 of the content
+func FileUpload(
+	db_handle *sql.DB,
+	auth_result auth.AuthorizationResult,
+	settings UploadSettings,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	job, ok := receive_document(db_handle, auth_result.ID, auth_result.ID, user_upload_settings(auth_result, settings), w, r)
+	if !ok {
+		return
+	}
+
+	accept_job(w, job)
+}
+
+// user_upload_settings applies the upload limit of the caller's role.
+//
+// Roles without the upload_large_documents permission may only upload up to
+// LargeUploadSize bytes.
+func user_upload_settings(auth_result auth.AuthorizationResult, settings UploadSettings) UploadSettings {
+	if !auth_result.HasPermission(db.PERMISSION_UPLOAD_LARGE_DOCUMENTS) {
+		settings.FileSizeLimit = min(settings.FileSizeLimit, settings.LargeUploadSize)
+	}
+
+	return settings
+}
+
+// receive_document spools an uploaded document and queues it for ingestion.
+//
+// Implements steps 1-4 of FileUpload. On failure the error response is already
+// written and ok is false.
+//
+// Parameters:
+//   - collection_id: ID the document is filed under in the ML pipeline (user ID or LEGAL_LIBRARY_COLLECTION)
+//   - user_id: Uploader, owner of the job
+//   - settings: Spool directory (Path) and maximum accepted body size (FileSizeLimit)
+//
+// Returns:
+//   - db.IngestionJob: The queued job
+//   - ok: Whether the document was queued
+func receive_document(
+	db_handle *sql.DB,
+	collection_id int64,
+	user_id int64,
+	settings UploadSettings,
+	w http.ResponseWriter,
+	r *http.Request,
+) (job db.IngestionJob, ok bool) {
 	// 1. Validate request headers
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	filename := r.Header.Get("X-Filename")
+	var filename string = r.Header.Get("X-Filename")
 	if filename == "" {
 		http.Error(w, "Missing X-Filename header", http.StatusBadRequest)
 		return
 	}
 
-	title := r.Header.Get("Title")
+	var title string = r.Header.Get("Title")
 	if title == "" {
 		http.Error(w, "Missing Title header", http.StatusBadRequest)
 		return
 	}
 
-	// 2. Limit and read body
-	r.Body = http.MaxBytesReader(w, r.Body, fileSizeLimit)
-	data, err := io.ReadAll(r.Body)
+	format, err := document.Lookup(filename)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
 		return
 	}
-	defer r.Body.Close()
 
-	// 3. Validate PDF
-	if err := validate_legal_pdf(filename, data); err != nil {
+	tags, err := header_tags(r)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// 4. Process upload
-	storage_name := create_storage_name(auth_result.ID, filename)
-	response, err := UploadDocument(auth_result.ID, title, storage_name, data)
+	// 2. Spool the limited body, the hash is needed before anything is sent
+	r.Body = http.MaxBytesReader(w, r.Body, settings.FileSizeLimit)
+	defer r.Body.Close()
+
+	file, checksum, size, err := spool_body(settings.Path, r.Body)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Upload failed: %v", err), http.StatusInternalServerError)
+		http.Error(w, err.Error(), body_error_status(err, http.StatusBadRequest))
 		return
 	}
-	defer response.Body.Close() // Always close the response body
 
-	// 5. Check response status
-	if response.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(response.Body) // Read error response if available
-		http.Error(w, fmt.Sprintf("ML pipeline error: %s", string(body)), response.StatusCode)
+	if collection_id == LEGAL_LIBRARY_COLLECTION {
+		metrics.UploadBytes.Add(float64(size), "library")
+	} else {
+		metrics.UploadBytes.Add(float64(size), "document")
+	}
+
+	// Reject content not matching the extension now, the worker validates the whole file
+	head := make([]byte, document.SNIFF_LENGTH)
+	read, _ := io.ReadFull(file, head)
+	file.Close()
+
+	if err := format.CheckHead(head[:read]); err != nil {
+		os.Remove(file.Name())
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// 6. Store in database
-	if err := db.AddDocument(db_handle, auth_result.ID, filename, storage_name); err != nil {
-		http.Error(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
+	// 3.-4. Reject duplicates and queue
+	job, status, err := enqueue_document(db_handle, settings, db.IngestionJob{
+		UserID:       user_id,
+		CollectionID: collection_id,
+		Filename:     filename,
+		Title:        title,
+		Path:         file.Name(),
+		SHA256:       checksum,
+		Size:         size,
+		Tags:         tags,
+	})
+
+	if err != nil {
+		os.Remove(file.Name())
+		http.Error(w, err.Error(), status)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Upload successful"))
+	return job, true
 }
 
-// validate_legal_pdf checks if a file is a valid PDF document.
+// spool_body writes body to a new file in directory while hashing it.
+//
+// Returns:
+//   - *os.File: The file, positioned at its start; the caller closes and eventually removes it
+//   - string: Hex encoded SHA-256 of the content
+//   - int64: Content length in bytes
+//   - error: Body read failure (possibly *http.MaxBytesError) or file system error
+func spool_body(directory string, body io.Reader) (*os.File, string, int64, error) {
+	if err := os.MkdirAll(directory, 0o700); err != nil {
+		return nil, "", 0, err
+	}
+
+	file, err := os.CreateTemp(directory, "spool-*")
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), body)
+
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, "", 0, fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	return file, hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// store_document hands a document with known content hash to the ML pipeline (run by the ingestion workers).
+//
+// Content already filed under collection_id is rejected. Content another user or
+// the legal library already uploaded is linked: the pipeline copies the processed
+// chunks instead of embedding the document again. If linking fails the document
+// is processed as usual by forward_document.
 //
 // Parameters:
-//   - filename: Original file name (checks extension)
-//   - data: File content (checks header signature)
+//   - collection_id: ID the document is filed under in the ML pipeline
+//   - filename, title: Original file name (selects the format) and document title
+//   - body: Document content, must be at its start
+//   - length: Size of the document in bytes
+//   - checksum: Hex encoded SHA-256 of the content
 //
 // Returns:
-//   - error: Validation failure reason
+//   - string: Identifier of the document in the ML pipeline
+//   - int: HTTP status classifying the error, below 500 if a retry cannot succeed
+//   - error: Duplicate, unsupported or invalid document, pipeline or database error
+func store_document(
+	ctx context.Context,
+	db_handle *sql.DB,
+	collection_id int64,
+	filename string,
+	title string,
+	body io.ReadSeeker,
+	length int64,
+	checksum string,
+) (string, int, error) {
+	// Reject duplicates of the collection, an identical upload may have been processed meanwhile
+	duplicate, err := find_duplicate(db_handle, collection_id, checksum)
+	if err == nil {
+		return "", http.StatusConflict, fmt.Errorf("already uploaded as %q", duplicate)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return "", http.StatusInternalServerError, fmt.Errorf("database error: %w", err)
+	}
+
+	var storage_name string = create_storage_name(collection_id, checksum)
+
+	// Link content the pipeline has already processed
+	source, err := db.GetBlobSource(db_handle, checksum)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", http.StatusInternalServerError, fmt.Errorf("database error: %w", err)
+	}
+
+	if err == nil {
+		if status, err := link_document(ctx, collection_id, filename, title, storage_name, source, body); err == nil {
+			return storage_name, http.StatusOK, nil
+		} else if status != http.StatusNotFound {
+			return "", status, err
+		} else {
+			logging.FromContext(ctx).Warn("Linking document failed, uploading it", "storage_name", storage_name, "source", source, "error", err)
+		}
+
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return "", http.StatusInternalServerError, err
+		}
+	}
+
+	if status, err := forward_document(ctx, collection_id, storage_name, filename, title, body, length); err != nil {
+		return "", status, err
+	}
+
+	return storage_name, http.StatusOK, nil
+}
+
+// find_duplicate returns the original name of the document with the given content in a collection.
 //
-// Validation rules:
-//   - Must have .pdf extension
-//   - Must start with %PDF-1. or %PDF-2. signature
-func validate_legal_pdf(filename string, data []byte) error {
-	if filename[len(filename)-4:] != ".pdf" {
-		return errors.New("detected unsupported file format")
+// Returns:
+//   - error: sql.ErrNoRows if the collection has no such document
+func find_duplicate(db_handle *sql.DB, collection_id int64, checksum string) (string, error) {
+	if collection_id == LEGAL_LIBRARY_COLLECTION {
+		document, err := db.GetLibraryDocumentByHash(db_handle, checksum)
+		return document.OriginalName, err
 	}
-	if !(bytes.HasPrefix(data, []byte("%PDF-1.")) || bytes.HasPrefix(data, []byte("%PDF-2."))) {
-		return errors.New("invalid signature")
+
+	document, err := db.GetDocumentByHash(db_handle, collection_id, checksum)
+	return document.OriginalName, err
+}
+
+// link_document validates the format of a document and asks the pipeline to copy source.
+//
+// The content has been accepted before, but possibly under another extension, so
+// the head is checked against the format of filename.
+//
+// Returns:
+//   - int: HTTP status to answer with if the error is not nil, 404 if the pipeline
+//     does not know source
+//   - error: Invalid document or pipeline error
+func link_document(
+	ctx context.Context,
+	collection_id int64,
+	filename string,
+	title string,
+	storage_name string,
+	source string,
+	body io.Reader,
+) (int, error) {
+	format, err := document.Lookup(filename)
+	if err != nil {
+		return http.StatusUnsupportedMediaType, err
 	}
 
-	return nil
+	head := make([]byte, document.SNIFF_LENGTH)
+	read, err := io.ReadFull(body, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return http.StatusInternalServerError, err
+	}
+
+	if err := format.CheckHead(head[:read]); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	response, err := LinkDocument(ctx, collection_id, title, storage_name, source)
+	if err != nil {
+		return http.StatusNotFound, err // Fall back to processing the document
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(response.Body)
+		return http.StatusNotFound, fmt.Errorf("ML pipeline error: %s", string(message))
+	}
+
+	return http.StatusOK, nil
 }
 
-// create_storage_name generates a unique storage identifier for documents.
+// forward_document validates a document and sends it to the ML pipeline.
+//
+// PDFs are validated on their first document.SNIFF_LENGTH bytes and streamed to
+// the pipeline as they are read from body. Other formats need the complete file
+// for text extraction and are read into memory; only their text is sent.
 //
 // Parameters:
-//   - id: User ID (prefix)
-//   - name: Original filename (used in hash)
+//   - collection_id: ID the document is filed under in the ML pipeline
+//   - storage_name: Identifier of the document in the ML pipeline
+//   - filename, title: Original file name (selects the format) and document title
+//   - body: Document content
+//   - length: Size of the document in bytes, -1 if unknown
 //
 // Returns:
-//   - string: Unique name format "userID/sha256hash"
+//   - int: HTTP status to answer with if the error is not nil
+//   - error: Unsupported, invalid or oversized (document.ErrTooLarge) document,
+//     body read failure or pipeline error
+func forward_document(
+	ctx context.Context,
+	collection_id int64,
+	storage_name string,
+	filename string,
+	title string,
+	body io.Reader,
+	length int64,
+) (int, error) {
+	format, err := document.Lookup(filename)
+	if err != nil {
+		return http.StatusUnsupportedMediaType, err
+	}
+
+	head := make([]byte, document.SNIFF_LENGTH)
+	read, err := io.ReadFull(body, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return body_error_status(err, http.StatusBadRequest), fmt.Errorf("failed to read request body: %w", err)
+	}
+	head = head[:read]
+
+	// PDFs are parsed by the pipeline, other formats are sent as text
+	var response *http.Response
+
+	if format.Extract == nil {
+		if err := format.Check(head); err != nil {
+			return http.StatusBadRequest, err
+		}
+
+		response, err = UploadDocument(ctx, collection_id, title, storage_name, io.MultiReader(bytes.NewReader(head), body), length)
+		if err != nil {
+			return body_error_status(err, http.StatusInternalServerError), fmt.Errorf("upload failed: %w", err)
+		}
+	} else {
+		rest, err := io.ReadAll(body)
+		if err != nil {
+			return body_error_status(err, http.StatusBadRequest), fmt.Errorf("failed to read request body: %w", err)
+		}
+
+		data := append(head, rest...)
+		if err := format.Check(data); err != nil {
+			return http.StatusBadRequest, err
+		}
+
+		text, err := format.Extract(data)
+		if errors.Is(err, document.ErrTooLarge) {
+			return http.StatusRequestEntityTooLarge, err
+		} else if err != nil {
+			return http.StatusBadRequest, fmt.Errorf("failed to extract text: %w", err)
+		}
+
+		if text == "" {
+			return http.StatusBadRequest, errors.New("document contains no text")
+		}
+
+		response, err = UploadDocumentText(ctx, collection_id, title, storage_name, text)
+		if err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("upload failed: %w", err)
+		}
+	}
+	defer response.Body.Close() // Always close the response body
+
+	// Check response status
+	if response.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(response.Body) // Read error response if available
+		return response.StatusCode, fmt.Errorf("ML pipeline error: %s", string(message))
+	}
+
+	return http.StatusOK, nil
+}
+
+// body_error_status returns 413 if err was caused by exceeding the upload size limit, else fallback.
+func body_error_status(err error, fallback int) int {
+	var too_large *http.MaxBytesError
+	if errors.As(err, &too_large) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return fallback
+}
+
+// create_storage_name generates the storage identifier of a document.
 //
-// Security:
-//   - Uses SHA-256 hashing of userID+filename
-//   - Returns hex-encoded string
-func create_storage_name(id int64, name string) string {
-	var int_str string = strconv.FormatInt(id, 10)
-	var hashed_name [32]byte = sha256.Sum256([]byte(int_str + name))
-	var hashed_name_str string = hex.EncodeToString(hashed_name[:])
-	return fmt.Sprintf("%s/%s", int_str, hashed_name_str)
+// Parameters:
+//   - id: Collection ID (prefix), user ID or LEGAL_LIBRARY_COLLECTION
+//   - checksum: Hex encoded SHA-256 of the content
+//
+// Returns:
+//   - string: Name format "ID/sha256", unique per collection since duplicates are rejected
+func create_storage_name(id int64, checksum string) string {
+	return fmt.Sprintf("%d/%s", id, checksum)
 }
 
 // MessageUpload handles message submission to processing pipeline.
@@ -156,7 +462,13 @@ func create_storage_name(id int64, name string) string {
 // Note:
 //   - Propagates errors from processing pipeline
 //   - Requires valid authentication
-func MessageUpload(auth_result auth.AuthorizationResult, w http.ResponseWriter, r *http.Request) {
+//   - The optional "Conversation" header selects the conversation (404 if not owned)
+func MessageUpload(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
 	data, err := io.ReadAll(r.Body)
 	defer r.Body.Close()
 
@@ -165,7 +477,14 @@ func MessageUpload(auth_result auth.AuthorizationResult, w http.ResponseWriter,
 		return
 	}
 
-	response, err := UploadMessage(auth_result.ID, data)
+	conversation_id, status, err := requested_conversation(auth_result, db_handle, r)
+
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	response, err := UploadMessage(r.Context(), auth_result.ID, conversation_id, data)
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -180,6 +499,10 @@ func MessageUpload(auth_result auth.AuthorizationResult, w http.ResponseWriter,
 		return
 	}
 
+	if conversation_id != 0 {
+		db.TouchConversation(db_handle, conversation_id)
+	}
+
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Success"))
 }
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"backend/auth"
+	"backend/db"
+	"backend/ratelimit"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// UsageSettings configures the budgets and quotas of inference requests.
+//
+//   - Limits:       Rate limits, Limits.DeepThink is taken by deep think requests
+//   - Quota:        Daily and monthly inference requests of users without premium status
+//   - PremiumQuota: Daily and monthly inference requests of premium users (and admins)
+type UsageSettings struct {
+	Limits       ratelimit.Limits
+	Quota        db.Quota
+	PremiumQuota db.Quota
+}
+
+// UserUsage is the response of GetUsage.
+//
+//   - Email:      The user
+//   - Role:       Role of the user
+//   - Quota:      Quota applying to the user, 0 meaning unlimited
+//   - Usage:      Requests today and this month (UTC) per kind
+//   - RateLimits: Current token buckets of the user per budget
+type UserUsage struct {
+	Email      string
+	Role       string
+	Quota      db.Quota
+	Usage      []db.Usage
+	RateLimits []ratelimit.BucketState
+}
+
+// user_quota selects the quota of a user by premium status; admins get the premium quota.
+func user_quota(is_premium bool, is_admin bool, settings UsageSettings) db.Quota {
+	if is_premium || is_admin {
+		return settings.PremiumQuota
+	}
+	return settings.Quota
+}
+
+// consume_inference counts an inference request against the deep think budget and the quota.
+//
+// Deep think requests take a token of the deep think budget in addition to the
+// inference budget checked by the router, and count as inference requests.
+// On failure the error response is already written and ok is false.
+//
+// Responses:
+//   - 429 Too Many Requests: Deep think budget or quota used up, Retry-After header set
+//     (for quotas the start of the next day or month, UTC)
+//   - 500 Internal Server Error: Database failure
+func consume_inference(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	settings UsageSettings,
+	deep_think bool,
+	w http.ResponseWriter,
+) (ok bool) {
+	if deep_think {
+		allowed, retry_after := settings.Limits.DeepThink.Allow(ratelimit.UserKey(auth_result.ID))
+
+		if !allowed {
+			ratelimit.Refuse(w, retry_after, "deep think rate limit exceeded")
+			return false
+		}
+	}
+
+	var now time.Time = time.Now().UTC()
+
+	err := db.ConsumeQuota(db_handle, auth_result.ID, db.USAGE_INFERENCE, user_quota(auth_result.IsPremium, auth_result.IsAdmin, settings), now)
+
+	if errors.Is(err, db.ErrDailyQuota) {
+		var tomorrow time.Time = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		ratelimit.Refuse(w, tomorrow.Sub(now), err.Error())
+		return false
+	} else if errors.Is(err, db.ErrMonthlyQuota) {
+		var next_month time.Time = time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		ratelimit.Refuse(w, next_month.Sub(now), err.Error())
+		return false
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	if deep_think {
+		if err := db.ConsumeQuota(db_handle, auth_result.ID, db.USAGE_DEEP_THINK, db.Quota{}, now); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return false
+		}
+	}
+
+	return true
+}
+
+// GetUsage shows the consumption of a user (permission manage_users).
+//
+// Query parameter:
+//   - email: The user
+//
+// Responses:
+//   - 200 OK: JSON object with UserUsage structure
+//   - 400 Bad Request: email missing
+//   - 404 Not Found: No user with this email
+//   - 500 Internal Server Error: Database operation failed
+//
+// Example Response:
+//
+//	{
+//	  "Email": "bob@example.com",
+//	  "Role": "standard",
+//	  "Quota": {"Daily": 200, "Monthly": 3000},
+//	  "Usage": [
+//	    {"Kind": "deep_think", "Day": 2, "Month": 9},
+//	    {"Kind": "inference", "Day": 14, "Month": 310}
+//	  ],
+//	  "RateLimits": [
+//	    {"Name": "login", "Tokens": 10, "PerMinute": 10},
+//	    {"Name": "inference", "Tokens": 17, "PerMinute": 20},
+//	    {"Name": "deep_think", "Tokens": 3, "PerMinute": 3},
+//	    {"Name": "upload", "Tokens": 10, "PerMinute": 10}
+//	  ]
+//	}
+//
+// The login budget is shown for the client address with the fewest attempts left
+// for the account, the others for the user.
+func GetUsage(db_handle *sql.DB, settings UsageSettings, w http.ResponseWriter, r *http.Request) {
+	var email string = strings.TrimSpace(r.URL.Query().Get("email"))
+
+	if email == "" {
+		http.Error(w, "email is required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := db.GetDataBaseUser(db_handle, email)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "no user found with this email", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	usage, err := db.GetUsage(db_handle, user.ID, time.Now())
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var user_key string = ratelimit.UserKey(user.ID)
+
+	rate_limits := []ratelimit.BucketState{
+		settings.Limits.Login.LowestState(ratelimit.LoginPrefix(email)),
+		settings.Limits.Inference.State(user_key),
+		settings.Limits.DeepThink.State(user_key),
+		settings.Limits.Upload.State(user_key),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(UserUsage{
+		Email:      user.Email,
+		Role:       user.Role,
+		Quota:      user_quota(user.IsPremium, user.IsAdmin, settings),
+		Usage:      usage,
+		RateLimits: rate_limits,
+	})
+}
+
+// ResetUsage clears the consumption of a user (permission manage_users).
+//
+// Expects the email of the user as plain text in the request body. The counters
+// of the current day and month are removed and every rate limit bucket of the
+// user, including the login attempts of the account from every address, is refilled. The reset is
+// recorded in the audit log (action "usage.reset").
+//
+// Responses:
+//   - 200 OK: Consumption reset
+//   - 400 Bad Request: Body cannot be read
+//   - 404 Not Found: No user with this email
+//   - 500 Internal Server Error: Database operation failed
+func ResetUsage(
+	auth_result auth.AuthorizationResult,
+	db_handle *sql.DB,
+	settings UsageSettings,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	data, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var email string = strings.TrimSpace(string(data[:]))
+
+	user, err := db.GetDataBaseUser(db_handle, email)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "no user found with this email", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := db.ResetUsage(db_handle, user.ID, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var user_key string = ratelimit.UserKey(user.ID)
+
+	settings.Limits.Login.ResetPrefix(ratelimit.LoginPrefix(email))
+	settings.Limits.Inference.Reset(user_key)
+	settings.Limits.DeepThink.Reset(user_key)
+	settings.Limits.Upload.Reset(user_key)
+
+	if err := audit(auth_result, db_handle, r, "usage.reset", fmt.Sprintf("user:%d", user.ID), map[string]int64{"UserID": user.ID}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte{})
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"backend/db"
+	"testing"
+)
+
+func TestUserQuota(t *testing.T) {
+	var settings UsageSettings = UsageSettings{
+		Quota:        db.Quota{Daily: 10, Monthly: 100},
+		PremiumQuota: db.Quota{Daily: 50, Monthly: 500},
+	}
+
+	for _, test := range []struct {
+		premium bool
+		admin   bool
+		want    db.Quota
+	}{
+		{false, false, settings.Quota},
+		{true, false, settings.PremiumQuota},
+		{false, true, settings.PremiumQuota},
+		{true, true, settings.PremiumQuota},
+	} {
+		if quota := user_quota(test.premium, test.admin, settings); quota != test.want {
+			t.Errorf("premium %v, admin %v: %+v, want %+v", test.premium, test.admin, quota, test.want)
+		}
+	}
+}
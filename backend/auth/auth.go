@@ -1,18 +1,27 @@
 package auth
 
 import (
-	"encoding/hex"
+	"backend/db"
+	"database/sql"
 	"errors"
+	"net"
+	"net/http"
+	"strings"
 	"time"
 )
 
-// Authorization verifies and validates a JWT token from the given hex-encoded string.
+// Authorization verifies and validates a signed JWT token from the Authorization header.
 //
-// Returns an AuthorizationResult with user metadata if successful. Possible error conditions:
-//   - Invalid hex encoding
+// An optional "Bearer " prefix is accepted. Returns an AuthorizationResult with
+// user metadata if successful. Possible error conditions:
 //   - Malformed JWT token
-//   - Expired token
+//   - Unknown signing key or unsupported algorithm
 //   - Invalid signature
+//   - Wrong issuer/audience, token not yet valid or expired
+//   - Unknown, expired or revoked session (logout, admin revocation, deleted user)
+//
+// The admin flag, the role and its permissions are taken from the database rather
+// than the token, so demoting a user or changing a role takes effect with the next request.
 //
 // Any error indicates the request is not authorized, suggesting either:
 //   - Expired session
@@ -20,27 +29,44 @@ import (
 //   - Invalid token format
 //
 // Returns:
-//   - AuthorizationResult: Contains user ID and admin status on success
+//   - AuthorizationResult: Contains user ID, admin status, role, permissions and session ID on success
 //   - error: Detailed authorization failure reason
-func Authorization(buffer_string string) (AuthorizationResult, error) {
-	buffer, err := hex.DecodeString(buffer_string)
+func Authorization(db_handle *sql.DB, buffer_string string) (AuthorizationResult, error) {
+	jwt, err := ParseJWTToken(strings.TrimPrefix(buffer_string, "Bearer "))
 
 	if err != nil {
 		return AuthorizationResult{IsAdmin: false, ID: 0}, err
 	}
 
-	jwt, err := JsonToJWTToken(buffer)
-	if err != nil {
+	session, err := db.GetSession(db_handle, jwt.SessionID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return AuthorizationResult{IsAdmin: false, ID: 0}, errors.New("session does not exist")
+	} else if err != nil {
 		return AuthorizationResult{IsAdmin: false, ID: 0}, err
 	}
 
-	if jwt.ExpirationTime < time.Now().Unix() {
-		return AuthorizationResult{IsAdmin: false, ID: 0}, errors.New("token is expired. Please refresh the browser")
+	if session.Revoked || session.UserID != jwt.ID {
+		return AuthorizationResult{IsAdmin: false, ID: 0}, errors.New("session has been revoked. Please log in again")
 	}
 
-	return AuthorizationResult{IsAdmin: jwt.IsAdmin, ID: jwt.ID}, nil
+	if session.ExpiresAt < time.Now().UTC().Unix() {
+		return AuthorizationResult{IsAdmin: false, ID: 0}, errors.New("session is expired. Please log in again")
+	}
+
+	return AuthorizationResult{
+		IsAdmin:     session.IsAdmin,
+		IsPremium:   session.IsPremium,
+		ID:          session.UserID,
+		SessionID:   session.ID,
+		Role:        session.Role,
+		Permissions: session.Permissions,
+	}, nil
 }
 
+// ErrNotAdmin is returned by AdminAuthorization for valid tokens of users without admin privileges.
+var ErrNotAdmin error = errors.New("admin privileges required")
+
 // AdminAuthorization performs authorization specifically requiring admin privileges.
 //
 // This wraps the standard Authorization check and adds an additional admin privilege
@@ -49,21 +75,32 @@ func Authorization(buffer_string string) (AuthorizationResult, error) {
 //   - The authenticated user has IsAdmin flag set
 //
 // Returns:
-//   - AuthorizationResult: User metadata if authorized as admin
-//   - error: nil (always returns nil error, check IsAdmin flag instead)
-//
-// Note: Unlike Authorization, this intentionally swallows errors to prevent
-// leaking information about authorization failures.
-func AdminAuthorization(buffer_string string) (AuthorizationResult, error) {
-	auth_result, err := Authorization(buffer_string)
+//   - AuthorizationResult: User metadata if authorized as admin, also returned
+//     with ErrNotAdmin so the refusal can be attributed to the caller
+//   - error: The Authorization error for invalid tokens, ErrNotAdmin for
+//     authenticated users without admin privileges
+func AdminAuthorization(db_handle *sql.DB, buffer_string string) (AuthorizationResult, error) {
+	auth_result, err := Authorization(db_handle, buffer_string)
 
 	if err != nil {
-		return AuthorizationResult{IsAdmin: false, ID: 0}, nil
+		return AuthorizationResult{IsAdmin: false, ID: 0}, err
+	}
+
+	if !auth_result.IsAdmin {
+		return auth_result, ErrNotAdmin
 	}
 
-	if auth_result.IsAdmin {
-		return auth_result, nil
-	} else {
-		return AuthorizationResult{IsAdmin: false, ID: 0}, nil
+	return auth_result, nil
+}
+
+// ClientAddress is the address of the client of a request, as used for rate limits and the audit log.
+//
+// The address of the TCP connection is used, forwarding headers are ignored
+// since they can be set by any client.
+func ClientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
 	}
+	return host
 }
@@ -1,43 +1,70 @@
 package auth
 
-import (
-	"encoding/json"
-)
+import "slices"
 
 type LoginCredentials struct {
 	Email    string
 	Password string
 }
 
+// LoginResponse is returned by Login.
+//
+// IsAdmin and IsPremium are kept for older clients, Role and Permissions
+// describe what the user may do (see db.ROLES and db.PERMISSIONS).
 type LoginResponse struct {
-	IsAdmin   bool
-	IsPremium bool
-	JWTToken  string
-	Username  string
+	IsAdmin      bool
+	IsPremium    bool
+	Role         string
+	Permissions  []string
+	JWTToken     string
+	RefreshToken string
+	Username     string
 }
 
+// JWTHeader is the JOSE header of a signed token.
+//
+//   - Algorithm is always "HS256"; any other value is rejected on verification.
+//   - Type is always "JWT".
+//   - KeyID names the signing key in the key ring, allowing keys to be rotated
+//     without invalidating tokens signed with a previous key.
+type JWTHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// JWTToken holds the claims carried by a session token.
+//
+// The registered claims (iss, aud, sub, iat, nbf, exp) follow RFC 7519,
+// all timestamps are Unix seconds. ID, IsAdmin, Role, Permissions and SessionID
+// are private claims and may only be trusted after the signature has been verified.
+// Role and Permissions tell clients what to offer; the server checks the current
+// role of the user on every request (see Authorization).
 type JWTToken struct {
-	ExpirationTime int64
-	ID             int64
-	IsAdmin        bool
+	Issuer         string   `json:"iss"`
+	Audience       string   `json:"aud"`
+	Subject        string   `json:"sub"`
+	IssuedAt       int64    `json:"iat"`
+	NotBefore      int64    `json:"nbf"`
+	ExpirationTime int64    `json:"exp"`
+	ID             int64    `json:"uid"`
+	IsAdmin        bool     `json:"adm"`
+	Role           string   `json:"rol"`
+	Permissions    []string `json:"prm"`
+	SessionID      string   `json:"sid"`
 }
 
 // Returns the authorization data
 type AuthorizationResult struct {
-	IsAdmin bool
-	ID      int64
+	IsAdmin     bool
+	IsPremium   bool
+	ID          int64
+	SessionID   string
+	Role        string
+	Permissions []string
 }
 
-func (jwt JWTToken) JWTTokenToJson() ([]byte, error) {
-	return json.Marshal(jwt)
-}
-
-func JsonToJWTToken(buffer []byte) (JWTToken, error) {
-	var data JWTToken
-	err := json.Unmarshal(buffer, &data)
-
-	if err != nil {
-		return data, err
-	}
-	return data, nil
+// HasPermission reports whether the role of the caller grants a permission (see db.PERMISSIONS).
+func (result AuthorizationResult) HasPermission(permission string) bool {
+	return slices.Contains(result.Permissions, permission)
 }
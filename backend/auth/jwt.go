@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const TOKEN_ISSUER string = "chatbot-backend"
+const TOKEN_AUDIENCE string = "chatbot-frontend"
+
+// Tolerated clock difference in seconds when checking iat, nbf and exp.
+const CLOCK_SKEW int64 = 30
+
+var encoding *base64.Encoding = base64.RawURLEncoding
+
+// NewJWTToken creates the claims for a user session starting now.
+//
+// Parameters:
+//   - id: User ID (also written as "sub")
+//   - is_admin: Administrator flag of the user
+//   - role: Role of the user (see db.ROLES)
+//   - permissions: Permissions granted to the role
+//   - session_id: Session the token belongs to (see db.Session)
+//   - lifetime: Validity of the token in seconds
+func NewJWTToken(id int64, is_admin bool, role string, permissions []string, session_id string, lifetime int64) JWTToken {
+	var now int64 = time.Now().UTC().Unix()
+
+	return JWTToken{
+		Issuer:         TOKEN_ISSUER,
+		Audience:       TOKEN_AUDIENCE,
+		Subject:        strconv.FormatInt(id, 10),
+		IssuedAt:       now,
+		NotBefore:      now,
+		ExpirationTime: now + lifetime,
+		ID:             id,
+		IsAdmin:        is_admin,
+		Role:           role,
+		Permissions:    permissions,
+		SessionID:      session_id,
+	}
+}
+
+// Sign serializes the claims into a compact HS256 JWT using the active signing key.
+//
+// Returns:
+//   - string: "<header>.<payload>.<signature>", each segment base64url encoded
+//   - error: If no signing key is configured or serialization fails
+func (jwt JWTToken) Sign() (string, error) {
+	key_id, secret, err := activeSigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	header, err := json.Marshal(JWTHeader{Algorithm: "HS256", Type: "JWT", KeyID: key_id})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(jwt)
+	if err != nil {
+		return "", err
+	}
+
+	var signing_input string = encoding.EncodeToString(header) + "." + encoding.EncodeToString(payload)
+
+	return signing_input + "." + encoding.EncodeToString(sign(secret, signing_input)), nil
+}
+
+// ParseJWTToken verifies a compact JWT and returns its claims.
+//
+// Verification order:
+//  1. Structure (three base64url segments)
+//  2. Header (alg must be HS256, kid must be a known key)
+//  3. Signature (constant-time HMAC comparison)
+//  4. Claims (iss, aud, iat, nbf, exp)
+//
+// Claims are never decoded before the signature has been checked.
+func ParseJWTToken(token string) (JWTToken, error) {
+	var claims JWTToken
+
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return claims, errors.New("malformed token")
+	}
+
+	header_bytes, err := encoding.DecodeString(segments[0])
+	if err != nil {
+		return claims, fmt.Errorf("malformed token header: %w", err)
+	}
+
+	var header JWTHeader
+	if err := json.Unmarshal(header_bytes, &header); err != nil {
+		return claims, fmt.Errorf("malformed token header: %w", err)
+	}
+
+	if header.Algorithm != "HS256" {
+		return claims, fmt.Errorf("unsupported signing algorithm: %s", header.Algorithm)
+	}
+
+	secret, err := lookupSigningKey(header.KeyID)
+	if err != nil {
+		return claims, err
+	}
+
+	signature, err := encoding.DecodeString(segments[2])
+	if err != nil {
+		return claims, fmt.Errorf("malformed token signature: %w", err)
+	}
+
+	if !hmac.Equal(signature, sign(secret, segments[0]+"."+segments[1])) {
+		return claims, errors.New("invalid signature")
+	}
+
+	payload, err := encoding.DecodeString(segments[1])
+	if err != nil {
+		return claims, fmt.Errorf("malformed token payload: %w", err)
+	}
+
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return JWTToken{}, fmt.Errorf("malformed token payload: %w", err)
+	}
+
+	if err := claims.validate(time.Now().UTC().Unix()); err != nil {
+		return JWTToken{}, err
+	}
+
+	return claims, nil
+}
+
+// validate checks the registered claims against the current time.
+func (jwt JWTToken) validate(now int64) error {
+	if jwt.Issuer != TOKEN_ISSUER {
+		return errors.New("invalid token issuer")
+	}
+
+	if jwt.Audience != TOKEN_AUDIENCE {
+		return errors.New("invalid token audience")
+	}
+
+	if jwt.Subject != strconv.FormatInt(jwt.ID, 10) {
+		return errors.New("invalid token subject")
+	}
+
+	if jwt.IssuedAt > now+CLOCK_SKEW || jwt.NotBefore > now+CLOCK_SKEW {
+		return errors.New("token is not valid yet")
+	}
+
+	if jwt.ExpirationTime < now-CLOCK_SKEW {
+		return errors.New("token is expired. Please refresh the browser")
+	}
+
+	return nil
+}
+
+func sign(secret []byte, signing_input string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signing_input))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useSigningKeys installs two signing keys, "current" (active) and "previous".
+func useSigningKeys(t *testing.T) {
+	t.Helper()
+
+	for _, key_id := range []string{"current", "previous"} {
+		if err := AddSigningKey(key_id, bytes.Repeat([]byte(key_id[:1]), MIN_KEY_LENGTH)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := SetActiveSigningKey("current"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// encodeToken assembles a token from a header and claims, signed with secret.
+func encodeToken(t *testing.T, header JWTHeader, claims JWTToken, secret []byte) string {
+	t.Helper()
+
+	header_bytes, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var signing_input string = encoding.EncodeToString(header_bytes) + "." + encoding.EncodeToString(payload)
+	return signing_input + "." + encoding.EncodeToString(sign(secret, signing_input))
+}
+
+func TestParseJWTTokenAcceptsSignedToken(t *testing.T) {
+	useSigningKeys(t)
+
+	token, err := NewJWTToken(7, true, "admin", []string{"manage_users"}, "session", 60).Sign()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := ParseJWTToken(token)
+	if err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+
+	if claims.ID != 7 || !claims.IsAdmin || claims.SessionID != "session" {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+}
+
+func TestParseJWTTokenRejectsForgedSignature(t *testing.T) {
+	useSigningKeys(t)
+
+	var claims JWTToken = NewJWTToken(7, false, "user", nil, "session", 60)
+	var header JWTHeader = JWTHeader{Algorithm: "HS256", Type: "JWT", KeyID: "current"}
+
+	forged := encodeToken(t, header, claims, bytes.Repeat([]byte("x"), MIN_KEY_LENGTH))
+	if _, err := ParseJWTToken(forged); err == nil {
+		t.Error("token signed with an unknown secret accepted")
+	}
+
+	// Claims swapped after signing
+	token, err := claims.Sign()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims.IsAdmin = true
+	elevated := encodeToken(t, header, claims, []byte("ignored"))
+	segments := strings.Split(token, ".")
+	tampered := strings.Split(elevated, ".")[0] + "." + strings.Split(elevated, ".")[1] + "." + segments[2]
+
+	if _, err := ParseJWTToken(tampered); err == nil {
+		t.Error("token with modified claims accepted")
+	}
+}
+
+func TestParseJWTTokenRejectsOtherAlgorithms(t *testing.T) {
+	useSigningKeys(t)
+
+	var claims JWTToken = NewJWTToken(7, false, "user", nil, "session", 60)
+	secret, err := lookupSigningKey("current")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, algorithm := range []string{"none", "None", "HS512", "RS256", ""} {
+		token := encodeToken(t, JWTHeader{Algorithm: algorithm, Type: "JWT", KeyID: "current"}, claims, secret)
+		if _, err := ParseJWTToken(token); err == nil {
+			t.Errorf("token with alg %q accepted", algorithm)
+		}
+	}
+
+	// alg "none" with an empty signature
+	unsigned := encodeToken(t, JWTHeader{Algorithm: "none", Type: "JWT", KeyID: "current"}, claims, secret)
+	unsigned = unsigned[:strings.LastIndex(unsigned, ".")+1]
+
+	if _, err := ParseJWTToken(unsigned); err == nil {
+		t.Error("unsigned token accepted")
+	}
+}
+
+func TestParseJWTTokenRejectsUnknownAndRetiredKeys(t *testing.T) {
+	useSigningKeys(t)
+
+	var claims JWTToken = NewJWTToken(7, false, "user", nil, "session", 60)
+
+	unknown := encodeToken(t, JWTHeader{Algorithm: "HS256", Type: "JWT", KeyID: "unknown"}, claims, bytes.Repeat([]byte("c"), MIN_KEY_LENGTH))
+	if _, err := ParseJWTToken(unknown); err == nil {
+		t.Error("token with unknown kid accepted")
+	}
+
+	if err := SetActiveSigningKey("previous"); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := claims.Sign()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetActiveSigningKey("current"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseJWTToken(token); err != nil {
+		t.Fatalf("token of a rotated key rejected before retirement: %v", err)
+	}
+
+	if err := RemoveSigningKey("previous"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseJWTToken(token); err == nil {
+		t.Error("token of a retired key accepted")
+	}
+
+	if err := RemoveSigningKey("current"); err == nil {
+		t.Error("active key removed")
+	}
+}
+
+func TestParseJWTTokenChecksLifetime(t *testing.T) {
+	useSigningKeys(t)
+
+	var now int64 = time.Now().UTC().Unix()
+
+	tests := []struct {
+		name   string
+		change func(*JWTToken)
+		valid  bool
+	}{
+		{"expired", func(claims *JWTToken) { claims.ExpirationTime = now - CLOCK_SKEW - 1 }, false},
+		{"expired within clock skew", func(claims *JWTToken) { claims.ExpirationTime = now - CLOCK_SKEW + 5 }, true},
+		{"not valid yet", func(claims *JWTToken) { claims.NotBefore = now + CLOCK_SKEW + 60 }, false},
+		{"issued in the future", func(claims *JWTToken) { claims.IssuedAt = now + CLOCK_SKEW + 60 }, false},
+		{"other issuer", func(claims *JWTToken) { claims.Issuer = "someone-else" }, false},
+		{"other audience", func(claims *JWTToken) { claims.Audience = "someone-else" }, false},
+		{"subject differs from ID", func(claims *JWTToken) { claims.Subject = "8" }, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var claims JWTToken = NewJWTToken(7, false, "user", nil, "session", 60)
+			test.change(&claims)
+
+			token, err := claims.Sign()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = ParseJWTToken(token)
+			if test.valid && err != nil {
+				t.Errorf("token rejected: %v", err)
+			} else if !test.valid && err == nil {
+				t.Error("token accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Minimum length of an HMAC-SHA256 signing secret in bytes.
+const MIN_KEY_LENGTH int = 32
+
+// Package level key ring used to sign and verify tokens.
+//
+// signingKeys maps a key ID to its secret. activeKeyID names the key new tokens
+// are signed with; all other keys are only used for verification so that tokens
+// issued before a rotation stay valid until they expire.
+var (
+	keyMutex    sync.RWMutex
+	signingKeys map[string][]byte = make(map[string][]byte)
+	activeKeyID string
+)
+
+// AddSigningKey registers a secret under the given key ID.
+//
+// Parameters:
+//   - key_id: Identifier written into the "kid" header of signed tokens
+//   - secret: HMAC secret, at least MIN_KEY_LENGTH bytes long
+//
+// Returns:
+//   - error: If the key ID is empty or the secret is too short
+//
+// Note:
+//   - The first key added becomes the active signing key
+//   - Re-adding an existing key ID replaces its secret
+func AddSigningKey(key_id string, secret []byte) error {
+	if key_id == "" {
+		return errors.New("signing key id must not be empty")
+	}
+
+	if len(secret) < MIN_KEY_LENGTH {
+		return fmt.Errorf("signing key %s must be at least %d bytes long", key_id, MIN_KEY_LENGTH)
+	}
+
+	keyMutex.Lock()
+	defer keyMutex.Unlock()
+
+	signingKeys[key_id] = append([]byte(nil), secret...)
+
+	if activeKeyID == "" {
+		activeKeyID = key_id
+	}
+
+	return nil
+}
+
+// SetActiveSigningKey selects the key used to sign new tokens.
+//
+// Returns an error if no key with the given ID has been registered.
+func SetActiveSigningKey(key_id string) error {
+	keyMutex.Lock()
+	defer keyMutex.Unlock()
+
+	if _, ok := signingKeys[key_id]; !ok {
+		return fmt.Errorf("unknown signing key: %s", key_id)
+	}
+
+	activeKeyID = key_id
+	return nil
+}
+
+// RemoveSigningKey retires a key. Tokens signed with it are rejected afterwards.
+//
+// The active key cannot be removed; activate another key first.
+func RemoveSigningKey(key_id string) error {
+	keyMutex.Lock()
+	defer keyMutex.Unlock()
+
+	if key_id == activeKeyID {
+		return fmt.Errorf("signing key %s is active and cannot be removed", key_id)
+	}
+
+	delete(signingKeys, key_id)
+	return nil
+}
+
+// activeSigningKey returns the ID and secret of the key new tokens are signed with.
+func activeSigningKey() (string, []byte, error) {
+	keyMutex.RLock()
+	defer keyMutex.RUnlock()
+
+	secret, ok := signingKeys[activeKeyID]
+	if !ok {
+		return "", nil, errors.New("no signing key configured")
+	}
+
+	return activeKeyID, secret, nil
+}
+
+// lookupSigningKey returns the secret registered under the given key ID.
+func lookupSigningKey(key_id string) ([]byte, error) {
+	keyMutex.RLock()
+	defer keyMutex.RUnlock()
+
+	secret, ok := signingKeys[key_id]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %s", key_id)
+	}
+
+	return secret, nil
+}
@@ -2,18 +2,19 @@ package auth
 
 import (
 	"backend/db"
-	"crypto/cipher"
+	"backend/logging"
+	"backend/metrics"
+	"backend/ratelimit"
 	"database/sql"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 )
 
-const N_MINUTES int64 = 120 * 60 // In seconds
-
 func get_request_body(r *http.Request) ([]byte, error) {
 	buffer, err := io.ReadAll(r.Body)
 	defer r.Body.Close()
@@ -31,22 +32,34 @@ func get_request_body(r *http.Request) ([]byte, error) {
 //	}
 //
 // On successful authentication:
-//   - Generates a JWT token with user claims (ID, admin status)
+//   - Starts a new server-side session (see db.Session)
+//   - Generates a JWT token with user claims (ID, admin status, session ID)
 //   - Returns a LoginResponse containing:
 //   - User metadata (admin/premium status)
-//   - Hex-encoded JWT token
+//   - HMAC-SHA256 signed JWT token
+//   - Refresh token for /api/auth/refresh
 //   - Username
 //
 // Possible error responses:
 //   - 400 Bad Request: Malformed JSON or missing fields
 //   - 401 Unauthorized: Invalid credentials
+//   - 429 Too Many Requests: Too many attempts for the account from the client address
+//     (settings.LoginLimit) or from the client address overall (checked by the router),
+//     Retry-After header set
 //   - 500 Internal Server Error: Database or token generation failure
 //
 // Security Note:
-//   - Uses constant-time comparison for password validation
-//   - JWT contains expiration claim (N_MINUTES from issuance)
-//   - Tokens are hex-encoded for transport
-func Login(db_handle *sql.DB, cipher cipher.Block, w http.ResponseWriter, r *http.Request) {
+//   - Uses constant-time comparison for password validation (see VerifyPassword)
+//   - Unknown emails are verified against a dummy hash, so the response time does
+//     not reveal whether an account exists
+//   - Legacy plaintext or outdated hashes are rehashed with argon2id on success
+//   - JWT contains iss, aud, iat, nbf and exp claims (settings.AccessTokenLifetime from issuance)
+//   - Refresh tokens are only stored as SHA-256 hash and rotate on every use
+//   - Tokens are signed with the active key of the key ring (see AddSigningKey)
+//   - Every verified attempt is recorded in the audit log (action "auth.login",
+//     outcome success or failure); attempts refused by the rate limit are not,
+//     they are only counted in metrics.Logins (outcome "limited")
+func Login(db_handle *sql.DB, settings SessionSettings, w http.ResponseWriter, r *http.Request) {
 	buffer, err := get_request_body(r)
 
 	if err != nil {
@@ -59,35 +72,84 @@ func Login(db_handle *sql.DB, cipher cipher.Block, w http.ResponseWriter, r *htt
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if settings.LoginLimit != nil {
+		allowed, retry_after := settings.LoginLimit.Allow(ratelimit.LoginKey(login_credentials.Email, ClientAddress(r)))
+
+		if !allowed {
+			metrics.Logins.Inc("limited")
+			ratelimit.Refuse(w, retry_after, "too many login attempts")
+			return
+		}
 	}
 
 	record, err := db.GetDataBaseUser(db_handle, login_credentials.Email)
 
-	if err != nil {
+	if errors.Is(err, sql.ErrNoRows) {
+		// Verify against a dummy hash so unknown emails take as long as wrong passwords
+		record = db.DataBaseUser{Password: dummyPasswordHash()}
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	matches, needs_rehash := VerifyPassword(login_credentials.Password, record.Password)
+
+	var event db.AuditEvent = db.AuditEvent{
+		UserID:   record.ID,
+		Action:   "auth.login",
+		Target:   "account:" + strings.ToLower(strings.TrimSpace(login_credentials.Email)),
+		SourceIP: ClientAddress(r),
+		Outcome:  db.AUDIT_SUCCESS,
+	}
+
+	if record.ID == 0 || !matches {
+		event.Outcome = db.AUDIT_FAILURE
+	}
+
+	if err := db.AddAuditEntry(db_handle, event); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if record.Password == login_credentials.Password {
-		jwt, err := JWTToken{
-			ID:             record.ID,
-			IsAdmin:        record.IsAdmin,
-			ExpirationTime: time.Now().UTC().Unix() + N_MINUTES,
-		}.JWTTokenToJson()
+	metrics.Logins.Inc(event.Outcome)
+
+	if record.ID != 0 && matches {
+		if needs_rehash {
+			upgradePassword(db_handle, record.ID, login_credentials.Password)
+		}
+
+		if err := db.DeleteExpiredSessions(db_handle, time.Now().UTC().Unix()); err != nil {
+			logging.FromContext(r.Context()).Error("Failed to delete expired sessions", "error", err)
+		}
+
+		permissions, err := db.GetRolePermissions(db_handle, record.Role)
 
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		jwt_string, refresh_token, err := createSession(db_handle, settings, record, permissions)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 
-		var jwt_string string = hex.EncodeToString(jwt)
 		var login_response LoginResponse = LoginResponse{
-			IsAdmin:   record.IsAdmin,
-			IsPremium: record.IsPremium,
-			JWTToken:  jwt_string,
-			Username:  record.Name,
+			IsAdmin:      record.IsAdmin,
+			IsPremium:    record.IsPremium,
+			Role:         record.Role,
+			Permissions:  permissions,
+			JWTToken:     jwt_string,
+			RefreshToken: refresh_token,
+			Username:     record.Name,
 		}
 
-		log.Printf("%s Login Successful", login_credentials.Email)
+		logging.FromContext(r.Context()).Info("Login successful", "user", record.ID)
 
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(login_response)
@@ -95,3 +157,20 @@ func Login(db_handle *sql.DB, cipher cipher.Block, w http.ResponseWriter, r *htt
 		http.Error(w, "Username or Password is wrong", http.StatusUnauthorized)
 	}
 }
+
+// upgradePassword replaces a legacy or outdated password hash after a successful login.
+//
+// Failures are only logged, the login itself is not affected and the upgrade is
+// retried on the next login.
+func upgradePassword(db_handle *sql.DB, id int64, password string) {
+	hash, err := HashPassword(password)
+
+	if err != nil {
+		slog.Error("Failed to rehash password", "user", id, "error", err)
+		return
+	}
+
+	if err := db.UpdatePassword(db_handle, id, hash); err != nil {
+		slog.Error("Failed to store rehashed password", "user", id, "error", err)
+	}
+}
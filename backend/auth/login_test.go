@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"backend/ratelimit"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func login(t *testing.T, handler func(http.ResponseWriter, *http.Request), email string, password string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	body, _ := json.Marshal(LoginCredentials{Email: email, Password: password})
+	recorder := httptest.NewRecorder()
+
+	handler(recorder, httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(string(body))))
+	return recorder
+}
+
+func TestLogin(t *testing.T) {
+	useSigningKeys(t)
+	db_handle := openTestDatabase(t)
+
+	handler := func(w http.ResponseWriter, r *http.Request) { Login(db_handle, testSessionSettings, w, r) }
+
+	recorder := login(t, handler, "admin@example.com", "Admin")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("valid credentials: status %d, %s", recorder.Code, recorder.Body.String())
+	}
+
+	var response LoginResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	if !response.IsAdmin || response.JWTToken == "" || response.RefreshToken == "" {
+		t.Errorf("unexpected response: %+v", response)
+	}
+
+	if recorder := login(t, handler, "admin@example.com", "wrong"); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: status %d, want 401", recorder.Code)
+	}
+}
+
+func TestLoginUnknownEmail(t *testing.T) {
+	db_handle := openTestDatabase(t)
+
+	handler := func(w http.ResponseWriter, r *http.Request) { Login(db_handle, testSessionSettings, w, r) }
+
+	unknown := login(t, handler, "nobody@example.com", "Admin")
+	wrong := login(t, handler, "admin@example.com", "wrong")
+
+	if unknown.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown email: status %d, want 401", unknown.Code)
+	}
+
+	if unknown.Body.String() != wrong.Body.String() {
+		t.Errorf("unknown email and wrong password answered differently: %q, %q", unknown.Body.String(), wrong.Body.String())
+	}
+
+	var failures int
+	err := db_handle.QueryRow(`SELECT COUNT(*) FROM audit_log WHERE action = 'auth.login' AND outcome = 'failure'`).Scan(&failures)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if failures != 2 {
+		t.Errorf("%d failed logins audited, want 2", failures)
+	}
+}
+
+func TestLoginLimitPerAddress(t *testing.T) {
+	useSigningKeys(t)
+	db_handle := openTestDatabase(t)
+
+	var settings SessionSettings = testSessionSettings
+	settings.LoginLimit = ratelimit.NewLimiter(ratelimit.LOGIN, 3)
+
+	attempt := func(address string, password string) int {
+		body, _ := json.Marshal(LoginCredentials{Email: "admin@example.com", Password: password})
+		request := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(string(body)))
+		request.RemoteAddr = address + ":40000"
+
+		recorder := httptest.NewRecorder()
+		Login(db_handle, settings, recorder, request)
+		return recorder.Code
+	}
+
+	for range 3 {
+		attempt("203.0.113.9", "wrong")
+	}
+
+	if status := attempt("203.0.113.9", "Admin"); status != http.StatusTooManyRequests {
+		t.Errorf("attacker's address: status %d, want 429", status)
+	}
+
+	// Wrong passwords sent by someone else do not lock the owner out
+	if status := attempt("192.0.2.1", "Admin"); status != http.StatusOK {
+		t.Errorf("owner's address: status %d, want 200", status)
+	}
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// PasswordParameters configures the argon2id key derivation.
+//
+//   - Memory: Memory cost in KiB
+//   - Iterations: Number of passes over the memory
+//   - Parallelism: Number of lanes
+//   - SaltLength: Length of the random salt in bytes
+//   - KeyLength: Length of the derived key in bytes
+type PasswordParameters struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Parameters used for newly hashed passwords (OWASP recommendation for argon2id).
+// Stored hashes with different parameters are rehashed on the next successful login.
+var CURRENT_PASSWORD_PARAMETERS PasswordParameters = PasswordParameters{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// HashPassword derives an argon2id hash of the password.
+//
+// The result is a self-describing PHC string:
+//
+//	$argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<hash>
+//
+// Salt and hash are unpadded base64. The embedded algorithm, version and
+// parameters allow VerifyPassword to detect outdated hashes.
+func HashPassword(password string) (string, error) {
+	var params PasswordParameters = CURRENT_PASSWORD_PARAMETERS
+
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		params.Memory,
+		params.Iterations,
+		params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// dummyPasswordHash returns a hash of a random password with the current parameters.
+//
+// Login verifies passwords of unknown emails against it, so it spends the same
+// time as for an existing account. Computed once, on the first use.
+//
+// Panics if no random password or salt can be generated: an empty hash would let
+// logins of unknown emails return early and reveal which accounts exist.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	password := make([]byte, CURRENT_PASSWORD_PARAMETERS.SaltLength)
+	if _, err := rand.Read(password); err != nil {
+		panic(fmt.Sprintf("auth: failed to generate dummy password: %v", err))
+	}
+
+	hash, err := HashPassword(base64.RawStdEncoding.EncodeToString(password))
+	if err != nil {
+		panic(fmt.Sprintf("auth: failed to hash dummy password: %v", err))
+	}
+
+	return hash
+})
+
+// VerifyPassword checks a password against a stored hash.
+//
+// Supported formats:
+//   - argon2id PHC strings produced by HashPassword
+//   - Legacy plaintext rows (anything not starting with "$")
+//
+// Returns:
+//   - bool: True if the password matches
+//   - bool: True if the stored value should be replaced by a fresh HashPassword
+//     result (plaintext, other argon2 version or outdated parameters)
+//
+// Note:
+//   - All comparisons are constant-time
+//   - An empty stored value never matches
+func VerifyPassword(password string, encoded string) (bool, bool) {
+	if encoded == "" {
+		return false, false
+	}
+
+	if !strings.HasPrefix(encoded, "$") {
+		matches := subtle.ConstantTimeCompare([]byte(password), []byte(encoded)) == 1
+		return matches, matches
+	}
+
+	params, version, salt, key, err := decodePasswordHash(encoded)
+	if err != nil {
+		return false, false
+	}
+
+	derived := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	if subtle.ConstantTimeCompare(derived, key) != 1 {
+		return false, false
+	}
+
+	var current PasswordParameters = CURRENT_PASSWORD_PARAMETERS
+	needs_rehash := version != argon2.Version ||
+		params.Memory != current.Memory ||
+		params.Iterations != current.Iterations ||
+		params.Parallelism != current.Parallelism ||
+		params.SaltLength != current.SaltLength ||
+		params.KeyLength != current.KeyLength
+
+	return true, needs_rehash
+}
+
+// decodePasswordHash parses an argon2id PHC string.
+func decodePasswordHash(encoded string) (PasswordParameters, int, []byte, []byte, error) {
+	var params PasswordParameters
+	var version int
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, 0, nil, nil, errors.New("unsupported password hash format")
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, 0, nil, nil, fmt.Errorf("invalid password hash version: %w", err)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, 0, nil, nil, fmt.Errorf("invalid password hash parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, 0, nil, nil, fmt.Errorf("invalid password salt: %w", err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, 0, nil, nil, fmt.Errorf("invalid password hash: %w", err)
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, version, salt, key, nil
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		t.Fatalf("unexpected hash format: %s", hash)
+	}
+
+	if matches, needs_rehash := VerifyPassword("correct horse", hash); !matches || needs_rehash {
+		t.Errorf("current hash: matches = %v, needs_rehash = %v", matches, needs_rehash)
+	}
+
+	if matches, _ := VerifyPassword("wrong horse", hash); matches {
+		t.Error("wrong password matches")
+	}
+
+	if matches, _ := VerifyPassword("", ""); matches {
+		t.Error("empty stored value matches")
+	}
+}
+
+func TestVerifyPasswordRehashesLegacyPlaintext(t *testing.T) {
+	if matches, needs_rehash := VerifyPassword("secret", "secret"); !matches || !needs_rehash {
+		t.Errorf("plaintext row: matches = %v, needs_rehash = %v", matches, needs_rehash)
+	}
+
+	if matches, needs_rehash := VerifyPassword("other", "secret"); matches || needs_rehash {
+		t.Errorf("wrong password on plaintext row: matches = %v, needs_rehash = %v", matches, needs_rehash)
+	}
+}
+
+func TestVerifyPasswordRehashesOutdatedParameters(t *testing.T) {
+	var current PasswordParameters = CURRENT_PASSWORD_PARAMETERS
+	t.Cleanup(func() { CURRENT_PASSWORD_PARAMETERS = current })
+
+	CURRENT_PASSWORD_PARAMETERS.Memory = 8 * 1024
+	CURRENT_PASSWORD_PARAMETERS.Iterations = 1
+
+	outdated, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Parameters are raised after the hash was stored
+	CURRENT_PASSWORD_PARAMETERS = current
+
+	matches, needs_rehash := VerifyPassword("correct horse", outdated)
+	if !matches || !needs_rehash {
+		t.Fatalf("outdated hash: matches = %v, needs_rehash = %v", matches, needs_rehash)
+	}
+
+	if matches, needs_rehash := VerifyPassword("wrong horse", outdated); matches || needs_rehash {
+		t.Errorf("wrong password on outdated hash: matches = %v, needs_rehash = %v", matches, needs_rehash)
+	}
+
+	upgraded, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if matches, needs_rehash := VerifyPassword("correct horse", upgraded); !matches || needs_rehash {
+		t.Errorf("upgraded hash: matches = %v, needs_rehash = %v", matches, needs_rehash)
+	}
+}
+
+func TestDummyPasswordHashUsesCurrentParameters(t *testing.T) {
+	var hash string = dummyPasswordHash()
+
+	if _, _, _, _, err := decodePasswordHash(hash); err != nil {
+		t.Fatalf("dummy hash cannot be decoded: %v", err)
+	}
+
+	if matches, _ := VerifyPassword("", hash); matches {
+		t.Error("empty password matches the dummy hash")
+	}
+}
@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"backend/db"
+	"backend/logging"
+	"backend/ratelimit"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SessionSettings configures the lifetime of issued tokens.
+//
+//   - AccessTokenLifetime: Validity of access tokens in seconds
+//   - RefreshTokenLifetime: Validity of refresh tokens in seconds, renewed on every refresh
+//   - LoginLimit: Budget of login attempts per account and client address, nil for unlimited
+type SessionSettings struct {
+	AccessTokenLifetime  int64
+	RefreshTokenLifetime int64
+	LoginLimit           *ratelimit.Limiter
+}
+
+type RefreshRequest struct {
+	RefreshToken string
+}
+
+type RefreshResponse struct {
+	JWTToken     string
+	RefreshToken string
+}
+
+// createSession starts a new session for a user and issues the first token pair.
+//
+// Parameters:
+//   - permissions: Permissions of the user's role, carried in the access token
+//
+// Returns:
+//   - string: Signed access token carrying the session ID
+//   - string: Refresh token in the form "<session id>.<secret>"
+//   - error: Token generation or database failure
+func createSession(db_handle *sql.DB, settings SessionSettings, user db.DataBaseUser, permissions []string) (string, string, error) {
+	session_id, err := randomHex(16)
+	if err != nil {
+		return "", "", err
+	}
+
+	refresh_token, refresh_hash, err := newRefreshToken(session_id)
+	if err != nil {
+		return "", "", err
+	}
+
+	var now int64 = time.Now().UTC().Unix()
+
+	err = db.AddSession(db_handle, db.Session{
+		ID:          session_id,
+		UserID:      user.ID,
+		RefreshHash: refresh_hash,
+		CreatedAt:   now,
+		ExpiresAt:   now + settings.RefreshTokenLifetime,
+	})
+
+	if err != nil {
+		return "", "", err
+	}
+
+	access_token, err := NewJWTToken(user.ID, user.IsAdmin, user.Role, permissions, session_id, settings.AccessTokenLifetime).Sign()
+	if err != nil {
+		return "", "", err
+	}
+
+	return access_token, refresh_token, nil
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token.
+//
+// Expects a JSON payload in the request body with the format:
+//
+//	{
+//		"RefreshToken": string
+//	}
+//
+// Refresh tokens are single use. Presenting a refresh token that has already been
+// rotated revokes the whole session, since it indicates that the token was stolen;
+// the reuse is recorded in the audit log (action "session.reuse").
+//
+// Possible error responses:
+//   - 400 Bad Request: Malformed JSON or refresh token
+//   - 401 Unauthorized: Unknown, expired, revoked or reused refresh token
+//   - 500 Internal Server Error: Database or token generation failure
+func Refresh(db_handle *sql.DB, settings SessionSettings, w http.ResponseWriter, r *http.Request) {
+	buffer, err := get_request_body(r)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var refresh_request RefreshRequest
+	if err := json.Unmarshal(buffer, &refresh_request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session_id, _, found := strings.Cut(refresh_request.RefreshToken, ".")
+	if !found || session_id == "" {
+		http.Error(w, "malformed refresh token", http.StatusBadRequest)
+		return
+	}
+
+	session, err := db.GetSession(db_handle, session_id)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "unknown session", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var now int64 = time.Now().UTC().Unix()
+
+	if session.Revoked || session.ExpiresAt < now {
+		http.Error(w, "session expired. Please log in again", http.StatusUnauthorized)
+		return
+	}
+
+	var presented_hash string = hashRefreshToken(refresh_request.RefreshToken)
+
+	refresh_token, refresh_hash, err := newRefreshToken(session_id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rotated, err := db.RotateSession(db_handle, session_id, presented_hash, refresh_hash, now+settings.RefreshTokenLifetime)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !rotated {
+		logging.FromContext(r.Context()).Warn("Refresh token reuse detected, revoking session", "session", session_id, "user", session.UserID)
+
+		if err := db.RevokeSession(db_handle, session_id); err != nil {
+			logging.FromContext(r.Context()).Error("Failed to revoke session", "session", session_id, "error", err)
+		}
+
+		err := db.AddAuditEntry(db_handle, db.AuditEvent{
+			UserID:   session.UserID,
+			Action:   "session.reuse",
+			Target:   fmt.Sprintf("user:%d", session.UserID),
+			SourceIP: ClientAddress(r),
+			Outcome:  db.AUDIT_DENIED,
+		})
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to record refresh token reuse", "error", err)
+		}
+
+		http.Error(w, "refresh token has already been used", http.StatusUnauthorized)
+		return
+	}
+
+	access_token, err := NewJWTToken(
+		session.UserID,
+		session.IsAdmin,
+		session.Role,
+		session.Permissions,
+		session_id,
+		settings.AccessTokenLifetime,
+	).Sign()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RefreshResponse{JWTToken: access_token, RefreshToken: refresh_token})
+}
+
+// Logout revokes the session the presented access token belongs to.
+//
+// Both the access token and the refresh token of the session are rejected afterwards.
+//
+// Responses:
+//   - 200 OK: Session revoked
+//   - 500 Internal Server Error: Database failure
+func Logout(db_handle *sql.DB, auth_result AuthorizationResult, w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	if err := db.RevokeSession(db_handle, auth_result.SessionID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte{})
+}
+
+// newRefreshToken creates a refresh token for a session and the hash to store.
+func newRefreshToken(session_id string) (string, string, error) {
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	var token string = session_id + "." + secret
+	return token, hashRefreshToken(token), nil
+}
+
+func hashRefreshToken(token string) string {
+	var hash [32]byte = sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func randomHex(n int) (string, error) {
+	buffer := make([]byte, n)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buffer), nil
+}
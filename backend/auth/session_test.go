@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"backend/db"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testSessionSettings SessionSettings = SessionSettings{AccessTokenLifetime: 60, RefreshTokenLifetime: 600}
+
+// openTestDatabase creates a migrated database in a temporary directory with
+// one admin, "admin@example.com" with the password "Admin".
+func openTestDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+
+	hash, err := HashPassword("Admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db_handle, err := db.SetupSqlite(filepath.Join(t.TempDir(), "test.db"), db.CreateAdmin("Admin", hash, "admin@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db_handle.Close() })
+	return db_handle
+}
+
+func refresh(db_handle *sql.DB, refresh_token string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(RefreshRequest{RefreshToken: refresh_token})
+	recorder := httptest.NewRecorder()
+
+	Refresh(db_handle, testSessionSettings, recorder, httptest.NewRequest(http.MethodPost, "/api/auth/refresh", strings.NewReader(string(body))))
+	return recorder
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	useSigningKeys(t)
+	db_handle := openTestDatabase(t)
+
+	user, err := db.GetDataBaseUser(db_handle, "admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, first, err := createSession(db_handle, testSessionSettings, user, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := refresh(db_handle, first)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("refresh: status %d, %s", recorder.Code, recorder.Body.String())
+	}
+
+	var response RefreshResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.RefreshToken == first {
+		t.Error("refresh token was not rotated")
+	}
+
+	claims, err := ParseJWTToken(response.JWTToken)
+	if err != nil {
+		t.Fatalf("refreshed access token rejected: %v", err)
+	}
+
+	if claims.ID != user.ID || claims.SessionID != strings.Split(first, ".")[0] {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+
+	if recorder := refresh(db_handle, response.RefreshToken); recorder.Code != http.StatusOK {
+		t.Errorf("second refresh: status %d", recorder.Code)
+	}
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	useSigningKeys(t)
+	db_handle := openTestDatabase(t)
+
+	user, err := db.GetDataBaseUser(db_handle, "admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, stolen, err := createSession(db_handle, testSessionSettings, user, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The legitimate client refreshes first
+	recorder := refresh(db_handle, stolen)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("refresh: status %d", recorder.Code)
+	}
+
+	var response RefreshResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	// The attacker replays the rotated token
+	if recorder := refresh(db_handle, stolen); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("reused refresh token: status %d, want 401", recorder.Code)
+	}
+
+	session, err := db.GetSession(db_handle, strings.Split(stolen, ".")[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !session.Revoked {
+		t.Error("session not revoked after refresh token reuse")
+	}
+
+	// The token rotated to the legitimate client belongs to the same family
+	if recorder := refresh(db_handle, response.RefreshToken); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("refresh token of revoked session: status %d, want 401", recorder.Code)
+	}
+
+	var reuses int
+	err = db_handle.QueryRow(`SELECT COUNT(*) FROM audit_log WHERE action = 'session.reuse'`).Scan(&reuses)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reuses != 1 {
+		t.Errorf("%d session.reuse audit entries, want 1", reuses)
+	}
+}
+
+func TestRefreshRejectsUnknownSession(t *testing.T) {
+	db_handle := openTestDatabase(t)
+
+	if recorder := refresh(db_handle, "unknown.secret"); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("unknown session: status %d, want 401", recorder.Code)
+	}
+
+	if recorder := refresh(db_handle, "no-separator"); recorder.Code != http.StatusBadRequest {
+		t.Errorf("malformed token: status %d, want 400", recorder.Code)
+	}
+}
@@ -0,0 +1,356 @@
+package config
+
+import (
+	"backend/logging"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+// Prefix of all environment variables read by Load, e.g. CHATBOT_LISTEN_ADDRESS.
+const ENV_PREFIX string = "CHATBOT_"
+
+// Config holds every deployment specific setting of the backend.
+//
+// Values are resolved in three layers, later layers overriding earlier ones:
+//  1. Defaults (see Default)
+//  2. JSON configuration file (keys are the json tags below)
+//  3. Environment variables (ENV_PREFIX + upper-cased json tag)
+//
+// Durations are given in seconds, sizes in bytes. Rate limits are positive
+// requests per minute, per user or, for login attempts, per account and client
+// address; the address rate limit covers unauthenticated requests (login, token
+// refresh and signup) per client address. All requests of the frontend share its
+// address, so it must be generous. Quotas are inference requests per user and day
+// or month, 0 meaning unlimited; the premium quotas apply to premium users and
+// admins. The log level is one of debug, info, warn and error, the log format text
+// or json. Scrapers of /metrics must present the metrics token as bearer token;
+// without a token /metrics is not served at all, the metrics are never open.
+// Ollama local declares whether the Ollama at ollama_url runs on the premises; if
+// it points to a hosted service it must be false, local-only users are then
+// refused its models.
+// Boolean environment variables accept the values of strconv.ParseBool.
+type Config struct {
+	ListenAddress     string `json:"listen_address"`
+	DatabasePath      string `json:"database_path"`
+	DefaultPromptPath string `json:"default_prompt_path"`
+	LogLevel          string `json:"log_level"`
+	LogFormat         string `json:"log_format"`
+	MetricsToken      string `json:"metrics_token"`
+
+	MLPipelineURL   string `json:"ml_pipeline_url"`
+	OllamaURL       string `json:"ollama_url"`
+	OllamaLocal     bool   `json:"ollama_local"`
+	PipelineTimeout int64  `json:"pipeline_timeout"`
+	DefaultModel    string `json:"default_model"`
+	FileSizeLimit   int64  `json:"file_size_limit"`
+	LargeUploadSize int64  `json:"large_upload_size"`
+	UploadPath      string `json:"upload_path"`
+	UploadExpiry    int64  `json:"upload_expiry"`
+	IngestWorkers   int64  `json:"ingest_workers"`
+	IngestAttempts  int64  `json:"ingest_attempts"`
+	IngestBackoff   int64  `json:"ingest_backoff"`
+	BlobPath        string `json:"blob_path"`
+
+	ThumbnailCommand string `json:"thumbnail_command"`
+
+	SigningKeyID         string `json:"signing_key_id"`
+	SigningKey           string `json:"signing_key"`
+	AccessTokenLifetime  int64  `json:"access_token_lifetime"`
+	RefreshTokenLifetime int64  `json:"refresh_token_lifetime"`
+
+	AddressRateLimit    int64 `json:"address_rate_limit"`
+	LoginRateLimit      int64 `json:"login_rate_limit"`
+	InferenceRateLimit  int64 `json:"inference_rate_limit"`
+	DeepThinkRateLimit  int64 `json:"deep_think_rate_limit"`
+	UploadRateLimit     int64 `json:"upload_rate_limit"`
+	DailyQuota          int64 `json:"daily_quota"`
+	MonthlyQuota        int64 `json:"monthly_quota"`
+	PremiumDailyQuota   int64 `json:"premium_daily_quota"`
+	PremiumMonthlyQuota int64 `json:"premium_monthly_quota"`
+
+	AdminName     string `json:"admin_name"`
+	AdminEmail    string `json:"admin_email"`
+	AdminPassword string `json:"admin_password"`
+}
+
+// Default returns the configuration used when nothing is configured.
+//
+// Note:
+//   - SigningKey is empty, Load leaves it empty and the caller is expected to
+//     generate an ephemeral key (tokens then do not survive a restart)
+//   - The admin credentials are development defaults and must be overridden in production
+func Default() Config {
+	return Config{
+		ListenAddress:     "0.0.0.0:8080",
+		DatabasePath:      "./data/data",
+		DefaultPromptPath: "./data/default_prompt.txt",
+		LogLevel:          "info",
+		LogFormat:         "text",
+
+		MLPipelineURL:   "http://ml_pipeline:3030",
+		OllamaURL:       "http://ollama:11434",
+		OllamaLocal:     true,
+		PipelineTimeout: 1200,
+		DefaultModel:    "gemma3:12b",
+		FileSizeLimit:   (1 << 20) * 200, // 200 MB
+		LargeUploadSize: (1 << 20) * 20,  // 20 MB
+		UploadPath:      "./data/uploads",
+		UploadExpiry:    24 * 60 * 60,
+		IngestWorkers:   2,
+		IngestAttempts:  3,
+		IngestBackoff:   30,
+		BlobPath:        "./data/blobs",
+
+		ThumbnailCommand: "pdftoppm",
+
+		SigningKeyID:         "default",
+		AccessTokenLifetime:  15 * 60,
+		RefreshTokenLifetime: 7 * 24 * 60 * 60,
+
+		AddressRateLimit:    120,
+		LoginRateLimit:      10,
+		InferenceRateLimit:  20,
+		DeepThinkRateLimit:  3,
+		UploadRateLimit:     10,
+		DailyQuota:          200,
+		MonthlyQuota:        3000,
+		PremiumDailyQuota:   1000,
+		PremiumMonthlyQuota: 20000,
+
+		AdminName:     "Admin",
+		AdminEmail:    "julius@korbjuhn.net",
+		AdminPassword: "Admin",
+	}
+}
+
+// Load resolves the configuration from defaults, the given file and the environment.
+//
+// Parameters:
+//   - path: JSON configuration file. An empty path skips the file layer
+//   - required: If false, a missing file is not an error
+//
+// Returns:
+//   - Config: The validated configuration
+//   - error: Unreadable or malformed file, malformed environment variable or
+//     a validation failure (see Validate)
+func Load(path string, required bool) (Config, error) {
+	var config Config = Default()
+
+	if path != "" {
+		content, err := os.ReadFile(path)
+
+		if errors.Is(err, os.ErrNotExist) && !required {
+			// Nothing to do, defaults and environment apply
+		} else if err != nil {
+			return Config{}, fmt.Errorf("failed to read config file: %w", err)
+		} else {
+			decoder := json.NewDecoder(bytes.NewReader(content))
+			decoder.DisallowUnknownFields()
+
+			if err := decoder.Decode(&config); err != nil {
+				return Config{}, fmt.Errorf("invalid config file %s: %w", path, err)
+			}
+		}
+	}
+
+	if err := config.applyEnvironment(os.LookupEnv); err != nil {
+		return Config{}, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
+
+	return config, nil
+}
+
+// applyEnvironment overrides settings with environment variables.
+func (config *Config) applyEnvironment(lookup func(string) (string, bool)) error {
+	text_settings := map[string]*string{
+		"LISTEN_ADDRESS":      &config.ListenAddress,
+		"DATABASE_PATH":       &config.DatabasePath,
+		"DEFAULT_PROMPT_PATH": &config.DefaultPromptPath,
+		"LOG_LEVEL":           &config.LogLevel,
+		"LOG_FORMAT":          &config.LogFormat,
+		"METRICS_TOKEN":       &config.MetricsToken,
+		"ML_PIPELINE_URL":     &config.MLPipelineURL,
+		"OLLAMA_URL":          &config.OllamaURL,
+		"DEFAULT_MODEL":       &config.DefaultModel,
+		"UPLOAD_PATH":         &config.UploadPath,
+		"BLOB_PATH":           &config.BlobPath,
+		"THUMBNAIL_COMMAND":   &config.ThumbnailCommand,
+		"SIGNING_KEY_ID":      &config.SigningKeyID,
+		"SIGNING_KEY":         &config.SigningKey,
+		"ADMIN_NAME":          &config.AdminName,
+		"ADMIN_EMAIL":         &config.AdminEmail,
+		"ADMIN_PASSWORD":      &config.AdminPassword,
+	}
+
+	integer_settings := map[string]*int64{
+		"PIPELINE_TIMEOUT":       &config.PipelineTimeout,
+		"FILE_SIZE_LIMIT":        &config.FileSizeLimit,
+		"LARGE_UPLOAD_SIZE":      &config.LargeUploadSize,
+		"UPLOAD_EXPIRY":          &config.UploadExpiry,
+		"INGEST_WORKERS":         &config.IngestWorkers,
+		"INGEST_ATTEMPTS":        &config.IngestAttempts,
+		"INGEST_BACKOFF":         &config.IngestBackoff,
+		"ACCESS_TOKEN_LIFETIME":  &config.AccessTokenLifetime,
+		"REFRESH_TOKEN_LIFETIME": &config.RefreshTokenLifetime,
+		"ADDRESS_RATE_LIMIT":     &config.AddressRateLimit,
+		"LOGIN_RATE_LIMIT":       &config.LoginRateLimit,
+		"INFERENCE_RATE_LIMIT":   &config.InferenceRateLimit,
+		"DEEP_THINK_RATE_LIMIT":  &config.DeepThinkRateLimit,
+		"UPLOAD_RATE_LIMIT":      &config.UploadRateLimit,
+		"DAILY_QUOTA":            &config.DailyQuota,
+		"MONTHLY_QUOTA":          &config.MonthlyQuota,
+		"PREMIUM_DAILY_QUOTA":    &config.PremiumDailyQuota,
+		"PREMIUM_MONTHLY_QUOTA":  &config.PremiumMonthlyQuota,
+	}
+
+	boolean_settings := map[string]*bool{
+		"OLLAMA_LOCAL": &config.OllamaLocal,
+	}
+
+	for name, target := range text_settings {
+		if value, ok := lookup(ENV_PREFIX + name); ok {
+			*target = value
+		}
+	}
+
+	for name, target := range integer_settings {
+		if value, ok := lookup(ENV_PREFIX + name); ok {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid value for %s%s: %w", ENV_PREFIX, name, err)
+			}
+			*target = parsed
+		}
+	}
+
+	for name, target := range boolean_settings {
+		if value, ok := lookup(ENV_PREFIX + name); ok {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid value for %s%s: %w", ENV_PREFIX, name, err)
+			}
+			*target = parsed
+		}
+	}
+
+	return nil
+}
+
+// Validate checks that every setting is usable.
+//
+// All problems are reported at once, joined into a single error.
+func (config Config) Validate() error {
+	var problems []error
+
+	if _, _, err := net.SplitHostPort(config.ListenAddress); err != nil {
+		problems = append(problems, fmt.Errorf("listen_address: %w", err))
+	}
+
+	if config.DatabasePath == "" {
+		problems = append(problems, errors.New("database_path must not be empty"))
+	}
+
+	if config.DefaultPromptPath == "" {
+		problems = append(problems, errors.New("default_prompt_path must not be empty"))
+	}
+
+	if !logging.ValidLevel(config.LogLevel) {
+		problems = append(problems, fmt.Errorf("log_level must be debug, info, warn or error, got %q", config.LogLevel))
+	}
+
+	if !logging.ValidFormat(config.LogFormat) {
+		problems = append(problems, fmt.Errorf("log_format must be text or json, got %q", config.LogFormat))
+	}
+
+	if config.UploadPath == "" {
+		problems = append(problems, errors.New("upload_path must not be empty"))
+	}
+
+	if config.BlobPath == "" {
+		problems = append(problems, errors.New("blob_path must not be empty"))
+	}
+
+	if config.ThumbnailCommand == "" {
+		problems = append(problems, errors.New("thumbnail_command must not be empty"))
+	}
+
+	problems = append(problems, validateURL("ml_pipeline_url", config.MLPipelineURL)...)
+	problems = append(problems, validateURL("ollama_url", config.OllamaURL)...)
+
+	if config.DefaultModel == "" {
+		problems = append(problems, errors.New("default_model must not be empty"))
+	}
+
+	problems = append(problems, validatePositive("pipeline_timeout", config.PipelineTimeout)...)
+	problems = append(problems, validatePositive("file_size_limit", config.FileSizeLimit)...)
+	problems = append(problems, validatePositive("large_upload_size", config.LargeUploadSize)...)
+	problems = append(problems, validatePositive("upload_expiry", config.UploadExpiry)...)
+	problems = append(problems, validatePositive("ingest_workers", config.IngestWorkers)...)
+	problems = append(problems, validatePositive("ingest_attempts", config.IngestAttempts)...)
+	problems = append(problems, validatePositive("ingest_backoff", config.IngestBackoff)...)
+	problems = append(problems, validatePositive("access_token_lifetime", config.AccessTokenLifetime)...)
+	problems = append(problems, validatePositive("refresh_token_lifetime", config.RefreshTokenLifetime)...)
+	problems = append(problems, validatePositive("address_rate_limit", config.AddressRateLimit)...)
+	problems = append(problems, validatePositive("login_rate_limit", config.LoginRateLimit)...)
+	problems = append(problems, validatePositive("inference_rate_limit", config.InferenceRateLimit)...)
+	problems = append(problems, validatePositive("deep_think_rate_limit", config.DeepThinkRateLimit)...)
+	problems = append(problems, validatePositive("upload_rate_limit", config.UploadRateLimit)...)
+	problems = append(problems, validateNonNegative("daily_quota", config.DailyQuota)...)
+	problems = append(problems, validateNonNegative("monthly_quota", config.MonthlyQuota)...)
+	problems = append(problems, validateNonNegative("premium_daily_quota", config.PremiumDailyQuota)...)
+	problems = append(problems, validateNonNegative("premium_monthly_quota", config.PremiumMonthlyQuota)...)
+
+	if config.RefreshTokenLifetime < config.AccessTokenLifetime {
+		problems = append(problems, errors.New("refresh_token_lifetime must not be shorter than access_token_lifetime"))
+	}
+
+	if config.SigningKeyID == "" {
+		problems = append(problems, errors.New("signing_key_id must not be empty"))
+	}
+
+	if config.SigningKey != "" && len(config.SigningKey) < 32 {
+		problems = append(problems, errors.New("signing_key must be at least 32 bytes long"))
+	}
+
+	if config.AdminName == "" || config.AdminEmail == "" || config.AdminPassword == "" {
+		problems = append(problems, errors.New("admin_name, admin_email and admin_password must not be empty"))
+	}
+
+	return errors.Join(problems...)
+}
+
+func validateURL(name string, value string) []error {
+	parsed, err := url.Parse(value)
+
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return []error{fmt.Errorf("%s must be an absolute http(s) URL, got %q", name, value)}
+	}
+
+	return nil
+}
+
+func validatePositive(name string, value int64) []error {
+	if value <= 0 {
+		return []error{fmt.Errorf("%s must be positive, got %d", name, value)}
+	}
+
+	return nil
+}
+
+func validateNonNegative(name string, value int64) []error {
+	if value < 0 {
+		return []error{fmt.Errorf("%s must not be negative, got %d", name, value)}
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadDefaults(t *testing.T) {
+	// Neither a configuration file nor a metrics token is required to start
+	config, err := Load(filepath.Join(t.TempDir(), "config.json"), false)
+	if err != nil {
+		t.Fatalf("defaults: %v", err)
+	}
+
+	if config.MetricsToken != "" {
+		t.Errorf("metrics token %q, want none", config.MetricsToken)
+	}
+}
+
+func TestValidateRejectsNonPositiveRateLimits(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("defaults: %v", err)
+	}
+
+	for _, value := range []int64{0, -5} {
+		config := Default()
+		config.AddressRateLimit = value
+		config.LoginRateLimit = value
+		config.InferenceRateLimit = value
+		config.DeepThinkRateLimit = value
+		config.UploadRateLimit = value
+
+		err := config.Validate()
+
+		for _, name := range []string{"address_rate_limit", "login_rate_limit", "inference_rate_limit", "deep_think_rate_limit", "upload_rate_limit"} {
+			if err == nil || !strings.Contains(err.Error(), name+" must be positive") {
+				t.Errorf("%s = %d accepted: %v", name, value, err)
+			}
+		}
+	}
+
+	// A quota of 0 means unlimited
+	config := Default()
+	config.DailyQuota = 0
+
+	if err := config.Validate(); err != nil {
+		t.Errorf("daily_quota = 0: %v", err)
+	}
+}
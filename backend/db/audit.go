@@ -0,0 +1,434 @@
+package db
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcomes of audited events.
+const (
+	AUDIT_SUCCESS string = "success" // The action was carried out
+	AUDIT_FAILURE string = "failure" // The action was attempted and failed, e.g. wrong credentials
+	AUDIT_DENIED  string = "denied"  // The caller was not allowed to perform the action
+)
+
+// AuditEvent is an event to be appended to the audit log.
+//
+//   - UserID:   User who caused the event, 0 for system events and unknown callers
+//   - Action:   Dotted event name, e.g. "user.promote"
+//   - Target:   Object acted on as "kind:key", e.g. "user:5", empty if there is none
+//   - SourceIP: Client address of the request, empty for system events
+//   - Outcome:  One of the AUDIT_* constants, AUDIT_SUCCESS if empty
+//   - Detail:   Value serialized as JSON object into the entry, nil for an empty object
+type AuditEvent struct {
+	UserID   int64
+	Action   string
+	Target   string
+	SourceIP string
+	Outcome  string
+	Detail   any
+}
+
+// AuditEntry is a single record of the audit log.
+//
+//   - ID:           Auto-incremented primary key, reflects the order of events
+//   - CreatedAt:    Unix timestamp of the event
+//   - UserID:       User who caused the event, 0 for system events
+//   - Actor:        Email of the user at the time of the event, empty for system events
+//   - Action:       Dotted event name, e.g. "inference.route"
+//   - Target:       Object acted on as "kind:key", empty if there is none
+//   - SourceIP:     Client address of the request
+//   - Outcome:      One of the AUDIT_* constants
+//   - Detail:       JSON object with event specific fields
+//   - PreviousHash: Hash of the preceding entry, empty for the first entry of the chain
+//   - Hash:         SHA-256 over the fields above and PreviousHash,
+//     empty for entries written before the log was chained
+type AuditEntry struct {
+	ID           int64
+	CreatedAt    int64
+	UserID       int64
+	Actor        string
+	Action       string
+	Target       string
+	SourceIP     string
+	Outcome      string
+	Detail       json.RawMessage
+	PreviousHash string
+	Hash         string
+}
+
+// AuditQuery selects a page of the audit log.
+//
+//   - Actor:      Email of the user who caused the events, empty for all
+//   - Action:     Event name, also matches the events below it ("user" matches "user.delete")
+//   - Target:     Exact target, empty for all
+//   - Outcome:    One of the AUDIT_* constants, empty for all
+//   - From, To:   Unix timestamps, events in [From, To); 0 leaves the bound open
+//   - Descending: Newest events first
+//   - Limit:      Maximum number of entries returned, 0 for all
+//   - Offset:     Number of matching entries skipped
+type AuditQuery struct {
+	Actor      string
+	Action     string
+	Target     string
+	Outcome    string
+	From       int64
+	To         int64
+	Descending bool
+	Limit      int64
+	Offset     int64
+}
+
+// AuditVerification is the result of VerifyAuditLog.
+//
+//   - Valid:     Whether every chained entry matches its hash and links to its predecessor
+//   - Entries:   Number of entries checked
+//   - Unchained: Entries written before the log was chained, they precede the chain
+//   - BrokenAt:  ID of the first entry that fails the check, 0 if valid
+//   - Reason:    Why BrokenAt fails, empty if valid
+type AuditVerification struct {
+	Valid     bool
+	Entries   int64
+	Unchained int64
+	BrokenAt  int64
+	Reason    string
+}
+
+// auditMutex serializes appends, every entry has to link to the one written before it.
+var auditMutex sync.Mutex
+
+const getLastAuditEntry string = `
+SELECT id, hash FROM audit_log
+ORDER BY id DESC
+LIMIT 1
+`
+
+const getAuditActor string = `
+SELECT email FROM users WHERE id = $1
+`
+
+const insertAuditEntry string = `
+INSERT INTO audit_log (id, created_at, user_id, actor, action, target, source_ip, outcome, detail, previous_hash, hash)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+`
+
+// AddAuditEntry appends an event to the audit log.
+//
+// The entry is chained to the last one: it stores the hash of its predecessor and
+// a hash over its own fields, so changing or removing an entry later breaks the
+// chain (see VerifyAuditLog). The table itself refuses updates and deletes.
+//
+// Parameters:
+//   - db: Database connection handle
+//   - event: The event, Action is required
+func AddAuditEntry(db *sql.DB, event AuditEvent) error {
+	var encoded []byte = []byte("{}")
+
+	if event.Detail != nil {
+		var err error
+		encoded, err = json.Marshal(event.Detail)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit detail: %w", err)
+		}
+	}
+
+	if event.Outcome == "" {
+		event.Outcome = AUDIT_SUCCESS
+	}
+
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var last_id int64
+	var previous_hash string
+
+	err = tx.QueryRow(getLastAuditEntry).Scan(&last_id, &previous_hash)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to read last audit entry: %w", err)
+	}
+
+	var actor string
+
+	if event.UserID != 0 {
+		err = tx.QueryRow(getAuditActor, event.UserID).Scan(&actor)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to read audit actor: %w", err)
+		}
+	}
+
+	var entry AuditEntry = AuditEntry{
+		ID:           last_id + 1,
+		CreatedAt:    time.Now().UTC().Unix(),
+		UserID:       event.UserID,
+		Actor:        actor,
+		Action:       event.Action,
+		Target:       event.Target,
+		SourceIP:     event.SourceIP,
+		Outcome:      event.Outcome,
+		Detail:       encoded,
+		PreviousHash: previous_hash,
+	}
+
+	entry.Hash, err = audit_hash(entry)
+	if err != nil {
+		return err
+	}
+
+	var user sql.NullInt64 = sql.NullInt64{Int64: entry.UserID, Valid: entry.UserID != 0}
+
+	_, err = tx.Exec(
+		insertAuditEntry,
+		entry.ID,
+		entry.CreatedAt,
+		user,
+		entry.Actor,
+		entry.Action,
+		entry.Target,
+		entry.SourceIP,
+		entry.Outcome,
+		string(entry.Detail),
+		entry.PreviousHash,
+		entry.Hash,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// audit_hash computes the hash of an entry from its stored fields and the hash of its predecessor.
+func audit_hash(entry AuditEntry) (string, error) {
+	fields, err := json.Marshal([]any{
+		entry.ID,
+		entry.CreatedAt,
+		entry.UserID,
+		entry.Actor,
+		entry.Action,
+		entry.Target,
+		entry.SourceIP,
+		entry.Outcome,
+		string(entry.Detail),
+		entry.PreviousHash,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+
+	var sum [32]byte = sha256.Sum256(fields)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+const listAuditEntries string = `
+SELECT a.id, a.created_at, IFNULL(a.user_id, 0), a.actor, a.action, a.target,
+	a.source_ip, a.outcome, a.detail, a.previous_hash, a.hash
+FROM audit_log a
+WHERE `
+
+const countAuditEntries string = `
+SELECT COUNT(*)
+FROM audit_log a
+WHERE `
+
+// Conditions of AuditQuery, joined with AND.
+const (
+	auditAll       string = `TRUE`
+	auditByActor   string = `a.actor = ?`
+	auditByAction  string = `(a.action = ? OR a.action LIKE ? ESCAPE '\')`
+	auditByTarget  string = `a.target = ?`
+	auditByOutcome string = `a.outcome = ?`
+	auditFrom      string = `a.created_at >= ?`
+	auditUntil     string = `a.created_at < ?`
+	auditPageLimit string = ` LIMIT ? OFFSET ?`
+)
+
+// GetAuditEntries returns a page of the audit log, ordered by ID.
+//
+// Returns:
+//   - []AuditEntry: Entries of the page, empty if the page is past the end
+//   - int64: Number of entries matching the query across all pages
+//   - error: Database errors
+func GetAuditEntries(db *sql.DB, query AuditQuery) ([]AuditEntry, int64, error) {
+	var conditions []string = []string{auditAll}
+	var arguments []any
+
+	if query.Actor != "" {
+		conditions = append(conditions, auditByActor)
+		arguments = append(arguments, query.Actor)
+	}
+
+	if query.Action != "" {
+		conditions = append(conditions, auditByAction)
+		arguments = append(arguments, query.Action, escape_like(query.Action)+".%")
+	}
+
+	if query.Target != "" {
+		conditions = append(conditions, auditByTarget)
+		arguments = append(arguments, query.Target)
+	}
+
+	if query.Outcome != "" {
+		conditions = append(conditions, auditByOutcome)
+		arguments = append(arguments, query.Outcome)
+	}
+
+	if query.From != 0 {
+		conditions = append(conditions, auditFrom)
+		arguments = append(arguments, query.From)
+	}
+
+	if query.To != 0 {
+		conditions = append(conditions, auditUntil)
+		arguments = append(arguments, query.To)
+	}
+
+	var where string = strings.Join(conditions, " AND ")
+
+	var total int64
+	if err := db.QueryRow(countAuditEntries+where, arguments...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count failed: %w", err)
+	}
+
+	var order string = " ORDER BY a.id ASC"
+	if query.Descending {
+		order = " ORDER BY a.id DESC"
+	}
+
+	var limit int64 = query.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := db.Query(listAuditEntries+where+order+auditPageLimit, append(arguments, limit, query.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry = []AuditEntry{}
+
+	for rows.Next() {
+		entry, err := scan_audit_entry(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return entries, total, nil
+}
+
+// scan_audit_entry reads an entry selected with the columns of listAuditEntries.
+func scan_audit_entry(rows *sql.Rows) (AuditEntry, error) {
+	var entry AuditEntry
+	var detail string
+
+	err := rows.Scan(
+		&entry.ID,
+		&entry.CreatedAt,
+		&entry.UserID,
+		&entry.Actor,
+		&entry.Action,
+		&entry.Target,
+		&entry.SourceIP,
+		&entry.Outcome,
+		&detail,
+		&entry.PreviousHash,
+		&entry.Hash,
+	)
+	if err != nil {
+		return AuditEntry{}, fmt.Errorf("scan failed: %w", err)
+	}
+
+	entry.Detail = json.RawMessage(detail)
+	return entry, nil
+}
+
+// VerifyAuditLog recomputes the hash chain of the whole audit log.
+//
+// Entries written before the log was chained carry no hash; they are counted as
+// unchained as long as no chained entry precedes them. Any other missing, altered
+// or reordered entry breaks the chain at the first entry that no longer matches.
+func VerifyAuditLog(db *sql.DB) (AuditVerification, error) {
+	rows, err := db.Query(listAuditEntries + auditAll + " ORDER BY a.id ASC")
+	if err != nil {
+		return AuditVerification{}, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var verification AuditVerification = AuditVerification{Valid: true}
+	var previous_hash string
+	var chained bool
+
+	for rows.Next() {
+		entry, err := scan_audit_entry(rows)
+		if err != nil {
+			return AuditVerification{}, err
+		}
+
+		verification.Entries++
+
+		if !verification.Valid {
+			continue
+		}
+
+		if entry.Hash == "" && !chained {
+			verification.Unchained++
+			continue
+		}
+
+		chained = true
+
+		hash, err := audit_hash(entry)
+		if err != nil {
+			return AuditVerification{}, err
+		}
+
+		var reason string
+
+		switch {
+		case entry.PreviousHash != previous_hash:
+			reason = "does not link to the preceding entry"
+		case entry.Hash != hash:
+			reason = "does not match its hash"
+		}
+
+		if reason != "" {
+			verification = AuditVerification{
+				Entries:   verification.Entries,
+				Unchained: verification.Unchained,
+				BrokenAt:  entry.ID,
+				Reason:    fmt.Sprintf("entry %d %s", entry.ID, reason),
+			}
+			continue
+		}
+
+		previous_hash = entry.Hash
+	}
+
+	if err := rows.Err(); err != nil {
+		return AuditVerification{}, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return verification, nil
+}
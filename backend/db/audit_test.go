@@ -0,0 +1,98 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+)
+
+// chainedAuditLog returns a migrated database with three chained audit entries, IDs 1 to 3,
+// whose append-only triggers are dropped so the test can tamper with them.
+func chainedAuditLog(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db_handle := openDatabase(t)
+
+	if err := Migrate(db_handle); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, action := range []string{"user.login", "document.upload", "user.logout"} {
+		if err := AddAuditEntry(db_handle, AuditEvent{Action: action, Target: "document:contract.pdf"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	verification, err := VerifyAuditLog(db_handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if verification != (AuditVerification{Valid: true, Entries: 3}) {
+		t.Fatalf("untouched log: %+v", verification)
+	}
+
+	if _, err := db_handle.Exec(`DROP TRIGGER audit_log_no_update; DROP TRIGGER audit_log_no_delete;`); err != nil {
+		t.Fatal(err)
+	}
+
+	return db_handle
+}
+
+func TestAuditLogIsAppendOnly(t *testing.T) {
+	db_handle := openDatabase(t)
+
+	if err := Migrate(db_handle); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AddAuditEntry(db_handle, AuditEvent{Action: "user.login"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db_handle.Exec(`UPDATE audit_log SET action = 'user.logout'`); err == nil {
+		t.Error("entry updated")
+	}
+
+	if _, err := db_handle.Exec(`DELETE FROM audit_log`); err == nil {
+		t.Error("entry deleted")
+	}
+}
+
+func TestVerifyAuditLogDetectsTampering(t *testing.T) {
+	for name, test := range map[string]struct {
+		tamper string
+		want   AuditVerification
+	}{
+		"edited field": {
+			tamper: `UPDATE audit_log SET target = 'document:statute.pdf' WHERE id = 2`,
+			want:   AuditVerification{Entries: 3, BrokenAt: 2, Reason: "entry 2 does not match its hash"},
+		},
+		"edited field and hash": {
+			tamper: `UPDATE audit_log SET outcome = 'denied', hash = 'forged' WHERE id = 2`,
+			want:   AuditVerification{Entries: 3, BrokenAt: 2, Reason: "entry 2 does not match its hash"},
+		},
+		"deleted entry": {
+			tamper: `DELETE FROM audit_log WHERE id = 2`,
+			want:   AuditVerification{Entries: 2, BrokenAt: 3, Reason: "entry 3 does not link to the preceding entry"},
+		},
+		"deleted first entry": {
+			tamper: `DELETE FROM audit_log WHERE id = 1`,
+			want:   AuditVerification{Entries: 2, BrokenAt: 2, Reason: "entry 2 does not link to the preceding entry"},
+		},
+	} {
+		db_handle := chainedAuditLog(t)
+
+		if _, err := db_handle.Exec(test.tamper); err != nil {
+			t.Fatal(err)
+		}
+
+		verification, err := VerifyAuditLog(db_handle)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if verification != test.want {
+			t.Errorf("%s: %+v, want %+v", name, verification, test.want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Blob is a unique document content, identified by its SHA-256.
+//
+// Documents of users and of the legal library reference blobs by hash. The
+// reference count is maintained by triggers on user_documents and
+// library_documents, a blob is removed with its last reference.
+//
+//   - SHA256:    Hex encoded SHA-256 of the content
+//   - Size:      Content length in bytes
+//   - RefCount:  Number of documents with this content
+//   - CreatedAt: Unix timestamp of the first upload
+type Blob struct {
+	SHA256    string
+	Size      int64
+	RefCount  int64
+	CreatedAt int64
+}
+
+const insertBlob string = `
+INSERT OR IGNORE INTO blobs (sha256, size, ref_count, created_at)
+VALUES ($1, $2, 0, $3)
+`
+
+// add_blob registers content before a document referencing it is inserted in the same transaction.
+func add_blob(tx *sql.Tx, sha256 string, size int64) error {
+	if _, err := tx.Exec(insertBlob, sha256, size, time.Now().UTC().Unix()); err != nil {
+		return fmt.Errorf("failed to add blob: %w", err)
+	}
+	return nil
+}
+
+const getBlob string = `
+SELECT sha256, size, ref_count, created_at
+FROM blobs
+WHERE sha256 = ?
+`
+
+// GetBlob returns the blob of a content hash.
+//
+// Returns:
+//   - error: sql.ErrNoRows if no document has this content
+func GetBlob(db *sql.DB, sha256 string) (Blob, error) {
+	var blob Blob
+
+	err := db.QueryRow(getBlob, sha256).Scan(&blob.SHA256, &blob.Size, &blob.RefCount, &blob.CreatedAt)
+	if err != nil {
+		return Blob{}, err
+	}
+
+	return blob, nil
+}
+
+const getBlobSource string = `
+SELECT storage_name FROM user_documents WHERE sha256 = $1
+UNION ALL
+SELECT storage_name FROM library_documents WHERE sha256 = $1
+LIMIT 1
+`
+
+// GetBlobSource finds a document the ML pipeline has already processed with the given content.
+//
+// Returns:
+//   - string: Storage name of the document
+//   - error: sql.ErrNoRows if no document has this content
+func GetBlobSource(db *sql.DB, sha256 string) (string, error) {
+	var storage_name string
+
+	if err := db.QueryRow(getBlobSource, sha256).Scan(&storage_name); err != nil {
+		return "", err
+	}
+
+	return storage_name, nil
+}
+
+const getDocumentByHash string = `
+SELECT
+	d.original_name, d.storage_name, d.title, d.size, d.mime_type, d.page_count, d.uploaded_at,
+	IFNULL(d.sha256, ''),
+	IFNULL((SELECT GROUP_CONCAT(t.tag, ',') FROM document_tags t WHERE t.user_id = d.user_id AND t.storage_name = d.storage_name), '')
+FROM user_documents d
+WHERE d.user_id = $1 AND d.sha256 = $2
+`
+
+// GetDocumentByHash finds the document of a user with the given content.
+//
+// Returns:
+//   - error: sql.ErrNoRows if the user has no such document
+func GetDocumentByHash(db *sql.DB, user_id int64, sha256 string) (DocumentRecord, error) {
+	var document DocumentRecord
+	var tags string
+
+	err := db.QueryRow(getDocumentByHash, user_id, sha256).Scan(
+		&document.OriginalName,
+		&document.StorageName,
+		&document.Title,
+		&document.Size,
+		&document.MimeType,
+		&document.PageCount,
+		&document.UploadedAt,
+		&document.SHA256,
+		&tags,
+	)
+
+	if err != nil {
+		return DocumentRecord{}, err
+	}
+
+	document.Tags = split_tags(tags)
+	document.OwnerID = user_id
+	document.Access = DOCUMENT_OWNER
+	return document, nil
+}
+
+const keepReusedBlobs string = `
+DELETE FROM blob_garbage
+WHERE sha256 IN (SELECT sha256 FROM blobs)
+`
+
+const takeBlobGarbage string = `
+DELETE FROM blob_garbage
+RETURNING sha256
+`
+
+// TakeBlobGarbage returns the hashes of blobs removed since the last call, so their files can be deleted.
+//
+// Blobs are recorded as garbage by a trigger when their last reference goes,
+// including references removed by cascades. Content uploaded again in the
+// meantime is not returned.
+//
+// Returns:
+//   - []string: Hex encoded SHA-256 of every removed blob, each returned once
+func TakeBlobGarbage(db *sql.DB) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(keepReusedBlobs); err != nil {
+		return nil, fmt.Errorf("failed to keep reused blobs: %w", err)
+	}
+
+	rows, err := tx.Query(takeBlobGarbage)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var hashes []string
+
+	for rows.Next() {
+		var sha256 string
+		if err := rows.Scan(&sha256); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		hashes = append(hashes, sha256)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	rows.Close()
+	return hashes, tx.Commit()
+}
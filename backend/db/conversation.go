@@ -0,0 +1,185 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Conversation is a named chat of a user.
+//
+//   - ID:        Auto-incremented primary key, forwarded to the ML pipeline as "Conversation" header
+//   - UserID:    Owner of the conversation
+//   - Title:     Display name chosen by the user
+//   - CreatedAt: Unix timestamp of creation
+//   - UpdatedAt: Unix timestamp of the last message or rename
+//   - Archived:  Archived conversations are hidden from the default listing
+type Conversation struct {
+	ID        int64
+	UserID    int64
+	Title     string
+	CreatedAt int64
+	UpdatedAt int64
+	Archived  bool
+}
+
+const insertConversation string = `
+INSERT INTO conversations (user_id, title, created_at, updated_at, archived)
+VALUES ($1, $2, $3, $3, FALSE)
+`
+
+// AddConversation creates a new conversation for a user.
+//
+// Returns:
+//   - Conversation: The stored conversation including its ID
+//   - error: Database errors
+func AddConversation(db *sql.DB, user_id int64, title string) (Conversation, error) {
+	var now int64 = time.Now().UTC().Unix()
+
+	result, err := db.Exec(insertConversation, user_id, title, now)
+	if err != nil {
+		return Conversation{}, fmt.Errorf("failed to create conversation: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Conversation{}, fmt.Errorf("failed to get conversation id: %w", err)
+	}
+
+	return Conversation{ID: id, UserID: user_id, Title: title, CreatedAt: now, UpdatedAt: now}, nil
+}
+
+const getConversation string = `
+SELECT id, user_id, title, created_at, updated_at, archived
+FROM conversations
+WHERE id = ? AND user_id = ?
+`
+
+// GetConversation retrieves a conversation if it belongs to the given user.
+//
+// Returns:
+//   - Conversation: The conversation
+//   - error: sql.ErrNoRows if it does not exist or belongs to another user
+func GetConversation(db *sql.DB, id int64, user_id int64) (Conversation, error) {
+	var conversation Conversation
+
+	err := db.QueryRow(getConversation, id, user_id).Scan(
+		&conversation.ID,
+		&conversation.UserID,
+		&conversation.Title,
+		&conversation.CreatedAt,
+		&conversation.UpdatedAt,
+		&conversation.Archived,
+	)
+
+	return conversation, err
+}
+
+const getConversations string = `
+SELECT id, user_id, title, created_at, updated_at, archived
+FROM conversations
+WHERE user_id = ? AND (archived = FALSE OR ?)
+ORDER BY updated_at DESC, id DESC
+`
+
+// GetConversations lists the conversations of a user, most recently used first.
+//
+// Parameters:
+//   - db: Database connection handle
+//   - user_id: Owner of the conversations
+//   - include_archived: Whether archived conversations are listed as well
+func GetConversations(db *sql.DB, user_id int64, include_archived bool) ([]Conversation, error) {
+	rows, err := db.Query(getConversations, user_id, include_archived)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	conversations := []Conversation{}
+
+	for rows.Next() {
+		var conversation Conversation
+		if err := rows.Scan(
+			&conversation.ID,
+			&conversation.UserID,
+			&conversation.Title,
+			&conversation.CreatedAt,
+			&conversation.UpdatedAt,
+			&conversation.Archived,
+		); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		conversations = append(conversations, conversation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return conversations, nil
+}
+
+const renameConversation string = `
+UPDATE conversations
+SET title = $1, updated_at = $2
+WHERE id = $3 AND user_id = $4
+`
+
+// RenameConversation changes the title of a conversation owned by the user.
+func RenameConversation(db *sql.DB, id int64, user_id int64, title string) error {
+	return expectOneRow(db.Exec(renameConversation, title, time.Now().UTC().Unix(), id, user_id))
+}
+
+const archiveConversation string = `
+UPDATE conversations
+SET archived = $1
+WHERE id = $2 AND user_id = $3
+`
+
+// SetConversationArchived archives or restores a conversation owned by the user.
+func SetConversationArchived(db *sql.DB, id int64, user_id int64, archived bool) error {
+	return expectOneRow(db.Exec(archiveConversation, archived, id, user_id))
+}
+
+const touchConversation string = `
+UPDATE conversations
+SET updated_at = $1
+WHERE id = $2
+`
+
+// TouchConversation marks a conversation as used now, moving it to the top of the listing.
+func TouchConversation(db *sql.DB, id int64) error {
+	_, err := db.Exec(touchConversation, time.Now().UTC().Unix(), id)
+	return err
+}
+
+const deleteConversation string = `
+DELETE FROM conversations
+WHERE id = $1 AND user_id = $2
+`
+
+// DeleteConversation removes a conversation owned by the user.
+//
+// Note:
+//   - Only removes the conversation record, the messages are stored in the ML pipeline
+func DeleteConversation(db *sql.DB, id int64, user_id int64) error {
+	return expectOneRow(db.Exec(deleteConversation, id, user_id))
+}
+
+// expectOneRow turns an update that matched no row into sql.ErrNoRows.
+func expectOneRow(result sql.Result, err error) error {
+	if err != nil {
+		return fmt.Errorf("error executing statement: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -1,13 +1,11 @@
 package db
 
-import "encoding/json"
-
 // Defines an insertible user.
 // User defines a user object for insertion into the system.
 // This represents the basic user information required for account creation.
 // Fields:
 //   - Name:     The full name of the user (required)
-//   - Password: The user's password (stored in plaintext - should be hashed before storage)
+//   - Password: The user's password hash (see auth.HashPassword)
 //   - Email:    The user's email address (must be unique)
 //   - IsAdmin:  Flag indicating administrator privileges (default: false)
 type User struct {
@@ -22,10 +20,11 @@ type User struct {
 // This extends the basic User struct with database-specific fields.
 // Fields:
 //   - Name:     The full name of the user (indexed)
-//   - Password: The hashed password (should never be stored in plaintext)
+//   - Password: The hashed password (legacy rows may still be plaintext until the next login)
 //   - Email:    The user's email address (unique constraint)
 //   - ID:       The auto-incremented primary key from the database
 //   - IsAdmin:  Administrator status flag (default: false)
+//   - Role:     One of the ROLE_* constants, determines the permissions
 type DataBaseUser struct {
 	Name      string
 	Password  string
@@ -33,12 +32,14 @@ type DataBaseUser struct {
 	ID        int64
 	IsAdmin   bool
 	IsPremium bool
+	Role      string
 }
 
 // Isolated UserInfo to not reveal sensitive information.
 type UserInfo struct {
 	Email   string
 	IsAdmin bool
+	Role    string
 }
 
 func CreateUser(name string, password string, email string, is_premium bool) User {
@@ -49,6 +50,8 @@ func CreateAdmin(name string, password string, email string) User {
 	return User{Name: name, Password: password, Email: email, IsAdmin: true, IsPremium: true}
 }
 
+// SignupRequest is a pending account request.
+// Password holds the hash of the requested password once stored.
 type SignupRequest struct {
 	Name     string
 	Password string
@@ -63,34 +66,31 @@ type SignupRequestDB struct {
 	Email string
 }
 
+// DocumentRecord is a document of a user, or a document shared with the user.
+//
+//   - OriginalName: File name given at upload
+//   - StorageName:  Identifier of the document in the ML pipeline
+//   - Title:        Display title, the file name for documents uploaded before titles were stored
+//   - Size:         Content length in bytes, 0 if unknown
+//   - MimeType:     Media type of the document format, empty if unknown
+//   - PageCount:    Number of pages, 0 if unknown or the format has no pages
+//   - UploadedAt:   Unix timestamp of the upload, 0 if unknown
+//   - SHA256:       Hex encoded SHA-256 of the content, empty if unknown
+//   - Tags:         Labels chosen by the owner, sorted
+//   - OwnerID:      User who uploaded the document, its collection in the ML pipeline
+//   - Owner:        Name of that user
+//   - Access:       DOCUMENT_OWNER for own documents, else the share permission (SHARE_READ or SHARE_RETRIEVE)
 type DocumentRecord struct {
 	OriginalName string
 	StorageName  string
-}
-
-type PreviousPrompts struct {
-	prompts [10]string
-}
-
-// Adds a prompt, maintaining a rotating cache of the last 10 prompts.
-func (p *PreviousPrompts) AddPrompt(prompt string) {
-	// Shift all elements left (drop oldest)
-	copy(p.prompts[:], p.prompts[1:])
-	// Add new prompt at the end
-	p.prompts[9] = prompt
-}
-
-// Returns a copy of the prompts (safe from external modification).
-func (p *PreviousPrompts) GetPrompts() []string {
-	return append([]string(nil), p.prompts[:]...)
-}
-
-// Serializes the prompts to JSON.
-func (p *PreviousPrompts) Serialize() ([]byte, error) {
-	return json.Marshal(p.prompts)
-}
-
-// Deserializes JSON into an existing PreviousPrompts struct.
-func (p *PreviousPrompts) Deserialize(bytes []byte) error {
-	return json.Unmarshal(bytes, &p.prompts)
+	Title        string
+	Size         int64
+	MimeType     string
+	PageCount    int64
+	UploadedAt   int64
+	SHA256       string
+	Tags         []string
+	OwnerID      int64
+	Owner        string
+	Access       string
 }
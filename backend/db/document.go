@@ -0,0 +1,359 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Sort keys of DocumentQuery.
+const (
+	DOCUMENT_SORT_NAME        string = "name"
+	DOCUMENT_SORT_TITLE       string = "title"
+	DOCUMENT_SORT_UPLOADED_AT string = "uploaded_at"
+	DOCUMENT_SORT_SIZE        string = "size"
+)
+
+// Scopes of DocumentQuery.
+const (
+	DOCUMENT_SCOPE_ALL    string = ""
+	DOCUMENT_SCOPE_OWN    string = "own"
+	DOCUMENT_SCOPE_SHARED string = "shared"
+)
+
+// Access of the caller's own documents in DocumentRecord, shared documents carry the share permission.
+const DOCUMENT_OWNER string = "owner"
+
+// Columns ordered by for each sort key. Only these values ever end up in ORDER BY.
+var documentSortColumns map[string]string = map[string]string{
+	DOCUMENT_SORT_NAME:        "d.original_name COLLATE NOCASE",
+	DOCUMENT_SORT_TITLE:       "d.title COLLATE NOCASE",
+	DOCUMENT_SORT_UPLOADED_AT: "d.uploaded_at",
+	DOCUMENT_SORT_SIZE:        "d.size",
+}
+
+// DocumentQuery selects a page of the documents a user owns or that are shared with the user.
+//
+//   - Scope:      One of the DOCUMENT_SCOPE_* values, own and shared documents if empty
+//   - Search:     Case-insensitive substring of the file name or title, empty for all
+//   - Tags:       Tags a document must all carry
+//   - From, To:   Unix timestamps, documents uploaded in [From, To); 0 leaves the bound open
+//   - Sort:       One of the DOCUMENT_SORT_* keys, DOCUMENT_SORT_UPLOADED_AT if empty
+//   - Descending: Reverses the order
+//   - Limit:      Maximum number of documents returned
+//   - Offset:     Number of matching documents skipped
+type DocumentQuery struct {
+	Scope      string
+	Search     string
+	Tags       []string
+	From       int64
+	To         int64
+	Sort       string
+	Descending bool
+	Limit      int64
+	Offset     int64
+}
+
+const addDocument string = `
+INSERT INTO user_documents (user_id, original_name, storage_name, sha256, title, size, mime_type, page_count, uploaded_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+`
+
+const addDocumentTag string = `
+INSERT OR IGNORE INTO document_tags (user_id, storage_name, tag)
+VALUES ($1, $2, $3)
+`
+
+// AddDocument associates a document with a user in the database.
+//
+// Parameters:
+//   - db: Database connection handle
+//   - id: User ID (foreign key)
+//   - document: The document; its SHA256 and Size are registered as blob
+//
+// Returns:
+//   - error: Database operation errors, a constraint error if the user already
+//     has a document with this content
+//
+// Note:
+//   - Documents are automatically deleted when users are removed (ON DELETE CASCADE)
+func AddDocument(db *sql.DB, id int64, document DocumentRecord) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := add_blob(tx, document.SHA256, document.Size); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		addDocument,
+		id,
+		document.OriginalName,
+		document.StorageName,
+		document.SHA256,
+		document.Title,
+		document.Size,
+		document.MimeType,
+		document.PageCount,
+		document.UploadedAt,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range document.Tags {
+		if _, err := tx.Exec(addDocumentTag, id, document.StorageName, tag); err != nil {
+			return fmt.Errorf("failed to add tag: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Documents of the user given as the 1st parameter and documents shared with the user
+// (2nd to 4th parameter), each with its access. position keeps the upload order.
+const accessibleDocuments string = `
+FROM (
+	SELECT d.rowid AS position, d.*, 'owner' AS access
+	FROM user_documents d
+	WHERE d.user_id = ?
+	UNION ALL
+	SELECT d.rowid, d.*, g.access
+	FROM user_documents d
+	JOIN (` + sharedWithUser + `) g ON g.owner_id = d.user_id AND g.storage_name = d.storage_name
+) d
+`
+
+const countDocuments string = `
+SELECT COUNT(*)
+` + accessibleDocuments + `
+WHERE `
+
+const listDocuments string = `
+SELECT
+	d.original_name, d.storage_name, d.title, d.size, d.mime_type, d.page_count, d.uploaded_at,
+	IFNULL(d.sha256, ''),
+	IFNULL((SELECT GROUP_CONCAT(t.tag, ',') FROM document_tags t WHERE t.user_id = d.user_id AND t.storage_name = d.storage_name), ''),
+	d.user_id, IFNULL((SELECT name FROM users WHERE id = d.user_id), ''), d.access
+` + accessibleDocuments + `
+WHERE `
+
+// Conditions of DocumentQuery, joined with AND.
+const (
+	documentsAll       string = `TRUE`
+	documentsOwned     string = `d.access = 'owner'`
+	documentsShared    string = `d.access <> 'owner'`
+	documentsMatching  string = `(d.original_name LIKE ? ESCAPE '\' OR d.title LIKE ? ESCAPE '\')`
+	documentsWithTag   string = `EXISTS (SELECT 1 FROM document_tags t WHERE t.user_id = d.user_id AND t.storage_name = d.storage_name AND t.tag = ?)`
+	documentsFrom      string = `d.uploaded_at >= ?`
+	documentsUntil     string = `d.uploaded_at < ?`
+	documentsPageLimit string = ` LIMIT ? OFFSET ?`
+)
+
+// GetDocuments returns a page of the documents a user owns or can access through shares.
+//
+// Documents with equal sort values keep their upload order, so pages are stable.
+// Tags of shared documents are the tags their owner chose.
+//
+// Returns:
+//   - []DocumentRecord: Documents of the page, empty if the page is past the end
+//   - int64: Number of documents matching the query across all pages
+//   - error: Unknown sort key or database error
+func GetDocuments(db *sql.DB, user_id int64, query DocumentQuery) ([]DocumentRecord, int64, error) {
+	if query.Sort == "" {
+		query.Sort = DOCUMENT_SORT_UPLOADED_AT
+	}
+
+	column, known := documentSortColumns[query.Sort]
+	if !known {
+		return nil, 0, fmt.Errorf("unknown sort key %q", query.Sort)
+	}
+
+	var direction string = "ASC"
+	if query.Descending {
+		direction = "DESC"
+	}
+
+	var conditions []string
+	var arguments []any = []any{user_id, user_id, user_id, user_id}
+
+	switch query.Scope {
+	case DOCUMENT_SCOPE_ALL:
+		conditions = append(conditions, documentsAll)
+	case DOCUMENT_SCOPE_OWN:
+		conditions = append(conditions, documentsOwned)
+	case DOCUMENT_SCOPE_SHARED:
+		conditions = append(conditions, documentsShared)
+	default:
+		return nil, 0, fmt.Errorf("unknown scope %q", query.Scope)
+	}
+
+	if query.Search != "" {
+		var pattern string = "%" + escape_like(query.Search) + "%"
+		conditions = append(conditions, documentsMatching)
+		arguments = append(arguments, pattern, pattern)
+	}
+
+	for _, tag := range query.Tags {
+		conditions = append(conditions, documentsWithTag)
+		arguments = append(arguments, tag)
+	}
+
+	if query.From != 0 {
+		conditions = append(conditions, documentsFrom)
+		arguments = append(arguments, query.From)
+	}
+
+	if query.To != 0 {
+		conditions = append(conditions, documentsUntil)
+		arguments = append(arguments, query.To)
+	}
+
+	var where string = strings.Join(conditions, " AND ")
+
+	var total int64
+	if err := db.QueryRow(countDocuments+where, arguments...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count failed: %w", err)
+	}
+
+	var order string = fmt.Sprintf(" ORDER BY %s %s, d.position %s", column, direction, direction)
+
+	rows, err := db.Query(listDocuments+where+order+documentsPageLimit, append(arguments, query.Limit, query.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var documents []DocumentRecord = []DocumentRecord{}
+
+	for rows.Next() {
+		var document DocumentRecord
+		var tags string
+
+		err := rows.Scan(
+			&document.OriginalName,
+			&document.StorageName,
+			&document.Title,
+			&document.Size,
+			&document.MimeType,
+			&document.PageCount,
+			&document.UploadedAt,
+			&document.SHA256,
+			&tags,
+			&document.OwnerID,
+			&document.Owner,
+			&document.Access,
+		)
+
+		if err != nil {
+			return nil, 0, fmt.Errorf("scan failed: %w", err)
+		}
+
+		document.Tags = split_tags(tags)
+		documents = append(documents, document)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return documents, total, nil
+}
+
+const getAccessibleDocument string = listDocuments + `d.sha256 = ?
+ORDER BY d.access = 'owner' DESC, d.position
+LIMIT 1
+`
+
+// GetAccessibleDocument finds a document with the given content that a user owns or that is shared with the user.
+//
+// The user's own copy is preferred over shared ones.
+//
+// Returns:
+//   - error: sql.ErrNoRows if the user can access no such document
+func GetAccessibleDocument(db *sql.DB, user_id int64, sha256 string) (DocumentRecord, error) {
+	var document DocumentRecord
+	var tags string
+
+	err := db.QueryRow(getAccessibleDocument, user_id, user_id, user_id, user_id, sha256).Scan(
+		&document.OriginalName,
+		&document.StorageName,
+		&document.Title,
+		&document.Size,
+		&document.MimeType,
+		&document.PageCount,
+		&document.UploadedAt,
+		&document.SHA256,
+		&tags,
+		&document.OwnerID,
+		&document.Owner,
+		&document.Access,
+	)
+
+	if err != nil {
+		return DocumentRecord{}, err
+	}
+
+	document.Tags = split_tags(tags)
+	return document, nil
+}
+
+const documentExists string = `
+SELECT 1 FROM user_documents
+WHERE user_id = $1 AND storage_name = $2
+`
+
+const deleteDocumentTags string = `
+DELETE FROM document_tags
+WHERE user_id = $1 AND storage_name = $2
+`
+
+// SetDocumentTags replaces the tags of a user's document.
+//
+// Returns:
+//   - error: sql.ErrNoRows if the user has no such document
+func SetDocumentTags(db *sql.DB, user_id int64, storage_name string, tags []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow(documentExists, user_id, storage_name).Scan(&exists); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(deleteDocumentTags, user_id, storage_name); err != nil {
+		return fmt.Errorf("failed to remove tags: %w", err)
+	}
+
+	for _, tag := range tags {
+		if _, err := tx.Exec(addDocumentTag, user_id, storage_name, tag); err != nil {
+			return fmt.Errorf("failed to add tag: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// split_tags parses tags stored comma separated (GROUP_CONCAT, ingestion jobs) into a sorted list.
+func split_tags(joined string) []string {
+	if joined == "" {
+		return []string{}
+	}
+
+	tags := strings.Split(joined, ",")
+	slices.Sort(tags)
+	return tags
+}
+
+// escape_like escapes the wildcards of a LIKE pattern, '\' is the escape character.
+func escape_like(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(text)
+}
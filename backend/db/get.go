@@ -6,7 +6,7 @@ import (
 )
 
 const userRetrivalQuery string = `
-SELECT email, is_admin
+SELECT email, is_admin, role
 FROM users
 `
 
@@ -21,7 +21,7 @@ func GetUsers(db *sql.DB) ([]UserInfo, error) {
 
 	for rows.Next() {
 		var usr UserInfo
-		if err := rows.Scan(&usr.Email, &usr.IsAdmin); err != nil {
+		if err := rows.Scan(&usr.Email, &usr.IsAdmin, &usr.Role); err != nil {
 			return nil, fmt.Errorf("scan failed: %w", err)
 		}
 		users = append(users, usr)
@@ -30,33 +30,6 @@ func GetUsers(db *sql.DB) ([]UserInfo, error) {
 	return users, nil
 }
 
-const getDocumentsQuery string = `
-SELECT original_name, storage_name
-FROM user_documents
-WHERE user_id = ?
-`
-
-func GetDocuments(db *sql.DB, user_id int64) ([]DocumentRecord, error) {
-	rows, err := db.Query(getDocumentsQuery, user_id)
-
-	if err != nil {
-		return nil, err
-	}
-
-	var documents []DocumentRecord
-
-	for rows.Next() {
-		var document DocumentRecord
-		if err := rows.Scan(&document.OriginalName, &document.StorageName); err != nil {
-			return nil, fmt.Errorf("scan failed: %w", err)
-		}
-
-		documents = append(documents, document)
-	}
-
-	return documents, nil
-}
-
 const getPrompt string = `
 SELECT prompt
 FROM prompts
@@ -2,12 +2,11 @@ package db
 
 import (
 	"database/sql"
-	"log"
 )
 
 const insertUser string = `
-INSERT INTO users (name, password, email, is_admin, is_premium)
-VALUES (?, ?, ?, ?, ?)
+INSERT INTO users (name, password, email, is_admin, is_premium, role)
+VALUES (?, ?, ?, ?, ?, ?)
 `
 
 // AddUser inserts a new user record into the database.
@@ -19,6 +18,8 @@ VALUES (?, ?, ?, ?, ?)
 //   - IsAdmin: Boolean admin flag
 //   - IsPremium: Boolean premium status flag
 //
+// The role of the user is derived from the flags (see UserRole).
+//
 // Returns:
 //   - error: nil on success, or:
 //   - sql.ErrNoRows if email already exists (preventing duplication)
@@ -27,9 +28,7 @@ VALUES (?, ?, ?, ?, ?)
 // Note:
 //   - Email must be unique (enforced by database constraints)
 //   - Password should be hashed before calling this function
-//   - Logs the addition attempt including name and email
 func AddUser(db *sql.DB, user User) error {
-	log.Printf("Adding user %s with email %s", user.Name, user.Email)
 	_, err := db.Exec(
 		insertUser,
 		user.Name,
@@ -37,6 +36,7 @@ func AddUser(db *sql.DB, user User) error {
 		user.Email,
 		user.IsAdmin,
 		user.IsPremium,
+		UserRole(user.IsAdmin, user.IsPremium),
 	)
 
 	return err
@@ -81,12 +81,3 @@ func AddPrompt(db *sql.DB, id int64, pre_prompt string) error {
 	_, err := db.Exec(createPreprompt, id, pre_prompt)
 	return err
 }
-
-const createPrePromptHistory string = `
-INSERT INTO preprompt_history (user_id, prompts)
-VALUES ($1, $2)
-`
-
-// func AddToPrePromptHistory(db *sql.DB, id int64, pre_prompt string) error {
-// 	_, err := db.Exec(createPrePromptHistory, id, nil)
-// }
@@ -0,0 +1,239 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// States of an ingestion job.
+const (
+	JOB_QUEUED     string = "queued"
+	JOB_PROCESSING string = "processing"
+	JOB_READY      string = "ready"
+	JOB_FAILED     string = "failed"
+)
+
+// IngestionJob is an accepted upload waiting for, or done with, processing by the ML pipeline.
+//
+//   - ID:            Identifier returned to the uploader
+//   - UserID:        Uploader, the only user allowed to see the job
+//   - CollectionID:  ID the document is filed under (user ID or the legal library collection)
+//   - Filename:      Original file name, selects the document format
+//   - Title:         Display title of the document
+//   - Path:          Spooled file, removed once the job is ready or failed
+//   - SHA256, Size:  Hex encoded hash and length of the content
+//   - Tags:          Tags the document receives once ready
+//   - State:         JOB_QUEUED, JOB_PROCESSING, JOB_READY or JOB_FAILED
+//   - Attempts:      Number of times processing was started
+//   - Error:         Message of the last failed attempt, empty if there was none
+//   - StorageName:   Identifier of the document in the ML pipeline once ready
+//   - NextAttemptAt: Unix timestamp before which a queued job is not picked up
+//   - CreatedAt:     Unix timestamp of the upload
+//   - UpdatedAt:     Unix timestamp of the last state change
+type IngestionJob struct {
+	ID            int64
+	UserID        int64
+	CollectionID  int64
+	Filename      string
+	Title         string
+	Path          string
+	SHA256        string
+	Size          int64
+	Tags          []string
+	State         string
+	Attempts      int64
+	Error         string
+	StorageName   string
+	NextAttemptAt int64
+	CreatedAt     int64
+	UpdatedAt     int64
+}
+
+const jobColumns string = `
+id, user_id, collection_id, filename, title, path, sha256, size, tags, state,
+attempts, error, storage_name, next_attempt_at, created_at, updated_at
+`
+
+func scanJob(row interface{ Scan(...any) error }) (IngestionJob, error) {
+	var job IngestionJob
+	var tags string
+
+	err := row.Scan(
+		&job.ID,
+		&job.UserID,
+		&job.CollectionID,
+		&job.Filename,
+		&job.Title,
+		&job.Path,
+		&job.SHA256,
+		&job.Size,
+		&tags,
+		&job.State,
+		&job.Attempts,
+		&job.Error,
+		&job.StorageName,
+		&job.NextAttemptAt,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	)
+
+	if err != nil {
+		return IngestionJob{}, err
+	}
+
+	job.Tags = split_tags(tags)
+	return job, nil
+}
+
+const insertJob string = `
+INSERT INTO ingestion_jobs (user_id, collection_id, filename, title, path, sha256, size, tags, next_attempt_at, created_at, updated_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9, $9)
+RETURNING` + jobColumns
+
+// CreateJob queues a spooled upload for processing.
+//
+// Only UserID, CollectionID, Filename, Title, Path, SHA256, Size and Tags of job are used.
+// Tags must not contain commas.
+//
+// Returns:
+//   - IngestionJob: The queued job
+func CreateJob(db *sql.DB, job IngestionJob) (IngestionJob, error) {
+	created, err := scanJob(db.QueryRow(
+		insertJob,
+		job.UserID,
+		job.CollectionID,
+		job.Filename,
+		job.Title,
+		job.Path,
+		job.SHA256,
+		job.Size,
+		strings.Join(job.Tags, ","),
+		time.Now().UTC().Unix(),
+	))
+
+	if err != nil {
+		return IngestionJob{}, fmt.Errorf("failed to create job: %w", err)
+	}
+
+	return created, nil
+}
+
+const getJob string = `
+SELECT` + jobColumns + `
+FROM ingestion_jobs
+WHERE id = $1 AND user_id = $2
+`
+
+// GetJob returns an ingestion job of a user.
+//
+// Returns:
+//   - error: sql.ErrNoRows if the job does not exist or belongs to another user
+func GetJob(db *sql.DB, id int64, user_id int64) (IngestionJob, error) {
+	return scanJob(db.QueryRow(getJob, id, user_id))
+}
+
+const claimJob string = `
+UPDATE ingestion_jobs
+SET state = 'processing', attempts = attempts + 1, updated_at = $1
+WHERE id = (
+	SELECT id FROM ingestion_jobs
+	WHERE state = 'queued' AND next_attempt_at <= $1
+	ORDER BY next_attempt_at, id
+	LIMIT 1
+)
+RETURNING` + jobColumns
+
+// ClaimJob moves the next due queued job to JOB_PROCESSING and counts the attempt.
+//
+// The update is a single statement, so concurrent workers never claim the same job.
+//
+// Returns:
+//   - error: sql.ErrNoRows if no job is due
+func ClaimJob(db *sql.DB) (IngestionJob, error) {
+	return scanJob(db.QueryRow(claimJob, time.Now().UTC().Unix()))
+}
+
+const updateJobReady string = `
+UPDATE ingestion_jobs
+SET state = 'ready', error = '', storage_name = $1, updated_at = $2
+WHERE id = $3
+`
+
+// FinishJob marks a job as ready.
+//
+// Returns:
+//   - error: sql.ErrNoRows if the job does not exist (anymore)
+func FinishJob(db *sql.DB, id int64, storage_name string) error {
+	return expectOneRow(db.Exec(updateJobReady, storage_name, time.Now().UTC().Unix(), id))
+}
+
+const updateJobFailed string = `
+UPDATE ingestion_jobs
+SET state = 'failed', error = $1, updated_at = $2
+WHERE id = $3
+`
+
+// FailJob marks a job as failed for good.
+//
+// Returns:
+//   - error: sql.ErrNoRows if the job does not exist (anymore)
+func FailJob(db *sql.DB, id int64, message string) error {
+	return expectOneRow(db.Exec(updateJobFailed, message, time.Now().UTC().Unix(), id))
+}
+
+const updateJobRetry string = `
+UPDATE ingestion_jobs
+SET state = 'queued', error = $1, next_attempt_at = $2, updated_at = $3
+WHERE id = $4
+`
+
+// RetryJob queues a job again after a failed attempt.
+//
+// Parameters:
+//   - message: Error of the failed attempt, reported while the job waits
+//   - next_attempt_at: Unix timestamp before which the job is not picked up
+//
+// Returns:
+//   - error: sql.ErrNoRows if the job does not exist (anymore)
+func RetryJob(db *sql.DB, id int64, message string, next_attempt_at int64) error {
+	return expectOneRow(db.Exec(updateJobRetry, message, next_attempt_at, time.Now().UTC().Unix(), id))
+}
+
+const requeueJobs string = `
+UPDATE ingestion_jobs
+SET state = 'queued', updated_at = $1
+WHERE state = 'processing'
+`
+
+// RequeueInterruptedJobs queues jobs again that were processing when the server stopped.
+//
+// Must be called before workers start, every processing job is considered abandoned.
+//
+// Returns:
+//   - int64: Number of requeued jobs
+func RequeueInterruptedJobs(db *sql.DB) (int64, error) {
+	result, err := db.Exec(requeueJobs, time.Now().UTC().Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue jobs: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+const deleteFinishedJobs string = `
+DELETE FROM ingestion_jobs
+WHERE state IN ('ready', 'failed') AND updated_at < ?
+`
+
+// DeleteFinishedJobs removes ready and failed jobs finished before the given time.
+//
+// Parameters:
+//   - before: Unix timestamp, jobs finished earlier are removed
+func DeleteFinishedJobs(db *sql.DB, before int64) error {
+	if _, err := db.Exec(deleteFinishedJobs, before); err != nil {
+		return fmt.Errorf("failed to delete finished jobs: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// LibraryDocument is a document of the shared legal library managed by administrators.
+//
+//   - ID:           Auto-incremented primary key
+//   - OriginalName: File name as uploaded
+//   - StorageName:  Identifier of the document in the ML pipeline
+//   - Title:        Display title
+//   - UploadedBy:   Administrator who uploaded the document, 0 if the account was deleted
+//   - CreatedAt:    Unix timestamp of the upload
+type LibraryDocument struct {
+	ID           int64
+	OriginalName string
+	StorageName  string
+	Title        string
+	UploadedBy   int64
+	CreatedAt    int64
+}
+
+const insertLibraryDocument string = `
+INSERT INTO library_documents (original_name, storage_name, title, uploaded_by, created_at, sha256)
+VALUES ($1, $2, $3, $4, $5, $6)
+`
+
+// AddLibraryDocument records a document of the shared legal library.
+//
+// Parameters:
+//   - sha256, size: Hash and length of the content, registered as blob
+//
+// Returns:
+//   - error: Database errors, a constraint error if the library already has this content
+func AddLibraryDocument(
+	db *sql.DB,
+	original_name string,
+	storage_name string,
+	title string,
+	uploaded_by int64,
+	sha256 string,
+	size int64,
+) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := add_blob(tx, sha256, size); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(insertLibraryDocument, original_name, storage_name, title, uploaded_by, time.Now().UTC().Unix(), sha256)
+	if err != nil {
+		return fmt.Errorf("failed to add library document: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+const getLibraryDocumentByHash string = `
+SELECT id, original_name, storage_name, title, IFNULL(uploaded_by, 0), created_at
+FROM library_documents
+WHERE sha256 = ?
+`
+
+// GetLibraryDocumentByHash finds the library document with the given content.
+//
+// Returns:
+//   - error: sql.ErrNoRows if the library has no such document
+func GetLibraryDocumentByHash(db *sql.DB, sha256 string) (LibraryDocument, error) {
+	var document LibraryDocument
+
+	err := db.QueryRow(getLibraryDocumentByHash, sha256).Scan(
+		&document.ID,
+		&document.OriginalName,
+		&document.StorageName,
+		&document.Title,
+		&document.UploadedBy,
+		&document.CreatedAt,
+	)
+
+	if err != nil {
+		return LibraryDocument{}, err
+	}
+
+	return document, nil
+}
+
+const getLibraryDocuments string = `
+SELECT id, original_name, storage_name, title, IFNULL(uploaded_by, 0), created_at
+FROM library_documents
+ORDER BY title, id
+`
+
+// GetLibraryDocuments lists the documents of the shared legal library.
+func GetLibraryDocuments(db *sql.DB) ([]LibraryDocument, error) {
+	rows, err := db.Query(getLibraryDocuments)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	documents := []LibraryDocument{}
+
+	for rows.Next() {
+		var document LibraryDocument
+		if err := rows.Scan(
+			&document.ID,
+			&document.OriginalName,
+			&document.StorageName,
+			&document.Title,
+			&document.UploadedBy,
+			&document.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		documents = append(documents, document)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return documents, nil
+}
+
+const deleteLibraryDocument string = `
+DELETE FROM library_documents
+WHERE storage_name = ?
+`
+
+// DeleteLibraryDocument removes a document from the shared legal library.
+//
+// Returns:
+//   - error: sql.ErrNoRows if no library document has the storage name
+func DeleteLibraryDocument(db *sql.DB, storage_name string) error {
+	return expectOneRow(db.Exec(deleteLibraryDocument, storage_name))
+}
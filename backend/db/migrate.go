@@ -0,0 +1,703 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Migration is a single versioned change of the database schema.
+//
+//   - Version: Position in the migration order, starting at 1 without gaps
+//   - Name:    Short description shown by the migrate command
+//   - Up:      Statements applying the change
+//   - Down:    Statements reverting the change
+//
+// Both directions run inside a transaction together with the bookkeeping in
+// schema_migrations, so a failing migration leaves the schema untouched.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState is a migration together with whether it is applied to a database.
+type MigrationState struct {
+	Migration
+	Applied   bool
+	AppliedAt int64 // Unix timestamp, 0 if not applied
+}
+
+// migrations is the ordered schema history. Append new migrations at the end and
+// never edit a migration that has been released: existing databases will not run it again.
+//
+// The first migrations use IF NOT EXISTS because databases created before migrations
+// existed already contain their tables; those databases adopt the history as is.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		Up: `
+CREATE TABLE IF NOT EXISTS users (
+	name TEXT NOT NULL,
+	password TEXT NOT NULL,
+	email TEXT NOT NULL UNIQUE,
+	is_admin BOOLEAN,
+	is_premium BOOLEAN,
+	id INTEGER PRIMARY KEY
+);
+
+CREATE TABLE IF NOT EXISTS prompts (
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	prompt TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_documents (
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	original_name TEXT NOT NULL,
+	storage_name TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS signup_requests (
+	name TEXT NOT NULL,
+	password TEXT NOT NULL,
+	email TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS preprompt_history (
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	prompts BLOB
+);
+`,
+		Down: `
+DROP TABLE preprompt_history;
+DROP TABLE signup_requests;
+DROP TABLE user_documents;
+DROP TABLE prompts;
+DROP TABLE users;
+`,
+	},
+	{
+		Version: 2,
+		Name:    "sessions",
+		Up: `
+CREATE TABLE IF NOT EXISTS sessions (
+	id TEXT PRIMARY KEY,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	refresh_hash TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL,
+	revoked BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id ON sessions(user_id);
+`,
+		Down: `
+DROP TABLE sessions;
+`,
+	},
+	{
+		Version: 3,
+		Name:    "conversations",
+		Up: `
+CREATE TABLE IF NOT EXISTS conversations (
+	id INTEGER PRIMARY KEY,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	title TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	archived BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX IF NOT EXISTS conversations_user_id ON conversations(user_id);
+`,
+		Down: `
+DROP TABLE conversations;
+`,
+	},
+	{
+		Version: 4,
+		Name:    "model selections",
+		Up: `
+CREATE TABLE model_selections (
+	scope TEXT NOT NULL CHECK (scope IN ('global', 'role', 'user')),
+	subject TEXT NOT NULL,
+	model TEXT NOT NULL,
+	updated_at INTEGER NOT NULL,
+	PRIMARY KEY (scope, subject)
+);
+
+CREATE TRIGGER model_selections_user_deleted AFTER DELETE ON users
+BEGIN
+	DELETE FROM model_selections WHERE scope = 'user' AND subject = CAST(OLD.id AS TEXT);
+END;
+`,
+		Down: `
+DROP TRIGGER model_selections_user_deleted;
+DROP TABLE model_selections;
+`,
+	},
+	{
+		Version: 5,
+		Name:    "versioned prompt history",
+		// The serialized ring buffer of the initial schema was never written, so
+		// the table is replaced instead of converted.
+		Up: `
+DROP TABLE preprompt_history;
+
+CREATE TABLE preprompt_history (
+	id INTEGER PRIMARY KEY,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	prompt TEXT NOT NULL,
+	author_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	created_at INTEGER NOT NULL
+);
+
+CREATE INDEX preprompt_history_user_id ON preprompt_history(user_id, id);
+`,
+		Down: `
+DROP TABLE preprompt_history;
+
+CREATE TABLE preprompt_history (
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	prompts BLOB
+);
+`,
+	},
+	{
+		Version: 6,
+		Name:    "user settings and legal library",
+		Up: `
+CREATE TABLE user_settings (
+	user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	legal_library BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE library_documents (
+	id INTEGER PRIMARY KEY,
+	original_name TEXT NOT NULL,
+	storage_name TEXT NOT NULL UNIQUE,
+	title TEXT NOT NULL,
+	uploaded_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	created_at INTEGER NOT NULL
+);
+`,
+		Down: `
+DROP TABLE library_documents;
+DROP TABLE user_settings;
+`,
+	},
+	{
+		Version: 7,
+		Name:    "local-only mode and audit log",
+		Up: `
+ALTER TABLE user_settings ADD COLUMN local_only BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE global_settings (
+	key TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+
+CREATE TABLE audit_log (
+	id INTEGER PRIMARY KEY,
+	created_at INTEGER NOT NULL,
+	user_id INTEGER,
+	action TEXT NOT NULL,
+	detail TEXT NOT NULL
+);
+
+CREATE INDEX audit_log_user_id ON audit_log(user_id, id);
+`,
+		Down: `
+DROP TABLE audit_log;
+DROP TABLE global_settings;
+ALTER TABLE user_settings DROP COLUMN local_only;
+`,
+	},
+	{
+		Version: 8,
+		Name:    "model providers",
+		Up: `
+CREATE TABLE model_providers (
+	name TEXT PRIMARY KEY,
+	kind TEXT NOT NULL,
+	base_url TEXT NOT NULL,
+	api_key TEXT NOT NULL DEFAULT '',
+	local BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at INTEGER NOT NULL
+);
+`,
+		Down: `
+DROP TABLE model_providers;
+`,
+	},
+	{
+		Version: 9,
+		Name:    "resumable uploads",
+		Up: `
+CREATE TABLE uploads (
+	id TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	filename TEXT NOT NULL,
+	title TEXT NOT NULL,
+	length INTEGER NOT NULL,
+	received INTEGER NOT NULL DEFAULT 0,
+	sha256 TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL
+);
+CREATE INDEX uploads_user_id ON uploads(user_id);
+`,
+		Down: `
+DROP TABLE uploads;
+`,
+	},
+	{
+		Version: 10,
+		Name:    "content addressed blobs",
+		Up: `
+CREATE TABLE blobs (
+	sha256 TEXT PRIMARY KEY,
+	size INTEGER NOT NULL,
+	ref_count INTEGER NOT NULL DEFAULT 0,
+	created_at INTEGER NOT NULL
+);
+
+ALTER TABLE user_documents ADD COLUMN sha256 TEXT;
+ALTER TABLE library_documents ADD COLUMN sha256 TEXT;
+CREATE UNIQUE INDEX user_documents_user_sha256 ON user_documents(user_id, sha256);
+CREATE UNIQUE INDEX library_documents_sha256 ON library_documents(sha256);
+
+CREATE TRIGGER user_documents_blob_added AFTER INSERT ON user_documents
+WHEN NEW.sha256 IS NOT NULL
+BEGIN
+	UPDATE blobs SET ref_count = ref_count + 1 WHERE sha256 = NEW.sha256;
+END;
+
+CREATE TRIGGER user_documents_blob_removed AFTER DELETE ON user_documents
+WHEN OLD.sha256 IS NOT NULL
+BEGIN
+	UPDATE blobs SET ref_count = ref_count - 1 WHERE sha256 = OLD.sha256;
+	DELETE FROM blobs WHERE sha256 = OLD.sha256 AND ref_count <= 0;
+END;
+
+CREATE TRIGGER library_documents_blob_added AFTER INSERT ON library_documents
+WHEN NEW.sha256 IS NOT NULL
+BEGIN
+	UPDATE blobs SET ref_count = ref_count + 1 WHERE sha256 = NEW.sha256;
+END;
+
+CREATE TRIGGER library_documents_blob_removed AFTER DELETE ON library_documents
+WHEN OLD.sha256 IS NOT NULL
+BEGIN
+	UPDATE blobs SET ref_count = ref_count - 1 WHERE sha256 = OLD.sha256;
+	DELETE FROM blobs WHERE sha256 = OLD.sha256 AND ref_count <= 0;
+END;
+`,
+		Down: `
+DROP TRIGGER library_documents_blob_removed;
+DROP TRIGGER library_documents_blob_added;
+DROP TRIGGER user_documents_blob_removed;
+DROP TRIGGER user_documents_blob_added;
+DROP INDEX library_documents_sha256;
+DROP INDEX user_documents_user_sha256;
+ALTER TABLE library_documents DROP COLUMN sha256;
+ALTER TABLE user_documents DROP COLUMN sha256;
+DROP TABLE blobs;
+`,
+	},
+	{
+		Version: 11,
+		Name:    "ingestion jobs",
+		Up: `
+CREATE TABLE ingestion_jobs (
+	id INTEGER PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	collection_id INTEGER NOT NULL,
+	filename TEXT NOT NULL,
+	title TEXT NOT NULL,
+	path TEXT NOT NULL,
+	sha256 TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	state TEXT NOT NULL DEFAULT 'queued' CHECK (state IN ('queued', 'processing', 'ready', 'failed')),
+	attempts INTEGER NOT NULL DEFAULT 0,
+	error TEXT NOT NULL DEFAULT '',
+	storage_name TEXT NOT NULL DEFAULT '',
+	next_attempt_at INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL
+);
+CREATE INDEX ingestion_jobs_state ON ingestion_jobs(state, next_attempt_at);
+CREATE INDEX ingestion_jobs_user_id ON ingestion_jobs(user_id);
+`,
+		Down: `
+DROP TABLE ingestion_jobs;
+`,
+	},
+	{
+		Version: 12,
+		Name:    "document metadata",
+		Up: `
+ALTER TABLE user_documents ADD COLUMN title TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_documents ADD COLUMN size INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE user_documents ADD COLUMN mime_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_documents ADD COLUMN page_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE user_documents ADD COLUMN uploaded_at INTEGER NOT NULL DEFAULT 0;
+UPDATE user_documents SET title = original_name;
+UPDATE user_documents SET size = IFNULL((SELECT size FROM blobs WHERE blobs.sha256 = user_documents.sha256), 0);
+
+DELETE FROM user_documents
+WHERE rowid NOT IN (SELECT MAX(rowid) FROM user_documents GROUP BY user_id, storage_name);
+CREATE UNIQUE INDEX user_documents_user_storage_name ON user_documents(user_id, storage_name);
+CREATE INDEX user_documents_user_uploaded_at ON user_documents(user_id, uploaded_at);
+
+CREATE TABLE document_tags (
+	user_id INTEGER NOT NULL,
+	storage_name TEXT NOT NULL,
+	tag TEXT NOT NULL,
+	PRIMARY KEY (user_id, storage_name, tag),
+	FOREIGN KEY (user_id, storage_name) REFERENCES user_documents(user_id, storage_name) ON DELETE CASCADE
+);
+CREATE INDEX document_tags_user_tag ON document_tags(user_id, tag);
+
+ALTER TABLE ingestion_jobs ADD COLUMN tags TEXT NOT NULL DEFAULT '';
+ALTER TABLE uploads ADD COLUMN tags TEXT NOT NULL DEFAULT '';
+`,
+		Down: `
+ALTER TABLE uploads DROP COLUMN tags;
+ALTER TABLE ingestion_jobs DROP COLUMN tags;
+DROP TABLE document_tags;
+DROP INDEX user_documents_user_uploaded_at;
+DROP INDEX user_documents_user_storage_name;
+ALTER TABLE user_documents DROP COLUMN uploaded_at;
+ALTER TABLE user_documents DROP COLUMN page_count;
+ALTER TABLE user_documents DROP COLUMN mime_type;
+ALTER TABLE user_documents DROP COLUMN size;
+ALTER TABLE user_documents DROP COLUMN title;
+`,
+	},
+	{
+		Version: 13,
+		Name:    "blob garbage",
+		Up: `
+CREATE TABLE blob_garbage (
+	sha256 TEXT PRIMARY KEY
+);
+
+CREATE TRIGGER blobs_removed AFTER DELETE ON blobs
+BEGIN
+	INSERT OR IGNORE INTO blob_garbage (sha256) VALUES (OLD.sha256);
+END;
+`,
+		Down: `
+DROP TRIGGER blobs_removed;
+DROP TABLE blob_garbage;
+`,
+	},
+	{
+		Version: 14,
+		Name:    "teams and document shares",
+		Up: `
+CREATE TABLE teams (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE,
+	created_at INTEGER NOT NULL
+);
+
+CREATE TABLE team_members (
+	team_id INTEGER NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role TEXT NOT NULL CHECK (role IN ('owner', 'member')),
+	added_at INTEGER NOT NULL,
+	PRIMARY KEY (team_id, user_id)
+);
+
+CREATE INDEX team_members_user_id ON team_members(user_id);
+
+CREATE TABLE document_shares (
+	id INTEGER PRIMARY KEY,
+	owner_id INTEGER NOT NULL,
+	storage_name TEXT NOT NULL,
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	team_id INTEGER REFERENCES teams(id) ON DELETE CASCADE,
+	permission TEXT NOT NULL CHECK (permission IN ('read', 'retrieve')),
+	created_at INTEGER NOT NULL,
+	CHECK ((user_id IS NULL) <> (team_id IS NULL)),
+	FOREIGN KEY (owner_id, storage_name) REFERENCES user_documents(user_id, storage_name) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX document_shares_grantee ON document_shares(owner_id, storage_name, IFNULL(user_id, 0), IFNULL(team_id, 0));
+CREATE INDEX document_shares_user_id ON document_shares(user_id);
+CREATE INDEX document_shares_team_id ON document_shares(team_id);
+`,
+		Down: `
+DROP TABLE document_shares;
+DROP TABLE team_members;
+DROP TABLE teams;
+`,
+	},
+	{
+		Version: 15,
+		Name:    "roles and permissions",
+		Up: `
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'standard';
+
+UPDATE users
+SET role = CASE WHEN is_admin THEN 'admin' WHEN is_premium THEN 'premium' ELSE 'standard' END;
+
+CREATE TABLE role_permissions (
+	role TEXT NOT NULL CHECK (role IN ('admin', 'premium', 'standard', 'auditor', 'read-only')),
+	permission TEXT NOT NULL,
+	PRIMARY KEY (role, permission)
+);
+
+INSERT INTO role_permissions (role, permission) VALUES
+	('admin', 'manage_users'),
+	('admin', 'change_models'),
+	('admin', 'edit_default_prompt'),
+	('admin', 'use_deep_think'),
+	('admin', 'upload_documents'),
+	('admin', 'upload_large_documents'),
+	('admin', 'view_audit_log'),
+	('premium', 'use_deep_think'),
+	('premium', 'upload_documents'),
+	('premium', 'upload_large_documents'),
+	('standard', 'upload_documents'),
+	('auditor', 'view_audit_log');
+
+UPDATE model_selections
+SET subject = 'standard'
+WHERE scope = 'role' AND subject = 'user';
+`,
+		Down: `
+DELETE FROM model_selections
+WHERE scope = 'role' AND subject IN ('auditor', 'read-only');
+
+UPDATE model_selections
+SET subject = 'user'
+WHERE scope = 'role' AND subject = 'standard';
+
+DROP TABLE role_permissions;
+ALTER TABLE users DROP COLUMN role;
+`,
+	},
+	{
+		Version: 16,
+		Name:    "usage counters",
+		Up: `
+CREATE TABLE usage_counters (
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	kind TEXT NOT NULL,
+	period TEXT NOT NULL,
+	count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (user_id, kind, period)
+);
+`,
+		Down: `
+DROP TABLE usage_counters;
+`,
+	},
+	{
+		Version: 17,
+		Name:    "hash-chained audit log",
+		Up: `
+ALTER TABLE audit_log ADD COLUMN actor TEXT NOT NULL DEFAULT '';
+ALTER TABLE audit_log ADD COLUMN target TEXT NOT NULL DEFAULT '';
+ALTER TABLE audit_log ADD COLUMN source_ip TEXT NOT NULL DEFAULT '';
+ALTER TABLE audit_log ADD COLUMN outcome TEXT NOT NULL DEFAULT 'success';
+ALTER TABLE audit_log ADD COLUMN previous_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE audit_log ADD COLUMN hash TEXT NOT NULL DEFAULT '';
+
+UPDATE audit_log
+SET actor = IFNULL((SELECT email FROM users WHERE users.id = audit_log.user_id), '');
+
+CREATE INDEX audit_log_actor ON audit_log(actor, id);
+CREATE INDEX audit_log_action ON audit_log(action, id);
+CREATE INDEX audit_log_created_at ON audit_log(created_at);
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'the audit log is append-only');
+END;
+
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'the audit log is append-only');
+END;
+`,
+		Down: `
+DROP TRIGGER audit_log_no_delete;
+DROP TRIGGER audit_log_no_update;
+DROP INDEX audit_log_created_at;
+DROP INDEX audit_log_action;
+DROP INDEX audit_log_actor;
+ALTER TABLE audit_log DROP COLUMN hash;
+ALTER TABLE audit_log DROP COLUMN previous_hash;
+ALTER TABLE audit_log DROP COLUMN outcome;
+ALTER TABLE audit_log DROP COLUMN source_ip;
+ALTER TABLE audit_log DROP COLUMN target;
+ALTER TABLE audit_log DROP COLUMN actor;
+`,
+	},
+	{
+		Version: 18,
+		Name:    "library permission",
+		Up: `
+INSERT INTO role_permissions (role, permission) VALUES ('admin', 'manage_library');
+`,
+		Down: `
+DELETE FROM role_permissions WHERE permission = 'manage_library';
+`,
+	},
+}
+
+const createMigrationTable string = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at INTEGER NOT NULL
+);
+`
+
+const getAppliedMigrations string = `
+SELECT version, applied_at FROM schema_migrations
+`
+
+// MigrationStatus lists every known migration and whether it is applied.
+//
+// Returns:
+//   - []MigrationState: All migrations in version order
+//   - error: Database errors, or an error if the database contains migrations
+//     unknown to this build (it was migrated by a newer version)
+func MigrationStatus(db *sql.DB) ([]MigrationState, error) {
+	if _, err := db.Exec(createMigrationTable); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	rows, err := db.Query(getAppliedMigrations)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]int64{}
+
+	for rows.Next() {
+		var version int
+		var applied_at int64
+		if err := rows.Scan(&version, &applied_at); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		applied[version] = applied_at
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+
+	for _, migration := range migrations {
+		applied_at, ok := applied[migration.Version]
+		states = append(states, MigrationState{Migration: migration, Applied: ok, AppliedAt: applied_at})
+		delete(applied, migration.Version)
+	}
+
+	for version := range applied {
+		return nil, fmt.Errorf("database contains unknown migration %d, it was migrated by a newer version", version)
+	}
+
+	return states, nil
+}
+
+// LatestMigration returns the version of the newest known migration.
+func LatestMigration() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// Migrate applies all pending migrations.
+func Migrate(db *sql.DB) error {
+	return MigrateTo(db, LatestMigration())
+}
+
+// MigrateTo brings the schema to the given version.
+//
+// Pending migrations up to and including target are applied in ascending order;
+// applied migrations above target are rolled back in descending order.
+// A target of 0 rolls back every migration.
+//
+// Returns:
+//   - error: Unknown target or the first migration that failed. Migrations
+//     completed before the failure stay in effect.
+func MigrateTo(db *sql.DB, target int) error {
+	if target < 0 || target > LatestMigration() {
+		return fmt.Errorf("unknown migration version %d, latest is %d", target, LatestMigration())
+	}
+
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return err
+	}
+
+	for _, state := range states {
+		if !state.Applied && state.Version <= target {
+			if err := runMigration(db, state.Migration, true); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := len(states) - 1; i >= 0; i-- {
+		if states[i].Applied && states[i].Version > target {
+			if err := runMigration(db, states[i].Migration, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+const insertMigration string = `
+INSERT INTO schema_migrations (version, name, applied_at)
+VALUES ($1, $2, $3)
+`
+
+const deleteMigration string = `
+DELETE FROM schema_migrations
+WHERE version = ?
+`
+
+// runMigration applies (up) or reverts (down) a single migration in one transaction.
+func runMigration(db *sql.DB, migration Migration, up bool) error {
+	var direction string = "apply"
+	var statements string = migration.Up
+
+	if !up {
+		direction = "roll back"
+		statements = migration.Down
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(statements); err != nil {
+		return fmt.Errorf("failed to %s migration %d (%s): %w", direction, migration.Version, migration.Name, err)
+	}
+
+	if up {
+		_, err = tx.Exec(insertMigration, migration.Version, migration.Name, time.Now().UTC().Unix())
+	} else {
+		_, err = tx.Exec(deleteMigration, migration.Version)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+	}
+
+	return tx.Commit()
+}
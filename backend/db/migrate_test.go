@@ -0,0 +1,245 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// Schema created by SetupSqlite before migrations existed.
+const baselineSchema string = `
+CREATE TABLE IF NOT EXISTS users (
+    name TEXT NOT NULL,
+    password TEXT NOT NULL,
+    email TEXT NOT NULL UNIQUE,
+    is_admin BOOLEAN,
+	is_premium BOOLEAN,
+    id INTEGER PRIMARY KEY
+);
+
+CREATE TABLE IF NOT EXISTS prompts (
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	prompt TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_documents (
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	original_name TEXT NOT NULL,
+	storage_name TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS signup_requests (
+	name TEXT NOT NULL,
+	password TEXT NOT NULL,
+	email TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS preprompt_history (
+	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+	prompts  BLOB
+);
+`
+
+const seedBaseline string = `
+INSERT INTO users (name, password, email, is_admin, is_premium, id) VALUES
+	('Admin', 'Admin', 'admin@example.com', TRUE, TRUE, 1),
+	('Premium', 'secret', 'premium@example.com', FALSE, TRUE, 2),
+	('Standard', 'secret', 'standard@example.com', FALSE, FALSE, 3);
+
+INSERT INTO prompts (user_id, prompt) VALUES (1, 'Admin prompt'), (3, 'Standard prompt');
+
+INSERT INTO user_documents (user_id, original_name, storage_name) VALUES
+	(1, 'contract.pdf', 'a1.pdf'),
+	(3, 'statute.pdf', 'b2.pdf');
+
+INSERT INTO signup_requests (name, password, email) VALUES ('Applicant', 'secret', 'applicant@example.com');
+`
+
+func openDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db_handle, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db_handle.Close() })
+	return db_handle
+}
+
+func assertFullyMigrated(t *testing.T, db_handle *sql.DB) {
+	t.Helper()
+
+	states, err := MigrationStatus(db_handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, state := range states {
+		if !state.Applied {
+			t.Errorf("migration %d (%s) not applied", state.Version, state.Name)
+		}
+	}
+}
+
+func count(t *testing.T, db_handle *sql.DB, query string, args ...any) int {
+	t.Helper()
+
+	var n int
+	if err := db_handle.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return n
+}
+
+func TestMigrateFromEmpty(t *testing.T) {
+	db_handle := openDatabase(t)
+
+	if err := Migrate(db_handle); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFullyMigrated(t, db_handle)
+
+	// Running again is a no-op
+	if err := Migrate(db_handle); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+
+	if err := AddUser(db_handle, CreateAdmin("Admin", "hash", "admin@example.com")); err != nil {
+		t.Fatalf("schema unusable after migration: %v", err)
+	}
+}
+
+func TestMigrateFromBaseline(t *testing.T) {
+	db_handle := openDatabase(t)
+
+	if _, err := db_handle.Exec(baselineSchema + seedBaseline); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Migrate(db_handle); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFullyMigrated(t, db_handle)
+
+	for email, role := range map[string]string{
+		"admin@example.com":    ROLE_ADMIN,
+		"premium@example.com":  ROLE_PREMIUM,
+		"standard@example.com": ROLE_STANDARD,
+	} {
+		user, err := GetDataBaseUser(db_handle, email)
+		if err != nil {
+			t.Fatalf("%s: %v", email, err)
+		}
+
+		if user.Role != role {
+			t.Errorf("%s: role %q, want %q", email, user.Role, role)
+		}
+	}
+
+	prompt, err := GetPrompt(db_handle, 3)
+	if err != nil || prompt != "Standard prompt" {
+		t.Errorf("prompt of user 3: %q, %v", prompt, err)
+	}
+
+	if n := count(t, db_handle, `SELECT COUNT(*) FROM user_documents WHERE title = original_name`); n != 2 {
+		t.Errorf("%d documents kept with their title, want 2", n)
+	}
+
+	if n := count(t, db_handle, `SELECT COUNT(*) FROM signup_requests`); n != 1 {
+		t.Errorf("%d signup requests, want 1", n)
+	}
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	db_handle := openDatabase(t)
+
+	if err := Migrate(db_handle); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MigrateTo(db_handle, 0); err != nil {
+		t.Fatalf("down 0: %v", err)
+	}
+
+	states, err := MigrationStatus(db_handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, state := range states {
+		if state.Applied {
+			t.Errorf("migration %d (%s) still applied after down 0", state.Version, state.Name)
+		}
+	}
+
+	if n := count(t, db_handle, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT IN ('schema_migrations', 'sqlite_sequence')`); n != 0 {
+		t.Errorf("%d tables left after down 0", n)
+	}
+
+	if err := Migrate(db_handle); err != nil {
+		t.Fatalf("up after down 0: %v", err)
+	}
+
+	assertFullyMigrated(t, db_handle)
+}
+
+func TestMigrateToEveryVersion(t *testing.T) {
+	db_handle := openDatabase(t)
+
+	for version := 1; version <= LatestMigration(); version++ {
+		if err := MigrateTo(db_handle, version); err != nil {
+			t.Fatalf("up to %d: %v", version, err)
+		}
+
+		if err := MigrateTo(db_handle, version-1); err != nil {
+			t.Fatalf("down from %d: %v", version, err)
+		}
+
+		if err := MigrateTo(db_handle, version); err != nil {
+			t.Fatalf("up to %d again: %v", version, err)
+		}
+	}
+}
+
+func TestMigrationsAreUnique(t *testing.T) {
+	versions := map[int]bool{}
+	names := map[string]bool{}
+
+	for index, migration := range migrations {
+		if migration.Version != index+1 {
+			t.Errorf("migration %q has version %d, want %d (ascending without gaps)", migration.Name, migration.Version, index+1)
+		}
+
+		if versions[migration.Version] {
+			t.Errorf("version %d used twice", migration.Version)
+		}
+
+		if names[migration.Name] {
+			t.Errorf("name %q used twice", migration.Name)
+		}
+
+		if migration.Name == "" || migration.Up == "" || migration.Down == "" {
+			t.Errorf("migration %d is incomplete", migration.Version)
+		}
+
+		versions[migration.Version] = true
+		names[migration.Name] = true
+	}
+
+	if LatestMigration() != len(migrations) {
+		t.Errorf("LatestMigration() = %d, want %d", LatestMigration(), len(migrations))
+	}
+}
+
+func TestMigrateToUnknownVersion(t *testing.T) {
+	db_handle := openDatabase(t)
+
+	for _, target := range []int{-1, LatestMigration() + 1} {
+		if err := MigrateTo(db_handle, target); err == nil {
+			t.Errorf("MigrateTo(%d) succeeded", target)
+		}
+	}
+}
@@ -1,30 +1,188 @@
 package db
 
 import (
+	"database/sql"
+	"fmt"
+	"strconv"
 	"sync"
+	"time"
 )
 
-var (
-	modelMutex sync.Mutex // Protects concurrent access to `llm`
-	llm        string     // Stores the model string in memory
+// Scopes of a model selection, from the most to the least specific.
+const (
+	MODEL_SCOPE_USER    string = "user"    // Subject is the user ID
+	MODEL_SCOPE_ROLE    string = "role"    // Subject is one of the ROLE_* constants
+	MODEL_SCOPE_GLOBAL  string = "global"  // Subject is empty
+	MODEL_SCOPE_DEFAULT string = "default" // Not stored, the configured default_model
 )
 
-// Initialize with default model ("gemma3:12b" as specified)
-func InitModelSelection() {
-	llm = "gemma3:12b"
+// ModelSelection is a model assigned to a scope.
+//
+//   - Scope:     One of the MODEL_SCOPE_* constants
+//   - Subject:   User ID (user scope), role name (role scope) or empty (global scope)
+//   - Model:     Model name as listed by Ollama, e.g. "gemma3:12b"
+//   - UpdatedAt: Unix timestamp of the last change, 0 for the configured default
+type ModelSelection struct {
+	Scope     string
+	Subject   string
+	Model     string
+	UpdatedAt int64
 }
 
-// GetModel returns the current model (thread-safe read)
-func GetModel() string {
+var (
+	modelMutex   sync.Mutex // Protects concurrent access to `defaultModel`
+	defaultModel string     // Fallback if no global selection is stored
+)
+
+// Initialize with the configured default model (config default_model).
+// It is used until an administrator stores a global selection.
+func InitModelSelection(default_model string) {
 	modelMutex.Lock()
 	defer modelMutex.Unlock()
-	return llm
+	defaultModel = default_model
 }
 
-// SetModel updates the model (thread-safe write)
-func SetModel(model string) {
+// getDefaultModel returns the configured default model (thread-safe read)
+func getDefaultModel() ModelSelection {
 	modelMutex.Lock()
 	defer modelMutex.Unlock()
-	llm = model
-	println("LLM:", llm, "Selected Model:", model)
+	return ModelSelection{Scope: MODEL_SCOPE_DEFAULT, Model: defaultModel}
+}
+
+const getUserModelSelections string = `
+SELECT m.scope, m.subject, m.model, m.updated_at
+FROM model_selections m, users u
+WHERE u.id = $1
+AND (
+	(m.scope = 'user' AND m.subject = CAST(u.id AS TEXT))
+	OR (m.scope = 'role' AND m.subject = u.role)
+	OR m.scope = 'global'
+)
+ORDER BY CASE m.scope WHEN 'user' THEN 0 WHEN 'role' THEN 1 ELSE 2 END
+`
+
+// GetModelSelections lists the selections that apply to a user, most specific first.
+//
+// Returns:
+//   - []ModelSelection: User override, role override and global selection if present,
+//     always followed by the configured default. The first entry is the model in use.
+//   - error: Database errors
+func GetModelSelections(db *sql.DB, user_id int64) ([]ModelSelection, error) {
+	selections, err := queryModelSelections(db, getUserModelSelections, user_id)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(selections, getDefaultModel()), nil
+}
+
+// GetModel returns the model a user's requests are answered with.
+//
+// Resolution order: user override, role override, global selection, configured default.
+func GetModel(db *sql.DB, user_id int64) (string, error) {
+	selections, err := GetModelSelections(db, user_id)
+	if err != nil {
+		return "", err
+	}
+
+	return selections[0].Model, nil
+}
+
+const getGlobalModelSelection string = `
+SELECT scope, subject, model, updated_at
+FROM model_selections
+WHERE scope = 'global'
+`
+
+// GetGlobalModel returns the model used for users without an override.
+func GetGlobalModel(db *sql.DB) (string, error) {
+	selections, err := queryModelSelections(db, getGlobalModelSelection)
+	if err != nil {
+		return "", err
+	}
+
+	if len(selections) == 0 {
+		return getDefaultModel().Model, nil
+	}
+
+	return selections[0].Model, nil
+}
+
+const getAllModelSelections string = `
+SELECT scope, subject, model, updated_at
+FROM model_selections
+ORDER BY CASE scope WHEN 'global' THEN 0 WHEN 'role' THEN 1 ELSE 2 END, subject
+`
+
+// GetAllModelSelections lists every stored selection followed by the configured default.
+func GetAllModelSelections(db *sql.DB) ([]ModelSelection, error) {
+	selections, err := queryModelSelections(db, getAllModelSelections)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(selections, getDefaultModel()), nil
+}
+
+const upsertModelSelection string = `
+INSERT INTO model_selections (scope, subject, model, updated_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (scope, subject) DO UPDATE SET model = excluded.model, updated_at = excluded.updated_at
+`
+
+// SetModel stores the model of a scope, replacing a previous selection.
+//
+// Parameters:
+//   - db: Database connection handle
+//   - scope: MODEL_SCOPE_GLOBAL, MODEL_SCOPE_ROLE or MODEL_SCOPE_USER
+//   - subject: See ModelSelection
+//   - model: Model name, validated by the caller against the installed models
+func SetModel(db *sql.DB, scope string, subject string, model string) error {
+	_, err := db.Exec(upsertModelSelection, scope, subject, model, time.Now().UTC().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to store model selection: %w", err)
+	}
+	return nil
+}
+
+const deleteModelSelection string = `
+DELETE FROM model_selections
+WHERE scope = $1 AND subject = $2
+`
+
+// DeleteModelSelection removes the selection of a scope so the next less specific one applies.
+//
+// Returns:
+//   - error: sql.ErrNoRows if no selection is stored for the scope
+func DeleteModelSelection(db *sql.DB, scope string, subject string) error {
+	return expectOneRow(db.Exec(deleteModelSelection, scope, subject))
+}
+
+// UserSubject formats a user ID as subject of a MODEL_SCOPE_USER selection.
+func UserSubject(user_id int64) string {
+	return strconv.FormatInt(user_id, 10)
+}
+
+func queryModelSelections(db *sql.DB, query string, args ...any) ([]ModelSelection, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	selections := []ModelSelection{}
+
+	for rows.Next() {
+		var selection ModelSelection
+		if err := rows.Scan(&selection.Scope, &selection.Subject, &selection.Model, &selection.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		selections = append(selections, selection)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return selections, nil
 }
@@ -0,0 +1,202 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Number of versions kept per prompt, older versions are pruned when a new one is recorded.
+const PROMPT_HISTORY_LIMIT int = 50
+
+// PromptVersion is one recorded state of a prompt in the preprompt_history table.
+//
+//   - ID:        Version identifier, increasing with every change
+//   - UserID:    Owner of the prompt, 0 for the global default prompt
+//   - Prompt:    Full prompt text of this version
+//   - AuthorID:  User who made the change, 0 if unknown (baseline entries, deleted users)
+//   - Author:    Email of the author at the time of reading, empty if unknown
+//   - CreatedAt: Unix timestamp of the change
+type PromptVersion struct {
+	ID        int64
+	UserID    int64
+	Prompt    string
+	AuthorID  int64
+	Author    string
+	CreatedAt int64
+}
+
+// owner maps the user ID 0 of the default prompt to NULL.
+func owner(user_id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: user_id, Valid: user_id != 0}
+}
+
+const countPromptVersions string = `
+SELECT COUNT(*) FROM preprompt_history
+WHERE user_id IS $1
+`
+
+const insertPromptVersion string = `
+INSERT INTO preprompt_history (user_id, prompt, author_id, created_at)
+VALUES ($1, $2, $3, $4)
+`
+
+const prunePromptVersions string = `
+DELETE FROM preprompt_history
+WHERE user_id IS $1 AND id NOT IN (
+	SELECT id FROM preprompt_history
+	WHERE user_id IS $1
+	ORDER BY id DESC
+	LIMIT $2
+)
+`
+
+// recordPromptVersion appends a version inside a transaction.
+//
+// If the prompt has no history yet, the previous text is recorded first as a
+// baseline without author, so the state before the first tracked change can be restored.
+func recordPromptVersion(tx *sql.Tx, user_id int64, previous string, prompt string, author_id int64) error {
+	var count int
+	var now int64 = time.Now().UTC().Unix()
+
+	if err := tx.QueryRow(countPromptVersions, owner(user_id)).Scan(&count); err != nil {
+		return fmt.Errorf("failed to count prompt versions: %w", err)
+	}
+
+	if count == 0 {
+		if _, err := tx.Exec(insertPromptVersion, owner(user_id), previous, nil, now); err != nil {
+			return fmt.Errorf("failed to record baseline prompt: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(insertPromptVersion, owner(user_id), prompt, owner(author_id), now); err != nil {
+		return fmt.Errorf("failed to record prompt version: %w", err)
+	}
+
+	if _, err := tx.Exec(prunePromptVersions, owner(user_id), PROMPT_HISTORY_LIMIT); err != nil {
+		return fmt.Errorf("failed to prune prompt history: %w", err)
+	}
+
+	return nil
+}
+
+// ChangePrompt updates the prompt of a user and records the change in the history.
+//
+// Parameters:
+//   - db: Database connection handle
+//   - user_id: Owner of the prompt
+//   - prompt: New prompt text
+//   - author_id: User performing the change
+//
+// Returns:
+//   - error: Database errors, sql.ErrNoRows if the user has no prompt
+func ChangePrompt(db *sql.DB, user_id int64, prompt string, author_id int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var previous string
+	if err := tx.QueryRow(getPrompt, user_id).Scan(&previous); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(updatePrompt, prompt, user_id); err != nil {
+		return fmt.Errorf("failed to update prompt: %w", err)
+	}
+
+	if err := recordPromptVersion(tx, user_id, previous, prompt, author_id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RecordDefaultPromptChange records a change of the global default prompt.
+//
+// The default prompt itself is stored in a file (see api.SetDefaultPrompt),
+// only its history lives in the database.
+func RecordDefaultPromptChange(db *sql.DB, previous string, prompt string, author_id int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := recordPromptVersion(tx, 0, previous, prompt, author_id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const getPromptHistory string = `
+SELECT h.id, IFNULL(h.user_id, 0), h.prompt, IFNULL(h.author_id, 0), IFNULL(u.email, ''), h.created_at
+FROM preprompt_history h
+LEFT JOIN users u ON u.id = h.author_id
+WHERE h.user_id IS $1
+ORDER BY h.id DESC
+`
+
+// GetPromptHistory lists the recorded versions of a prompt, newest first.
+//
+// Parameters:
+//   - db: Database connection handle
+//   - user_id: Owner of the prompt, 0 for the global default prompt
+func GetPromptHistory(db *sql.DB, user_id int64) ([]PromptVersion, error) {
+	rows, err := db.Query(getPromptHistory, owner(user_id))
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []PromptVersion{}
+
+	for rows.Next() {
+		var version PromptVersion
+		if err := rows.Scan(
+			&version.ID,
+			&version.UserID,
+			&version.Prompt,
+			&version.AuthorID,
+			&version.Author,
+			&version.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		versions = append(versions, version)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return versions, nil
+}
+
+const getPromptVersion string = `
+SELECT h.id, IFNULL(h.user_id, 0), h.prompt, IFNULL(h.author_id, 0), IFNULL(u.email, ''), h.created_at
+FROM preprompt_history h
+LEFT JOIN users u ON u.id = h.author_id
+WHERE h.id = $1 AND h.user_id IS $2
+`
+
+// GetPromptVersion retrieves a single version of a prompt.
+//
+// Returns:
+//   - error: sql.ErrNoRows if the version does not exist or belongs to another prompt
+func GetPromptVersion(db *sql.DB, user_id int64, id int64) (PromptVersion, error) {
+	var version PromptVersion
+
+	err := db.QueryRow(getPromptVersion, id, owner(user_id)).Scan(
+		&version.ID,
+		&version.UserID,
+		&version.Prompt,
+		&version.AuthorID,
+		&version.Author,
+		&version.CreatedAt,
+	)
+
+	return version, err
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ModelProvider is a model backend registered by an administrator.
+//
+//   - Name:      Unique name, prefix of the provider's models in the catalogue
+//   - Kind:      Implementation, "ollama" or "openai" (see package provider)
+//   - BaseURL:   Root of the provider's API
+//   - APIKey:    Bearer token sent to the provider, stored as given
+//   - Local:     Whether the backend runs on the premises and may serve local-only users
+//   - CreatedAt: Unix timestamp of the registration
+type ModelProvider struct {
+	Name      string
+	Kind      string
+	BaseURL   string
+	APIKey    string
+	Local     bool
+	CreatedAt int64
+}
+
+const insertModelProvider string = `
+INSERT INTO model_providers (name, kind, base_url, api_key, local, created_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+`
+
+// AddModelProvider stores a newly registered provider.
+//
+// Returns:
+//   - error: Database errors, including a constraint error if the name is taken
+func AddModelProvider(db *sql.DB, provider ModelProvider) error {
+	_, err := db.Exec(
+		insertModelProvider,
+		provider.Name,
+		provider.Kind,
+		provider.BaseURL,
+		provider.APIKey,
+		provider.Local,
+		time.Now().UTC().Unix(),
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to add model provider: %w", err)
+	}
+	return nil
+}
+
+const getModelProviders string = `
+SELECT name, kind, base_url, api_key, local, created_at
+FROM model_providers
+ORDER BY created_at, name
+`
+
+// GetModelProviders lists the registered providers in registration order.
+func GetModelProviders(db *sql.DB) ([]ModelProvider, error) {
+	rows, err := db.Query(getModelProviders)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	providers := []ModelProvider{}
+
+	for rows.Next() {
+		var provider ModelProvider
+		if err := rows.Scan(
+			&provider.Name,
+			&provider.Kind,
+			&provider.BaseURL,
+			&provider.APIKey,
+			&provider.Local,
+			&provider.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		providers = append(providers, provider)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return providers, nil
+}
+
+const deleteModelProvider string = `
+DELETE FROM model_providers
+WHERE name = ?
+`
+
+// DeleteModelProvider removes a registered provider.
+//
+// Returns:
+//   - error: sql.ErrNoRows if no provider has the name
+func DeleteModelProvider(db *sql.DB, name string) error {
+	return expectOneRow(db.Exec(deleteModelProvider, name))
+}
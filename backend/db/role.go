@@ -0,0 +1,210 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Roles of a user. Every user has exactly one role; what it allows is stored as
+// permissions in the role_permissions table.
+const (
+	ROLE_ADMIN     string = "admin"
+	ROLE_PREMIUM   string = "premium"
+	ROLE_STANDARD  string = "standard"
+	ROLE_AUDITOR   string = "auditor"
+	ROLE_READ_ONLY string = "read-only"
+)
+
+// ROLES lists every role from the most to the least privileged.
+var ROLES = []string{ROLE_ADMIN, ROLE_PREMIUM, ROLE_STANDARD, ROLE_AUDITOR, ROLE_READ_ONLY}
+
+// Named permissions a role can be granted.
+const (
+	PERMISSION_MANAGE_USERS           string = "manage_users"           // Users, sessions, signup requests and roles
+	PERMISSION_CHANGE_MODELS          string = "change_models"          // Model selections, providers and local-only enforcement
+	PERMISSION_EDIT_DEFAULT_PROMPT    string = "edit_default_prompt"    // Default prompt and its history
+	PERMISSION_USE_DEEP_THINK         string = "use_deep_think"         // Inference requests with deep think enabled
+	PERMISSION_UPLOAD_DOCUMENTS       string = "upload_documents"       // Document uploads
+	PERMISSION_UPLOAD_LARGE_DOCUMENTS string = "upload_large_documents" // Uploads above the configured large upload size
+	PERMISSION_VIEW_AUDIT_LOG         string = "view_audit_log"         // Reading the audit log
+	PERMISSION_MANAGE_LIBRARY         string = "manage_library"         // Documents of the shared legal library
+)
+
+// PERMISSIONS lists every known permission.
+var PERMISSIONS = []string{
+	PERMISSION_MANAGE_USERS,
+	PERMISSION_CHANGE_MODELS,
+	PERMISSION_EDIT_DEFAULT_PROMPT,
+	PERMISSION_USE_DEEP_THINK,
+	PERMISSION_UPLOAD_DOCUMENTS,
+	PERMISSION_UPLOAD_LARGE_DOCUMENTS,
+	PERMISSION_VIEW_AUDIT_LOG,
+	PERMISSION_MANAGE_LIBRARY,
+}
+
+// ErrLastAdmin is returned by SetUserRole if the change would leave no administrator.
+var ErrLastAdmin = errors.New("the last administrator cannot be given another role")
+
+// Role is a role together with the permissions it grants.
+type Role struct {
+	Name        string
+	Permissions []string
+}
+
+// UserRole maps the legacy user flags to a role. Admin takes precedence over premium.
+func UserRole(is_admin bool, is_premium bool) string {
+	if is_admin {
+		return ROLE_ADMIN
+	} else if is_premium {
+		return ROLE_PREMIUM
+	}
+	return ROLE_STANDARD
+}
+
+const getRolePermissions string = `
+SELECT permission FROM role_permissions
+WHERE role = $1
+ORDER BY permission
+`
+
+// GetRolePermissions lists the permissions granted to a role, sorted by name.
+func GetRolePermissions(db *sql.DB, role string) ([]string, error) {
+	rows, err := db.Query(getRolePermissions, role)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		permissions = append(permissions, permission)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return permissions, nil
+}
+
+// GetRoles lists every role with its permissions, in the order of ROLES.
+func GetRoles(db *sql.DB) ([]Role, error) {
+	roles := []Role{}
+
+	for _, name := range ROLES {
+		permissions, err := GetRolePermissions(db, name)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, Role{Name: name, Permissions: permissions})
+	}
+
+	return roles, nil
+}
+
+const deleteRolePermissions string = `
+DELETE FROM role_permissions
+WHERE role = $1
+`
+
+const insertRolePermission string = `
+INSERT INTO role_permissions (role, permission)
+VALUES ($1, $2)
+`
+
+// SetRolePermissions replaces the permissions of a role.
+//
+// The change applies to the next request of every user with the role.
+// Role and permissions are validated by the caller against ROLES and PERMISSIONS.
+func SetRolePermissions(db *sql.DB, role string, permissions []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(deleteRolePermissions, role); err != nil {
+		return fmt.Errorf("failed to remove permissions: %w", err)
+	}
+
+	for _, permission := range permissions {
+		if _, err := tx.Exec(insertRolePermission, role, permission); err != nil {
+			return fmt.Errorf("failed to grant %s: %w", permission, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+const getUserRole string = `
+SELECT id, role FROM users
+WHERE email = $1
+`
+
+// The legacy flags are kept in sync with the role for clients still reading them.
+const updateUserRole string = `
+UPDATE users
+SET role = $1, is_admin = ($1 = 'admin'), is_premium = ($1 IN ('admin', 'premium'))
+WHERE id = $2
+`
+
+const countAdmins string = `
+SELECT COUNT(*) FROM users
+WHERE role = 'admin'
+`
+
+// SetUserRole assigns a role to a user.
+//
+// Returns:
+//   - int64: ID of the user
+//   - string: The previous role of the user
+//   - error: sql.ErrNoRows if no user has the email, ErrLastAdmin if the last
+//     administrator would be demoted, database errors
+func SetUserRole(db *sql.DB, email string, role string) (int64, string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var user_id int64
+	var previous string
+	if err := tx.QueryRow(getUserRole, email).Scan(&user_id, &previous); err != nil {
+		return 0, "", err
+	}
+
+	if _, err := tx.Exec(updateUserRole, role, user_id); err != nil {
+		return 0, "", fmt.Errorf("failed to update role: %w", err)
+	}
+
+	var admins int64
+	if err := tx.QueryRow(countAdmins).Scan(&admins); err != nil {
+		return 0, "", fmt.Errorf("failed to count administrators: %w", err)
+	}
+
+	if admins == 0 {
+		return 0, "", ErrLastAdmin
+	}
+
+	return user_id, previous, tx.Commit()
+}
+
+// split_permissions parses a comma separated permission list as produced by GROUP_CONCAT.
+func split_permissions(list string) []string {
+	if list == "" {
+		return []string{}
+	}
+
+	permissions := strings.Split(list, ",")
+	slices.Sort(permissions)
+
+	return permissions
+}
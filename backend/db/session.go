@@ -0,0 +1,162 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Session is a login session as stored in the sessions table.
+//
+//   - ID:          Random session identifier, carried as "sid" claim in access tokens
+//   - UserID:      Owner of the session
+//   - RefreshHash: Hex-encoded SHA-256 of the current refresh token (the token itself is never stored)
+//   - CreatedAt:   Unix timestamp of the login
+//   - ExpiresAt:   Unix timestamp after which the refresh token is no longer accepted
+//   - Revoked:     Set by logout or an administrator, revoked sessions never become valid again
+type Session struct {
+	ID          string
+	UserID      int64
+	RefreshHash string
+	CreatedAt   int64
+	ExpiresAt   int64
+	Revoked     bool
+}
+
+// SessionRecord is a session joined with the current privileges of its owner.
+// Privileges are read on every request so that demotions take effect immediately.
+//
+//   - Role:        One of the ROLE_* constants
+//   - Permissions: Permissions granted to the role, sorted by name
+type SessionRecord struct {
+	Session
+	IsAdmin     bool
+	IsPremium   bool
+	Role        string
+	Permissions []string
+}
+
+const insertSession string = `
+INSERT INTO sessions (id, user_id, refresh_hash, created_at, expires_at, revoked)
+VALUES ($1, $2, $3, $4, $5, FALSE)
+`
+
+// AddSession stores a newly created session.
+func AddSession(db *sql.DB, session Session) error {
+	_, err := db.Exec(
+		insertSession,
+		session.ID,
+		session.UserID,
+		session.RefreshHash,
+		session.CreatedAt,
+		session.ExpiresAt,
+	)
+
+	return err
+}
+
+const getSession string = `
+SELECT
+	s.id, s.user_id, s.refresh_hash, s.created_at, s.expires_at, s.revoked, u.is_admin, u.is_premium, u.role,
+	IFNULL((SELECT GROUP_CONCAT(p.permission) FROM role_permissions p WHERE p.role = u.role), '')
+FROM sessions s
+JOIN users u ON u.id = s.user_id
+WHERE s.id = ?
+`
+
+// GetSession retrieves a session together with the privileges of its owner.
+//
+// Returns:
+//   - SessionRecord: The session and the owner's current flags, role and permissions
+//   - error: sql.ErrNoRows if the session does not exist or its user was deleted
+func GetSession(db *sql.DB, id string) (SessionRecord, error) {
+	var record SessionRecord
+	var permissions string
+
+	err := db.QueryRow(getSession, id).Scan(
+		&record.ID,
+		&record.UserID,
+		&record.RefreshHash,
+		&record.CreatedAt,
+		&record.ExpiresAt,
+		&record.Revoked,
+		&record.IsAdmin,
+		&record.IsPremium,
+		&record.Role,
+		&permissions,
+	)
+
+	record.Permissions = split_permissions(permissions)
+
+	return record, err
+}
+
+const rotateSession string = `
+UPDATE sessions
+SET refresh_hash = $1, expires_at = $2
+WHERE id = $3 AND refresh_hash = $4 AND revoked = FALSE
+`
+
+// RotateSession replaces the refresh token hash of a session.
+//
+// The update only succeeds if old_hash is still the current hash, which makes
+// rotation atomic: of two concurrent refreshes with the same token only one wins.
+//
+// Returns:
+//   - bool: True if the session was rotated
+//   - error: Database errors
+func RotateSession(db *sql.DB, id string, old_hash string, new_hash string, expires_at int64) (bool, error) {
+	result, err := db.Exec(rotateSession, new_hash, expires_at, id, old_hash)
+	if err != nil {
+		return false, fmt.Errorf("session rotation failed: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+const revokeSession string = `
+UPDATE sessions
+SET revoked = TRUE
+WHERE id = ?
+`
+
+// RevokeSession invalidates a single session (logout or refresh token reuse).
+func RevokeSession(db *sql.DB, id string) error {
+	_, err := db.Exec(revokeSession, id)
+	return err
+}
+
+const revokeUserSessions string = `
+UPDATE sessions
+SET revoked = TRUE
+WHERE user_id = ? AND revoked = FALSE
+`
+
+// RevokeUserSessions invalidates every session of a user.
+//
+// Returns:
+//   - int64: Number of sessions that were revoked
+//   - error: Database errors
+func RevokeUserSessions(db *sql.DB, user_id int64) (int64, error) {
+	result, err := db.Exec(revokeUserSessions, user_id)
+	if err != nil {
+		return 0, fmt.Errorf("session revocation failed: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+const deleteExpiredSessions string = `
+DELETE FROM sessions
+WHERE expires_at < ?
+`
+
+// DeleteExpiredSessions removes sessions whose refresh token expired before the given Unix timestamp.
+func DeleteExpiredSessions(db *sql.DB, now int64) error {
+	_, err := db.Exec(deleteExpiredSessions, now)
+	return err
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// UserSettings are the per-user switches of the chat interface.
+//
+//   - LegalLibrary: Whether retrieval includes the shared legal library (see LibraryDocument)
+//   - LocalOnly:    Whether inference must stay on model backends running on the premises
+//
+// Users without a stored row get DEFAULT_USER_SETTINGS.
+type UserSettings struct {
+	LegalLibrary bool
+	LocalOnly    bool
+}
+
+// Settings of users who never changed a switch, matching the column defaults.
+var DEFAULT_USER_SETTINGS = UserSettings{LegalLibrary: false, LocalOnly: false}
+
+const getUserSettings string = `
+SELECT legal_library, local_only
+FROM user_settings
+WHERE user_id = ?
+`
+
+// GetUserSettings retrieves the settings of a user, defaults if none are stored.
+func GetUserSettings(db *sql.DB, user_id int64) (UserSettings, error) {
+	var settings UserSettings
+
+	err := db.QueryRow(getUserSettings, user_id).Scan(&settings.LegalLibrary, &settings.LocalOnly)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return DEFAULT_USER_SETTINGS, nil
+	} else if err != nil {
+		return UserSettings{}, fmt.Errorf("failed to read user settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+const setLegalLibrary string = `
+INSERT INTO user_settings (user_id, legal_library)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE SET legal_library = excluded.legal_library
+`
+
+// SetLegalLibrary stores whether a user opted into the shared legal library.
+func SetLegalLibrary(db *sql.DB, user_id int64, enabled bool) error {
+	_, err := db.Exec(setLegalLibrary, user_id, enabled)
+	if err != nil {
+		return fmt.Errorf("failed to store user settings: %w", err)
+	}
+	return nil
+}
+
+const setLocalOnly string = `
+INSERT INTO user_settings (user_id, local_only)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE SET local_only = excluded.local_only
+`
+
+// SetLocalOnly stores whether a user's inference must stay on local model backends.
+func SetLocalOnly(db *sql.DB, user_id int64, enabled bool) error {
+	_, err := db.Exec(setLocalOnly, user_id, enabled)
+	if err != nil {
+		return fmt.Errorf("failed to store user settings: %w", err)
+	}
+	return nil
+}
+
+// Keys of the global_settings table.
+const (
+	SETTING_LOCAL_ONLY_ENFORCED string = "local_only_enforced" // "true" forces local-only mode for every user
+)
+
+const getGlobalSetting string = `
+SELECT value
+FROM global_settings
+WHERE key = ?
+`
+
+const setGlobalSetting string = `
+INSERT INTO global_settings (key, value)
+VALUES ($1, $2)
+ON CONFLICT (key) DO UPDATE SET value = excluded.value
+`
+
+// GetLocalOnlyEnforced reports whether an administrator enforces local-only mode for everyone.
+func GetLocalOnlyEnforced(db *sql.DB) (bool, error) {
+	var value string
+
+	err := db.QueryRow(getGlobalSetting, SETTING_LOCAL_ONLY_ENFORCED).Scan(&value)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to read global settings: %w", err)
+	}
+
+	return strconv.ParseBool(value)
+}
+
+// SetLocalOnlyEnforced enables or lifts the global local-only override.
+func SetLocalOnlyEnforced(db *sql.DB, enforced bool) error {
+	_, err := db.Exec(setGlobalSetting, SETTING_LOCAL_ONLY_ENFORCED, strconv.FormatBool(enforced))
+	if err != nil {
+		return fmt.Errorf("failed to store global settings: %w", err)
+	}
+	return nil
+}
@@ -4,54 +4,16 @@ import (
 	"database/sql"
 	"fmt"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
-const tableCreationQuery string = `
-CREATE TABLE IF NOT EXISTS users (
-    name TEXT NOT NULL,
-    password TEXT NOT NULL,
-    email TEXT NOT NULL UNIQUE,
-    is_admin BOOLEAN,
-	is_premium BOOLEAN,
-    id INTEGER PRIMARY KEY
-);
-
-CREATE TABLE IF NOT EXISTS prompts (
-	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
-	prompt TEXT NOT NULL
-);
-
-CREATE TABLE IF NOT EXISTS user_documents (
-	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
-	original_name TEXT NOT NULL,
-	storage_name TEXT NOT NULL
-);
-
-CREATE TABLE IF NOT EXISTS signup_requests (
-	name TEXT NOT NULL,
-	password TEXT NOT NULL,
-	email TEXT NOT NULL UNIQUE
-);
-
-CREATE TABLE IF NOT EXISTS preprompt_history (
-	user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
-	prompts  BLOB
-);
-`
-
-const addDocument string = `
-INSERT OR REPLACE INTO user_documents (user_id, original_name, storage_name)
-VALUES ($1, $2, $3)
-`
-
 const getUserID string = `
 SELECT id FROM users
 WHERE email = ?
 `
 
 const getDBUser string = `
-SELECT name, password, is_admin, is_premium, id FROM users
+SELECT name, password, is_admin, is_premium, role, id FROM users
 WHERE email = ?
 `
 
@@ -59,7 +21,19 @@ const getSignup string = `
 SELECT name, email FROM signup_requests
 `
 
-// SetupSqlite initializes a new SQLite database with required tables and admin user.
+// Open opens the SQLite database without touching its schema.
+//
+// Foreign key enforcement is enabled on every connection of the pool, so the
+// ON DELETE CASCADE clauses of the schema take effect. The execution time of
+// every statement is recorded in metrics.DatabaseDuration.
+func Open(db_location string) (*sql.DB, error) {
+	return sql.OpenDB(timedConnector{
+		dsn:    db_location + "?_foreign_keys=on",
+		driver: &sqlite3.SQLiteDriver{},
+	}), nil
+}
+
+// SetupSqlite opens the SQLite database, migrates it to the latest schema and creates the admin user.
 //
 // Parameters:
 //   - db_location: Path to the SQLite database file
@@ -69,21 +43,21 @@ SELECT name, email FROM signup_requests
 //   - *sql.DB: Database connection handle
 //   - error: Initialization errors including:
 //   - Database connection failures
-//   - Table creation failures
+//   - Migration failures (see Migrate)
 //   - Admin user creation failures
 //
 // Note:
-//   - Creates four tables: users, subscriptions, user_documents, and signup_requests
+//   - The schema is defined by the migrations in migrate.go
 //   - Automatically adds a default signup request for testing
 //   - Uses FOREIGN KEY constraints with ON DELETE CASCADE
 func SetupSqlite(db_location string, admin User) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", db_location)
+	db, err := Open(db_location)
 
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = db.Exec(tableCreationQuery)
+	err = Migrate(db)
 
 	if err != nil {
 		return nil, err
@@ -129,21 +103,21 @@ func GetUserID(db *sql.DB, email string) (int64, error) {
 //
 // Returns:
 //   - DataBaseUser: Struct containing all user fields
-//   - error: Database query errors
+//   - error: sql.ErrNoRows if no user has this email, other database errors as is
 //
 // Note:
-//   - Returns empty DataBaseUser with nil error if user not found
 //   - Includes sensitive information (hashed password)
 func GetDataBaseUser(db *sql.DB, email string) (DataBaseUser, error) {
 	var name string
 	var password string
 	var is_admin bool
 	var is_premium bool
+	var role string
 	var id int64
 
-	err := db.QueryRow(getDBUser, email).Scan(&name, &password, &is_admin, &is_premium, &id)
+	err := db.QueryRow(getDBUser, email).Scan(&name, &password, &is_admin, &is_premium, &role, &id)
 	if err != nil {
-		return DataBaseUser{Name: "", ID: 0, IsAdmin: false, IsPremium: false, Password: "", Email: ""}, nil
+		return DataBaseUser{}, err
 	}
 
 	return DataBaseUser{
@@ -152,34 +126,11 @@ func GetDataBaseUser(db *sql.DB, email string) (DataBaseUser, error) {
 		Email:     email,
 		IsAdmin:   is_admin,
 		IsPremium: is_premium,
+		Role:      role,
 		ID:        id,
 	}, nil
 }
 
-// AddDocument associates a document with a user in the database.
-//
-// Parameters:
-//   - db: Database connection handle
-//   - id: User ID (foreign key)
-//   - filename: Original document name
-//   - storage_name: Internal storage identifier
-//
-// Returns:
-//   - error: Database operation errors
-//
-// Note:
-//   - Uses INSERT OR REPLACE to handle duplicates
-//   - Documents are automatically deleted when users are removed (ON DELETE CASCADE)
-func AddDocument(db *sql.DB, id int64, filename string, storage_name string) error {
-	_, err := db.Exec(addDocument, id, filename, storage_name)
-
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 // GetSignupRequests retrieves all pending signup requests from the database.
 //
 // Parameters:
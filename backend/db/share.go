@@ -0,0 +1,250 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Permissions of a share. SHARE_READ lists the document and allows downloading it,
+// SHARE_RETRIEVE additionally adds it to the retrieval context of inference requests.
+const (
+	SHARE_READ     string = "read"
+	SHARE_RETRIEVE string = "retrieve"
+)
+
+// DocumentShare grants a user or all members of a team access to a document.
+//
+//   - ID:          Auto-incremented primary key, used to revoke the share
+//   - StorageName: Shared document of the granting owner
+//   - Title:       Title of the shared document
+//   - UserID:      User the document is shared with, 0 for team shares
+//   - UserEmail:   Email of that user, empty for team shares
+//   - TeamID:      Team the document is shared with, 0 for user shares
+//   - TeamName:    Name of that team, empty for user shares
+//   - Permission:  SHARE_READ or SHARE_RETRIEVE
+//   - CreatedAt:   Unix timestamp of the grant or its last change
+type DocumentShare struct {
+	ID          int64
+	StorageName string
+	Title       string
+	UserID      int64
+	UserEmail   string
+	TeamID      int64
+	TeamName    string
+	Permission  string
+	CreatedAt   int64
+}
+
+// SharedSource identifies a document of another user in the ML pipeline.
+type SharedSource struct {
+	OwnerID     int64
+	StorageName string
+}
+
+// Documents shared with the user given as the 1st, 2nd and 3rd parameter, one row
+// per document. A document shared several times (directly and through teams) gets
+// the strongest permission; 'retrieve' sorts after 'read', so MAX picks it.
+const sharedWithUser string = `
+SELECT owner_id, storage_name, MAX(permission) AS access
+FROM document_shares
+WHERE owner_id <> ? AND (user_id = ? OR team_id IN (SELECT team_id FROM team_members WHERE user_id = ?))
+GROUP BY owner_id, storage_name
+`
+
+const shareColumns string = `
+SELECT
+	s.id, s.storage_name, d.title,
+	IFNULL(s.user_id, 0), IFNULL(u.email, ''),
+	IFNULL(s.team_id, 0), IFNULL(t.name, ''),
+	s.permission, s.created_at
+FROM document_shares s
+JOIN user_documents d ON d.user_id = s.owner_id AND d.storage_name = s.storage_name
+LEFT JOIN users u ON u.id = s.user_id
+LEFT JOIN teams t ON t.id = s.team_id
+`
+
+const upsertShare string = `
+INSERT INTO document_shares (owner_id, storage_name, user_id, team_id, permission, created_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (owner_id, storage_name, IFNULL(user_id, 0), IFNULL(team_id, 0))
+DO UPDATE SET permission = excluded.permission, created_at = excluded.created_at
+`
+
+const getShareByGrantee string = shareColumns + `
+WHERE s.owner_id = $1 AND s.storage_name = $2 AND IFNULL(s.user_id, 0) = $3 AND IFNULL(s.team_id, 0) = $4
+`
+
+// ShareDocument grants a user or a team access to a document, or changes the permission of an existing grant.
+//
+// Parameters:
+//   - owner_id: Owner of the document
+//   - storage_name: Document to share
+//   - user_id, team_id: Grantee, exactly one of them must be non-zero
+//   - permission: SHARE_READ or SHARE_RETRIEVE
+//
+// Returns:
+//   - DocumentShare: The stored share
+//   - error: sql.ErrNoRows if the owner has no such document, database errors
+//     (a constraint error if the grantee does not exist)
+func ShareDocument(db *sql.DB, owner_id int64, storage_name string, user_id int64, team_id int64, permission string) (DocumentShare, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return DocumentShare{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow(documentExists, owner_id, storage_name).Scan(&exists); err != nil {
+		return DocumentShare{}, err
+	}
+
+	var user sql.NullInt64 = sql.NullInt64{Int64: user_id, Valid: user_id != 0}
+	var team sql.NullInt64 = sql.NullInt64{Int64: team_id, Valid: team_id != 0}
+
+	_, err = tx.Exec(upsertShare, owner_id, storage_name, user, team, permission, time.Now().UTC().Unix())
+	if err != nil {
+		return DocumentShare{}, fmt.Errorf("failed to share document: %w", err)
+	}
+
+	share, err := scan_share(tx.QueryRow(getShareByGrantee, owner_id, storage_name, user_id, team_id))
+	if err != nil {
+		return DocumentShare{}, err
+	}
+
+	return share, tx.Commit()
+}
+
+const getSharesOfOwner string = shareColumns + `
+WHERE s.owner_id = $1 AND ($2 = '' OR s.storage_name = $2)
+ORDER BY s.storage_name, s.id
+`
+
+// GetDocumentShares lists the shares a user granted.
+//
+// Parameters:
+//   - owner_id: Owner of the shared documents
+//   - storage_name: Only list shares of this document, empty for all documents
+func GetDocumentShares(db *sql.DB, owner_id int64, storage_name string) ([]DocumentShare, error) {
+	rows, err := db.Query(getSharesOfOwner, owner_id, storage_name)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	shares := []DocumentShare{}
+
+	for rows.Next() {
+		share, err := scan_share(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return shares, nil
+}
+
+const getShare string = shareColumns + `
+WHERE s.id = $1 AND s.owner_id = $2
+`
+
+const deleteShare string = `
+DELETE FROM document_shares
+WHERE id = $1 AND owner_id = $2
+`
+
+// RevokeDocumentShare removes a share granted by a user.
+//
+// Returns:
+//   - DocumentShare: The revoked share
+//   - error: sql.ErrNoRows if the user granted no share with this ID
+func RevokeDocumentShare(db *sql.DB, owner_id int64, id int64) (DocumentShare, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return DocumentShare{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	share, err := scan_share(tx.QueryRow(getShare, id, owner_id))
+	if err != nil {
+		return DocumentShare{}, err
+	}
+
+	if err := expectOneRow(tx.Exec(deleteShare, id, owner_id)); err != nil {
+		return DocumentShare{}, err
+	}
+
+	return share, tx.Commit()
+}
+
+// scan_share reads a row selected with shareColumns.
+func scan_share(row interface{ Scan(...any) error }) (DocumentShare, error) {
+	var share DocumentShare
+
+	err := row.Scan(
+		&share.ID,
+		&share.StorageName,
+		&share.Title,
+		&share.UserID,
+		&share.UserEmail,
+		&share.TeamID,
+		&share.TeamName,
+		&share.Permission,
+		&share.CreatedAt,
+	)
+
+	return share, err
+}
+
+// Library documents are filed under collection 0 in the ML pipeline (api.LEGAL_LIBRARY_COLLECTION).
+const getRetrievalSources string = `
+SELECT owner_id, storage_name
+FROM (` + sharedWithUser + `)
+WHERE access = 'retrieve'
+UNION
+SELECT 0, storage_name
+FROM library_documents
+WHERE ?
+ORDER BY 1, 2
+`
+
+// GetRetrievalSources lists the documents besides their own a user's inference retrieves from.
+//
+// The ML pipeline searches these in addition to the user's own documents.
+//
+// Parameters:
+//   - user_id: The user asking
+//   - include_library: Whether to include the shared legal library (see UserSettings.LegalLibrary)
+//
+// Returns:
+//   - []SharedSource: Documents of other users shared for retrieval, and the
+//     library documents with OwnerID 0 if include_library is set
+//   - error: Database errors
+func GetRetrievalSources(db *sql.DB, user_id int64, include_library bool) ([]SharedSource, error) {
+	rows, err := db.Query(getRetrievalSources, user_id, user_id, user_id, include_library)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	sources := []SharedSource{}
+
+	for rows.Next() {
+		var source SharedSource
+		if err := rows.Scan(&source.OwnerID, &source.StorageName); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		sources = append(sources, source)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return sources, nil
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGetRetrievalSources(t *testing.T) {
+	db_handle := openDatabase(t)
+
+	if err := Migrate(db_handle); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, email := range []string{"owner@example.com", "reader@example.com"} {
+		if err := AddUser(db_handle, User{Name: email, Password: "hash", Email: email}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	owner, _ := GetUserID(db_handle, "owner@example.com")
+	reader, _ := GetUserID(db_handle, "reader@example.com")
+
+	for _, storage_name := range []string{"retrieve.pdf", "read.pdf"} {
+		err := AddDocument(db_handle, owner, DocumentRecord{OriginalName: storage_name, StorageName: storage_name, Title: storage_name, SHA256: storage_name})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := ShareDocument(db_handle, owner, "retrieve.pdf", reader, 0, SHARE_RETRIEVE); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ShareDocument(db_handle, owner, "read.pdf", reader, 0, SHARE_READ); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AddLibraryDocument(db_handle, "statute.pdf", "statute.pdf", "Statute", owner, "statute", 10); err != nil {
+		t.Fatal(err)
+	}
+
+	shared := SharedSource{OwnerID: owner, StorageName: "retrieve.pdf"}
+	library := SharedSource{OwnerID: 0, StorageName: "statute.pdf"}
+
+	sources, err := GetRetrievalSources(db_handle, reader, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(sources, []SharedSource{shared}) {
+		t.Errorf("without library: %+v, want %+v", sources, []SharedSource{shared})
+	}
+
+	sources, err = GetRetrievalSources(db_handle, reader, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(sources, []SharedSource{library, shared}) {
+		t.Errorf("with library: %+v, want %+v", sources, []SharedSource{library, shared})
+	}
+
+	// The owner's own documents are searched by the pipeline anyway
+	sources, err = GetRetrievalSources(db_handle, owner, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(sources, []SharedSource{library}) {
+		t.Errorf("owner with library: %+v, want %+v", sources, []SharedSource{library})
+	}
+}
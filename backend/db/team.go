@@ -0,0 +1,276 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Roles of team members. Owners manage the members of a team and may delete it.
+const (
+	TEAM_OWNER  string = "owner"
+	TEAM_MEMBER string = "member"
+)
+
+// ErrTeamExists is returned by AddTeam if the team name is taken.
+var ErrTeamExists = errors.New("a team with this name exists")
+
+// ErrLastOwner is returned when a change would leave a team without owner.
+var ErrLastOwner = errors.New("the last owner cannot leave the team, delete it instead")
+
+// Team is a group of users documents can be shared with.
+//
+//   - ID:        Auto-incremented primary key
+//   - Name:      Unique display name
+//   - CreatedAt: Unix timestamp of creation
+//   - Role:      Role of the requesting user in the team
+//   - Members:   Members ordered by name
+type Team struct {
+	ID        int64
+	Name      string
+	CreatedAt int64
+	Role      string
+	Members   []TeamMember
+}
+
+// TeamMember is a user belonging to a team.
+type TeamMember struct {
+	UserID  int64
+	Name    string
+	Email   string
+	Role    string
+	AddedAt int64
+}
+
+const teamNameExists string = `
+SELECT 1 FROM teams
+WHERE name = $1
+`
+
+const insertTeam string = `
+INSERT INTO teams (name, created_at)
+VALUES ($1, $2)
+`
+
+const getMemberUser string = `
+SELECT name, email FROM users
+WHERE id = $1
+`
+
+const insertTeamMember string = `
+INSERT INTO team_members (team_id, user_id, role, added_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (team_id, user_id) DO UPDATE SET role = excluded.role
+`
+
+// AddTeam creates a team with the given user as its owner.
+//
+// Returns:
+//   - Team: The created team, its owner as only member
+//   - error: ErrTeamExists if the name is taken, database errors
+func AddTeam(db *sql.DB, name string, owner_id int64) (Team, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return Team{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRow(teamNameExists, name).Scan(&exists)
+	if err == nil {
+		return Team{}, ErrTeamExists
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return Team{}, err
+	}
+
+	var now int64 = time.Now().UTC().Unix()
+
+	result, err := tx.Exec(insertTeam, name, now)
+	if err != nil {
+		return Team{}, fmt.Errorf("failed to create team: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Team{}, fmt.Errorf("failed to get team id: %w", err)
+	}
+
+	if _, err := tx.Exec(insertTeamMember, id, owner_id, TEAM_OWNER, now); err != nil {
+		return Team{}, fmt.Errorf("failed to add owner: %w", err)
+	}
+
+	var owner TeamMember = TeamMember{UserID: owner_id, Role: TEAM_OWNER, AddedAt: now}
+	if err := tx.QueryRow(getMemberUser, owner_id).Scan(&owner.Name, &owner.Email); err != nil {
+		return Team{}, fmt.Errorf("failed to get owner: %w", err)
+	}
+
+	team := Team{ID: id, Name: name, CreatedAt: now, Role: TEAM_OWNER, Members: []TeamMember{owner}}
+	return team, tx.Commit()
+}
+
+const getTeamRole string = `
+SELECT role FROM team_members
+WHERE team_id = $1 AND user_id = $2
+`
+
+// GetTeamRole returns the role of a user in a team.
+//
+// Returns:
+//   - error: sql.ErrNoRows if the team does not exist or the user is no member
+func GetTeamRole(db *sql.DB, team_id int64, user_id int64) (string, error) {
+	var role string
+	err := db.QueryRow(getTeamRole, team_id, user_id).Scan(&role)
+	return role, err
+}
+
+const getTeams string = `
+SELECT t.id, t.name, t.created_at, m.role
+FROM teams t
+JOIN team_members m ON m.team_id = t.id
+WHERE m.user_id = $1
+ORDER BY t.name COLLATE NOCASE
+`
+
+const getTeamMembers string = `
+SELECT m.team_id, u.id, u.name, u.email, m.role, m.added_at
+FROM team_members m
+JOIN users u ON u.id = m.user_id
+WHERE m.team_id IN (SELECT team_id FROM team_members WHERE user_id = $1)
+ORDER BY u.name COLLATE NOCASE, u.id
+`
+
+// GetTeams lists the teams a user belongs to together with their members.
+func GetTeams(db *sql.DB, user_id int64) ([]Team, error) {
+	rows, err := db.Query(getTeams, user_id)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	teams := []Team{}
+	positions := map[int64]int{}
+
+	for rows.Next() {
+		var team Team = Team{Members: []TeamMember{}}
+		if err := rows.Scan(&team.ID, &team.Name, &team.CreatedAt, &team.Role); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		positions[team.ID] = len(teams)
+		teams = append(teams, team)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	rows.Close()
+
+	rows, err = db.Query(getTeamMembers, user_id)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var team_id int64
+		var member TeamMember
+		if err := rows.Scan(&team_id, &member.UserID, &member.Name, &member.Email, &member.Role, &member.AddedAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+
+		if position, ok := positions[team_id]; ok {
+			teams[position].Members = append(teams[position].Members, member)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return teams, nil
+}
+
+// SetTeamMember adds a user to a team or changes the role of a member.
+//
+// Returns:
+//   - error: ErrLastOwner if the last owner would be demoted, database errors
+//     (a constraint error if the team or user does not exist)
+func SetTeamMember(db *sql.DB, team_id int64, user_id int64, role string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(insertTeamMember, team_id, user_id, role, time.Now().UTC().Unix()); err != nil {
+		return fmt.Errorf("failed to add member: %w", err)
+	}
+
+	if err := expect_owner(tx, team_id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const deleteTeamMember string = `
+DELETE FROM team_members
+WHERE team_id = $1 AND user_id = $2
+`
+
+// RemoveTeamMember removes a user from a team.
+//
+// Documents shared with the team are no longer accessible to the user.
+//
+// Returns:
+//   - error: sql.ErrNoRows if the user is no member, ErrLastOwner if the user
+//     is the last owner, database errors
+func RemoveTeamMember(db *sql.DB, team_id int64, user_id int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := expectOneRow(tx.Exec(deleteTeamMember, team_id, user_id)); err != nil {
+		return err
+	}
+
+	if err := expect_owner(tx, team_id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const countTeamOwners string = `
+SELECT COUNT(*) FROM team_members
+WHERE team_id = $1 AND role = 'owner'
+`
+
+// expect_owner fails with ErrLastOwner if a team has no owner left.
+func expect_owner(tx *sql.Tx, team_id int64) error {
+	var owners int64
+	if err := tx.QueryRow(countTeamOwners, team_id).Scan(&owners); err != nil {
+		return fmt.Errorf("failed to count owners: %w", err)
+	}
+
+	if owners == 0 {
+		return ErrLastOwner
+	}
+
+	return nil
+}
+
+const deleteTeam string = `
+DELETE FROM teams
+WHERE id = $1
+`
+
+// DeleteTeam removes a team, its memberships and all shares with it.
+//
+// Returns:
+//   - error: sql.ErrNoRows if the team does not exist
+func DeleteTeam(db *sql.DB, team_id int64) error {
+	return expectOneRow(db.Exec(deleteTeam, team_id))
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"backend/metrics"
+	"context"
+	"database/sql/driver"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// timedConnector opens SQLite connections whose statements are timed (see metrics.DatabaseDuration).
+type timedConnector struct {
+	dsn    string
+	driver *sqlite3.SQLiteDriver
+}
+
+func (connector timedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := connector.driver.Open(connector.dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &timedConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+func (connector timedConnector) Driver() driver.Driver {
+	return connector.driver
+}
+
+// timedConn measures every statement executed on a connection, also within transactions.
+type timedConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (conn *timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	var start time.Time = time.Now()
+	result, err := conn.SQLiteConn.ExecContext(ctx, query, args)
+	metrics.DatabaseDuration.Observe(time.Since(start).Seconds(), metrics.StatementKind(query))
+
+	return result, err
+}
+
+func (conn *timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	var start time.Time = time.Now()
+	rows, err := conn.SQLiteConn.QueryContext(ctx, query, args)
+
+	if err != nil {
+		metrics.DatabaseDuration.Observe(time.Since(start).Seconds(), metrics.StatementKind(query))
+		return nil, err
+	}
+
+	return &timedRows{Rows: rows, start: start, statement: metrics.StatementKind(query)}, nil
+}
+
+// timedRows completes the measurement of a query when its rows are closed,
+// SQLite only computes them while they are read.
+type timedRows struct {
+	driver.Rows
+	start     time.Time
+	statement string
+}
+
+func (rows *timedRows) Close() error {
+	err := rows.Rows.Close()
+	metrics.DatabaseDuration.Observe(time.Since(rows.start).Seconds(), rows.statement)
+
+	return err
+}
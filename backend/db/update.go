@@ -7,18 +7,16 @@ import (
 
 const promoteUserQuery string = `
 UPDATE users
-SET is_admin = TRUE
+SET is_admin = TRUE, is_premium = TRUE, role = 'admin'
 WHERE email = ?
 `
 
 func PromoteUser(db *sql.DB, email string) error {
-	fmt.Printf("Attempting to promote email: '%s'\n", email) // Debug log
 	result, err := db.Exec(promoteUserQuery, email)
 	if err != nil {
 		return fmt.Errorf("promote failed: %w", err)
 	}
 	rowsAffected, _ := result.RowsAffected()
-	fmt.Printf("Rows affected: %d\n", rowsAffected) // Debug log
 	if rowsAffected == 0 {
 		return fmt.Errorf("no user found with email '%s'", email)
 	}
@@ -45,3 +43,36 @@ func UpdatePrompt(db *sql.DB, id int64, prompt string) error {
 	_, err := db.Exec(updatePrompt, prompt, id)
 	return err
 }
+
+const updatePassword string = `
+UPDATE users
+SET password = $1
+WHERE id = $2
+`
+
+// UpdatePassword replaces the stored password hash of a user.
+//
+// Parameters:
+//   - db:   Database connection handle (*sql.DB)
+//   - id:   User ID to update (int64)
+//   - hash: Encoded password hash as produced by auth.HashPassword
+//
+// Returns:
+//   - error: Any database error, or an error if no user has the given ID
+func UpdatePassword(db *sql.DB, id int64, hash string) error {
+	result, err := db.Exec(updatePassword, hash, id)
+	if err != nil {
+		return fmt.Errorf("password update failed: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("no user found with id %d", id)
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package db
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Upload is a resumable upload in progress.
+//
+//   - ID:        Random identifier, part of the upload URL
+//   - UserID:    Owner of the upload
+//   - Filename:  Original file name, selects the document format
+//   - Title:     Display title of the document
+//   - Length:    Announced size in bytes
+//   - Received:  Bytes persisted so far, the offset the next chunk must start at
+//   - SHA256:    Announced hex encoded SHA-256 of the complete file
+//   - Tags:      Tags the document receives once processed
+//   - CreatedAt: Unix timestamp of the creation
+//   - UpdatedAt: Unix timestamp of the last received chunk
+type Upload struct {
+	ID        string
+	UserID    int64
+	Filename  string
+	Title     string
+	Length    int64
+	Received  int64
+	SHA256    string
+	Tags      []string
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+const insertUpload string = `
+INSERT INTO uploads (id, user_id, filename, title, length, received, sha256, tags, created_at, updated_at)
+VALUES ($1, $2, $3, $4, $5, 0, $6, $7, $8, $8)
+`
+
+// CreateUpload starts a resumable upload. Tags must not contain commas.
+//
+// Returns:
+//   - Upload: The new upload with a random ID and nothing received
+//   - error: Random source or database failure
+func CreateUpload(
+	db *sql.DB,
+	user_id int64,
+	filename string,
+	title string,
+	length int64,
+	sha256 string,
+	tags []string,
+) (Upload, error) {
+	var random [16]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return Upload{}, fmt.Errorf("failed to generate upload ID: %w", err)
+	}
+
+	var now int64 = time.Now().UTC().Unix()
+	var upload Upload = Upload{
+		ID:        hex.EncodeToString(random[:]),
+		UserID:    user_id,
+		Filename:  filename,
+		Title:     title,
+		Length:    length,
+		SHA256:    sha256,
+		Tags:      tags,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	_, err := db.Exec(insertUpload, upload.ID, user_id, filename, title, length, sha256, strings.Join(tags, ","), now)
+	if err != nil {
+		return Upload{}, fmt.Errorf("failed to create upload: %w", err)
+	}
+
+	return upload, nil
+}
+
+const getUpload string = `
+SELECT id, user_id, filename, title, length, received, sha256, tags, created_at, updated_at
+FROM uploads
+WHERE id = $1 AND user_id = $2
+`
+
+// GetUpload returns an upload of a user.
+//
+// Returns:
+//   - error: sql.ErrNoRows if the upload does not exist or belongs to another user
+func GetUpload(db *sql.DB, id string, user_id int64) (Upload, error) {
+	var upload Upload
+	var tags string
+
+	err := db.QueryRow(getUpload, id, user_id).Scan(
+		&upload.ID,
+		&upload.UserID,
+		&upload.Filename,
+		&upload.Title,
+		&upload.Length,
+		&upload.Received,
+		&upload.SHA256,
+		&tags,
+		&upload.CreatedAt,
+		&upload.UpdatedAt,
+	)
+
+	if err != nil {
+		return Upload{}, err
+	}
+
+	upload.Tags = split_tags(tags)
+	return upload, nil
+}
+
+const updateUploadReceived string = `
+UPDATE uploads
+SET received = $1, updated_at = $2
+WHERE id = $3
+`
+
+// SetUploadReceived records how many bytes of an upload are persisted.
+//
+// Returns:
+//   - error: sql.ErrNoRows if the upload does not exist
+func SetUploadReceived(db *sql.DB, id string, received int64) error {
+	return expectOneRow(db.Exec(updateUploadReceived, received, time.Now().UTC().Unix(), id))
+}
+
+const deleteUpload string = `
+DELETE FROM uploads
+WHERE id = ?
+`
+
+// DeleteUpload removes a finished or cancelled upload.
+//
+// Returns:
+//   - error: sql.ErrNoRows if the upload does not exist
+func DeleteUpload(db *sql.DB, id string) error {
+	return expectOneRow(db.Exec(deleteUpload, id))
+}
+
+const getExpiredUploads string = `
+SELECT id
+FROM uploads
+WHERE updated_at < ?
+`
+
+// GetExpiredUploads lists uploads that received no data since the given time.
+//
+// Parameters:
+//   - before: Unix timestamp, uploads last updated earlier are listed
+//
+// Returns:
+//   - []string: IDs of the expired uploads, remove them with DeleteExpiredUpload
+func GetExpiredUploads(db *sql.DB, before int64) ([]string, error) {
+	rows, err := db.Query(getExpiredUploads, before)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return ids, nil
+}
+
+const deleteExpiredUpload string = `
+DELETE FROM uploads
+WHERE id = ? AND updated_at < ?
+`
+
+// DeleteExpiredUpload removes an upload if it still received no data since the given time.
+//
+// Returns:
+//   - error: sql.ErrNoRows if the upload does not exist or received data in the meantime
+func DeleteExpiredUpload(db *sql.DB, id string, before int64) error {
+	return expectOneRow(db.Exec(deleteExpiredUpload, id, before))
+}
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Kinds of counted usage.
+const (
+	USAGE_INFERENCE  string = "inference"  // Every inference request, deep think included
+	USAGE_DEEP_THINK string = "deep_think" // Inference requests with deep think enabled
+)
+
+// Layouts of the counter periods, days and months in UTC.
+const (
+	DAY_PERIOD   string = "2006-01-02"
+	MONTH_PERIOD string = "2006-01"
+)
+
+// ErrDailyQuota and ErrMonthlyQuota are returned by ConsumeQuota if a quota is used up.
+var (
+	ErrDailyQuota   = errors.New("daily quota exceeded")
+	ErrMonthlyQuota = errors.New("monthly quota exceeded")
+)
+
+// Quota limits the requests of a user, 0 means unlimited.
+type Quota struct {
+	Daily   int64
+	Monthly int64
+}
+
+// Usage is the consumption of a user in the current day and month.
+//
+//   - Kind:  One of the USAGE_* constants
+//   - Day:   Requests today (UTC)
+//   - Month: Requests this month (UTC)
+type Usage struct {
+	Kind  string
+	Day   int64
+	Month int64
+}
+
+const getUsageCount string = `
+SELECT IFNULL(SUM(count), 0) FROM usage_counters
+WHERE user_id = $1 AND kind = $2 AND period = $3
+`
+
+// consumeQuota counts a request in the day ($3) and the month ($4) if neither the
+// daily ($5) nor the monthly ($6) limit is reached, limits of 0 or less being unlimited.
+// As a single statement it checks and counts atomically.
+const consumeQuota string = `
+INSERT INTO usage_counters (user_id, kind, period, count)
+SELECT $1, $2, periods.period, 1
+FROM (SELECT $3 AS period UNION ALL SELECT $4) AS periods
+WHERE ($5 <= 0 OR (SELECT IFNULL(SUM(count), 0) FROM usage_counters WHERE user_id = $1 AND kind = $2 AND period = $3) < $5)
+AND ($6 <= 0 OR (SELECT IFNULL(SUM(count), 0) FROM usage_counters WHERE user_id = $1 AND kind = $2 AND period = $4) < $6)
+ON CONFLICT (user_id, kind, period) DO UPDATE SET count = count + 1
+`
+
+// ConsumeQuota counts a request of a user unless it exceeds the quota.
+//
+// Check and count are one statement, so concurrent requests of a user cannot
+// both take the last request of a quota.
+//
+// Parameters:
+//   - kind: One of the USAGE_* constants
+//   - quota: Limits of the user, Quota{} only counts
+//   - now: Time of the request, selects the day and month
+//
+// Returns:
+//   - error: ErrDailyQuota or ErrMonthlyQuota if the request is refused, database errors
+func ConsumeQuota(db *sql.DB, user_id int64, kind string, quota Quota, now time.Time) error {
+	var day string = now.UTC().Format(DAY_PERIOD)
+	var month string = now.UTC().Format(MONTH_PERIOD)
+
+	result, err := db.Exec(consumeQuota, user_id, kind, day, month, quota.Daily, quota.Monthly)
+	if err != nil {
+		return fmt.Errorf("failed to count usage: %w", err)
+	}
+
+	counted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to count usage: %w", err)
+	} else if counted > 0 {
+		return nil
+	}
+
+	// Refused, tell which quota is used up
+	if quota.Daily > 0 {
+		var count int64
+		if err := db.QueryRow(getUsageCount, user_id, kind, day).Scan(&count); err != nil {
+			return fmt.Errorf("failed to read usage: %w", err)
+		}
+
+		if count >= quota.Daily {
+			return ErrDailyQuota
+		}
+	}
+
+	return ErrMonthlyQuota
+}
+
+const getUsage string = `
+WITH counters AS (
+	SELECT kind, period, count FROM usage_counters
+	WHERE user_id = $1 AND period IN ($2, $3)
+)
+SELECT
+	kind,
+	SUM(CASE WHEN period = $2 THEN count ELSE 0 END),
+	SUM(CASE WHEN period = $3 THEN count ELSE 0 END)
+FROM counters
+GROUP BY kind
+ORDER BY kind
+`
+
+// GetUsage lists the consumption of a user in the day and month of now.
+// Kinds without requests in the month are omitted.
+func GetUsage(db *sql.DB, user_id int64, now time.Time) ([]Usage, error) {
+	rows, err := db.Query(getUsage, user_id, now.UTC().Format(DAY_PERIOD), now.UTC().Format(MONTH_PERIOD))
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	usage := []Usage{}
+
+	for rows.Next() {
+		var entry Usage
+		if err := rows.Scan(&entry.Kind, &entry.Day, &entry.Month); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		usage = append(usage, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return usage, nil
+}
+
+const deleteUsage string = `
+DELETE FROM usage_counters
+WHERE user_id = $1 AND period IN ($2, $3)
+`
+
+// ResetUsage clears the consumption of a user in the day and month of now.
+func ResetUsage(db *sql.DB, user_id int64, now time.Time) error {
+	_, err := db.Exec(deleteUsage, user_id, now.UTC().Format(DAY_PERIOD), now.UTC().Format(MONTH_PERIOD))
+	if err != nil {
+		return fmt.Errorf("failed to reset usage: %w", err)
+	}
+	return nil
+}
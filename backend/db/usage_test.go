@@ -0,0 +1,80 @@
+package db
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConsumeQuotaConcurrently(t *testing.T) {
+	db_handle := openDatabase(t)
+
+	if err := Migrate(db_handle); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AddUser(db_handle, User{Name: "Standard", Password: "hash", Email: "standard@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	user_id, _ := GetUserID(db_handle, "standard@example.com")
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	var mutex sync.Mutex
+	var group sync.WaitGroup
+	var counted, refused int
+	var failures []error
+
+	for range 40 {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+
+			err := ConsumeQuota(db_handle, user_id, USAGE_INFERENCE, Quota{Daily: 5, Monthly: 100}, now)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			switch {
+			case err == nil:
+				counted++
+			case errors.Is(err, ErrDailyQuota):
+				refused++
+			default:
+				failures = append(failures, err)
+			}
+		}()
+	}
+
+	group.Wait()
+
+	if counted != 5 || refused != 35 || len(failures) > 0 {
+		t.Errorf("%d counted, %d refused, failures %v; want 5 and 35", counted, refused, failures)
+	}
+
+	usage, err := GetUsage(db_handle, user_id, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(usage) != 1 || usage[0] != (Usage{Kind: USAGE_INFERENCE, Day: 5, Month: 5}) {
+		t.Errorf("usage %+v", usage)
+	}
+
+	// The monthly quota applies once the day is over
+	tomorrow := now.Add(24 * time.Hour)
+
+	if err := ConsumeQuota(db_handle, user_id, USAGE_INFERENCE, Quota{Daily: 5, Monthly: 6}, tomorrow); err != nil {
+		t.Errorf("next day: %v", err)
+	}
+
+	if err := ConsumeQuota(db_handle, user_id, USAGE_INFERENCE, Quota{Daily: 5, Monthly: 6}, tomorrow); !errors.Is(err, ErrMonthlyQuota) {
+		t.Errorf("monthly quota used up: %v", err)
+	}
+
+	// Without limits the request is only counted
+	if err := ConsumeQuota(db_handle, user_id, USAGE_DEEP_THINK, Quota{}, tomorrow); err != nil {
+		t.Errorf("unlimited: %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+// Package document recognizes uploaded documents and extracts their text.
+//
+// Every accepted file type is described by a Format in a registry keyed by file
+// extension. An upload is accepted if its extension is registered, the sniffed
+// content matches what the format expects and the format's validator passes.
+// PDFs are forwarded to the ML pipeline as they are; all other formats are
+// converted to normalized UTF-8 text by their extractor first.
+package document
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Content classes returned by Sniff.
+const (
+	CONTENT_PDF     string = "pdf"
+	CONTENT_ZIP     string = "zip"
+	CONTENT_TEXT    string = "text"
+	CONTENT_UNKNOWN string = "unknown"
+)
+
+// ErrUnsupportedFormat is returned by Detect for file extensions without a registered format.
+var ErrUnsupportedFormat = errors.New("unsupported file format")
+
+// ErrTooLarge is returned by Extract when a document unpacks to more than its format allows.
+var ErrTooLarge = errors.New("document too large")
+
+// Format describes an accepted file type.
+//
+//   - Name:       Short name, e.g. "docx"
+//   - Extensions: Lower case file extensions including the dot
+//   - MediaType:  MIME type recorded for files of the format
+//   - Content:    Content class (CONTENT_*) the file must sniff as
+//   - Validate:   Checks the structure of the file beyond its content class
+//   - Extract:    Returns the normalized text of the file, nil if the file is
+//     forwarded to the pipeline unchanged
+//   - Pages:      Counts the pages of a complete file of the given size, nil if
+//     the format has no pages. A count of 0 means it could not be determined
+type Format struct {
+	Name       string
+	Extensions []string
+	MediaType  string
+	Content    string
+	Validate   func(data []byte) error
+	Extract    func(data []byte) (string, error)
+	Pages      func(file io.ReaderAt, size int64) (int64, error)
+}
+
+// formats maps file extensions to their format. It is only written during package initialization.
+var formats map[string]Format = map[string]Format{}
+
+// Register adds a format to the registry, replacing formats registered for the same extensions.
+//
+// Not synchronized, must be called before uploads are handled (e.g. from init).
+func Register(format Format) {
+	for _, extension := range format.Extensions {
+		formats[strings.ToLower(extension)] = format
+	}
+}
+
+// Extensions returns the registered file extensions in alphabetical order.
+func Extensions() []string {
+	extensions := make([]string, 0, len(formats))
+	for extension := range formats {
+		extensions = append(extensions, extension)
+	}
+	slices.Sort(extensions)
+	return extensions
+}
+
+// Sniff determines the content class of a file from its first bytes.
+func Sniff(data []byte) string {
+	var content_type string = http.DetectContentType(data)
+
+	switch {
+	case content_type == "application/pdf":
+		return CONTENT_PDF
+	case content_type == "application/zip":
+		return CONTENT_ZIP
+	case strings.HasPrefix(content_type, "text/"):
+		return CONTENT_TEXT
+	default:
+		return CONTENT_UNKNOWN
+	}
+}
+
+// SNIFF_LENGTH is the number of leading bytes Sniff considers.
+//
+// Formats without extractor (PDF) are validated on these bytes alone, so they
+// can be streamed to the pipeline without buffering the file.
+const SNIFF_LENGTH int = 512
+
+// Lookup finds the format registered for the extension of a file name.
+//
+// Returns:
+//   - Format: The format of the file
+//   - error: ErrUnsupportedFormat if no format is registered for the extension
+func Lookup(filename string) (Format, error) {
+	format, exists := formats[strings.ToLower(filepath.Ext(filename))]
+	if !exists {
+		return Format{}, fmt.Errorf("%w, accepted are %s", ErrUnsupportedFormat, strings.Join(Extensions(), ", "))
+	}
+	return format, nil
+}
+
+// Check validates file content against the format.
+//
+// For formats without extractor data may be the first SNIFF_LENGTH bytes of the
+// file, all other formats need the complete file.
+//
+// Returns:
+//   - error: A mismatch between extension and content, or the validation error
+func (format Format) Check(data []byte) error {
+	if err := format.check_content(data); err != nil {
+		return err
+	}
+
+	if err := format.Validate(data); err != nil {
+		return fmt.Errorf("invalid %s file: %w", format.Name, err)
+	}
+
+	return nil
+}
+
+// CheckHead validates the first SNIFF_LENGTH bytes of a file against the format.
+//
+// The content class is always checked. The validator only runs for formats
+// without extractor, all others need the complete file (see Check).
+//
+// Returns:
+//   - error: A mismatch between extension and content, or the validation error
+func (format Format) CheckHead(head []byte) error {
+	if format.Extract == nil {
+		return format.Check(head)
+	}
+
+	return format.check_content(head)
+}
+
+// check_content compares the sniffed content class with the one the format expects.
+func (format Format) check_content(data []byte) error {
+	if content := Sniff(data); content != format.Content {
+		return fmt.Errorf("content does not match the file extension: expected %s, detected %s", format.Content, content)
+	}
+	return nil
+}
+
+// Detect finds the format of an uploaded file and validates the file against it (Lookup and Check).
+//
+// Parameters:
+//   - filename: Original file name, its extension selects the format
+//   - data: File content
+//
+// Returns:
+//   - Format: The format of the file
+//   - error: ErrUnsupportedFormat, a mismatch between extension and content, or the validation error
+func Detect(filename string, data []byte) (Format, error) {
+	format, err := Lookup(filename)
+	if err != nil {
+		return Format{}, err
+	}
+
+	if err := format.Check(data); err != nil {
+		return Format{}, err
+	}
+
+	return format, nil
+}
@@ -0,0 +1,168 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Upper bound of the uncompressed main part of a Word document, guards against zip bombs.
+const maxDocumentXML int64 = 64 << 20
+
+const docxMainPart string = "word/document.xml"
+
+// Extended properties part, holds the page count Word saved with the document.
+const docxAppPart string = "docProps/app.xml"
+
+// Upper bound of the extended properties part.
+const maxAppXML int64 = 1 << 20
+
+func init() {
+	Register(Format{
+		Name:       "docx",
+		Extensions: []string{".docx"},
+		MediaType:  "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		Content:    CONTENT_ZIP,
+		Validate: func(data []byte) error {
+			_, err := docx_main_part(data)
+			return err
+		},
+		Extract: extract_docx,
+		Pages:   docx_pages,
+	})
+}
+
+// docx_main_part finds the main document part of a Word (Office Open XML) document.
+func docx_main_part(data []byte) (*zip.File, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not a zip archive: %w", err)
+	}
+
+	for _, file := range archive.File {
+		if file.Name == docxMainPart {
+			return file, nil
+		}
+	}
+
+	return nil, errors.New("archive has no " + docxMainPart + ", it is not a Word document")
+}
+
+// extract_docx returns the text of the document body.
+//
+// Paragraphs and table rows end with a newline, table cells are separated by tabs
+// and paragraphs within a cell by spaces.
+// Deleted tracked changes and field codes are skipped; headers, footers and
+// comments are not included. A main part larger than maxDocumentXML is refused
+// with ErrTooLarge instead of being cut off.
+func extract_docx(data []byte) (string, error) {
+	part, err := docx_main_part(data)
+	if err != nil {
+		return "", err
+	}
+
+	reader, err := part.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", docxMainPart, err)
+	}
+	defer reader.Close()
+
+	limited := &io.LimitedReader{R: reader, N: maxDocumentXML + 1}
+	decoder := xml.NewDecoder(limited)
+
+	var builder strings.Builder
+	var in_text bool = false
+	var cell_depth int = 0
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			if limited.N <= 0 {
+				return "", fmt.Errorf("%w: %s exceeds %d bytes", ErrTooLarge, docxMainPart, maxDocumentXML)
+			}
+			return "", fmt.Errorf("invalid %s: %w", docxMainPart, err)
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "t":
+				in_text = true
+			case "tc":
+				cell_depth++
+			case "tab":
+				builder.WriteByte('\t')
+			case "br", "cr":
+				builder.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch element.Name.Local {
+			case "t":
+				in_text = false
+			case "p":
+				if cell_depth > 0 {
+					builder.WriteByte(' ')
+				} else {
+					builder.WriteByte('\n')
+				}
+			case "tr":
+				builder.WriteByte('\n')
+			case "tc":
+				cell_depth--
+				builder.WriteByte('\t')
+			}
+		case xml.CharData:
+			if in_text {
+				builder.Write(element)
+			}
+		}
+	}
+
+	// The limit may end the input where the XML happens to be complete
+	if limited.N <= 0 {
+		return "", fmt.Errorf("%w: %s exceeds %d bytes", ErrTooLarge, docxMainPart, maxDocumentXML)
+	}
+
+	return Normalize(builder.String()), nil
+}
+
+// docx_pages returns the page count Word stored in the extended properties.
+//
+// The count is computed by the application that last saved the file; documents
+// written by other tools may lack it, then 0 is returned.
+func docx_pages(file io.ReaderAt, size int64) (int64, error) {
+	archive, err := zip.NewReader(file, size)
+	if err != nil {
+		return 0, fmt.Errorf("not a zip archive: %w", err)
+	}
+
+	for _, part := range archive.File {
+		if part.Name != docxAppPart {
+			continue
+		}
+
+		reader, err := part.Open()
+		if err != nil {
+			return 0, fmt.Errorf("failed to open %s: %w", docxAppPart, err)
+		}
+		defer reader.Close()
+
+		var properties struct {
+			Pages int64 `xml:"Pages"`
+		}
+
+		if err := xml.NewDecoder(io.LimitReader(reader, maxAppXML)).Decode(&properties); err != nil {
+			return 0, fmt.Errorf("invalid %s: %w", docxAppPart, err)
+		}
+
+		return properties.Pages, nil
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,68 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// wordDocument packs the given main part into a minimal Word document.
+func wordDocument(t *testing.T, main_part string) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+
+	part, err := archive.Create(docxMainPart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := part.Write([]byte(main_part)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+const wordBody string = `<?xml version="1.0"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:r><w:t>Erster</w:t><w:tab/><w:t>Absatz</w:t></w:r></w:p>
+<w:tbl><w:tr><w:tc><w:p><w:r><w:t>A</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>B</w:t></w:r></w:p></w:tc></w:tr></w:tbl>
+</w:body></w:document>`
+
+func TestExtractDocx(t *testing.T) {
+	text, err := extract_docx(wordDocument(t, wordBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"Erster\tAbsatz", "A", "B"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text %q lacks %q", text, want)
+		}
+	}
+}
+
+func TestExtractDocxTooLarge(t *testing.T) {
+	padding := strings.Repeat(" ", int(maxDocumentXML))
+
+	for name, main_part := range map[string]string{
+		// The limit cuts the XML in the middle of an element
+		"truncated": wordBody[:len(wordBody)-len("</w:document>")] + padding + "</w:document>",
+		// The limit falls into whitespace after the complete XML
+		"complete": wordBody + padding,
+	} {
+		_, err := extract_docx(wordDocument(t, main_part))
+
+		if !errors.Is(err, ErrTooLarge) {
+			t.Errorf("%s: error %v, want ErrTooLarge", name, err)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package document
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// Nesting depth of multipart bodies followed, deeper parts are ignored.
+const maxMultipartDepth int = 8
+
+// Headers included at the top of the extracted text of an email.
+var emailHeaders []string = []string{"From", "To", "Cc", "Date", "Subject"}
+
+var wordDecoder *mime.WordDecoder = &mime.WordDecoder{
+	CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+		data, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		return strings.NewReader(decode_charset(data, charset)), nil
+	},
+}
+
+func init() {
+	Register(Format{
+		Name:       "eml",
+		Extensions: []string{".eml"},
+		MediaType:  "message/rfc822",
+		Content:    CONTENT_TEXT,
+		Validate:   validate_eml,
+		Extract:    extract_eml,
+	})
+}
+
+// validate_eml requires an RFC 5322 message with at least a sender, date or subject.
+func validate_eml(data []byte) error {
+	message, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("not an email message: %w", err)
+	}
+
+	if message.Header.Get("From") == "" && message.Header.Get("Date") == "" && message.Header.Get("Subject") == "" {
+		return errors.New("message has neither From, Date nor Subject header")
+	}
+
+	return nil
+}
+
+// extract_eml returns the main headers and the text of an email.
+//
+// Of multipart/alternative bodies the plain text version is preferred, HTML is
+// converted as a fallback. Attachments are listed by name but not extracted.
+func extract_eml(data []byte) (string, error) {
+	message, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("not an email message: %w", err)
+	}
+
+	var builder strings.Builder
+
+	for _, name := range emailHeaders {
+		value := message.Header.Get(name)
+		if value == "" {
+			continue
+		}
+
+		if decoded, err := wordDecoder.DecodeHeader(value); err == nil {
+			value = decoded
+		}
+
+		fmt.Fprintf(&builder, "%s: %s\n", name, value)
+	}
+
+	builder.WriteByte('\n')
+
+	body, err := email_part(textproto.MIMEHeader(message.Header), message.Body, 0)
+	if err != nil {
+		return "", err
+	}
+
+	builder.WriteString(body)
+
+	return Normalize(builder.String()), nil
+}
+
+// email_part returns the text of a message part, following multipart bodies up to maxMultipartDepth.
+func email_part(header textproto.MIMEHeader, body io.Reader, depth int) (string, error) {
+	media_type, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		media_type, params = "text/plain", map[string]string{}
+	}
+
+	if filename := attachment_name(header); filename != "" {
+		return fmt.Sprintf("\n[Attachment: %s]\n", filename), nil
+	}
+
+	if strings.HasPrefix(media_type, "multipart/") {
+		if depth >= maxMultipartDepth {
+			return "", nil
+		}
+		return email_multipart(media_type, params["boundary"], body, depth)
+	}
+
+	if media_type != "text/plain" && media_type != "text/html" {
+		return "", nil
+	}
+
+	data, err := io.ReadAll(transfer_decoder(header.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode %s part: %w", media_type, err)
+	}
+
+	var text string = decode_charset(data, params["charset"])
+
+	if media_type == "text/html" {
+		text = html_text(text)
+	}
+
+	return text, nil
+}
+
+// email_multipart returns the text of a multipart body.
+//
+// Parts of multipart/alternative are versions of the same content, the first
+// plain text version is used, else the first version with text. Parts of all
+// other multipart types are concatenated.
+func email_multipart(media_type string, boundary string, body io.Reader, depth int) (string, error) {
+	if boundary == "" {
+		return "", errors.New("multipart body without boundary")
+	}
+
+	reader := multipart.NewReader(body, boundary)
+
+	var texts []string
+	var alternative string
+
+	for {
+		part, err := reader.NextRawPart()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return "", fmt.Errorf("invalid multipart body: %w", err)
+		}
+
+		text, err := email_part(part.Header, part, depth+1)
+		if err != nil {
+			return "", err
+		}
+
+		if media_type != "multipart/alternative" {
+			texts = append(texts, text)
+			continue
+		}
+
+		part_type, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if part_type == "text/plain" && strings.TrimSpace(text) != "" {
+			return text, nil
+		}
+
+		if alternative == "" {
+			alternative = text
+		}
+	}
+
+	if media_type == "multipart/alternative" {
+		return alternative, nil
+	}
+
+	return strings.Join(texts, "\n"), nil
+}
+
+// attachment_name returns the file name of a part sent as attachment, "" for inline parts.
+func attachment_name(header textproto.MIMEHeader) string {
+	disposition, params, err := mime.ParseMediaType(header.Get("Content-Disposition"))
+	if err != nil || disposition != "attachment" {
+		return ""
+	}
+
+	if params["filename"] != "" {
+		return params["filename"]
+	}
+
+	return "unnamed"
+}
+
+// transfer_decoder undoes the Content-Transfer-Encoding of a part.
+func transfer_decoder(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	default:
+		return body
+	}
+}
+
+// decode_charset converts text in the given charset to a string.
+//
+// Only UTF-8 and the Western European single byte charsets are supported,
+// unknown charsets are treated like UTF-8 with the fallback of decode.
+func decode_charset(data []byte, charset string) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "iso-8859-15", "latin1", "windows-1252", "cp1252":
+		return decode_windows1252(data)
+	default:
+		return decode(data)
+	}
+}
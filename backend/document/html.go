@@ -0,0 +1,125 @@
+package document
+
+import (
+	"html"
+	"strings"
+)
+
+// Elements whose content is not text shown to the reader.
+var skippedElements map[string]bool = map[string]bool{
+	"head": true, "script": true, "style": true, "noscript": true, "template": true, "svg": true,
+}
+
+// Elements that start a new line.
+var blockElements map[string]bool = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "br": true,
+	"dd": true, "div": true, "dl": true, "dt": true, "figcaption": true, "footer": true,
+	"form": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hr": true, "li": true, "main": true, "nav": true, "ol": true, "p": true,
+	"pre": true, "section": true, "table": true, "tr": true, "ul": true,
+}
+
+func init() {
+	Register(Format{
+		Name:       "html",
+		Extensions: []string{".html", ".htm"},
+		MediaType:  "text/html",
+		Content:    CONTENT_TEXT,
+		Validate:   validate_text,
+		Extract: func(data []byte) (string, error) {
+			return Normalize(html_text(decode(data))), nil
+		},
+	})
+}
+
+// html_text returns the visible text of an HTML document.
+//
+// This is a lenient scanner rather than a parser: tags are dropped, the content
+// of skippedElements is removed, block elements and table cells become line
+// breaks and tabs, entities are decoded and whitespace is collapsed as a browser would.
+func html_text(source string) string {
+	var builder strings.Builder
+
+	for len(source) > 0 {
+		start := strings.IndexByte(source, '<')
+		if start < 0 {
+			write_html_text(&builder, source)
+			break
+		}
+
+		write_html_text(&builder, source[:start])
+		source = source[start:]
+
+		if strings.HasPrefix(source, "<!--") {
+			end := strings.Index(source, "-->")
+			if end < 0 {
+				break
+			}
+			source = source[end+len("-->"):]
+			continue
+		}
+
+		end := strings.IndexByte(source, '>')
+		if end < 0 {
+			break
+		}
+
+		var name string = tag_name(source[1:end])
+		var closing bool = strings.HasPrefix(source, "</")
+		source = source[end+1:]
+
+		switch {
+		case skippedElements[name] && !closing:
+			if close := strings.Index(strings.ToLower(source), "</"+name); close >= 0 {
+				source = source[close:]
+			} else {
+				source = ""
+			}
+		case name == "td" || name == "th":
+			if closing {
+				builder.WriteByte('\t')
+			}
+		case name == "li":
+			if !closing {
+				builder.WriteString("\n- ")
+			}
+		case blockElements[name]:
+			builder.WriteByte('\n')
+		}
+	}
+
+	lines := strings.Split(builder.String(), "\n")
+	for index, line := range lines {
+		lines[index] = strings.Trim(line, " ")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// tag_name returns the lower case element name of the inside of a tag, e.g. "p" for "/P class=x".
+func tag_name(tag string) string {
+	tag = strings.TrimPrefix(tag, "/")
+	if end := strings.IndexAny(tag, " \t\r\n/"); end >= 0 {
+		tag = tag[:end]
+	}
+	return strings.ToLower(tag)
+}
+
+// write_html_text decodes entities and collapses whitespace of a text run.
+func write_html_text(builder *strings.Builder, text string) {
+	if text == "" {
+		return
+	}
+
+	var leading bool = strings.TrimLeft(text, " \t\r\n") != text
+	var trailing bool = strings.TrimRight(text, " \t\r\n") != text
+	var words []string = strings.Fields(html.UnescapeString(text))
+
+	if leading {
+		builder.WriteByte(' ')
+	}
+	builder.WriteString(strings.Join(words, " "))
+	if trailing && len(words) > 0 {
+		builder.WriteByte(' ')
+	}
+}
@@ -0,0 +1,72 @@
+package document
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+)
+
+func init() {
+	Register(Format{
+		Name:       "pdf",
+		Extensions: []string{".pdf"},
+		MediaType:  "application/pdf",
+		Content:    CONTENT_PDF,
+		Validate:   validate_pdf,
+		Pages:      pdf_pages,
+	})
+}
+
+// Page objects, "/Type /Pages" (the page tree nodes) is excluded by the character after "Page".
+var pdfPageObject = regexp.MustCompile(`/Type\s*/Page[^a-zA-Z0-9]`)
+
+// Bytes of the previous block searched again, so matches spanning two blocks are found.
+// Longer than any match short of absurd whitespace.
+const pdfPageOverlap int = 64
+
+// validate_pdf requires a %PDF-1.x or %PDF-2.x signature. Text is extracted by the pipeline.
+func validate_pdf(data []byte) error {
+	if !(bytes.HasPrefix(data, []byte("%PDF-1.")) || bytes.HasPrefix(data, []byte("%PDF-2."))) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// pdf_pages counts the page objects of a PDF without parsing it.
+//
+// The count is a best effort: page objects inside compressed object streams are
+// not visible (0 is returned if none are found), and objects replaced by
+// incremental updates are counted twice.
+func pdf_pages(file io.ReaderAt, size int64) (int64, error) {
+	var pages int64 = 0
+	var block []byte = make([]byte, 0, pdfPageOverlap+64*1024)
+	var offset int64 = 0
+
+	for offset < size {
+		// Keep the tail of the previous block in front of the new data
+		var kept int = min(len(block), pdfPageOverlap)
+		block = append(block[:0], block[len(block)-kept:]...)
+
+		read, err := file.ReadAt(block[kept:cap(block)], offset)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+
+		if read == 0 {
+			break
+		}
+
+		block = block[:kept+read]
+		offset += int64(read)
+
+		// Matches ending within the kept tail were counted with the previous block
+		for _, match := range pdfPageObject.FindAllIndex(block, -1) {
+			if match[1] > kept {
+				pages++
+			}
+		}
+	}
+
+	return pages, nil
+}
@@ -0,0 +1,114 @@
+package document
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var byteOrderMark []byte = []byte{0xEF, 0xBB, 0xBF}
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+func init() {
+	Register(Format{
+		Name:       "text",
+		Extensions: []string{".txt"},
+		MediaType:  "text/plain",
+		Content:    CONTENT_TEXT,
+		Validate:   validate_text,
+		Extract:    extract_text,
+	})
+
+	Register(Format{
+		Name:       "markdown",
+		Extensions: []string{".md", ".markdown"},
+		MediaType:  "text/markdown",
+		Content:    CONTENT_TEXT,
+		Validate:   validate_text,
+		Extract:    extract_text,
+	})
+}
+
+// extract_text returns plain text and Markdown as they are, normalized. Markdown syntax is kept.
+func extract_text(data []byte) (string, error) {
+	return Normalize(decode(data)), nil
+}
+
+// validate_text rejects text containing NUL bytes, which no text editor produces.
+func validate_text(data []byte) error {
+	if bytes.IndexByte(data, 0) >= 0 {
+		return errors.New("file contains binary data")
+	}
+	return nil
+}
+
+// decode returns data as string, interpreting it as Windows-1252 if it is not valid UTF-8.
+//
+// Older Windows programs still save text in this encoding; it is a superset of
+// ISO-8859-1 for all printable characters, so both are covered.
+func decode(data []byte) string {
+	data = bytes.TrimPrefix(data, byteOrderMark)
+
+	if utf8.Valid(data) {
+		return string(data)
+	}
+
+	return decode_windows1252(data)
+}
+
+// decode_windows1252 converts Windows-1252 encoded text to a string.
+func decode_windows1252(data []byte) string {
+	var builder strings.Builder
+	builder.Grow(len(data) + len(data)/4)
+
+	for _, b := range data {
+		if b >= 0x80 && b < 0xA0 {
+			builder.WriteRune(windows1252[b-0x80])
+		} else {
+			builder.WriteRune(rune(b))
+		}
+	}
+
+	return builder.String()
+}
+
+// Characters 0x80-0x9F of Windows-1252, undefined positions map to U+FFFD.
+var windows1252 [32]rune = [32]rune{
+	'€', '\uFFFD', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '\uFFFD', 'Ž', '\uFFFD',
+	'\uFFFD', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '\uFFFD', 'ž', 'Ÿ',
+}
+
+// Normalize cleans extracted text before it is sent to the pipeline.
+//
+//   - Line endings become "\n", non-breaking spaces regular spaces
+//   - Control characters other than tab and newline are removed
+//   - Trailing whitespace is removed from every line
+//   - Runs of blank lines are collapsed to a single blank line
+func Normalize(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	text = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\u00a0':
+			return ' '
+		case r == '\n' || r == '\t':
+			return r
+		case unicode.IsControl(r) || r == '\ufeff':
+			return -1
+		default:
+			return r
+		}
+	}, text)
+
+	lines := strings.Split(text, "\n")
+	for index, line := range lines {
+		lines[index] = strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
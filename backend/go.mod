@@ -2,11 +2,16 @@ module backend
 
 go 1.24.3
 
+require (
+	github.com/mattn/go-sqlite3 v1.14.28
+	golang.org/x/crypto v0.45.0
+)
+
 require (
 	github.com/fxamacker/cbor/v2 v2.7.0 // indirect
 	github.com/gofrs/uuid v4.4.0+incompatible // indirect
 	github.com/gorilla/websocket v1.5.3 // indirect
-	github.com/mattn/go-sqlite3 v1.14.28 // indirect
 	github.com/surrealdb/surrealdb.go v0.3.2 // indirect
 	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/sys v0.38.0 // indirect
 )
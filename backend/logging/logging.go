@@ -0,0 +1,226 @@
+// Package logging sets up structured logging with log/slog.
+//
+// Every record passes a redaction layer before it is written: attributes whose
+// key names a secret or a payload (passwords, tokens, request bodies, prompts,
+// messages) are replaced by REDACTED, and bearer tokens or JWTs found inside
+// any other string are masked. An http.Header is logged as a group of its
+// headers, each checked by name like an attribute. Log lines carry the ID of
+// the request they belong to, which is also sent to the ML pipeline so both
+// logs can be joined.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Levels accepted by Setup.
+const (
+	LEVEL_DEBUG string = "debug"
+	LEVEL_INFO  string = "info"
+	LEVEL_WARN  string = "warn"
+	LEVEL_ERROR string = "error"
+)
+
+// Formats accepted by Setup.
+const (
+	FORMAT_TEXT string = "text" // key=value pairs, for reading in a terminal
+	FORMAT_JSON string = "json" // One JSON object per line, for log collectors
+)
+
+// Header carrying the request ID, accepted from clients and sent to the ML pipeline.
+const REQUEST_ID_HEADER string = "X-Request-ID"
+
+// Replacement of redacted values.
+const REDACTED string = "REDACTED"
+
+var levels map[string]slog.Level = map[string]slog.Level{
+	LEVEL_DEBUG: slog.LevelDebug,
+	LEVEL_INFO:  slog.LevelInfo,
+	LEVEL_WARN:  slog.LevelWarn,
+	LEVEL_ERROR: slog.LevelError,
+}
+
+// Attribute keys whose values are never logged, compared case-insensitively
+// after removing '_' and '-'. A key matches if it contains one of them.
+var sensitiveKeys []string = []string{
+	"password",
+	"token",
+	"jwt",
+	"secret",
+	"authorization",
+	"cookie",
+	"apikey",
+	"signingkey",
+	"body",
+	"prompt",
+	"message",
+	"content",
+}
+
+// Credentials that may end up inside otherwise harmless strings, e.g. error messages.
+var sensitivePatterns []*regexp.Regexp = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._~+/=-]+`),
+	regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+}
+
+// Client supplied request IDs are only kept if they are this harmless.
+var requestIDPattern *regexp.Regexp = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type requestIDKey struct{}
+
+// ValidLevel reports whether level is one of the LEVEL_* constants.
+func ValidLevel(level string) bool {
+	_, ok := levels[level]
+	return ok
+}
+
+// ValidFormat reports whether format is one of the FORMAT_* constants.
+func ValidFormat(format string) bool {
+	return format == FORMAT_TEXT || format == FORMAT_JSON
+}
+
+// Setup installs the default logger writing to stderr.
+//
+// Output of the standard log package is routed through the same logger at
+// info level (see slog.SetDefault), so nothing bypasses the redaction layer.
+//
+// Parameters:
+//   - level: One of the LEVEL_* constants, records below it are dropped
+//   - format: One of the FORMAT_* constants
+func Setup(level string, format string) error {
+	logger, err := New(os.Stderr, level, format)
+	if err != nil {
+		return err
+	}
+
+	slog.SetDefault(logger)
+	return nil
+}
+
+// New creates a redacting logger writing to w, see Setup.
+func New(w io.Writer, level string, format string) (*slog.Logger, error) {
+	minimum, ok := levels[level]
+	if !ok {
+		return nil, fmt.Errorf("unknown log level %q", level)
+	}
+
+	options := &slog.HandlerOptions{Level: minimum, ReplaceAttr: redact}
+
+	switch format {
+	case FORMAT_TEXT:
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case FORMAT_JSON:
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+// redact is the redaction layer, called by the handler for every attribute.
+func redact(groups []string, attribute slog.Attr) slog.Attr {
+	if len(groups) == 0 && (attribute.Key == slog.TimeKey || attribute.Key == slog.LevelKey) {
+		return attribute
+	}
+
+	if SensitiveKey(attribute.Key) {
+		return slog.String(attribute.Key, REDACTED)
+	}
+
+	switch attribute.Value.Kind() {
+	case slog.KindString:
+		return slog.String(attribute.Key, Redact(attribute.Value.String()))
+	case slog.KindAny:
+		switch value := attribute.Value.Any().(type) {
+		case error:
+			return slog.String(attribute.Key, Redact(value.Error()))
+		case http.Header:
+			return slog.Attr{Key: attribute.Key, Value: header_value(value)}
+		}
+		return slog.String(attribute.Key, Redact(attribute.Value.String()))
+	default:
+		return attribute
+	}
+}
+
+// header_value turns headers into a group with one attribute per header, sorted by name.
+// The handler passes every member through redact, so sensitive headers are masked by name.
+func header_value(header http.Header) slog.Value {
+	var attributes []slog.Attr
+
+	for _, name := range slices.Sorted(maps.Keys(header)) {
+		attributes = append(attributes, slog.String(name, strings.Join(header[name], ", ")))
+	}
+
+	return slog.GroupValue(attributes...)
+}
+
+// SensitiveKey reports whether values of an attribute or header of this name must not be logged.
+func SensitiveKey(key string) bool {
+	var normalized string = strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(normalized, sensitive) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Redact masks bearer tokens and JWTs within text.
+func Redact(text string) string {
+	for _, pattern := range sensitivePatterns {
+		text = pattern.ReplaceAllString(text, REDACTED)
+	}
+	return text
+}
+
+// NewRequestID returns the request ID a request is handled under.
+//
+// An ID supplied by the client (e.g. the frontend) is kept if it consists of at
+// most 64 letters, digits, '.', '_' and '-'; otherwise a random ID is generated.
+func NewRequestID(supplied string) string {
+	if requestIDPattern.MatchString(supplied) {
+		return supplied
+	}
+
+	buffer := make([]byte, 8)
+	rand.Read(buffer)
+	return hex.EncodeToString(buffer)
+}
+
+// WithRequestID returns a context carrying a request ID.
+func WithRequestID(ctx context.Context, request_id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, request_id)
+}
+
+// RequestID returns the request ID of a context, empty if there is none.
+func RequestID(ctx context.Context) string {
+	request_id, _ := ctx.Value(requestIDKey{}).(string)
+	return request_id
+}
+
+// FromContext returns the default logger, annotated with the request ID of ctx if there is one.
+func FromContext(ctx context.Context) *slog.Logger {
+	if request_id := RequestID(ctx); request_id != "" {
+		return slog.Default().With("request_id", request_id)
+	}
+	return slog.Default()
+}
+
+// Fatal logs an error and terminates the process with exit code 1.
+func Fatal(message string, args ...any) {
+	slog.Error(message, args...)
+	os.Exit(1)
+}
@@ -3,449 +3,136 @@ package main
 import (
 	"backend/api"
 	"backend/auth"
+	"backend/config"
 	"backend/db"
-	"crypto/aes"
-	"fmt"
+	"backend/logging"
+	"backend/router"
+	"crypto/rand"
+	"flag"
+	"log/slog"
 	"net/http"
+	"os"
+	"time"
 )
 
-const SECRET_KEY string = "32-byte-key-for-AES-256222222222"
+// Location of the configuration file if neither -config nor CHATBOT_CONFIG is given.
+// A missing file at this location is not an error.
+const DEFAULT_CONFIG_PATH string = "./data/config.json"
 
 func main() {
-	aes, err := aes.NewCipher([]byte(SECRET_KEY))
+	config_path, required := configPath()
 
+	configuration, err := config.Load(config_path, required)
 	if err != nil {
-		println("Encryption could not be set up:", err.Error())
-		return
+		logging.Fatal("Invalid configuration", "error", err)
 	}
 
-	db.InitModelSelection()
-
-	prompt, err := api.Load_default_prompt("./data/default_prompt.txt")
-
-	if err != nil {
-		fmt.Println("Got error initializing prompt", err.Error())
-		api.Write_default_prompt("./data/default_prompt.txt", api.BACK_UP_PROMPT)
-	} else {
-		fmt.Println("Setting:", prompt, "as default prompt")
-		api.SetDefaultPrompt(prompt)
+	if err := logging.Setup(configuration.LogLevel, configuration.LogFormat); err != nil {
+		logging.Fatal("Logging could not be set up", "error", err)
 	}
 
-	db, err := db.SetupSqlite("./data/data", db.CreateAdmin("Admin", "Admin", "julius@korbjuhn.net"))
-	if err != nil {
-		println("DB Setup failed", err.Error())
-		return
+	if flag.Arg(0) == "migrate" {
+		os.Exit(migrateCommand(configuration, flag.Args()[1:]))
 	}
 
-	http.HandleFunc("/api/login", func(w http.ResponseWriter, r *http.Request) {
-		auth.Login(db, aes, w, r)
-	})
-
-	http.HandleFunc("/api/update/legal_libary", func(w http.ResponseWriter, r *http.Request) {
-		var auth_header string = r.Header.Get("Authorization")
-
-		if auth_header == "" {
-			http.Error(w, "Authorization header missing", http.StatusBadRequest)
-			return
-		}
-
-		_, err := auth.Authorization(auth_header)
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		api.Legal_libary(w, r)
-	})
-
-	http.HandleFunc("/api/update/local_only", func(w http.ResponseWriter, r *http.Request) {
-		var auth_header string = r.Header.Get("Authorization")
-
-		if auth_header == "" {
-			http.Error(w, "Authorization header missing", http.StatusBadRequest)
-			return
-		}
-
-		_, err := auth.Authorization(auth_header)
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		api.Local_only(w, r)
-	})
-
-	http.HandleFunc("/api/upload/file", func(w http.ResponseWriter, r *http.Request) {
-		var auth_header string = r.Header.Get("Authorization")
-
-		if auth_header == "" {
-			http.Error(w, "Authorization header missing", http.StatusBadRequest)
-			return
-		}
-
-		auth_result, err := auth.Authorization(auth_header)
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		api.FileUpload(db, auth_result, w, r)
-	})
-
-	http.HandleFunc("/api/upload/message", func(w http.ResponseWriter, r *http.Request) {
-		var auth_header string = r.Header.Get("Authorization")
-
-		if auth_header == "" {
-			http.Error(w, "Authorization header missing", http.StatusBadRequest)
-			return
-		}
-
-		auth, err := auth.Authorization(auth_header)
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		api.MessageUpload(auth, w, r)
-	})
-
-	http.HandleFunc("/api/message/inference", func(w http.ResponseWriter, r *http.Request) {
-		var auth_header string = r.Header.Get("Authorization")
-
-		println("Received Request")
-
-		if auth_header == "" {
-			http.Error(w, "Authorization header missing", http.StatusBadRequest)
-			return
-		}
-
-		var deep_think_header string = r.Header.Get("Deep_think")
-
-		if deep_think_header == "" {
-			http.Error(w, "Deep think header is missing", http.StatusBadRequest)
-			return
-		}
-
-		auth, err := auth.Authorization(auth_header)
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		api.Inference(auth, db, w, r)
-	})
-
-	http.HandleFunc("/api/get/history", func(w http.ResponseWriter, r *http.Request) {
-		var auth_header string = r.Header.Get("Authorization")
-
-		if auth_header == "" {
-			http.Error(w, "Authorization header missing", http.StatusBadRequest)
-			return
-		}
-
-		auth, err := auth.Authorization(auth_header)
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		api.GetHistory(auth, w, r)
-	})
-
-	http.HandleFunc("/api/get/users", func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get("Authorization")
-
-		if header == "" {
-			http.Error(w, "Authorization header missing", http.StatusBadRequest)
-			return
-		}
-
-		_, err := auth.AdminAuthorization(header)
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		api.GetUser(db, w, r)
-	})
-
-	http.HandleFunc("/api/get/signup_request", func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get("Authorization")
-		if header == "" {
-			http.Error(w, "Authorization header missing", http.StatusBadRequest)
-			return
-		}
-
-		_, err := auth.AdminAuthorization(header)
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		api.GetSignupRequests(db, w, r)
-	})
-
-	http.HandleFunc("/api/get/documents", func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get("Authorization")
-
-		if header == "" {
-			http.Error(w, "Authorization header missing", http.StatusBadRequest)
-			return
-		}
-
-		auth_result, err := auth.Authorization(header)
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		api.GetDocuments(auth_result, db, w, r)
-
-	})
-
-	http.HandleFunc("/api/get/models", func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get("Authorization")
-
-		if header == "" {
-			http.Error(w, "Authorization header missing", http.StatusBadRequest)
-			return
-		}
-
-		_, err := auth.AdminAuthorization(header)
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		api.GetModels(w, r)
-	})
-
-	http.HandleFunc("/api/get/current_model", func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get("Authorization")
-
-		if header == "" {
-			http.Error(w, "Authorization header missing", http.StatusBadRequest)
-			return
-		}
-
-		_, err := auth.AdminAuthorization(header)
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		api.GetCurrentModel(w)
-	})
-
-	http.HandleFunc("/api/get/prompt", func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get("Authorization")
-
-		if header == "" {
-			http.Error(w, "Authorization header is missing", http.StatusBadRequest)
-			return
-		}
-
-		auth_result, err := auth.Authorization(header)
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		api.GetPrompt(auth_result, db, w, r)
-	})
-
-	http.HandleFunc("/api/get/default_prompt", func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get("Authorization")
-
-		if header == "" {
-			http.Error(w, "Authorization header is missing", http.StatusBadRequest)
-			return
-		}
-
-		_, err := auth.Authorization(header)
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		api.GetDefaultPrompt(w, r)
-	})
+	var signing_key []byte = []byte(configuration.SigningKey)
 
-	http.HandleFunc("/api/update/signup_request", func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get("Authorization")
-
-		if header == "" {
-			http.Error(w, "Authorization header missing", http.StatusBadRequest)
-			return
-		}
-
-		_, err := auth.AdminAuthorization(header)
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		api.AcceptSignupRequest(db, w, r)
-	})
-
-	http.HandleFunc("/api/update/promote_user", func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get("Authorization")
-
-		if header == "" {
-			http.Error(w, "Authorization header missing", http.StatusBadRequest)
-			return
-		}
-
-		_, err := auth.AdminAuthorization(header)
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		api.PromoteUser(db, w, r)
-	})
-
-	http.HandleFunc("/api/update/model_selection", func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get("Authorization")
-
-		if header == "" {
-			http.Error(w, "Authorization header is missing", http.StatusBadRequest)
-			return
-		}
-
-		_, err := auth.AdminAuthorization(header)
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		api.UpdateModelSelection(w, r)
-	})
-
-	http.HandleFunc("/api/update/prompt", func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get("Authorization")
-
-		if header == "" {
-			http.Error(w, "Authorization header is missing", http.StatusBadRequest)
-			return
-		}
-
-		auth_result, err := auth.Authorization(header)
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		api.UpdatePrompt(auth_result, db, w, r)
-	})
-
-	http.HandleFunc("/api/update/default_prompt", func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get("Authorization")
-
-		if header == "" {
-			http.Error(w, "Authorization header is missing", http.StatusBadRequest)
-			return
-		}
-
-		_, err := auth.AdminAuthorization(header)
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
+	if len(signing_key) == 0 {
+		slog.Warn("No signing_key configured, using an ephemeral key. Tokens will not survive a restart.")
+		signing_key = make([]byte, auth.MIN_KEY_LENGTH)
+		rand.Read(signing_key)
+	}
 
-		api.UpdateDefaultPromt(db, w, r)
-	})
+	err = auth.AddSigningKey(configuration.SigningKeyID, signing_key)
 
-	http.HandleFunc("/api/delete/signup_request", func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get("Authorization")
-		if header == "" {
-			http.Error(w, "Authorization header missing", http.StatusBadRequest)
-			return
-		}
+	if err != nil {
+		logging.Fatal("Token signing could not be set up", "error", err)
+	}
 
-		_, err := auth.AdminAuthorization(header)
+	if configuration.MetricsToken == "" {
+		slog.Warn("No metrics_token configured, /metrics is disabled.")
+	}
 
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
+	if configuration.AdminPassword == config.Default().AdminPassword {
+		slog.Warn("The default admin password is in use, set admin_password.")
+	}
 
-		api.DeleteSignupRequest(db, w, r)
-	})
+	api.ConfigurePipeline(
+		configuration.MLPipelineURL,
+		configuration.OllamaURL,
+		time.Duration(configuration.PipelineTimeout)*time.Second,
+	)
 
-	http.HandleFunc("/api/delete/user", func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get("Authorization")
-		if header == "" {
-			http.Error(w, "Authorization header missing", http.StatusBadRequest)
-			return
-		}
+	db.InitModelSelection(configuration.DefaultModel)
 
-		_, err := auth.AdminAuthorization(header)
+	prompt, err := api.Load_default_prompt(configuration.DefaultPromptPath)
 
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
+	if err != nil {
+		slog.Warn("Default prompt could not be loaded, restoring the backup prompt", "path", configuration.DefaultPromptPath, "error", err)
+		api.Write_default_prompt(configuration.DefaultPromptPath, api.BACK_UP_PROMPT)
+	} else {
+		slog.Info("Loaded default prompt", "path", configuration.DefaultPromptPath, "length", len(prompt))
+		api.SetDefaultPrompt(configuration.DefaultPromptPath, prompt)
+	}
 
-		api.DeleteUser(db, w, r)
-	})
+	admin_password, err := auth.HashPassword(configuration.AdminPassword)
+	if err != nil {
+		logging.Fatal("Hashing admin password failed", "error", err)
+	}
 
-	http.HandleFunc("/api/delete/document", func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get("Authorization")
-		if header == "" {
-			http.Error(w, "Authorization header missing", http.StatusBadRequest)
-			return
-		}
+	db, err := db.SetupSqlite(
+		configuration.DatabasePath,
+		db.CreateAdmin(configuration.AdminName, admin_password, configuration.AdminEmail),
+	)
+	if err != nil {
+		logging.Fatal("DB setup failed", "error", err)
+	}
 
-		auth_result, err := auth.Authorization(header)
+	err = api.ConfigureProviders(db, time.Duration(configuration.PipelineTimeout)*time.Second, configuration.OllamaLocal)
+	if err != nil {
+		logging.Fatal("Loading model providers failed", "error", err)
+	}
 
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
+	api.ConfigureBlobs(configuration.BlobPath, configuration.ThumbnailCommand)
+	api.CollectBlobs(db)
 
-		api.DeleteDocument(auth_result, db, w, r)
+	err = api.StartIngestion(db, api.IngestSettings{
+		Workers:  int(configuration.IngestWorkers),
+		Attempts: configuration.IngestAttempts,
+		Backoff:  time.Duration(configuration.IngestBackoff) * time.Second,
 	})
+	if err != nil {
+		logging.Fatal("Starting document ingestion failed", "error", err)
+	}
 
-	http.HandleFunc("/api/delete/chat", func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get("Authorization")
-		if header == "" {
-			http.Error(w, "Authorization header missing", http.StatusBadRequest)
-			return
-		}
+	api.StartUploadExpiry(db, uploadSettings(configuration))
 
-		auth_result, err := auth.Authorization(header)
+	routes := router.NewRouter(db)
+	routes.Register(Routes(db, configuration)...)
 
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
+	slog.Info("Starting server", "address", configuration.ListenAddress)
+	err = http.ListenAndServe(configuration.ListenAddress, routes)
+	logging.Fatal("Server stopped", "error", err)
+}
 
-		api.DeleteChat(auth_result, w, r)
-	})
+// configPath determines the configuration file to load.
+//
+// Returns:
+//   - string: Path given by -config, else CHATBOT_CONFIG, else DEFAULT_CONFIG_PATH
+//   - bool: Whether the file must exist (true if it was given explicitly)
+func configPath() (string, bool) {
+	var path string
+	flag.StringVar(&path, "config", "", "Path of the JSON configuration file (default "+DEFAULT_CONFIG_PATH+")")
+	flag.Usage = usage
+	flag.Parse()
+
+	if path != "" {
+		return path, true
+	}
 
-	http.HandleFunc("/api/post/signup", func(w http.ResponseWriter, r *http.Request) {
-		api.HandleSignUpRequest(db, w, r)
-	})
+	if path, ok := os.LookupEnv(config.ENV_PREFIX + "CONFIG"); ok && path != "" {
+		return path, true
+	}
 
-	println("Starting Server...")
-	http.ListenAndServe("0.0.0.0:8080", nil)
+	return DEFAULT_CONFIG_PATH, false
 }
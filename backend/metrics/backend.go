@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Content type of the text exposition format.
+const CONTENT_TYPE string = "text/plain; version=0.0.4; charset=utf-8"
+
+// Upper bounds in seconds for ML pipeline calls; inference and document processing take minutes.
+var PIPELINE_BUCKETS []float64 = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1200}
+
+// Upper bounds in seconds for SQLite statements.
+var DATABASE_BUCKETS []float64 = []float64{0.0001, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.5, 1}
+
+// Metrics of the backend.
+//
+// Routes are labelled with the path they were registered under, requests no
+// route matched with "unmatched". ML pipeline endpoints are labelled with their
+// path, failed calls (no response) with status "error". SQL statements are
+// labelled with their kind: select (including WITH queries), insert, update,
+// delete or other.
+var (
+	HTTPRequests = NewCounter("chatbot_http_requests_total",
+		"HTTP requests handled, by route, method and status code.",
+		"route", "method", "status")
+	HTTPDuration = NewHistogram("chatbot_http_request_duration_seconds",
+		"Time to handle HTTP requests, by route and method.",
+		DEFAULT_BUCKETS, "route", "method")
+
+	PipelineRequests = NewCounter("chatbot_ml_pipeline_requests_total",
+		"Calls to the ML pipeline, by endpoint and status code.",
+		"endpoint", "status")
+	PipelineDuration = NewHistogram("chatbot_ml_pipeline_request_duration_seconds",
+		"Time until the ML pipeline answered, by endpoint. Streamed calls are measured to the response headers.",
+		PIPELINE_BUCKETS, "endpoint")
+
+	InferenceInFlight = NewGauge("chatbot_inference_in_flight",
+		"Inference requests currently waiting for or streaming an answer.")
+
+	UploadBytes = NewCounter("chatbot_upload_bytes_total",
+		"Bytes of documents received, by kind of upload (document, library or resumable).",
+		"kind")
+
+	Logins = NewCounter("chatbot_logins_total",
+		"Login attempts, by outcome (success, failure or limited).",
+		"outcome")
+
+	DatabaseDuration = NewHistogram("chatbot_db_query_duration_seconds",
+		"Time to execute SQLite statements, including reading all rows of queries, by kind of statement.",
+		DATABASE_BUCKETS, "statement")
+)
+
+// Handle serves all metrics in the Prometheus text format.
+//
+// Scrapers must authenticate with "Authorization: Bearer <token>". An empty token
+// refuses every request, the metrics are never served without authentication
+// (without a token the route is not registered at all, see Routes).
+//
+// Responses:
+//   - 200 OK: The metrics
+//   - 401 Unauthorized: Token missing or wrong
+func Handle(token string, w http.ResponseWriter, r *http.Request) {
+	presented, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	if token == "" || !found || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+		http.Error(w, "metrics token required", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", CONTENT_TYPE)
+	w.WriteHeader(http.StatusOK)
+	Write(w)
+}
+
+// StatementKind returns the label of a SQL statement for DatabaseDuration.
+func StatementKind(query string) string {
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return "other"
+	}
+
+	switch keyword := strings.ToLower(words[0]); keyword {
+	case "select", "with":
+		return "select"
+	case "insert", "update", "delete":
+		return keyword
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,286 @@
+// Package metrics collects counters, gauges and histograms and exposes them in
+// the Prometheus text exposition format (version 0.0.4).
+//
+// Metrics are registered once at package initialization (see backend.go) and
+// updated from anywhere in the backend. Every metric has a fixed list of label
+// names; values passed when updating must match it in number and order. Label
+// values must come from a bounded set (route patterns, status codes, endpoint
+// paths), never from user input, or the number of series grows without limit.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric types as written in the TYPE line.
+const (
+	COUNTER   string = "counter"
+	GAUGE     string = "gauge"
+	HISTOGRAM string = "histogram"
+)
+
+// Upper bounds in seconds of the histogram buckets for request latencies.
+var DEFAULT_BUCKETS []float64 = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// family is a metric with all its label combinations (series).
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64 // Histograms only
+
+	mutex  sync.Mutex
+	series map[string]*series
+}
+
+// series holds the state of one label combination.
+type series struct {
+	values []string
+	value  float64  // Counter and gauge value, sum of observations for histograms
+	counts []uint64 // Histograms only: observations per bucket, not cumulative
+	count  uint64   // Histograms only: number of observations
+}
+
+// Families in registration order, written by Write.
+var (
+	registryMutex sync.Mutex
+	registry      []*family
+)
+
+// Counter is a value that only increases, e.g. requests handled.
+type Counter struct{ family *family }
+
+// Gauge is a value that goes up and down, e.g. requests in flight.
+type Gauge struct{ family *family }
+
+// Histogram counts observations, e.g. durations, in buckets of upper bounds.
+type Histogram struct{ family *family }
+
+// NewCounter registers a counter.
+//
+// Panics if the name is already registered, so mistakes surface at startup.
+//
+// Parameters:
+//   - name: Metric name, counters end in "_total" by convention
+//   - help: One line description, written as HELP line
+//   - labels: Label names, values are passed in this order when updating
+func NewCounter(name string, help string, labels ...string) *Counter {
+	return &Counter{register(name, help, COUNTER, labels, nil)}
+}
+
+// NewGauge registers a gauge, see NewCounter.
+func NewGauge(name string, help string, labels ...string) *Gauge {
+	return &Gauge{register(name, help, GAUGE, labels, nil)}
+}
+
+// NewHistogram registers a histogram, see NewCounter.
+//
+// Parameters:
+//   - buckets: Ascending upper bounds, the +Inf bucket is added implicitly
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	if !slices.IsSorted(buckets) {
+		panic(fmt.Sprintf("metrics: buckets of %s are not ascending", name))
+	}
+
+	return &Histogram{register(name, help, HISTOGRAM, labels, buckets)}
+}
+
+func register(name string, help string, kind string, labels []string, buckets []float64) *family {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	for _, registered := range registry {
+		if registered.name == name {
+			panic(fmt.Sprintf("metrics: %s registered twice", name))
+		}
+	}
+
+	metric := &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+
+	registry = append(registry, metric)
+	return metric
+}
+
+// Inc adds 1 to the counter.
+func (counter *Counter) Inc(values ...string) {
+	counter.Add(1, values...)
+}
+
+// Add adds a non-negative amount to the counter.
+func (counter *Counter) Add(amount float64, values ...string) {
+	if amount < 0 {
+		panic(fmt.Sprintf("metrics: counter %s decreased", counter.family.name))
+	}
+
+	counter.family.update(values, func(state *series) { state.value += amount })
+}
+
+// Inc adds 1 to the gauge.
+func (gauge *Gauge) Inc(values ...string) {
+	gauge.Add(1, values...)
+}
+
+// Dec subtracts 1 from the gauge.
+func (gauge *Gauge) Dec(values ...string) {
+	gauge.Add(-1, values...)
+}
+
+// Add adds amount, possibly negative, to the gauge.
+func (gauge *Gauge) Add(amount float64, values ...string) {
+	gauge.family.update(values, func(state *series) { state.value += amount })
+}
+
+// Set replaces the value of the gauge.
+func (gauge *Gauge) Set(value float64, values ...string) {
+	gauge.family.update(values, func(state *series) { state.value = value })
+}
+
+// Observe records one observation, e.g. a duration in seconds.
+func (histogram *Histogram) Observe(observation float64, values ...string) {
+	var buckets []float64 = histogram.family.buckets
+
+	histogram.family.update(values, func(state *series) {
+		if state.counts == nil {
+			state.counts = make([]uint64, len(buckets)+1)
+		}
+
+		index, _ := slices.BinarySearch(buckets, observation)
+		state.counts[index]++
+		state.count++
+		state.value += observation
+	})
+}
+
+// update applies change to the series of the given label values, creating it if needed.
+//
+// Panics if the number of values does not match the label names.
+func (metric *family) update(values []string, change func(*series)) {
+	if len(values) != len(metric.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", metric.name, len(metric.labels), len(values)))
+	}
+
+	var key string = strings.Join(values, "\xff")
+
+	metric.mutex.Lock()
+	defer metric.mutex.Unlock()
+
+	state, ok := metric.series[key]
+	if !ok {
+		state = &series{values: slices.Clone(values)}
+		metric.series[key] = state
+	}
+
+	change(state)
+}
+
+// Write writes every registered metric in the Prometheus text format.
+//
+// Families appear in registration order, their series sorted by label values.
+// Families without any series are written with their HELP and TYPE lines only.
+func Write(w io.Writer) error {
+	registryMutex.Lock()
+	var families []*family = slices.Clone(registry)
+	registryMutex.Unlock()
+
+	writer := bufio.NewWriter(w)
+
+	for _, metric := range families {
+		metric.write(writer)
+	}
+
+	return writer.Flush()
+}
+
+func (metric *family) write(writer *bufio.Writer) {
+	metric.mutex.Lock()
+	defer metric.mutex.Unlock()
+
+	fmt.Fprintf(writer, "# HELP %s %s\n", metric.name, escape(metric.help, false))
+	fmt.Fprintf(writer, "# TYPE %s %s\n", metric.name, metric.kind)
+
+	keys := make([]string, 0, len(metric.series))
+	for key := range metric.series {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		var state *series = metric.series[key]
+
+		if metric.kind != HISTOGRAM {
+			fmt.Fprintf(writer, "%s%s %s\n", metric.name, label_set(metric.labels, state.values, "", ""), number(state.value))
+			continue
+		}
+
+		var cumulative uint64 = 0
+
+		for index, bound := range metric.buckets {
+			cumulative += state.counts[index]
+			fmt.Fprintf(writer, "%s_bucket%s %d\n", metric.name, label_set(metric.labels, state.values, "le", number(bound)), cumulative)
+		}
+
+		fmt.Fprintf(writer, "%s_bucket%s %d\n", metric.name, label_set(metric.labels, state.values, "le", "+Inf"), state.count)
+		fmt.Fprintf(writer, "%s_sum%s %s\n", metric.name, label_set(metric.labels, state.values, "", ""), number(state.value))
+		fmt.Fprintf(writer, "%s_count%s %d\n", metric.name, label_set(metric.labels, state.values, "", ""), state.count)
+	}
+}
+
+// label_set formats labels as {name="value",...}, with an optional extra label (the bucket bound "le").
+func label_set(names []string, values []string, extra_name string, extra_value string) string {
+	if len(names) == 0 && extra_name == "" {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(names)+1)
+
+	for index, name := range names {
+		pairs = append(pairs, name+`="`+escape(values[index], true)+`"`)
+	}
+
+	if extra_name != "" {
+		pairs = append(pairs, extra_name+`="`+extra_value+`"`)
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escape escapes backslashes and line feeds, and double quotes in label values.
+func escape(text string, quotes bool) string {
+	text = strings.ReplaceAll(text, `\`, `\\`)
+	text = strings.ReplaceAll(text, "\n", `\n`)
+
+	if quotes {
+		text = strings.ReplaceAll(text, `"`, `\"`)
+	}
+
+	return text
+}
+
+// number formats a sample value, using the spelling of the format for infinities and NaN.
+func number(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
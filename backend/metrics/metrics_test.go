@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// useRegistry replaces the metrics of the backend by an empty registry for one test.
+func useRegistry(t *testing.T) {
+	t.Helper()
+
+	registryMutex.Lock()
+	var previous []*family = registry
+	registry = nil
+	registryMutex.Unlock()
+
+	t.Cleanup(func() {
+		registryMutex.Lock()
+		registry = previous
+		registryMutex.Unlock()
+	})
+}
+
+const golden string = `# HELP test_requests_total Requests, by path.\nLabel values are escaped: \\ and \n.
+# TYPE test_requests_total counter
+test_requests_total{path="/api/get/\"quoted\""} 1
+test_requests_total{path="/api/line\nbreak"} 1
+test_requests_total{path="/api/upload"} 3
+test_requests_total{path="C:\\uploads"} 2.5
+# HELP test_in_flight Requests in flight.
+# TYPE test_in_flight gauge
+test_in_flight -1
+# HELP test_limit Configured limit.
+# TYPE test_limit gauge
+test_limit +Inf
+# HELP test_duration_seconds Durations, by route and method.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{route="/api/inference",method="POST",le="0.25"} 2
+test_duration_seconds_bucket{route="/api/inference",method="POST",le="0.5"} 2
+test_duration_seconds_bucket{route="/api/inference",method="POST",le="1"} 3
+test_duration_seconds_bucket{route="/api/inference",method="POST",le="+Inf"} 4
+test_duration_seconds_sum{route="/api/inference",method="POST"} 5.125
+test_duration_seconds_count{route="/api/inference",method="POST"} 4
+test_duration_seconds_bucket{route="/api/login",method="POST",le="0.25"} 0
+test_duration_seconds_bucket{route="/api/login",method="POST",le="0.5"} 0
+test_duration_seconds_bucket{route="/api/login",method="POST",le="1"} 0
+test_duration_seconds_bucket{route="/api/login",method="POST",le="+Inf"} 1
+test_duration_seconds_sum{route="/api/login",method="POST"} 2
+test_duration_seconds_count{route="/api/login",method="POST"} 1
+# HELP test_unused_total Never updated.
+# TYPE test_unused_total counter
+`
+
+func TestWrite(t *testing.T) {
+	useRegistry(t)
+
+	requests := NewCounter("test_requests_total", "Requests, by path.\nLabel values are escaped: \\ and \n.", "path")
+	in_flight := NewGauge("test_in_flight", "Requests in flight.")
+	limit := NewGauge("test_limit", "Configured limit.")
+	duration := NewHistogram("test_duration_seconds", "Durations, by route and method.", []float64{0.25, 0.5, 1}, "route", "method")
+	NewCounter("test_unused_total", "Never updated.")
+
+	requests.Add(2, "/api/upload")
+	requests.Inc("/api/upload")
+	requests.Inc(`/api/get/"quoted"`)
+	requests.Inc("/api/line\nbreak")
+	requests.Add(2.5, `C:\uploads`)
+
+	in_flight.Inc()
+	in_flight.Dec()
+	in_flight.Dec()
+	limit.Set(math.Inf(1))
+
+	// An observation equal to a bound counts towards that bucket
+	for _, observation := range []float64{0.125, 0.25, 0.75, 4} {
+		duration.Observe(observation, "/api/inference", "POST")
+	}
+	duration.Observe(2, "/api/login", "POST")
+
+	var buffer bytes.Buffer
+	if err := Write(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	if buffer.String() != golden {
+		t.Errorf("got\n%s\nwant\n%s", buffer.String(), golden)
+	}
+}
+
+func TestRegistrationMistakesPanic(t *testing.T) {
+	useRegistry(t)
+
+	counter := NewCounter("test_total", "Test.", "route")
+
+	for name, mistake := range map[string]func(){
+		"registered twice":     func() { NewGauge("test_total", "Test.") },
+		"unsorted buckets":     func() { NewHistogram("test_seconds", "Test.", []float64{1, 0.5}) },
+		"missing label value":  func() { counter.Inc() },
+		"counter decreased":    func() { counter.Add(-1, "/api/login") },
+		"surplus label values": func() { counter.Inc("/api/login", "POST") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: no panic", name)
+				}
+			}()
+			mistake()
+		}()
+	}
+}
+
+func TestHandleRequiresToken(t *testing.T) {
+	useRegistry(t)
+	NewCounter("test_total", "Test.")
+
+	request := func(token string, authorization string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+
+		recorder := httptest.NewRecorder()
+		Handle(token, recorder, r)
+		return recorder
+	}
+
+	for _, test := range []struct{ token, authorization string }{
+		{"scrape", ""},
+		{"scrape", "Bearer wrong"},
+		{"scrape", "scrape"},
+		{"", ""},
+		{"", "Bearer "},
+	} {
+		if recorder := request(test.token, test.authorization); recorder.Code != http.StatusUnauthorized || recorder.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("token %q, Authorization %q: status %d, want 401", test.token, test.authorization, recorder.Code)
+		}
+	}
+
+	recorder := request("scrape", "Bearer scrape")
+
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != CONTENT_TYPE || recorder.Body.String() != "# HELP test_total Test.\n# TYPE test_total counter\n" {
+		t.Errorf("status %d, %s: %q", recorder.Code, recorder.Header().Get("Content-Type"), recorder.Body.String())
+	}
+}
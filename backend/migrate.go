@@ -0,0 +1,115 @@
+package main
+
+import (
+	"backend/config"
+	"backend/db"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+// usage prints the command line help.
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage:
+  %[1]s [-config path]                     Start the server (pending migrations are applied)
+  %[1]s [-config path] migrate status      Show applied and pending migrations
+  %[1]s [-config path] migrate up [N]      Apply pending migrations up to version N (default: latest)
+  %[1]s [-config path] migrate down [N]    Roll back to version N (default: one migration)
+
+Flags:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+// migrateCommand runs the "migrate" subcommand against the configured database.
+//
+// Parameters:
+//   - configuration: Loaded configuration, only database_path is used
+//   - args: Arguments following "migrate"
+//
+// Returns:
+//   - int: Process exit code
+func migrateCommand(configuration config.Config, args []string) int {
+	if len(args) == 0 || len(args) > 2 {
+		flag.Usage()
+		return 2
+	}
+
+	db_handle, err := db.Open(configuration.DatabasePath)
+	if err != nil {
+		slog.Error("Opening database failed", "error", err)
+		return 1
+	}
+	defer db_handle.Close()
+
+	states, err := db.MigrationStatus(db_handle)
+	if err != nil {
+		slog.Error("Reading migration status failed", "error", err)
+		return 1
+	}
+
+	var current int = 0
+	for _, state := range states {
+		if state.Applied {
+			current = state.Version
+		}
+	}
+
+	var target int
+
+	switch args[0] {
+	case "status":
+		print_migration_status(states)
+		return 0
+	case "up":
+		target = db.LatestMigration()
+	case "down":
+		target = max(current-1, 0)
+	default:
+		flag.Usage()
+		return 2
+	}
+
+	if len(args) == 2 {
+		target, err = strconv.Atoi(args[1])
+		if err != nil {
+			slog.Error("Invalid version", "version", args[1])
+			return 2
+		}
+	}
+
+	if args[0] == "up" && target < current || args[0] == "down" && target > current {
+		fmt.Println("Nothing to do: database is at version", current)
+		return 0
+	}
+
+	if err := db.MigrateTo(db_handle, target); err != nil {
+		slog.Error("Migration failed", "error", err)
+		return 1
+	}
+
+	states, err = db.MigrationStatus(db_handle)
+	if err != nil {
+		slog.Error("Reading migration status failed", "error", err)
+		return 1
+	}
+
+	print_migration_status(states)
+	return 0
+}
+
+// print_migration_status prints one line per migration.
+func print_migration_status(states []db.MigrationState) {
+	for _, state := range states {
+		var applied string = "pending"
+
+		if state.Applied {
+			applied = "applied " + time.Unix(state.AppliedAt, 0).UTC().Format(time.RFC3339)
+		}
+
+		fmt.Printf("%4d  %-30s %s\n", state.Version, state.Name, applied)
+	}
+}
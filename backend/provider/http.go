@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Upper bound of error bodies copied into error messages.
+const maxErrorBody int64 = 4096
+
+// httpBackend holds what both implementations need to talk to their API.
+type httpBackend struct {
+	endpoint Endpoint
+	client   *http.Client
+}
+
+func newHTTPBackend(endpoint Endpoint, client *http.Client) httpBackend {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	endpoint.BaseURL = strings.TrimRight(endpoint.BaseURL, "/")
+
+	return httpBackend{endpoint: endpoint, client: client}
+}
+
+func (backend httpBackend) Name() string {
+	return backend.endpoint.Name
+}
+
+func (backend httpBackend) Local() bool {
+	return backend.endpoint.Local
+}
+
+// do sends a request to path below the base URL.
+//
+// payload is encoded as JSON body unless it is nil. Responses with a status other
+// than 200 are turned into errors; on success the caller must close the body.
+func (backend httpBackend) do(ctx context.Context, method string, path string, payload any) (*http.Response, error) {
+	var body io.Reader = http.NoBody
+
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, backend.endpoint.BaseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if payload != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	if backend.endpoint.APIKey != "" {
+		request.Header.Set("Authorization", "Bearer "+backend.endpoint.APIKey)
+	}
+
+	response, err := backend.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("provider %s: request failed: %w", backend.endpoint.Name, err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBody))
+		return nil, fmt.Errorf("provider %s: %s: %s", backend.endpoint.Name, response.Status, strings.TrimSpace(string(message)))
+	}
+
+	return response, nil
+}
+
+// decode sends a request and decodes the JSON response into target.
+func (backend httpBackend) decode(ctx context.Context, method string, path string, payload any, target any) error {
+	response, err := backend.do(ctx, method, path, payload)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if err := json.NewDecoder(response.Body).Decode(target); err != nil {
+		return fmt.Errorf("provider %s: invalid response: %w", backend.endpoint.Name, err)
+	}
+
+	return nil
+}
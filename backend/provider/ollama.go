@@ -0,0 +1,147 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Ollama talks to the native Ollama API (/api/tags, /api/chat, /api/embed).
+type Ollama struct {
+	httpBackend
+}
+
+// NewOllama creates a provider for an Ollama server. A nil client uses http.DefaultClient.
+func NewOllama(endpoint Endpoint, client *http.Client) *Ollama {
+	endpoint.Kind = KIND_OLLAMA
+	return &Ollama{newHTTPBackend(endpoint, client)}
+}
+
+type ollamaTags struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+type ollamaChatRequest struct {
+	Model    string        `json:"model"`
+	Messages []ChatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+}
+
+type ollamaChatChunk struct {
+	Model           string      `json:"model"`
+	Message         ChatMessage `json:"message"`
+	Done            bool        `json:"done"`
+	PromptEvalCount int64       `json:"prompt_eval_count"`
+	EvalCount       int64       `json:"eval_count"`
+	Error           string      `json:"error"`
+}
+
+type ollamaEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type ollamaEmbedResponse struct {
+	Embeddings [][]float64 `json:"embeddings"`
+}
+
+func (ollama *Ollama) ListModels(ctx context.Context) ([]string, error) {
+	var tags ollamaTags
+	if err := ollama.decode(ctx, "GET", "/api/tags", nil, &tags); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(tags.Models))
+	for _, model := range tags.Models {
+		names = append(names, model.Name)
+	}
+
+	return names, nil
+}
+
+func (ollama *Ollama) Chat(ctx context.Context, request ChatRequest) (ChatResponse, error) {
+	var chunk ollamaChatChunk
+
+	err := ollama.decode(ctx, "POST", "/api/chat", ollamaChatRequest{
+		Model:    request.Model,
+		Messages: request.Messages,
+		Stream:   false,
+	}, &chunk)
+
+	if err != nil {
+		return ChatResponse{}, err
+	}
+
+	if chunk.Error != "" {
+		return ChatResponse{}, fmt.Errorf("provider %s: %s", ollama.Name(), chunk.Error)
+	}
+
+	return ChatResponse{
+		Content:          chunk.Message.Content,
+		Model:            chunk.Model,
+		PromptTokens:     chunk.PromptEvalCount,
+		CompletionTokens: chunk.EvalCount,
+	}, nil
+}
+
+// Stream reads the newline delimited JSON chunks Ollama sends with "stream": true.
+func (ollama *Ollama) Stream(ctx context.Context, request ChatRequest, on_chunk func(string) error) (ChatResponse, error) {
+	response, err := ollama.do(ctx, "POST", "/api/chat", ollamaChatRequest{
+		Model:    request.Model,
+		Messages: request.Messages,
+		Stream:   true,
+	})
+
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer response.Body.Close()
+
+	var full ChatResponse
+	decoder := json.NewDecoder(response.Body)
+
+	for {
+		var chunk ollamaChatChunk
+		err := decoder.Decode(&chunk)
+
+		if errors.Is(err, io.EOF) {
+			return full, nil
+		} else if err != nil {
+			return full, fmt.Errorf("provider %s: invalid stream: %w", ollama.Name(), err)
+		}
+
+		if chunk.Error != "" {
+			return full, fmt.Errorf("provider %s: %s", ollama.Name(), chunk.Error)
+		}
+
+		if chunk.Message.Content != "" {
+			full.Content += chunk.Message.Content
+			if err := on_chunk(chunk.Message.Content); err != nil {
+				return full, err
+			}
+		}
+
+		if chunk.Done {
+			full.Model = chunk.Model
+			full.PromptTokens = chunk.PromptEvalCount
+			full.CompletionTokens = chunk.EvalCount
+			return full, nil
+		}
+	}
+}
+
+func (ollama *Ollama) Embed(ctx context.Context, model string, input []string) ([][]float64, error) {
+	var embeddings ollamaEmbedResponse
+
+	err := ollama.decode(ctx, "POST", "/api/embed", ollamaEmbedRequest{Model: model, Input: input}, &embeddings)
+	if err != nil {
+		return nil, err
+	}
+
+	return embeddings.Embeddings, nil
+}
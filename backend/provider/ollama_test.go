@@ -0,0 +1,229 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeServer serves handler and returns a provider of the given kind talking to it with key "secret".
+func fakeServer(t *testing.T, kind string, handler http.HandlerFunc) Provider {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	backend, err := New(Endpoint{Name: "test", Kind: kind, BaseURL: server.URL + "/", APIKey: "secret"}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return backend
+}
+
+// checkRequest fails the request unless it has the expected method, path and headers.
+func checkRequest(w http.ResponseWriter, r *http.Request, method string, path string) bool {
+	var problem string
+
+	switch {
+	case r.Method != method || r.URL.Path != path:
+		problem = fmt.Sprintf("unexpected %s %s", r.Method, r.URL.Path)
+	case r.Header.Get("Authorization") != "Bearer secret":
+		problem = fmt.Sprintf("Authorization %q", r.Header.Get("Authorization"))
+	case method == "POST" && r.Header.Get("Content-Type") != "application/json":
+		problem = fmt.Sprintf("Content-Type %q", r.Header.Get("Content-Type"))
+	}
+
+	if problem != "" {
+		http.Error(w, problem, http.StatusTeapot)
+		return false
+	}
+
+	return true
+}
+
+var testMessages = []ChatMessage{{Role: ROLE_SYSTEM, Content: "Be brief."}, {Role: ROLE_USER, Content: "Hallo?"}}
+
+func TestOllamaListModels(t *testing.T) {
+	backend := fakeServer(t, KIND_OLLAMA, func(w http.ResponseWriter, r *http.Request) {
+		if checkRequest(w, r, "GET", "/api/tags") {
+			fmt.Fprint(w, `{"models": [{"name": "gemma3:12b"}, {"name": "llama3:8b"}]}`)
+		}
+	})
+
+	models, err := backend.ListModels(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(models, []string{"gemma3:12b", "llama3:8b"}) {
+		t.Errorf("models %v", models)
+	}
+}
+
+func TestOllamaChat(t *testing.T) {
+	backend := fakeServer(t, KIND_OLLAMA, func(w http.ResponseWriter, r *http.Request) {
+		if !checkRequest(w, r, "POST", "/api/chat") {
+			return
+		}
+
+		var request ollamaChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Model != "gemma3:12b" || request.Stream || !slices.Equal(request.Messages, testMessages) {
+			http.Error(w, fmt.Sprintf("unexpected body %+v, %v", request, err), http.StatusTeapot)
+			return
+		}
+
+		fmt.Fprint(w, `{"model": "gemma3:12b", "message": {"role": "assistant", "content": "Hallo!"}, "done": true, "prompt_eval_count": 12, "eval_count": 3}`)
+	})
+
+	answer, err := backend.Chat(context.Background(), ChatRequest{Model: "gemma3:12b", Messages: testMessages})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if answer != (ChatResponse{Content: "Hallo!", Model: "gemma3:12b", PromptTokens: 12, CompletionTokens: 3}) {
+		t.Errorf("answer %+v", answer)
+	}
+}
+
+func TestOllamaErrors(t *testing.T) {
+	for name, test := range map[string]struct {
+		handler http.HandlerFunc
+		want    string
+	}{
+		"status": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, `{"error": "model \"missing\" not found"}`, http.StatusNotFound)
+			},
+			want: `provider test: 404 Not Found: {"error": "model \"missing\" not found"}`,
+		},
+		"error field": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"error": "out of memory"}`)
+			},
+			want: "provider test: out of memory",
+		},
+		"invalid JSON": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `<html>`)
+			},
+			want: "provider test: invalid response",
+		},
+	} {
+		backend := fakeServer(t, KIND_OLLAMA, test.handler)
+
+		_, err := backend.Chat(context.Background(), ChatRequest{Model: "missing", Messages: testMessages})
+		if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("%s: error %v, want %q", name, err, test.want)
+		}
+	}
+
+	// Transport failures keep their cause
+	backend, _ := New(Endpoint{Name: "test", Kind: KIND_OLLAMA, BaseURL: "http://127.0.0.1:1"}, nil)
+
+	if _, err := backend.ListModels(context.Background()); err == nil || !strings.Contains(err.Error(), "request failed") {
+		t.Errorf("unreachable: %v", err)
+	}
+}
+
+func TestOllamaStream(t *testing.T) {
+	backend := fakeServer(t, KIND_OLLAMA, func(w http.ResponseWriter, r *http.Request) {
+		if !checkRequest(w, r, "POST", "/api/chat") {
+			return
+		}
+
+		var request ollamaChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || !request.Stream {
+			http.Error(w, "stream not requested", http.StatusTeapot)
+			return
+		}
+
+		for _, line := range []string{
+			`{"model": "gemma3:12b", "message": {"role": "assistant", "content": "Hal"}, "done": false}`,
+			`{"model": "gemma3:12b", "message": {"role": "assistant", "content": "lo"}, "done": false}`,
+			`{"model": "gemma3:12b", "message": {"role": "assistant", "content": ""}, "done": true, "prompt_eval_count": 12, "eval_count": 2}`,
+		} {
+			fmt.Fprintln(w, line)
+			w.(http.Flusher).Flush()
+		}
+	})
+
+	var chunks []string
+	answer, err := backend.Stream(context.Background(), ChatRequest{Model: "gemma3:12b", Messages: testMessages}, func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(chunks, []string{"Hal", "lo"}) {
+		t.Errorf("chunks %q", chunks)
+	}
+
+	if answer != (ChatResponse{Content: "Hallo", Model: "gemma3:12b", PromptTokens: 12, CompletionTokens: 2}) {
+		t.Errorf("answer %+v", answer)
+	}
+}
+
+func TestOllamaStreamErrors(t *testing.T) {
+	stream := func(lines ...string) Provider {
+		return fakeServer(t, KIND_OLLAMA, func(w http.ResponseWriter, r *http.Request) {
+			for _, line := range lines {
+				fmt.Fprintln(w, line)
+			}
+		})
+	}
+
+	ignore := func(string) error { return nil }
+
+	// An error reported in the middle of the stream keeps the text so far
+	answer, err := stream(`{"message": {"content": "Hal"}}`, `{"error": "model unloaded"}`).Stream(context.Background(), ChatRequest{}, ignore)
+	if err == nil || err.Error() != "provider test: model unloaded" || answer.Content != "Hal" {
+		t.Errorf("error chunk: %+v, %v", answer, err)
+	}
+
+	_, err = stream(`{"message": {"content": "Hal"}}`, `{"message": {"con`).Stream(context.Background(), ChatRequest{}, ignore)
+	if err == nil || !strings.Contains(err.Error(), "invalid stream") {
+		t.Errorf("truncated chunk: %v", err)
+	}
+
+	// The callback's error aborts the stream
+	stop := errors.New("client gone")
+	_, err = stream(`{"message": {"content": "Hal"}}`, `{"message": {"content": "lo"}}`).Stream(context.Background(), ChatRequest{}, func(string) error { return stop })
+	if !errors.Is(err, stop) {
+		t.Errorf("callback error: %v", err)
+	}
+}
+
+func TestOllamaEmbed(t *testing.T) {
+	backend := fakeServer(t, KIND_OLLAMA, func(w http.ResponseWriter, r *http.Request) {
+		if !checkRequest(w, r, "POST", "/api/embed") {
+			return
+		}
+
+		var request ollamaEmbedRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Model != "nomic" || !slices.Equal(request.Input, []string{"a", "b"}) {
+			http.Error(w, fmt.Sprintf("unexpected body %+v", request), http.StatusTeapot)
+			return
+		}
+
+		fmt.Fprint(w, `{"embeddings": [[0.1, 0.2], [0.3, 0.4]]}`)
+	})
+
+	vectors, err := backend.Embed(context.Background(), "nomic", []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(vectors) != 2 || !slices.Equal(vectors[1], []float64{0.3, 0.4}) {
+		t.Errorf("vectors %v", vectors)
+	}
+}
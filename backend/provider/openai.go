@@ -0,0 +1,185 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// OpenAI talks to servers implementing the OpenAI HTTP API
+// (/models, /chat/completions, /embeddings below the base URL).
+type OpenAI struct {
+	httpBackend
+}
+
+// NewOpenAI creates a provider for an OpenAI compatible server. A nil client uses http.DefaultClient.
+//
+// The base URL includes the version prefix, e.g. "http://vllm:8000/v1".
+func NewOpenAI(endpoint Endpoint, client *http.Client) *OpenAI {
+	endpoint.Kind = KIND_OPENAI
+	return &OpenAI{newHTTPBackend(endpoint, client)}
+}
+
+type openAIModels struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+type openAIChatRequest struct {
+	Model         string               `json:"model"`
+	Messages      []ChatMessage        `json:"messages"`
+	Stream        bool                 `json:"stream"`
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+}
+
+type openAIChatResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message ChatMessage `json:"message"`
+		Delta   ChatMessage `json:"delta"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+type openAIEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type openAIEmbedResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (openai *OpenAI) ListModels(ctx context.Context) ([]string, error) {
+	var models openAIModels
+	if err := openai.decode(ctx, "GET", "/models", nil, &models); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(models.Data))
+	for _, model := range models.Data {
+		names = append(names, model.ID)
+	}
+
+	return names, nil
+}
+
+func (openai *OpenAI) Chat(ctx context.Context, request ChatRequest) (ChatResponse, error) {
+	var completion openAIChatResponse
+
+	err := openai.decode(ctx, "POST", "/chat/completions", openAIChatRequest{
+		Model:    request.Model,
+		Messages: request.Messages,
+	}, &completion)
+
+	if err != nil {
+		return ChatResponse{}, err
+	}
+
+	if len(completion.Choices) == 0 {
+		return ChatResponse{}, fmt.Errorf("provider %s: response without choices", openai.Name())
+	}
+
+	var response ChatResponse = ChatResponse{Content: completion.Choices[0].Message.Content, Model: completion.Model}
+
+	if completion.Usage != nil {
+		response.PromptTokens = completion.Usage.PromptTokens
+		response.CompletionTokens = completion.Usage.CompletionTokens
+	}
+
+	return response, nil
+}
+
+// Stream reads the Server-Sent Events the API sends with "stream": true,
+// terminated by "data: [DONE]".
+func (openai *OpenAI) Stream(ctx context.Context, request ChatRequest, on_chunk func(string) error) (ChatResponse, error) {
+	response, err := openai.do(ctx, "POST", "/chat/completions", openAIChatRequest{
+		Model:         request.Model,
+		Messages:      request.Messages,
+		Stream:        true,
+		StreamOptions: &openAIStreamOptions{IncludeUsage: true},
+	})
+
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer response.Body.Close()
+
+	var full ChatResponse
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue // Blank separator lines, comments and other SSE fields
+		}
+
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			return full, nil
+		}
+
+		var chunk openAIChatResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return full, fmt.Errorf("provider %s: invalid stream: %w", openai.Name(), err)
+		}
+
+		if chunk.Model != "" {
+			full.Model = chunk.Model
+		}
+
+		if chunk.Usage != nil {
+			full.PromptTokens = chunk.Usage.PromptTokens
+			full.CompletionTokens = chunk.Usage.CompletionTokens
+		}
+
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			full.Content += chunk.Choices[0].Delta.Content
+			if err := on_chunk(chunk.Choices[0].Delta.Content); err != nil {
+				return full, err
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return full, fmt.Errorf("provider %s: stream interrupted: %w", openai.Name(), err)
+	}
+
+	return full, nil
+}
+
+func (openai *OpenAI) Embed(ctx context.Context, model string, input []string) ([][]float64, error) {
+	var embeddings openAIEmbedResponse
+
+	err := openai.decode(ctx, "POST", "/embeddings", openAIEmbedRequest{Model: model, Input: input}, &embeddings)
+	if err != nil {
+		return nil, err
+	}
+
+	vectors := make([][]float64, len(input))
+	for _, item := range embeddings.Data {
+		if item.Index < 0 || item.Index >= len(vectors) {
+			return nil, fmt.Errorf("provider %s: embedding index %d out of range", openai.Name(), item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+
+	return vectors, nil
+}
@@ -0,0 +1,191 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOpenAIListModels(t *testing.T) {
+	backend := fakeServer(t, KIND_OPENAI, func(w http.ResponseWriter, r *http.Request) {
+		if checkRequest(w, r, "GET", "/models") {
+			fmt.Fprint(w, `{"object": "list", "data": [{"id": "mistral-7b"}, {"id": "qwen2"}]}`)
+		}
+	})
+
+	models, err := backend.ListModels(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(models, []string{"mistral-7b", "qwen2"}) {
+		t.Errorf("models %v", models)
+	}
+}
+
+func TestOpenAIChat(t *testing.T) {
+	backend := fakeServer(t, KIND_OPENAI, func(w http.ResponseWriter, r *http.Request) {
+		if !checkRequest(w, r, "POST", "/chat/completions") {
+			return
+		}
+
+		var request map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request["model"] != "mistral-7b" || request["stream"] != false || request["stream_options"] != nil {
+			http.Error(w, fmt.Sprintf("unexpected body %v, %v", request, err), http.StatusTeapot)
+			return
+		}
+
+		fmt.Fprint(w, `{
+			"model": "mistral-7b",
+			"choices": [{"index": 0, "message": {"role": "assistant", "content": "Hallo!"}, "finish_reason": "stop"}],
+			"usage": {"prompt_tokens": 12, "completion_tokens": 3, "total_tokens": 15}
+		}`)
+	})
+
+	answer, err := backend.Chat(context.Background(), ChatRequest{Model: "mistral-7b", Messages: testMessages})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if answer != (ChatResponse{Content: "Hallo!", Model: "mistral-7b", PromptTokens: 12, CompletionTokens: 3}) {
+		t.Errorf("answer %+v", answer)
+	}
+}
+
+func TestOpenAIErrors(t *testing.T) {
+	for name, test := range map[string]struct {
+		handler http.HandlerFunc
+		want    string
+	}{
+		"status": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, `{"error": {"message": "Incorrect API key provided"}}`, http.StatusUnauthorized)
+			},
+			want: `provider test: 401 Unauthorized: {"error": {"message": "Incorrect API key provided"}}`,
+		},
+		"no choices": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"model": "mistral-7b", "choices": []}`)
+			},
+			want: "provider test: response without choices",
+		},
+		"invalid JSON": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `<html>`)
+			},
+			want: "provider test: invalid response",
+		},
+	} {
+		backend := fakeServer(t, KIND_OPENAI, test.handler)
+
+		_, err := backend.Chat(context.Background(), ChatRequest{Model: "mistral-7b", Messages: testMessages})
+		if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("%s: error %v, want %q", name, err, test.want)
+		}
+	}
+}
+
+func TestOpenAIStream(t *testing.T) {
+	backend := fakeServer(t, KIND_OPENAI, func(w http.ResponseWriter, r *http.Request) {
+		if !checkRequest(w, r, "POST", "/chat/completions") {
+			return
+		}
+
+		var request openAIChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || !request.Stream || request.StreamOptions == nil || !request.StreamOptions.IncludeUsage {
+			http.Error(w, fmt.Sprintf("unexpected body %+v", request), http.StatusTeapot)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		for _, event := range []string{
+			": keep-alive",
+			`data: {"model": "mistral-7b", "choices": [{"delta": {"role": "assistant", "content": ""}}]}`,
+			`data: {"model": "mistral-7b", "choices": [{"delta": {"content": "Hal"}}]}`,
+			`data:{"model": "mistral-7b", "choices": [{"delta": {"content": "lo"}}]}`,
+			`data: {"model": "mistral-7b", "choices": [], "usage": {"prompt_tokens": 12, "completion_tokens": 2}}`,
+			`data: [DONE]`,
+			`data: {"choices": [{"delta": {"content": "ignored"}}]}`,
+		} {
+			fmt.Fprint(w, event+"\n\n")
+			w.(http.Flusher).Flush()
+		}
+	})
+
+	var chunks []string
+	answer, err := backend.Stream(context.Background(), ChatRequest{Model: "mistral-7b", Messages: testMessages}, func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(chunks, []string{"Hal", "lo"}) {
+		t.Errorf("chunks %q", chunks)
+	}
+
+	if answer != (ChatResponse{Content: "Hallo", Model: "mistral-7b", PromptTokens: 12, CompletionTokens: 2}) {
+		t.Errorf("answer %+v", answer)
+	}
+}
+
+func TestOpenAIStreamErrors(t *testing.T) {
+	backend := fakeServer(t, KIND_OPENAI, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data: {\"choices\": [{\"delta\": {\"content\": \"Hal\"}}]}\n\ndata: {\"choi\n\n")
+	})
+
+	answer, err := backend.Stream(context.Background(), ChatRequest{}, func(string) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "invalid stream") || answer.Content != "Hal" {
+		t.Errorf("truncated event: %+v, %v", answer, err)
+	}
+
+	backend = fakeServer(t, KIND_OPENAI, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	})
+
+	_, err = backend.Stream(context.Background(), ChatRequest{}, func(string) error { return nil })
+	if err == nil || err.Error() != "provider test: 429 Too Many Requests: rate limited" {
+		t.Errorf("status: %v", err)
+	}
+}
+
+func TestOpenAIEmbed(t *testing.T) {
+	backend := fakeServer(t, KIND_OPENAI, func(w http.ResponseWriter, r *http.Request) {
+		if !checkRequest(w, r, "POST", "/embeddings") {
+			return
+		}
+
+		var request openAIEmbedRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Model != "bge" || !slices.Equal(request.Input, []string{"a", "b"}) {
+			http.Error(w, fmt.Sprintf("unexpected body %+v", request), http.StatusTeapot)
+			return
+		}
+
+		// Entries may arrive in any order
+		fmt.Fprint(w, `{"data": [{"index": 1, "embedding": [0.3, 0.4]}, {"index": 0, "embedding": [0.1, 0.2]}]}`)
+	})
+
+	vectors, err := backend.Embed(context.Background(), "bge", []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(vectors) != 2 || !slices.Equal(vectors[0], []float64{0.1, 0.2}) || !slices.Equal(vectors[1], []float64{0.3, 0.4}) {
+		t.Errorf("vectors %v", vectors)
+	}
+
+	backend = fakeServer(t, KIND_OPENAI, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data": [{"index": 5, "embedding": [0.1]}]}`)
+	})
+
+	if _, err := backend.Embed(context.Background(), "bge", []string{"a"}); err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("index out of range: %v", err)
+	}
+}
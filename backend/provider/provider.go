@@ -0,0 +1,145 @@
+// Package provider abstracts the model backends the chatbot can talk to.
+//
+// A Provider lists models, answers chats (buffered or streamed) and computes
+// embeddings. Implementations exist for Ollama (NewOllama) and for servers
+// speaking the OpenAI HTTP API such as vLLM, LM Studio or hosted APIs (NewOpenAI).
+// Providers are collected in a Registry, which merges their model lists into one
+// catalogue and resolves model names back to their provider.
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// Kinds of provider implementations, as stored with registered endpoints.
+const (
+	KIND_OLLAMA string = "ollama"
+	KIND_OPENAI string = "openai"
+)
+
+// Roles of chat messages.
+const (
+	ROLE_SYSTEM    string = "system"
+	ROLE_USER      string = "user"
+	ROLE_ASSISTANT string = "assistant"
+)
+
+// ChatMessage is a single turn of a conversation.
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatRequest asks a provider to continue a conversation.
+//
+//   - Model:    Model name as known to the provider (without the provider prefix)
+//   - Messages: Conversation so far, usually starting with a system message
+type ChatRequest struct {
+	Model    string
+	Messages []ChatMessage
+}
+
+// ChatResponse is the complete answer of a provider.
+//
+//   - Content:          Generated text
+//   - Model:            Model that answered, as reported by the provider
+//   - PromptTokens:     Tokens of the input, 0 if not reported
+//   - CompletionTokens: Tokens of the answer, 0 if not reported
+type ChatResponse struct {
+	Content          string
+	Model            string
+	PromptTokens     int64
+	CompletionTokens int64
+}
+
+// Provider is a model backend.
+//
+// All methods are bound to ctx; cancelling it aborts the upstream request.
+type Provider interface {
+	// Name identifies the provider in the catalogue and in qualified model names.
+	Name() string
+
+	// Local reports whether the backend runs on the premises (see local-only mode).
+	Local() bool
+
+	// ListModels returns the names of the models the backend serves.
+	ListModels(ctx context.Context) ([]string, error)
+
+	// Chat returns the complete answer once generation has finished.
+	Chat(ctx context.Context, request ChatRequest) (ChatResponse, error)
+
+	// Stream calls on_chunk with every piece of text as it is generated and returns
+	// the complete answer at the end. An error returned by on_chunk aborts the stream.
+	Stream(ctx context.Context, request ChatRequest, on_chunk func(string) error) (ChatResponse, error)
+
+	// Embed returns one embedding vector per input text.
+	Embed(ctx context.Context, model string, input []string) ([][]float64, error)
+}
+
+// Endpoint describes a provider registered by an administrator.
+//
+//   - Name:    Unique name, lower case letters, digits, "-" and "_"
+//   - Kind:    KIND_OLLAMA or KIND_OPENAI
+//   - BaseURL: Absolute http(s) root of the API, e.g. "http://vllm:8000/v1" (OpenAI) or "http://gpu-box:11434" (Ollama)
+//   - APIKey:  Sent as bearer token, may be empty
+//   - Local:   Whether the endpoint runs on the premises, decided by the administrator
+type Endpoint struct {
+	Name    string
+	Kind    string
+	BaseURL string
+	APIKey  string
+	Local   bool
+}
+
+var namePattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// Validate checks an endpoint before it is registered.
+func (endpoint Endpoint) Validate() error {
+	if !namePattern.MatchString(endpoint.Name) {
+		return fmt.Errorf("invalid provider name %q: use 1-32 lower case letters, digits, '-' or '_'", endpoint.Name)
+	}
+
+	if endpoint.Kind != KIND_OLLAMA && endpoint.Kind != KIND_OPENAI {
+		return fmt.Errorf("unknown provider kind %q", endpoint.Kind)
+	}
+
+	base_url, err := url.Parse(endpoint.BaseURL)
+
+	if err != nil || (base_url.Scheme != "http" && base_url.Scheme != "https") || base_url.Host == "" {
+		return fmt.Errorf("invalid base URL %q: an absolute http(s) URL is required", endpoint.BaseURL)
+	}
+
+	return nil
+}
+
+// New creates the provider implementation for an endpoint.
+func New(endpoint Endpoint, client *http.Client) (Provider, error) {
+	if err := endpoint.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch endpoint.Kind {
+	case KIND_OLLAMA:
+		return NewOllama(endpoint, client), nil
+	default:
+		return NewOpenAI(endpoint, client), nil
+	}
+}
+
+// DefaultClient returns the HTTP client used for providers when none is given.
+//
+// There is no total timeout since streamed answers may take minutes; the wait for
+// the first response byte is bounded by timeout.
+func DefaultClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			ResponseHeaderTimeout: timeout,
+		},
+	}
+}
@@ -0,0 +1,41 @@
+package provider
+
+import (
+	"testing"
+)
+
+func TestEndpointValidate(t *testing.T) {
+	valid := Endpoint{Name: "vllm", Kind: KIND_OPENAI, BaseURL: "http://vllm:8000/v1"}
+
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("valid endpoint: %v", err)
+	}
+
+	for name, change := range map[string]func(*Endpoint){
+		"empty name":        func(endpoint *Endpoint) { endpoint.Name = "" },
+		"upper case name":   func(endpoint *Endpoint) { endpoint.Name = "VLLM" },
+		"name with slash":   func(endpoint *Endpoint) { endpoint.Name = "a/b" },
+		"unknown kind":      func(endpoint *Endpoint) { endpoint.Kind = "anthropic" },
+		"empty URL":         func(endpoint *Endpoint) { endpoint.BaseURL = "" },
+		"relative URL":      func(endpoint *Endpoint) { endpoint.BaseURL = "/v1" },
+		"missing scheme":    func(endpoint *Endpoint) { endpoint.BaseURL = "vllm:8000/v1" },
+		"file scheme":       func(endpoint *Endpoint) { endpoint.BaseURL = "file:///etc/passwd" },
+		"missing host":      func(endpoint *Endpoint) { endpoint.BaseURL = "http:///v1" },
+		"unparseable URL":   func(endpoint *Endpoint) { endpoint.BaseURL = "http://[::1" },
+		"control character": func(endpoint *Endpoint) { endpoint.BaseURL = "http://vllm\n:8000" },
+	} {
+		endpoint := valid
+		change(&endpoint)
+
+		if err := endpoint.Validate(); err == nil {
+			t.Errorf("%s: %+v accepted", name, endpoint)
+		}
+	}
+
+	https := valid
+	https.BaseURL = "https://api.example.com/v1"
+
+	if err := https.Validate(); err != nil {
+		t.Errorf("https endpoint: %v", err)
+	}
+}
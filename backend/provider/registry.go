@@ -0,0 +1,212 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownModel is returned by Resolve for names no provider serves.
+var ErrUnknownModel = errors.New("unknown model")
+
+// Model is an entry of the merged catalogue.
+//
+//   - Name:     Name used for model selections. Models of the default provider keep
+//     their plain name, all others are qualified as "<provider>/<model>"
+//   - Model:    Name as known to the provider
+//   - Provider: Name of the provider serving the model
+//   - Local:    Whether the provider runs on the premises
+type Model struct {
+	Name     string `json:"name"`
+	Model    string `json:"model"`
+	Provider string `json:"provider"`
+	Local    bool   `json:"local"`
+}
+
+type cachedModels struct {
+	names     []string
+	cached_at time.Time
+}
+
+// Registry holds the default provider and the providers registered by administrators.
+//
+// Model lists are cached per provider for the configured lifetime, so resolving a
+// model on every inference request does not query every backend.
+type Registry struct {
+	mutex          sync.Mutex
+	default_name   string
+	providers      map[string]Provider
+	order          []string
+	cache          map[string]cachedModels
+	cache_lifetime time.Duration
+}
+
+// NewRegistry creates a registry around the default provider, which cannot be removed.
+func NewRegistry(default_provider Provider, cache_lifetime time.Duration) *Registry {
+	return &Registry{
+		default_name:   default_provider.Name(),
+		providers:      map[string]Provider{default_provider.Name(): default_provider},
+		order:          []string{default_provider.Name()},
+		cache:          map[string]cachedModels{},
+		cache_lifetime: cache_lifetime,
+	}
+}
+
+// Register adds a provider. Names must be unique.
+func (registry *Registry) Register(provider Provider) error {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if _, exists := registry.providers[provider.Name()]; exists {
+		return fmt.Errorf("provider %q already exists", provider.Name())
+	}
+
+	registry.providers[provider.Name()] = provider
+	registry.order = append(registry.order, provider.Name())
+	return nil
+}
+
+// Remove deletes a registered provider. The default provider cannot be removed.
+func (registry *Registry) Remove(name string) error {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if name == registry.default_name {
+		return fmt.Errorf("the default provider %q cannot be removed", name)
+	}
+
+	if _, exists := registry.providers[name]; !exists {
+		return fmt.Errorf("provider %q does not exist", name)
+	}
+
+	delete(registry.providers, name)
+	delete(registry.cache, name)
+	registry.order = slices.DeleteFunc(registry.order, func(entry string) bool { return entry == name })
+	return nil
+}
+
+// Default returns the default provider.
+func (registry *Registry) Default() Provider {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	return registry.providers[registry.default_name]
+}
+
+// Providers returns all providers in registration order, the default provider first.
+func (registry *Registry) Providers() []Provider {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	providers := make([]Provider, 0, len(registry.order))
+	for _, name := range registry.order {
+		providers = append(providers, registry.providers[name])
+	}
+	return providers
+}
+
+// Qualify returns the catalogue name of a provider's model.
+func (registry *Registry) Qualify(provider Provider, model string) string {
+	if provider.Name() == registry.default_name {
+		return model
+	}
+	return provider.Name() + "/" + model
+}
+
+// Catalogue merges the model lists of all providers.
+//
+// Returns:
+//   - []Model: Models of every provider that answered
+//   - error: Joined errors of the providers that failed, nil if all answered
+func (registry *Registry) Catalogue(ctx context.Context) ([]Model, error) {
+	var catalogue []Model = []Model{}
+	var problems []error
+
+	for _, provider := range registry.Providers() {
+		names, err := registry.models(ctx, provider)
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+
+		for _, name := range names {
+			catalogue = append(catalogue, Model{
+				Name:     registry.Qualify(provider, name),
+				Model:    name,
+				Provider: provider.Name(),
+				Local:    provider.Local(),
+			})
+		}
+	}
+
+	return catalogue, errors.Join(problems...)
+}
+
+// Lookup maps a catalogue name to its provider without contacting any backend.
+//
+// A name "<provider>/<model>" whose prefix is a registered provider refers to that
+// provider, any other name to the default provider.
+//
+// Returns:
+//   - Provider: Provider responsible for the name
+//   - string: Model name as known to the provider
+func (registry *Registry) Lookup(name string) (Provider, string) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if prefix, rest, found := strings.Cut(name, "/"); found && prefix != registry.default_name {
+		if named, exists := registry.providers[prefix]; exists {
+			return named, rest
+		}
+	}
+
+	return registry.providers[registry.default_name], name
+}
+
+// Resolve is Lookup plus a check that the provider actually serves the model.
+//
+// Returns:
+//   - Provider: Provider serving the model
+//   - string: Model name as known to the provider
+//   - error: ErrUnknownModel, or the error of listing the provider's models
+func (registry *Registry) Resolve(ctx context.Context, name string) (Provider, string, error) {
+	provider, model := registry.Lookup(name)
+
+	names, err := registry.models(ctx, provider)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !slices.Contains(names, model) {
+		return nil, "", fmt.Errorf("%w %q", ErrUnknownModel, name)
+	}
+
+	return provider, model, nil
+}
+
+// models returns the cached model list of a provider, refreshing it when stale.
+func (registry *Registry) models(ctx context.Context, provider Provider) ([]string, error) {
+	registry.mutex.Lock()
+	cached, ok := registry.cache[provider.Name()]
+	registry.mutex.Unlock()
+
+	if ok && time.Since(cached.cached_at) < registry.cache_lifetime {
+		return cached.names, nil
+	}
+
+	names, err := provider.ListModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	registry.mutex.Lock()
+	if _, exists := registry.providers[provider.Name()]; exists {
+		registry.cache[provider.Name()] = cachedModels{names: names, cached_at: time.Now()}
+	}
+	registry.mutex.Unlock()
+
+	return names, nil
+}
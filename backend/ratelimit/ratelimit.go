@@ -0,0 +1,254 @@
+// Package ratelimit throttles requests with token buckets.
+//
+// A Limiter keeps one bucket per key (a user or a client address). Each bucket
+// holds up to a minute's budget of tokens and refills continuously; a request
+// takes one token and is refused while the bucket is empty. Buckets live in
+// memory, so limits start fresh when the server restarts.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the budgets, each one a separate Limiter.
+const (
+	ADDRESS    string = "address"
+	LOGIN      string = "login"
+	INFERENCE  string = "inference"
+	DEEP_THINK string = "deep_think"
+	UPLOAD     string = "upload"
+)
+
+// Buckets untouched for this long are full again and are dropped on the next prune.
+const PRUNE_INTERVAL time.Duration = 10 * time.Minute
+
+// Limiter is a set of token buckets sharing one budget.
+type Limiter struct {
+	name       string
+	rate       float64 // Tokens per second
+	burst      float64
+	mutex      sync.Mutex
+	buckets    map[string]*bucket
+	last_prune time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// BucketState is the current state of a bucket, as shown to administrators.
+//
+//   - Name:      Budget of the bucket (one of the constants above)
+//   - Tokens:    Requests that can be made right now
+//   - PerMinute: Refill rate, also the capacity of the bucket
+type BucketState struct {
+	Name      string
+	Tokens    int64
+	PerMinute int64
+}
+
+// Limits are the budgets of the backend, each one counted separately.
+//
+//   - Address:   Unauthenticated requests per client address
+//   - Login:     Login attempts per account and client address, so failed attempts
+//     from one address do not lock the account out everywhere
+//   - Inference: Inference requests per user
+//   - DeepThink: Deep think requests per user, in addition to Inference
+//   - Upload:    Uploads per user
+type Limits struct {
+	Address   *Limiter
+	Login     *Limiter
+	Inference *Limiter
+	DeepThink *Limiter
+	Upload    *Limiter
+}
+
+// NewLimits creates the budgets with the given requests per minute.
+func NewLimits(address int64, login int64, inference int64, deep_think int64, upload int64) Limits {
+	return Limits{
+		Address:   NewLimiter(ADDRESS, address),
+		Login:     NewLimiter(LOGIN, login),
+		Inference: NewLimiter(INFERENCE, inference),
+		DeepThink: NewLimiter(DEEP_THINK, deep_think),
+		Upload:    NewLimiter(UPLOAD, upload),
+	}
+}
+
+// NewLimiter creates a limiter allowing per_minute requests per key and minute.
+// The bucket capacity equals the rate, so a key may use a minute's budget at once.
+//
+// Panics if per_minute is not positive: an empty bucket would never refill and
+// its Retry-After be infinite. Routes without a limit use a nil Limiter instead.
+func NewLimiter(name string, per_minute int64) *Limiter {
+	if per_minute <= 0 {
+		panic(fmt.Sprintf("ratelimit: limit %s must be positive, got %d", name, per_minute))
+	}
+
+	return &Limiter{
+		name:       name,
+		rate:       float64(per_minute) / 60,
+		burst:      float64(per_minute),
+		buckets:    map[string]*bucket{},
+		last_prune: time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket of a key.
+//
+// Returns:
+//   - bool: Whether the request may proceed
+//   - time.Duration: Time until a token is available again, 0 if allowed
+func (limiter *Limiter) Allow(key string) (bool, time.Duration) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	var now time.Time = time.Now()
+	limiter.prune(now)
+
+	current := limiter.refill(key, now)
+
+	if current.tokens >= 1 {
+		current.tokens--
+		return true, 0
+	}
+
+	var wait float64 = (1 - current.tokens) / limiter.rate
+	return false, time.Duration(math.Ceil(wait * float64(time.Second)))
+}
+
+// State returns the bucket of a key without taking a token.
+func (limiter *Limiter) State(key string) BucketState {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	current := limiter.refill(key, time.Now())
+
+	return BucketState{
+		Name:      limiter.name,
+		Tokens:    int64(current.tokens),
+		PerMinute: int64(limiter.burst),
+	}
+}
+
+// Reset refills the bucket of a key.
+func (limiter *Limiter) Reset(key string) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	delete(limiter.buckets, key)
+}
+
+// LowestState returns the emptiest bucket whose key starts with prefix, without
+// taking a token. A full bucket is returned if no key matches.
+func (limiter *Limiter) LowestState(prefix string) BucketState {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	var now time.Time = time.Now()
+	var tokens float64 = limiter.burst
+
+	for key := range limiter.buckets {
+		if strings.HasPrefix(key, prefix) {
+			tokens = min(tokens, limiter.refill(key, now).tokens)
+		}
+	}
+
+	return BucketState{
+		Name:      limiter.name,
+		Tokens:    int64(tokens),
+		PerMinute: int64(limiter.burst),
+	}
+}
+
+// ResetPrefix refills every bucket whose key starts with prefix.
+func (limiter *Limiter) ResetPrefix(prefix string) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	for key := range limiter.buckets {
+		if strings.HasPrefix(key, prefix) {
+			delete(limiter.buckets, key)
+		}
+	}
+}
+
+// refill returns the bucket of a key with the tokens accrued since its last use.
+// Unknown keys get a full bucket. The caller holds the mutex.
+func (limiter *Limiter) refill(key string, now time.Time) *bucket {
+	current, ok := limiter.buckets[key]
+
+	if !ok {
+		current = &bucket{tokens: limiter.burst, updated: now}
+		limiter.buckets[key] = current
+		return current
+	}
+
+	var elapsed float64 = now.Sub(current.updated).Seconds()
+	current.tokens = min(limiter.burst, current.tokens+elapsed*limiter.rate)
+	current.updated = now
+
+	return current
+}
+
+// prune drops buckets idle for PRUNE_INTERVAL, at most once per interval.
+// The caller holds the mutex.
+func (limiter *Limiter) prune(now time.Time) {
+	if now.Sub(limiter.last_prune) < PRUNE_INTERVAL {
+		return
+	}
+
+	for key, current := range limiter.buckets {
+		if now.Sub(current.updated) >= PRUNE_INTERVAL {
+			delete(limiter.buckets, key)
+		}
+	}
+
+	limiter.last_prune = now
+}
+
+// UserKey is the bucket key of an authenticated user.
+func UserKey(user_id int64) string {
+	return "user:" + strconv.FormatInt(user_id, 10)
+}
+
+// AccountKey is the bucket key of an account named in a request, e.g. a login attempt.
+func AccountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// LoginKey is the bucket key of login attempts for an account from a client address.
+func LoginKey(email string, address string) string {
+	return LoginPrefix(email) + AddressKey(address)
+}
+
+// LoginPrefix starts the LoginKey of an account from every address.
+func LoginPrefix(email string) string {
+	return AccountKey(email) + " "
+}
+
+// AddressKey is the bucket key of a client address (see auth.ClientAddress).
+func AddressKey(address string) string {
+	return "ip:" + address
+}
+
+// Refuse answers a request with 429 Too Many Requests and a Retry-After header.
+//
+// Parameters:
+//   - retry_after: Time until the request may be repeated, rounded up to whole seconds
+//   - reason: Response body
+func Refuse(w http.ResponseWriter, retry_after time.Duration, reason string) {
+	var seconds int64 = int64(math.Ceil(retry_after.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	http.Error(w, fmt.Sprintf("%s, retry after %d seconds", reason, seconds), http.StatusTooManyRequests)
+}
@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiterTokenBucket(t *testing.T) {
+	limiter := NewLimiter(INFERENCE, 6)
+
+	// A fresh bucket holds a minute's budget
+	for request := range 6 {
+		if allowed, _ := limiter.Allow("user:1"); !allowed {
+			t.Fatalf("request %d of the budget refused", request+1)
+		}
+	}
+
+	allowed, retry_after := limiter.Allow("user:1")
+	if allowed {
+		t.Fatal("request beyond the budget allowed")
+	}
+
+	// One token accrues every 10 seconds
+	if retry_after <= 9*time.Second || retry_after > 10*time.Second {
+		t.Errorf("retry after %v, want about 10s", retry_after)
+	}
+
+	// Other keys have their own bucket
+	if allowed, _ := limiter.Allow("user:2"); !allowed {
+		t.Error("other key refused")
+	}
+
+	// Half a minute later three tokens have accrued
+	limiter.buckets["user:1"].updated = limiter.buckets["user:1"].updated.Add(-30 * time.Second)
+
+	if state := limiter.State("user:1"); state.Tokens != 3 || state.PerMinute != 6 {
+		t.Errorf("state %+v, want 3 of 6 tokens", state)
+	}
+
+	// The bucket never holds more than a minute's budget
+	limiter.buckets["user:1"].updated = limiter.buckets["user:1"].updated.Add(-time.Hour)
+
+	if state := limiter.State("user:1"); state.Tokens != 6 {
+		t.Errorf("state %+v, want a full bucket", state)
+	}
+
+	limiter.Allow("user:1")
+	limiter.Reset("user:1")
+
+	if state := limiter.State("user:1"); state.Tokens != 6 {
+		t.Errorf("state after reset %+v, want a full bucket", state)
+	}
+}
+
+func TestLimiterPrefixes(t *testing.T) {
+	limiter := NewLimiter(LOGIN, 3)
+
+	for range 3 {
+		limiter.Allow(LoginKey("Bob@example.com ", "203.0.113.9"))
+	}
+	limiter.Allow(LoginKey("bob@example.com", "192.0.2.1"))
+	limiter.Allow(LoginKey("alice@example.com", "203.0.113.9"))
+
+	// Attempts from one address leave the account's other addresses alone
+	if allowed, _ := limiter.Allow(LoginKey("bob@example.com", "192.0.2.1")); !allowed {
+		t.Error("attempt from another address refused")
+	}
+
+	if state := limiter.LowestState(LoginPrefix("bob@example.com")); state.Tokens != 0 || state.PerMinute != 3 {
+		t.Errorf("lowest state %+v, want 0 of 3 tokens", state)
+	}
+
+	if state := limiter.LowestState(LoginPrefix("carol@example.com")); state.Tokens != 3 {
+		t.Errorf("account without attempts: %+v, want a full bucket", state)
+	}
+
+	limiter.ResetPrefix(LoginPrefix("bob@example.com"))
+
+	if state := limiter.LowestState(LoginPrefix("bob@example.com")); state.Tokens != 3 {
+		t.Errorf("after reset %+v, want a full bucket", state)
+	}
+
+	if state := limiter.State(LoginKey("alice@example.com", "203.0.113.9")); state.Tokens != 2 {
+		t.Errorf("other account %+v, want 2 tokens", state)
+	}
+}
+
+func TestLimiterPrunesIdleBuckets(t *testing.T) {
+	limiter := NewLimiter(UPLOAD, 10)
+
+	limiter.Allow("user:1")
+	limiter.buckets["user:1"].updated = time.Now().Add(-PRUNE_INTERVAL)
+	limiter.last_prune = time.Now().Add(-PRUNE_INTERVAL)
+
+	limiter.Allow("user:2")
+
+	if _, ok := limiter.buckets["user:1"]; ok {
+		t.Error("idle bucket kept")
+	}
+}
+
+func TestNewLimiterRejectsNonPositiveLimits(t *testing.T) {
+	for _, per_minute := range []int64{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewLimiter(%d) did not panic", per_minute)
+				}
+			}()
+
+			NewLimiter(LOGIN, per_minute)
+		}()
+	}
+}
+
+func TestRefuse(t *testing.T) {
+	for retry_after, want := range map[time.Duration]string{
+		0:                       "1",
+		1500 * time.Millisecond: "2",
+		10 * time.Second:        "10",
+	} {
+		recorder := httptest.NewRecorder()
+		Refuse(recorder, retry_after, "rate limit exceeded")
+
+		if recorder.Code != 429 || recorder.Header().Get("Retry-After") != want {
+			t.Errorf("%v: status %d, Retry-After %q, want %s", retry_after, recorder.Code, recorder.Header().Get("Retry-After"), want)
+		}
+	}
+}
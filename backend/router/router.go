@@ -0,0 +1,274 @@
+package router
+
+import (
+	"backend/auth"
+	"backend/db"
+	"backend/logging"
+	"backend/metrics"
+	"backend/ratelimit"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Access declares which callers may reach a route.
+//
+// The zero value is ADMIN, so a route that forgets to declare its access level
+// is locked down rather than opened up.
+type Access int
+
+const (
+	ADMIN  Access = iota // Valid token of a user with admin privileges
+	USER                 // Valid token of any user
+	PUBLIC               // No token required
+)
+
+func (access Access) String() string {
+	switch access {
+	case ADMIN:
+		return "admin"
+	case USER:
+		return "user"
+	case PUBLIC:
+		return "public"
+	default:
+		return fmt.Sprintf("Access(%d)", int(access))
+	}
+}
+
+// Route is a single declarative entry of the route table.
+//
+//   - Path:    URL path, matched exactly
+//   - Methods: Accepted HTTP methods, other methods are answered with 405 Method Not Allowed
+//   - Access:  Required authorization, checked before Handler runs
+//   - Permission: Permission the role of the caller must grant (see db.PERMISSIONS),
+//     checked after Access. Empty for routes open to every caller of the access level
+//   - RateLimit: Budget the route counts against, per user for USER and ADMIN routes and
+//     per client address for PUBLIC routes. Nil for unlimited routes
+//   - Handler: Called only if method, access, permission and rate limit allow it. For USER and
+//     ADMIN routes the AuthorizationResult of the caller can be read with Authorization(r.Context())
+type Route struct {
+	Path       string
+	Methods    []string
+	Access     Access
+	Permission string
+	RateLimit  *ratelimit.Limiter
+	Handler    http.HandlerFunc
+}
+
+// Router dispatches requests by method and path and enforces the access level of each route.
+type Router struct {
+	db_handle *sql.DB
+	mux       *http.ServeMux
+}
+
+type contextKey struct{}
+
+// NewRouter creates an empty router. The database handle is used to validate sessions.
+func NewRouter(db_handle *sql.DB) *Router {
+	return &Router{db_handle: db_handle, mux: http.NewServeMux()}
+}
+
+// Register adds routes to the router.
+//
+// Panics if a route has no methods, no handler, a permission on a PUBLIC route or if a
+// method/path combination is registered twice, so wiring mistakes surface at startup
+// instead of at runtime.
+func (router *Router) Register(routes ...Route) {
+	for _, route := range routes {
+		if len(route.Methods) == 0 {
+			panic(fmt.Sprintf("router: route %s has no methods", route.Path))
+		}
+
+		if route.Handler == nil {
+			panic(fmt.Sprintf("router: route %s has no handler", route.Path))
+		}
+
+		if route.Access == PUBLIC && route.Permission != "" {
+			panic(fmt.Sprintf("router: public route %s requires permission %s", route.Path, route.Permission))
+		}
+
+		var handler http.Handler = router.authorize(route.Access, route.Permission, throttle(route.RateLimit, route.Handler))
+
+		for _, method := range route.Methods {
+			router.mux.Handle(method+" "+route.Path, handler)
+		}
+	}
+}
+
+// ServeHTTP implements http.Handler.
+//
+// Every request is handled under a request ID (see logging.NewRequestID), taken from
+// the X-Request-ID header of the client if it is acceptable. The ID is echoed in the
+// response header, available to handlers through logging.RequestID(r.Context()) and
+// written with the access log line of the request. Bodies, headers and the query
+// string are not logged. Count and duration of requests are recorded per route
+// (see metrics.HTTPRequests).
+func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request_id string = logging.NewRequestID(r.Header.Get(logging.REQUEST_ID_HEADER))
+	var start time.Time = time.Now()
+
+	w.Header().Set(logging.REQUEST_ID_HEADER, request_id)
+	r = r.WithContext(logging.WithRequestID(r.Context(), request_id))
+
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	router.mux.ServeHTTP(recorder, r)
+
+	var duration time.Duration = time.Since(start)
+
+	// The mux sets the pattern of the matched route, "METHOD /path"
+	var route string = "unmatched"
+	if _, path, found := strings.Cut(r.Pattern, " "); found {
+		route = path
+	}
+
+	metrics.HTTPRequests.Inc(route, r.Method, strconv.Itoa(recorder.status))
+	metrics.HTTPDuration.Observe(duration.Seconds(), route, r.Method)
+
+	logging.FromContext(r.Context()).Info("Request handled",
+		"method", r.Method,
+		"path", r.URL.Path,
+		"status", recorder.status,
+		"duration_ms", duration.Milliseconds(),
+		"remote", auth.ClientAddress(r),
+	)
+}
+
+// statusRecorder remembers the status code a handler answered with.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps streamed responses (see api.InferenceStream) working through the recorder.
+func (recorder *statusRecorder) Flush() {
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying ResponseWriter.
+func (recorder *statusRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
+
+// authorize wraps a handler with the authorization check of its access level and permission.
+//
+// Responses:
+//   - 400 Bad Request: Authorization header missing
+//   - 401 Unauthorized: Invalid, expired or revoked token
+//   - 403 Forbidden: Valid token without admin privileges on an ADMIN route,
+//     or the role of the caller lacks the permission of the route (see deny)
+func (router *Router) authorize(access Access, permission string, handler http.HandlerFunc) http.Handler {
+	if access == PUBLIC {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var header string = r.Header.Get("Authorization")
+
+		if header == "" {
+			http.Error(w, "Authorization header missing", http.StatusBadRequest)
+			return
+		}
+
+		var auth_result auth.AuthorizationResult
+		var err error
+
+		if access == USER {
+			auth_result, err = auth.Authorization(router.db_handle, header)
+		} else {
+			auth_result, err = auth.AdminAuthorization(router.db_handle, header)
+		}
+
+		if errors.Is(err, auth.ErrNotAdmin) {
+			router.deny(auth_result, err.Error(), map[string]string{"Access": access.String()}, w, r)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if permission != "" && !auth_result.HasPermission(permission) {
+			router.deny(auth_result, fmt.Sprintf("permission %s required", permission), map[string]string{"Permission": permission}, w, r)
+			return
+		}
+
+		handler(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, auth_result)))
+	})
+}
+
+// deny answers an authenticated request the caller may not make and records the
+// refusal in the audit log (action "access.denied", the route as target).
+//
+// Responses:
+//   - 403 Forbidden: reason as body
+//   - 500 Internal Server Error: The refusal could not be recorded
+func (router *Router) deny(
+	auth_result auth.AuthorizationResult,
+	reason string,
+	detail any,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	err := db.AddAuditEntry(router.db_handle, db.AuditEvent{
+		UserID:   auth_result.ID,
+		Action:   "access.denied",
+		Target:   "route:" + r.Pattern,
+		SourceIP: auth.ClientAddress(r),
+		Outcome:  db.AUDIT_DENIED,
+		Detail:   detail,
+	})
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Error(w, reason, http.StatusForbidden)
+}
+
+// throttle wraps a handler with the rate limit of its route.
+//
+// Authenticated callers are limited per user, others per client address.
+//
+// Responses:
+//   - 429 Too Many Requests: The budget of the caller is used up, Retry-After header set
+func throttle(limiter *ratelimit.Limiter, handler http.HandlerFunc) http.HandlerFunc {
+	if limiter == nil {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var key string = ratelimit.AddressKey(auth.ClientAddress(r))
+
+		if auth_result := Authorization(r.Context()); auth_result.ID != 0 {
+			key = ratelimit.UserKey(auth_result.ID)
+		}
+
+		if allowed, retry_after := limiter.Allow(key); !allowed {
+			ratelimit.Refuse(w, retry_after, "rate limit exceeded")
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// Authorization returns the AuthorizationResult the router stored for the request.
+//
+// Returns a zero AuthorizationResult (ID 0, no admin rights) for PUBLIC routes.
+func Authorization(ctx context.Context) auth.AuthorizationResult {
+	auth_result, _ := ctx.Value(contextKey{}).(auth.AuthorizationResult)
+	return auth_result
+}
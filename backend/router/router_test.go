@@ -0,0 +1,107 @@
+package router
+
+import (
+	"backend/auth"
+	"backend/db"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// openTestDatabase creates a database with an admin and a standard user,
+// both with the password "secret", and signs tokens with a test key.
+func openTestDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+
+	if err := auth.AddSigningKey("router-test", bytes.Repeat([]byte("r"), auth.MIN_KEY_LENGTH)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := auth.SetActiveSigningKey("router-test"); err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := auth.HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db_handle, err := db.SetupSqlite(filepath.Join(t.TempDir(), "test.db"), db.CreateAdmin("Admin", hash, "admin@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db_handle.Close() })
+
+	if err := db.AddUser(db_handle, db.User{Name: "Standard", Password: hash, Email: "standard@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	return db_handle
+}
+
+// token logs a user in and returns the Authorization header value.
+func token(t *testing.T, db_handle *sql.DB, email string) string {
+	t.Helper()
+
+	body, _ := json.Marshal(auth.LoginCredentials{Email: email, Password: "secret"})
+	recorder := httptest.NewRecorder()
+
+	auth.Login(db_handle, auth.SessionSettings{AccessTokenLifetime: 60, RefreshTokenLifetime: 60}, recorder, httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(string(body))))
+
+	var response auth.LoginResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil || response.JWTToken == "" {
+		t.Fatalf("login of %s: status %d, %v", email, recorder.Code, err)
+	}
+
+	return "Bearer " + response.JWTToken
+}
+
+func TestRouterEnforcesPermission(t *testing.T) {
+	db_handle := openTestDatabase(t)
+
+	router := NewRouter(db_handle)
+	router.Register(Route{
+		Path: "/api/get/audit_log", Methods: []string{"GET"}, Access: USER, Permission: db.PERMISSION_VIEW_AUDIT_LOG,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		},
+	})
+
+	request := func(authorization string) int {
+		r := httptest.NewRequest(http.MethodGet, "/api/get/audit_log", nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, r)
+		return recorder.Code
+	}
+
+	if status := request(token(t, db_handle, "standard@example.com")); status != http.StatusForbidden {
+		t.Errorf("role without the permission: status %d, want 403", status)
+	}
+
+	if status := request(token(t, db_handle, "admin@example.com")); status != http.StatusOK {
+		t.Errorf("role with the permission: status %d, want 200", status)
+	}
+
+	if status := request(""); status != http.StatusBadRequest {
+		t.Errorf("without token: status %d, want 400", status)
+	}
+
+	var denied int
+	err := db_handle.QueryRow(`SELECT COUNT(*) FROM audit_log WHERE action = 'access.denied' AND target = 'route:GET /api/get/audit_log'`).Scan(&denied)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if denied != 1 {
+		t.Errorf("%d refusals audited, want 1", denied)
+	}
+}
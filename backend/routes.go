@@ -0,0 +1,527 @@
+package main
+
+import (
+	"backend/api"
+	"backend/auth"
+	"backend/config"
+	"backend/db"
+	"backend/metrics"
+	"backend/ratelimit"
+	"backend/router"
+	"database/sql"
+	"net/http"
+	"time"
+)
+
+// uploadSettings returns the settings of resumable uploads.
+func uploadSettings(configuration config.Config) api.UploadSettings {
+	return api.UploadSettings{
+		Path:            configuration.UploadPath,
+		Expiry:          time.Duration(configuration.UploadExpiry) * time.Second,
+		FileSizeLimit:   configuration.FileSizeLimit,
+		LargeUploadSize: configuration.LargeUploadSize,
+	}
+}
+
+// Routes returns the route table of the backend.
+//
+// Every route declares its methods, its access level (router.PUBLIC, router.USER
+// or router.ADMIN) and optionally the permission the caller's role must grant
+// (db.PERMISSION_*) and the rate limit budget it counts against; authorization and
+// rate limits are enforced by the router before a handler runs.
+// Handlers of USER and ADMIN routes read the caller from router.Authorization.
+func Routes(db_handle *sql.DB, configuration config.Config) []router.Route {
+	var limits ratelimit.Limits = ratelimit.NewLimits(
+		configuration.AddressRateLimit,
+		configuration.LoginRateLimit,
+		configuration.InferenceRateLimit,
+		configuration.DeepThinkRateLimit,
+		configuration.UploadRateLimit,
+	)
+
+	var session_settings auth.SessionSettings = auth.SessionSettings{
+		AccessTokenLifetime:  configuration.AccessTokenLifetime,
+		RefreshTokenLifetime: configuration.RefreshTokenLifetime,
+		LoginLimit:           limits.Login,
+	}
+
+	var usage_settings api.UsageSettings = api.UsageSettings{
+		Limits:       limits,
+		Quota:        db.Quota{Daily: configuration.DailyQuota, Monthly: configuration.MonthlyQuota},
+		PremiumQuota: db.Quota{Daily: configuration.PremiumDailyQuota, Monthly: configuration.PremiumMonthlyQuota},
+	}
+
+	var upload_settings api.UploadSettings = uploadSettings(configuration)
+
+	var routes []router.Route = []router.Route{
+		// Authentication
+		{
+			Path: "/api/login", Methods: []string{"GET", "POST"}, Access: router.PUBLIC, RateLimit: limits.Address,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				auth.Login(db_handle, session_settings, w, r)
+			},
+		},
+		{
+			Path: "/api/auth/refresh", Methods: []string{"POST"}, Access: router.PUBLIC, RateLimit: limits.Address,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				auth.Refresh(db_handle, session_settings, w, r)
+			},
+		},
+		{
+			Path: "/api/auth/logout", Methods: []string{"POST"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				auth.Logout(db_handle, router.Authorization(r.Context()), w, r)
+			},
+		},
+		{
+			Path: "/api/post/signup", Methods: []string{"POST"}, Access: router.PUBLIC, RateLimit: limits.Address,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.HandleSignUpRequest(db_handle, w, r)
+			},
+		},
+
+		// Chat
+		{
+			Path: "/api/upload/message", Methods: []string{"POST"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.MessageUpload(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/message/inference", Methods: []string{"GET", "POST"}, Access: router.USER, RateLimit: limits.Inference,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.Inference(router.Authorization(r.Context()), db_handle, usage_settings, w, r)
+			},
+		},
+		{
+			Path: "/api/message/inference/stream", Methods: []string{"GET", "POST"}, Access: router.USER, RateLimit: limits.Inference,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.InferenceStream(router.Authorization(r.Context()), db_handle, usage_settings, w, r)
+			},
+		},
+		{
+			Path: "/api/get/history", Methods: []string{"GET"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetHistory(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/delete/chat", Methods: []string{"DELETE"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.DeleteChat(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/post/conversation", Methods: []string{"POST"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.CreateConversation(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/get/conversations", Methods: []string{"GET"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetConversations(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/update/conversation", Methods: []string{"PUT"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.RenameConversation(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/update/conversation_archive", Methods: []string{"PUT"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.ArchiveConversation(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/delete/conversation", Methods: []string{"DELETE"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.DeleteConversation(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+
+		// Documents
+		{
+			Path: "/api/upload/file", Methods: []string{"POST"}, Access: router.USER, Permission: db.PERMISSION_UPLOAD_DOCUMENTS, RateLimit: limits.Upload,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.FileUpload(db_handle, router.Authorization(r.Context()), upload_settings, w, r)
+			},
+		},
+		{
+			Path: "/api/upload/resumable", Methods: []string{"POST"}, Access: router.USER, Permission: db.PERMISSION_UPLOAD_DOCUMENTS, RateLimit: limits.Upload,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.CreateUpload(router.Authorization(r.Context()), db_handle, upload_settings, w, r)
+			},
+		},
+		{
+			Path: "/api/upload/resumable/{id}", Methods: []string{"HEAD"}, Access: router.USER, Permission: db.PERMISSION_UPLOAD_DOCUMENTS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.UploadStatus(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/upload/resumable/{id}", Methods: []string{"PATCH"}, Access: router.USER, Permission: db.PERMISSION_UPLOAD_DOCUMENTS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.AppendUpload(router.Authorization(r.Context()), db_handle, upload_settings, w, r)
+			},
+		},
+		{
+			Path: "/api/upload/resumable/{id}", Methods: []string{"DELETE"}, Access: router.USER, Permission: db.PERMISSION_UPLOAD_DOCUMENTS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.CancelUpload(router.Authorization(r.Context()), db_handle, upload_settings, w, r)
+			},
+		},
+		{
+			Path: "/api/documents/{id}/status", Methods: []string{"GET"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetDocumentStatus(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/documents/{sha256}/download", Methods: []string{"GET"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.DownloadDocument(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/documents/{sha256}/thumbnail", Methods: []string{"GET"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.DocumentThumbnail(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/get/documents", Methods: []string{"GET"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetDocuments(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/update/document_tags", Methods: []string{"PUT"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.UpdateDocumentTags(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/delete/document", Methods: []string{"DELETE"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.DeleteDocument(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/post/document_share", Methods: []string{"POST"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.ShareDocument(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/get/document_shares", Methods: []string{"GET"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetDocumentShares(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/delete/document_share", Methods: []string{"DELETE"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.RevokeDocumentShare(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/get/library_documents", Methods: []string{"GET"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetLibraryDocuments(db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/upload/library_document", Methods: []string{"POST"}, Access: router.USER, Permission: db.PERMISSION_MANAGE_LIBRARY, RateLimit: limits.Upload,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.LibraryUpload(router.Authorization(r.Context()), db_handle, upload_settings, w, r)
+			},
+		},
+		{
+			Path: "/api/delete/library_document", Methods: []string{"DELETE"}, Access: router.USER, Permission: db.PERMISSION_MANAGE_LIBRARY,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.DeleteLibraryDocument(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+
+		// Teams
+		{
+			Path: "/api/post/team", Methods: []string{"POST"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.CreateTeam(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/get/teams", Methods: []string{"GET"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetTeams(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/post/team_member", Methods: []string{"POST"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.AddTeamMember(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/delete/team_member", Methods: []string{"DELETE"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.RemoveTeamMember(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/delete/team", Methods: []string{"DELETE"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.DeleteTeam(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+
+		// User settings
+		{
+			Path: "/api/update/legal_libary", Methods: []string{"PUT"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.Legal_libary(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/get/legal_libary", Methods: []string{"GET"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetLegalLibary(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/update/local_only", Methods: []string{"PUT"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.Local_only(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/get/local_only", Methods: []string{"GET"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetLocalOnly(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/get/prompt", Methods: []string{"GET"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetPrompt(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/update/prompt", Methods: []string{"PUT"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.UpdatePrompt(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/get/prompt_history", Methods: []string{"GET"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetPromptHistory(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/get/prompt_diff", Methods: []string{"GET"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetPromptDiff(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/update/prompt_restore", Methods: []string{"PUT"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.RestorePrompt(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/get/default_prompt", Methods: []string{"GET"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetDefaultPrompt(w, r)
+			},
+		},
+		{
+			Path: "/api/get/my_models", Methods: []string{"GET"}, Access: router.USER,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetMyModels(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+
+		// Administration
+		{
+			Path: "/api/get/users", Methods: []string{"GET"}, Access: router.USER, Permission: db.PERMISSION_MANAGE_USERS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetUser(db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/update/promote_user", Methods: []string{"PUT"}, Access: router.USER, Permission: db.PERMISSION_MANAGE_USERS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.PromoteUser(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/delete/user", Methods: []string{"DELETE"}, Access: router.USER, Permission: db.PERMISSION_MANAGE_USERS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.DeleteUser(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/get/roles", Methods: []string{"GET"}, Access: router.USER, Permission: db.PERMISSION_MANAGE_USERS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetRoles(db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/update/user_role", Methods: []string{"PUT"}, Access: router.USER, Permission: db.PERMISSION_MANAGE_USERS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.UpdateUserRole(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/update/role_permissions", Methods: []string{"PUT"}, Access: router.USER, Permission: db.PERMISSION_MANAGE_USERS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.UpdateRolePermissions(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/delete/sessions", Methods: []string{"DELETE"}, Access: router.USER, Permission: db.PERMISSION_MANAGE_USERS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.RevokeSessions(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/get/usage", Methods: []string{"GET"}, Access: router.USER, Permission: db.PERMISSION_MANAGE_USERS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetUsage(db_handle, usage_settings, w, r)
+			},
+		},
+		{
+			Path: "/api/delete/usage", Methods: []string{"DELETE"}, Access: router.USER, Permission: db.PERMISSION_MANAGE_USERS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.ResetUsage(router.Authorization(r.Context()), db_handle, usage_settings, w, r)
+			},
+		},
+		{
+			Path: "/api/get/signup_request", Methods: []string{"GET"}, Access: router.USER, Permission: db.PERMISSION_MANAGE_USERS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetSignupRequests(db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/update/signup_request", Methods: []string{"PUT"}, Access: router.USER, Permission: db.PERMISSION_MANAGE_USERS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.AcceptSignupRequest(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/delete/signup_request", Methods: []string{"DELETE"}, Access: router.USER, Permission: db.PERMISSION_MANAGE_USERS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.DeleteSignupRequest(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/get/models", Methods: []string{"GET"}, Access: router.USER, Permission: db.PERMISSION_CHANGE_MODELS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetModels(w, r)
+			},
+		},
+		{
+			Path: "/api/get/current_model", Methods: []string{"GET"}, Access: router.USER, Permission: db.PERMISSION_CHANGE_MODELS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetCurrentModel(db_handle, w)
+			},
+		},
+		{
+			Path: "/api/update/model_selection", Methods: []string{"PUT"}, Access: router.USER, Permission: db.PERMISSION_CHANGE_MODELS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.UpdateModelSelection(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/get/model_selections", Methods: []string{"GET"}, Access: router.USER, Permission: db.PERMISSION_CHANGE_MODELS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetModelSelections(db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/delete/model_selection", Methods: []string{"DELETE"}, Access: router.USER, Permission: db.PERMISSION_CHANGE_MODELS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.DeleteModelSelection(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/get/providers", Methods: []string{"GET"}, Access: router.USER, Permission: db.PERMISSION_CHANGE_MODELS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetProviders(db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/post/provider", Methods: []string{"POST"}, Access: router.USER, Permission: db.PERMISSION_CHANGE_MODELS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.AddProvider(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/delete/provider", Methods: []string{"DELETE"}, Access: router.USER, Permission: db.PERMISSION_CHANGE_MODELS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.DeleteProvider(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/update/local_only_enforced", Methods: []string{"PUT"}, Access: router.USER, Permission: db.PERMISSION_CHANGE_MODELS,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.UpdateLocalOnlyEnforced(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/update/default_prompt", Methods: []string{"PUT"}, Access: router.USER, Permission: db.PERMISSION_EDIT_DEFAULT_PROMPT,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.UpdateDefaultPromt(router.Authorization(r.Context()), db_handle, configuration.DefaultPromptPath, w, r)
+			},
+		},
+		{
+			Path: "/api/get/default_prompt_history", Methods: []string{"GET"}, Access: router.USER, Permission: db.PERMISSION_EDIT_DEFAULT_PROMPT,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetDefaultPromptHistory(db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/get/default_prompt_diff", Methods: []string{"GET"}, Access: router.USER, Permission: db.PERMISSION_EDIT_DEFAULT_PROMPT,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetDefaultPromptDiff(db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/update/default_prompt_restore", Methods: []string{"PUT"}, Access: router.USER, Permission: db.PERMISSION_EDIT_DEFAULT_PROMPT,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.RestoreDefaultPrompt(router.Authorization(r.Context()), db_handle, configuration.DefaultPromptPath, w, r)
+			},
+		},
+
+		// Audit
+		{
+			Path: "/api/get/audit_log", Methods: []string{"GET"}, Access: router.USER, Permission: db.PERMISSION_VIEW_AUDIT_LOG,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.GetAuditLog(router.Authorization(r.Context()), db_handle, w, r)
+			},
+		},
+		{
+			Path: "/api/get/audit_log/verify", Methods: []string{"GET"}, Access: router.USER, Permission: db.PERMISSION_VIEW_AUDIT_LOG,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				api.VerifyAuditLog(db_handle, w, r)
+			},
+		},
+	}
+
+	// Monitoring, only with a token: the metrics are never served unauthenticated
+	if configuration.MetricsToken != "" {
+		routes = append(routes, router.Route{
+			Path: "/metrics", Methods: []string{"GET"}, Access: router.PUBLIC,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				metrics.Handle(configuration.MetricsToken, w, r)
+			},
+		})
+	}
+
+	return routes
+}
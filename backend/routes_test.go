@@ -0,0 +1,64 @@
+package main
+
+import (
+	"backend/config"
+	"backend/db"
+	"backend/router"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRoutesUseNamedPermissions(t *testing.T) {
+	for _, route := range Routes(nil, config.Default()) {
+		if route.Access == router.ADMIN {
+			t.Errorf("%s %v gates on the admin flag instead of a permission", route.Path, route.Methods)
+		}
+
+		if strings.HasPrefix(route.Path, "/api/upload/resumable") && route.Permission != db.PERMISSION_UPLOAD_DOCUMENTS {
+			t.Errorf("%s %v does not require %s", route.Path, route.Methods, db.PERMISSION_UPLOAD_DOCUMENTS)
+		}
+	}
+}
+
+func TestDefaultConfigurationBoots(t *testing.T) {
+	configuration, err := config.Load(filepath.Join(t.TempDir(), "config.json"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db_handle, err := db.SetupSqlite(filepath.Join(t.TempDir(), "test.db"), db.CreateAdmin("Admin", "Admin", "admin@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db_handle.Close() })
+
+	metrics := func(configuration config.Config, authorization string) int {
+		routes := router.NewRouter(db_handle)
+		routes.Register(Routes(db_handle, configuration)...)
+
+		request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		request.Header.Set("Authorization", authorization)
+
+		recorder := httptest.NewRecorder()
+		routes.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	// Without a token the metrics are not served at all
+	if status := metrics(configuration, ""); status != http.StatusNotFound {
+		t.Errorf("without token: status %d, want 404", status)
+	}
+
+	configuration.MetricsToken = "scrape"
+
+	if status := metrics(configuration, ""); status != http.StatusUnauthorized {
+		t.Errorf("token configured, none presented: status %d, want 401", status)
+	}
+
+	if status := metrics(configuration, "Bearer scrape"); status != http.StatusOK {
+		t.Errorf("token presented: status %d, want 200", status)
+	}
+}
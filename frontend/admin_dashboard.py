@@ -1,4 +1,5 @@
 import streamlit as st
+from datetime import datetime, timezone
 from requests import request, Response, RequestException, put
 from data import User
 from chatbot import GET_DEFAULT_PROMPT, get_prompt
@@ -10,14 +11,20 @@ REJECT_SIGNUP_REQUEST: str = "http://backend:8080/api/delete/signup_request"
 
 GET_USER: str = "http://backend:8080/api/get/users"
 PROMOTE_USER: str = "http://backend:8080/api/update/promote_user"
+UPDATE_USER_ROLE: str = "http://backend:8080/api/update/user_role"
 DELETE_USER: str = "http://backend:8080/api/delete/user"
 
 UPDATE_DEFAULT_PROMPT: str = "http://backend:8080/api/update/default_prompt"
 
+ROLES: list[str] = ["admin", "premium", "standard", "auditor", "read-only"]
+
 GET_MODELS: str = "http://backend:8080/api/get/models"
 GET_SELECTED_MODEL: str = "http://backend:8080/api/get/current_model"
 UPDATE_MODELS: str = "http://backend:8080/api/update/model_selection"
 
+GET_AUDIT_LOG: str = "http://backend:8080/api/get/audit_log"
+VERIFY_AUDIT_LOG: str = "http://backend:8080/api/get/audit_log/verify"
+
 @st.fragment
 def admin_dashboard(user: User):
     st.set_page_config(
@@ -39,11 +46,18 @@ def admin_dashboard(user: User):
             st.session_state["Admin Dashboard"] = True
             st.rerun()
 
-    manage_signups(jwt=user.get_jwt())
-    manage_users(jwt=user.get_jwt())
+    if user.has_permission("manage_users"):
+        manage_signups(jwt=user.get_jwt())
+        manage_users(jwt=user.get_jwt())
+
+    if user.has_permission("change_models"):
+        llm_selection(jwt=user.get_jwt())
 
-    llm_selection(jwt=user.get_jwt())
-    update_default_prompt(jwt=user.get_jwt())
+    if user.has_permission("edit_default_prompt"):
+        update_default_prompt(jwt=user.get_jwt())
+
+    if user.has_permission("view_audit_log"):
+        audit_log(jwt=user.get_jwt())
 
 @st.fragment
 def manage_signups(jwt: str):
@@ -203,6 +217,7 @@ def manage_users(jwt: str):
     {
         "Email": str,
         "IsAdmin": bool,
+        "Role": str
     }
     """
     users: list[dict[str, str | bool]] | None = response.json()
@@ -217,7 +232,7 @@ def manage_users(jwt: str):
         )
 
         for index, user in enumerate(users):
-            email, promote, delete = st.columns([3, 1, 1])
+            email, role, promote, delete = st.columns([3, 2, 1, 1])
 
             with email:
                 if user["IsAdmin"]:
@@ -225,6 +240,35 @@ def manage_users(jwt: str):
                 else:
                     st.write(user["Email"])
             
+            with role:
+                current_role: str | bool | None = user.get("Role", "standard")
+                selected_role: str | None = st.selectbox(
+                    label="Role",
+                    options=ROLES,
+                    index=ROLES.index(current_role) if current_role in ROLES else 0,
+                    key=f"{index}_user_role",
+                    label_visibility="collapsed"
+                )
+
+                if selected_role != None and selected_role != current_role:
+                    response: Response | None = execute_backend_operation(
+                        url=UPDATE_USER_ROLE,
+                        method="PUT",
+                        headers={"Authorization": jwt},
+                        json_payload={"Email": user["Email"], "Role": selected_role},
+                        data=None
+                    )
+
+                    if response == None:
+                        st.stop()
+                        return
+
+                    if response.status_code == 200:
+                        st.toast(f"{user["Email"]} is now {selected_role}")
+                    else:
+                        st.error(response.content.decode("utf-8"))
+                    st.rerun(scope="fragment")
+
             with promote:
                 if st.button(label="Promote", key=f"{index}_promote_user", disabled=user["IsAdmin"] == True):
                     user_email: str | bool | None = user.get("Email")
@@ -409,6 +453,72 @@ def update_default_prompt(jwt: str):
                 return
 
 
+def audit_log(jwt: str):
+    """
+    Shows the latest audit log entries, verifies the hash chain and offers the log as CSV download.
+    """
+    with st.expander(label="Audit Log"):
+        if st.button(label="Verify integrity"):
+            if response := execute_backend_operation(
+                url=VERIFY_AUDIT_LOG,
+                method="GET",
+                headers={"Authorization": jwt},
+                json_payload=None,
+                data=None
+            ):
+                if response.status_code != 200:
+                    st.error(response.content.decode("utf-8"))
+                elif response.json()["Valid"]:
+                    st.success(f"All {response.json()["Entries"]} entries are intact")
+                else:
+                    st.error(f"Audit log has been tampered with: {response.json()["Reason"]}")
+
+        response: Response | None = execute_backend_operation(
+            url=f"{GET_AUDIT_LOG}?per_page=50",
+            method="GET",
+            headers={"Authorization": jwt},
+            json_payload=None,
+            data=None
+        )
+
+        if response is None or response.status_code != 200:
+            st.error("Failed to load the audit log")
+            return
+
+        st.dataframe(
+            [
+                {
+                    "Time": datetime.fromtimestamp(entry["CreatedAt"], tz=timezone.utc),
+                    "Actor": entry["Actor"],
+                    "Action": entry["Action"],
+                    "Target": entry["Target"],
+                    "Source IP": entry["SourceIP"],
+                    "Outcome": entry["Outcome"],
+                }
+                for entry in response.json()
+            ],
+            use_container_width=True
+        )
+
+        if st.button(label="Prepare CSV export"):
+            if export := execute_backend_operation(
+                url=f"{GET_AUDIT_LOG}?format=csv&order=asc",
+                method="GET",
+                headers={"Authorization": jwt},
+                json_payload=None,
+                data=None
+            ):
+                if export.status_code != 200:
+                    st.error(export.content.decode("utf-8"))
+                else:
+                    st.download_button(
+                        label="Download CSV",
+                        data=export.content,
+                        file_name="audit_log.csv",
+                        mime="text/csv"
+                    )
+
+
 def execute_backend_operation(
         url: str, 
         method: str, 
@@ -46,7 +46,7 @@ def chatbot():
     with st.sidebar:
         st.title(f"Welcome {user.get_username()}")
 
-        file = st.file_uploader(label="Provide context for your AI-Agent", type="pdf")
+        file = st.file_uploader(label="Provide context for your AI-Agent", type=["pdf", "docx", "txt", "md", "html", "htm", "eml"])
         if file:
             if not TEMPORARY_FILE_PATH.exists():
                 mkdir(TEMPORARY_FILE_PATH)
@@ -63,10 +63,10 @@ def chatbot():
                     }
                     response: Response = post(url=FILE_UPLOAD, data=f, headers=headers)
 
-                    if response.status_code != 200:
+                    if response.status_code != 202:
                         st.warning(f"File upload failed: {response.content.decode("utf-8")}")
                     else:
-                        st.toast(f"Succesfully uploaded {file.name}")
+                        st.toast(f"Succesfully uploaded {file.name}, it is being processed")
                 except RequestException as e:
                     st.error(f"Upload failed with: {e}")
                 finally:
@@ -84,7 +84,9 @@ def chatbot():
                             st.write(document["OriginalName"])
 
                         with delete:
-                            if st.button(label="Delete", key=f"{index}_delete_documents"):
+                            if document.get("Access", "owner") != "owner":
+                                st.caption(f"Shared by {document['Owner']}")
+                            elif st.button(label="Delete", key=f"{index}_delete_documents"):
                                 try:
                                     response: Response = request(
                                         url=DELETE_DOCUMENT,
@@ -149,11 +151,12 @@ def chatbot():
         )
 
         # Preprompt Field
-        st.checkbox(
-            label="Deep Think",
-            value=user.is_deep_think(),
-            on_change= lambda: user.set_deep_think(not user.is_deep_think())
-        )
+        if user.has_permission("use_deep_think"):
+            st.checkbox(
+                label="Deep Think",
+                value=user.is_deep_think(),
+                on_change= lambda: user.set_deep_think(not user.is_deep_think())
+            )
 
         with st.expander(label="Go Online"):
             for label, link in ONLINE_SERVICE_PROVIDERS:
@@ -197,7 +200,7 @@ def chatbot():
                     st.write(current_prompt)
 
 
-        if user.is_admin():
+        if user.is_admin() or user.has_permission("view_audit_log"):
             st.divider()
             if st.button("Admin Dashboard"):
                 st.session_state["Admin Dashboard"] = True
@@ -429,24 +432,38 @@ def get_documents(url: str, jwt: str) -> list[dict[str, str]] | None:
     """
     Retrieves the documents for a given user.
 
+    The backend pages the list, all pages are fetched.
     If the request does not fail, it will return a list of JSON-Objects:
 
     {
         "OriginalName": str
         "StorageName": str
+        "Title": str
+        "Owner": str
+        "Access": str ("owner" for own documents, else the share permission)
+        ...
     }
 
     If the request fails, it will return None
     """
     try:
-        response: Response = get(url=url, headers={"Authorization": jwt})
+        documents: list[dict[str, str]] = []
+        page: int = 1
 
-        if response.status_code != 200:
-            st.error(f"Request failed with: {response.content.decode("utf-8")}")
-            return None
-        
-        documents: list[dict[str, str]] = response.json()
-        return documents
+        while True:
+            response: Response = get(url=url, params={"page": page, "per_page": 200}, headers={"Authorization": jwt})
+
+            if response.status_code != 200:
+                st.error(f"Request failed with: {response.content.decode("utf-8")}")
+                return None
+
+            batch: list[dict[str, str]] = response.json()
+            documents.extend(batch)
+
+            if not batch or len(documents) >= int(response.headers.get("X-Total-Count", 0)):
+                return documents
+
+            page += 1
     except RequestException as e:
         st.error(f"Failed to send with {e}")
         return None
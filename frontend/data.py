@@ -1,4 +1,10 @@
 from enum import IntEnum
+from base64 import urlsafe_b64decode
+from json import loads
+from time import time
+from requests import post, RequestException, Response
+
+REFRESH: str = "http://backend:8080/api/auth/refresh"
 
 class Kind(IntEnum):
     AI = 0
@@ -36,12 +42,15 @@ class User:
     """
     Defines the entire state of a User. A User needs to have
     """
-    def __init__(self, username: str, jwt: str, is_premium: bool, is_admin: bool, *, local_only: bool = True) -> None:
+    def __init__(self, username: str, jwt: str, refresh_token: str, is_premium: bool, is_admin: bool, *, role: str = "standard", permissions: list[str] | None = None, local_only: bool = False) -> None:
         self._messages: list[Message] = []
         self._username: str = username
         self._jwt: str = jwt
+        self._refresh_token: str = refresh_token
         self._is_premium: bool = is_premium
         self._is_admin: bool = is_admin
+        self._role: str = role
+        self._permissions: list[str] = permissions or []
         self._local_only: bool = local_only
         self._prompt: Prompt = Prompt(0)
         self._legal_libary: bool = False
@@ -51,7 +60,32 @@ class User:
         return self._username
     
     def get_jwt(self) -> str:
+        """
+        Returns the access token, exchanging the refresh token for a new
+        token pair shortly before the access token expires.
+        """
+        if self._expires_at() - 60 < time():
+            self._refresh()
         return self._jwt
+
+    def _expires_at(self) -> float:
+        try:
+            payload: str = self._jwt.split(".")[1]
+            claims: dict = loads(urlsafe_b64decode(payload + "=" * (-len(payload) % 4)))
+            return float(claims["exp"])
+        except (IndexError, KeyError, ValueError):
+            return 0.0
+
+    def _refresh(self):
+        try:
+            response: Response = post(url=REFRESH, json={"RefreshToken": self._refresh_token})
+        except RequestException:
+            return
+
+        if response.status_code == 200:
+            payload: dict = response.json()
+            self._jwt = payload["JWTToken"]
+            self._refresh_token = payload["RefreshToken"]
     
     def get_prompt(self) -> Prompt:
         return self._prompt
@@ -67,6 +101,16 @@ class User:
     
     def is_admin(self) -> bool:
         return self._is_admin
+
+    def get_role(self) -> str:
+        return self._role
+
+    def has_permission(self, permission: str) -> bool:
+        """
+        Whether the role grants a permission, e.g. "use_deep_think".
+        Only decides what is shown, the backend checks every request.
+        """
+        return permission in self._permissions
     
     def set_prompt(self, new: Prompt):
         self._prompt = new
@@ -3,6 +3,8 @@ from data import User
 import streamlit as st
 
 LOGIN: str = "http://backend:8080/api/login"
+GET_LEGAL_LIBARY: str = "http://backend:8080/api/get/legal_libary"
+GET_LOCAL_ONLY: str = "http://backend:8080/api/get/local_only"
 
 def login():
     """
@@ -28,8 +30,11 @@ def login():
     {
         "Username": str,
         "JWTToken": str,
+        "RefreshToken": str,
         "IsPremium": bool,
-        "IsAdmin": bool
+        "IsAdmin": bool,
+        "Role": str,
+        "Permissions": list[str]
     }
     ```
 
@@ -63,10 +68,30 @@ def login():
                     st.session_state.user = User(
                         username=payload["Username"],
                         jwt=payload["JWTToken"],
+                        refresh_token=payload["RefreshToken"],
                         is_premium=payload["IsPremium"],
-                        is_admin=payload["IsAdmin"]
+                        is_admin=payload["IsAdmin"],
+                        role=payload.get("Role", "standard"),
+                        permissions=payload.get("Permissions", [])
                     )
+                    load_settings(st.session_state.user)
                     st.session_state.auth_page = 'main'
                     st.rerun()
             except RequestException as e:
-                st.error(f"Login failed: {str(e)}")
\ No newline at end of file
+                st.error(f"Login failed: {str(e)}")
+
+
+def load_settings(user: User):
+    """
+    Restores the settings persisted in the backend, so switches keep their state across logins.
+    """
+    try:
+        response: Response = get(url=GET_LEGAL_LIBARY, headers={"Authorization": user.get_jwt()})
+        if response.status_code == 200:
+            user.set_legal_libary(response.json()["Legal_library"])
+
+        response = get(url=GET_LOCAL_ONLY, headers={"Authorization": user.get_jwt()})
+        if response.status_code == 200:
+            user.set_local(response.json()["Local_only"])
+    except RequestException:
+        pass
@@ -115,6 +115,46 @@ impl Chunk {
     }
 
 
+    /// Copies the chunks of a processed document to another owner.
+    ///
+    /// Identical documents uploaded by several users are embedded once, later
+    /// uploads receive copies of the chunks under their own ID, title and storage name.
+    ///
+    /// # Returns
+    /// The number of copied chunks, 0 if the source has none.
+    pub async fn copy(
+        db: &Database<Init>,
+        source_id: i64,
+        source_name: String,
+        id: i64,
+        title: String,
+        storage_name: String
+    ) -> Result<usize, ChunkError> {
+        let mut response: Response = db.db.query("
+        SELECT user_id, title, content, embedding, filename FROM chunks
+        WHERE user_id = $user_id AND filename = $storage_name
+        ")
+        .bind(("user_id", source_id))
+        .bind(("storage_name", source_name))
+        .await.map_err(|err| ChunkError::DBError(Box::new(err)))?;
+
+        let mut chunks: Vec<Self> = response.take(0)
+        .map_err(|err| ChunkError::DBError(Box::new(err)))?;
+
+        for chunk in chunks.iter_mut() {
+            chunk.user_id = id;
+            chunk.title = title.clone();
+            chunk.filename = storage_name.clone();
+        }
+
+        for batch in chunks.chunks(40) {
+            Self::write_bulk(db, batch.to_vec()).await?;
+        }
+
+        Ok(chunks.len())
+    }
+
+
     pub async fn delete(db: &Database<Init>, id: i64, storage_name: String) -> Result<(), ChunkError> {
         db.db.query("
         DELETE chunks WHERE user_id = $user_id AND filename = $storage_name
@@ -128,6 +168,19 @@ impl Chunk {
 
 }
 
+/// A document of another user that the requesting user may retrieve from.
+///
+/// Sent by the backend with every inference request, the backend decides which
+/// shares grant retrieval. Documents of the shared legal library have owner 0,
+/// they are sent if the user opted into the library.
+#[derive(Serialize, Deserialize, Debug, Clone)]
+pub struct SharedDocument {
+    #[serde(rename="OwnerID")]
+    pub owner_id: i64,
+    #[serde(rename="StorageName")]
+    pub storage_name: String,
+}
+
 #[allow(dead_code)]
 #[derive(Deserialize, Debug)]
 pub struct ChunkRecord {
@@ -140,19 +193,26 @@ impl ChunkRecord {
     const GEOMETRIC_SEARCH: &str = r#"
         SELECT *, vector::similarity::cosine(embedding, $embedding) AS similarity
         FROM chunks
-        WHERE user_id = $user_id AND embedding <|100|> $embedding 
+        WHERE (user_id = $user_id OR [user_id, filename] INSIDE $shared) AND embedding <|100|> $embedding 
         ORDER BY similarity DESC
         LIMIT 20;
     "#;
 
+    /// Searches the chunks of the user's own documents and of the documents shared with the user.
     pub async fn most_related(
         db: &Database<Init>,
         user_id: i64,
+        shared: &[SharedDocument],
         embedding: Arc<Vec<f32>>
     ) -> Result<Vec<Self>, ChunkError> {
+        let shared: Vec<(i64, String)> = shared.iter()
+            .map(|document| (document.owner_id, document.storage_name.clone()))
+            .collect();
+
         let mut response: Response = db.db.query(Self::GEOMETRIC_SEARCH)
             .bind(("embedding", embedding))
             .bind(("user_id", user_id))
+            .bind(("shared", shared))
             .await.map_err(|err| ChunkError::DBError(Box::new(err)))?;
         
         let records: Vec<Self> = response.take(0)
@@ -166,7 +226,8 @@ impl ChunkRecord {
 #[cfg(test)]
 mod chunking {
     use std::{sync::Arc, time::Instant};
-    use crate::db::{Chunk, ChunkRecord, Database, Init, DATABASE_CONNECTION, EMBEDDING_DIMENSION};
+    use rand::random;
+    use crate::db::{Chunk, ChunkRecord, Database, Init, SharedDocument, DATABASE_CONNECTION, EMBEDDING_DIMENSION};
 
     #[tokio::test]
     async fn test_insertion() {
@@ -187,9 +248,47 @@ mod chunking {
         let response: Vec<ChunkRecord> = ChunkRecord::most_related(
             &db, 
             1,
+            &[],
             Arc::new(vec![0.5; EMBEDDING_DIMENSION])
         ).await.unwrap();
 
         assert_eq!(response.len(), 10);
     }
-}
\ No newline at end of file
+
+    #[tokio::test]
+    async fn test_library_retrieval() {
+        let db: Database<Init> = Database::init_db(&*DATABASE_CONNECTION).await.unwrap();
+
+        let user_id: i64 = random::<u32>() as i64 + 1;
+        let storage_name: String = format!("library-{user_id}.pdf");
+        let title: String = format!("Library {user_id}");
+
+        // Distinct from the embeddings of the other tests, so the chunk is the nearest neighbour
+        let embedding: Vec<f32> = (0..EMBEDDING_DIMENSION)
+            .map(|i| if i % 2 == 0 { 0.9 } else { -0.3 })
+            .collect();
+
+        // Library documents are filed under collection 0
+        Chunk::new(0, title.clone(), "Statute".to_string(), embedding.clone(), storage_name.clone())
+        .unwrap().write(&db).await.unwrap();
+
+        let without_library: Vec<ChunkRecord> = ChunkRecord::most_related(
+            &db,
+            user_id,
+            &[],
+            Arc::new(embedding.clone())
+        ).await.unwrap();
+
+        assert!(without_library.iter().all(|record| record.title != title));
+
+        let library: [SharedDocument; 1] = [SharedDocument { owner_id: 0, storage_name }];
+        let with_library: Vec<ChunkRecord> = ChunkRecord::most_related(
+            &db,
+            user_id,
+            &library,
+            Arc::new(embedding)
+        ).await.unwrap();
+
+        assert!(with_library.iter().any(|record| record.title == title));
+    }
+}
@@ -2,7 +2,7 @@ use std::sync::Arc;
 
 use axum::{extract::State, http::{HeaderMap, StatusCode}, response::IntoResponse};
 use crate::{
-    db::{delete_message, Chunk, ChunkError}, 
+    db::{delete_user_messages, Chunk, ChunkError}, 
     extract_header, AppState, HeaderError
 };
 
@@ -32,7 +32,7 @@ pub async fn delete_user(
     .map_err(|err| DeleteUser::IDHeader(err))?;
 
 
-    delete_message(&app_state.db, id)
+    delete_user_messages(&app_state.db, id)
     .await.map_err(|err| DeleteUser::DBError(err))?;
 
     Chunk::delete_all(&app_state.db, id)
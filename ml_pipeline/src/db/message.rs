@@ -21,9 +21,13 @@ impl Display for Kind {
 }
 
 /// This struct can be written to the db
+///
+/// conversation_id is the conversation of the user the message belongs to,
+/// 0 for the legacy single chat.
 #[derive(Debug, Deserialize, Serialize)]
 pub struct MessageRecord {
     pub user_id: i64,
+    pub conversation_id: i64,
     pub kind: Kind,
     pub message: String,
     pub embedding: Vec<f32>,
@@ -38,11 +42,12 @@ pub struct MessageHistoryRecord {
 impl MessageRecord {
     pub const fn new(
         user_id: i64, 
+        conversation_id: i64,
         kind: Kind, 
         message: String, 
         embedding: Vec<f32>
     ) -> Self {
-        Self { user_id, kind, message, embedding }
+        Self { user_id, conversation_id, kind, message, embedding }
     }
 }
 
@@ -61,7 +66,18 @@ pub async fn write_message(
     Ok(())
 }
 
-pub async fn delete_message(db: &Database<Init>, user_id: i64) -> Result<(), DBError> {
+/// Deletes the history of one conversation of a user
+pub async fn delete_message(db: &Database<Init>, user_id: i64, conversation_id: i64) -> Result<(), DBError> {
+    db.db.query("DELETE FROM message WHERE user_id = $user_id AND conversation_id = $conversation_id;")
+    .bind(("user_id", user_id))
+    .bind(("conversation_id", conversation_id))
+    .await?;
+
+    Ok(())
+}
+
+/// Deletes the messages of every conversation of a user
+pub async fn delete_user_messages(db: &Database<Init>, user_id: i64) -> Result<(), DBError> {
     db.db.query("DELETE FROM message WHERE user_id = $user_id;")
     .bind(("user_id", user_id))
     .await?;
@@ -82,6 +98,7 @@ pub struct MessageRecordDB {
 pub async fn related_messages(
     db: &Database<Init>,
     user_id: i64,
+    conversation_id: i64,
     embedding: Arc<Vec<f32>>
 ) -> Result<Vec<MessageRecordDB>, DBError> {
     let query: &str = r#"
@@ -92,36 +109,39 @@ pub async fn related_messages(
             embedding,
             vector::similarity::cosine(embedding, $embedding) AS combined_score
         FROM message
-        WHERE user_id = $user_id AND embedding <|10|> $embedding
+        WHERE user_id = $user_id AND conversation_id = $conversation_id AND embedding <|10|> $embedding
         ORDER BY combined_score DESC
     "#;
 
     db.db.query(query)
     .bind(("embedding", embedding))
     .bind(("user_id", user_id))
+    .bind(("conversation_id", conversation_id))
     .await?.take(0)
 }
 
-pub async fn get_history(db: &Database<Init>, user_id: i64) -> Result<Vec<MessageHistoryRecord>, DBError> {
+pub async fn get_history(db: &Database<Init>, user_id: i64, conversation_id: i64) -> Result<Vec<MessageHistoryRecord>, DBError> {
     const QUERY_HISTORY: &str = "
-    SELECT kind, message, creation FROM message WHERE user_id = $user_id
+    SELECT kind, message, creation FROM message WHERE user_id = $user_id AND conversation_id = $conversation_id
     ORDER BY creation ASC
     ";
 
     db.db.query(QUERY_HISTORY)
     .bind(("user_id", user_id))
+    .bind(("conversation_id", conversation_id))
     .await?.take(0)
 }
 
-pub async fn get_last_10(db: &Database<Init>, user_id: i64) -> Result<Vec<MessageHistoryRecord>, DBError> {
+pub async fn get_last_10(db: &Database<Init>, user_id: i64, conversation_id: i64) -> Result<Vec<MessageHistoryRecord>, DBError> {
     const QUERY_HISTORY: &str = "
-    SELECT kind, message, creation FROM message WHERE user_id = $user_id
+    SELECT kind, message, creation FROM message WHERE user_id = $user_id AND conversation_id = $conversation_id
     ORDER BY creation ASC
     LIMIT 10;
     ";
 
     db.db.query(QUERY_HISTORY)
     .bind(("user_id", user_id))
+    .bind(("conversation_id", conversation_id))
     .await?.take(0)
 }
 
@@ -132,7 +152,8 @@ mod message {
     use std::sync::Arc;
 
     use crate::db::{
-        related_messages, write_message, Database, Init, Kind, MessageRecord, MessageRecordDB, DATABASE_CONNECTION, EMBEDDING_DIMENSION
+        delete_message, get_history, related_messages, write_message, Database, Init, Kind,
+        MessageHistoryRecord, MessageRecord, MessageRecordDB, DATABASE_CONNECTION, EMBEDDING_DIMENSION
     };
 
     #[tokio::test]
@@ -144,6 +165,7 @@ mod message {
             message: String::from("Hallo Welt"),
             embedding: vec![0.0; EMBEDDING_DIMENSION as usize],
             user_id: 1,
+            conversation_id: 0,
         }).await;
 
         assert!(res.is_ok());
@@ -173,12 +195,14 @@ mod message {
                 message: format!("C{}M{}", cluster_idx, i),
                 embedding,
                 user_id: 1,
+                conversation_id: 0,
             }).await.unwrap();
         }
 
         let neighbours: Vec<MessageRecordDB> = related_messages(
             &db,
             1,
+            0,
             Arc::new(std::iter::repeat_n(random::<f32>(), EMBEDDING_DIMENSION).collect())
         ).await.unwrap();
 
@@ -190,4 +214,43 @@ mod message {
             })
         );
     }
-}
\ No newline at end of file
+
+    #[tokio::test]
+    async fn test_conversation_isolation() {
+        let db: Database<Init> = Database::init_db(&*DATABASE_CONNECTION).await.unwrap();
+        let user_id: i64 = random::<u32>() as i64;
+
+        for (conversation_id, text) in [(1, "First conversation"), (2, "Second conversation")] {
+            write_message(&db, MessageRecord::new(
+                user_id,
+                conversation_id,
+                Kind::User,
+                text.to_string(),
+                vec![0.5; EMBEDDING_DIMENSION]
+            )).await.unwrap();
+        }
+
+        let first: Vec<MessageHistoryRecord> = get_history(&db, user_id, 1).await.unwrap();
+        let second: Vec<MessageHistoryRecord> = get_history(&db, user_id, 2).await.unwrap();
+
+        assert_eq!(first.len(), 1);
+        assert_eq!(first[0].message, "First conversation");
+        assert_eq!(second.len(), 1);
+        assert_eq!(second[0].message, "Second conversation");
+
+        let related: Vec<MessageRecordDB> = related_messages(
+            &db,
+            user_id,
+            1,
+            Arc::new(vec![0.5; EMBEDDING_DIMENSION])
+        ).await.unwrap();
+
+        assert!(related.iter().all(|message| message.message == "First conversation"));
+
+        // Deleting one conversation keeps the others
+        delete_message(&db, user_id, 1).await.unwrap();
+
+        assert!(get_history(&db, user_id, 1).await.unwrap().is_empty());
+        assert_eq!(get_history(&db, user_id, 2).await.unwrap().len(), 1);
+    }
+}
@@ -43,12 +43,16 @@ impl Database<Uninit> {
                 FOR delete WHERE user = $auth.id;
 
             DEFINE FIELD IF NOT EXISTS user_id ON TABLE message TYPE int;
+            DEFINE FIELD IF NOT EXISTS conversation_id ON TABLE message TYPE int DEFAULT 0;
             DEFINE FIELD IF NOT EXISTS kind ON TABLE message TYPE int;
             DEFINE FIELD IF NOT EXISTS message ON TABLE message TYPE string;
             DEFINE FIELD IF NOT EXISTS embedding ON TABLE message TYPE array<float, {EMBEDDING_DIMENSION}>;
             DEFINE FIELD IF NOT EXISTS creation ON TABLE message TYPE datetime DEFAULT time::now();
             DEFINE INDEX IF NOT EXISTS embedding_idx ON TABLE message COLUMNS embedding MTREE DIMENSION {EMBEDDING_DIMENSION} DIST COSINE CONCURRENTLY;
 
+            -- Messages stored before conversations existed belong to the legacy chat
+            UPDATE message SET conversation_id = 0 WHERE conversation_id = NONE;
+
             -- Define Full-Text-Search Analyzer to search for similar or matching keywords
             DEFINE ANALYZER IF NOT EXISTS message_fts_global TOKENIZERS class FILTERS lowercase, ascii;
 
@@ -0,0 +1,68 @@
+use std::sync::Arc;
+use axum::{
+    extract::State,
+    http::{HeaderMap, StatusCode},
+    response::{IntoResponse, Response},
+};
+
+use tracing::{instrument, error};
+
+use crate::{db::Chunk, extract_header, files::File, AppState};
+
+/// Files a copy of an already processed document under another ID without
+/// embedding it again. Used by the backend to deduplicate identical uploads.
+///
+/// Expects headers
+///     - ID: Owner of the copy
+///     - Title: Title of the copy
+///     - X-Filename: Storage name of the copy (`<id>/<name>`)
+///     - Source: Storage name of the processed document (`<id>/<name>`)
+///
+/// Answers 404 if the source has no chunks, the backend then uploads the document instead.
+#[instrument(skip_all)]
+pub async fn link_document(
+    headers: HeaderMap,
+    State(state): State<Arc<AppState>>
+) -> Response {
+    let id: i64 = match extract_header(&headers, "ID") {
+        Ok(id) => id,
+        Err(err) => return err.into_response()
+    };
+    let title: String = match extract_header(&headers, "Title") {
+        Ok(title) => title,
+        Err(err) => return err.into_response()
+    };
+    let source: String = match extract_header(&headers, "Source") {
+        Ok(source) => source,
+        Err(err) => return err.into_response()
+    };
+
+    let Some(source_id) = source.split_once('/').and_then(|(id, _)| id.parse::<i64>().ok()) else {
+        return (StatusCode::BAD_REQUEST, "Malformed Source header").into_response()
+    };
+
+    let file: File = match File::from_request(&headers, &[]) {
+        Ok(file) => file,
+        Err(_) => return (StatusCode::BAD_REQUEST, "Malformed X-Filename header").into_response()
+    };
+    let storage_name: String = file.get_filename().to_string();
+
+    let copied: usize = match Chunk::copy(&state.db, source_id, source.clone(), id, title, storage_name.clone()).await {
+        Ok(copied) => copied,
+        Err(err) => {
+            error!("Failed to copy chunks: {err:?}");
+            return (StatusCode::INTERNAL_SERVER_ERROR, "Failed to copy chunks").into_response()
+        }
+    };
+
+    if copied == 0 {
+        return (StatusCode::NOT_FOUND, "Source document not found").into_response()
+    }
+
+    if let Err(err) = state.filesystem.copy(&source, &storage_name).await {
+        error!("Failed to copy file: {err:?}");
+        return (StatusCode::INTERNAL_SERVER_ERROR, "Failed to copy file").into_response()
+    }
+
+    (StatusCode::OK, "NICE").into_response()
+}
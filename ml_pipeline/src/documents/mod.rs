@@ -1,6 +1,10 @@
 mod normalization;
 mod process_pdf;
+mod process_text;
 mod chunk_text;
 mod delete;
+mod link;
 pub use process_pdf::process_pdf;
-pub use delete::delete_documents;
\ No newline at end of file
+pub use process_text::process_text;
+pub use delete::delete_documents;
+pub use link::link_document;
\ No newline at end of file
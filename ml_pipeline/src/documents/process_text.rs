@@ -0,0 +1,93 @@
+use std::sync::Arc;
+use axum::{
+    body::Bytes, 
+    extract::State, 
+    http::{self, HeaderMap}, response::IntoResponse,
+};
+
+use tokio::task::spawn_blocking;
+use tracing::{instrument, error};
+
+use crate::{
+    db::Chunk, documents::{
+        chunk_text::{Chunker, FixedSizeOverlap}, normalization::normalize,
+    }, extract_header, files::File, AppState
+};
+
+/// Processes a document whose text was already extracted by the backend
+/// (Word documents, emails, HTML, plain text and Markdown).
+///
+/// Expects the same headers as [`process_pdf`](super::process_pdf) and the
+/// UTF-8 encoded text as body. The text is stored as the document's file.
+///
+/// # Responses
+/// - `400 Bad Request`: `ID`, `Title` or `X-Filename` header missing or malformed, body not UTF-8
+/// - `500 Internal Server Error`: Embedding or storing the document failed
+#[instrument(skip_all)]
+pub async fn process_text(
+    headers: HeaderMap,
+    State(state): State<Arc<AppState>>,
+    body: Bytes
+) -> impl IntoResponse {
+    let Ok(id) = extract_header::<i64>(&headers, "ID") else {
+        return (http::StatusCode::BAD_REQUEST, "ID header missing or not a number")
+    };
+    let Ok(title) = extract_header::<String>(&headers, "Title") else {
+        return (http::StatusCode::BAD_REQUEST, "Title header missing or invalid")
+    };
+
+    let Ok(file) = File::from_request(&headers, &body) else {
+        return (http::StatusCode::BAD_REQUEST, "X-Filename header missing or malformed")
+    };
+    let Ok(text) = std::str::from_utf8(file.get_content()) else {
+        return (http::StatusCode::BAD_REQUEST, "Text must be UTF-8 encoded")
+    };
+    let text: String = text.to_string();
+    let storage_name: String = file.get_filename().to_string();
+
+    let cloned_state: Arc<AppState> = state.clone();
+
+    let chunks: Result<Vec<Chunk>, String> = spawn_blocking(move || {
+        let normalized_text: String = normalize(text, &[]);
+
+        let chunker: FixedSizeOverlap::<1000, 100> = FixedSizeOverlap::new(&normalized_text);
+        let text: Vec<&str> = chunker.chunks().collect();
+
+        let mut chunks: Vec<Chunk> = Vec::with_capacity(text.len());
+
+        for batch in text.chunks(16) {
+            let embedding: Vec<Vec<f32>> = state.embedder.embed(batch.to_vec(), Some(16))
+            .map_err(|err| format!("{err:?}"))?;
+
+            for (c, e) in batch.iter().zip(embedding) {
+                let chunk: Chunk = Chunk::new(id, title.clone(), c.to_string(), e, storage_name.clone())
+                .map_err(|err| format!("{err:?}"))?;
+                chunks.push(chunk);
+            }
+        }
+
+        Ok(chunks)
+    }).await.unwrap_or_else(|err| Err(format!("{err:?}")));
+
+    let chunks: Vec<Chunk> = match chunks {
+        Ok(chunks) => chunks,
+        Err(err) => {
+            error!("Failed to embed document: {err}");
+            return (http::StatusCode::INTERNAL_SERVER_ERROR, "Failed to embed document")
+        }
+    };
+
+    if let Err(err) = cloned_state.filesystem.write(&file).await {
+        error!("Failed to save file: {err:?}");
+        return (http::StatusCode::INTERNAL_SERVER_ERROR, "Failed to save file")
+    }
+
+    for batch in chunks.chunks(40) {
+        if let Err(err) = Chunk::write_bulk(&cloned_state.db, batch.to_vec()).await {
+            error!("Failed to store chunks: {err:?}");
+            return (http::StatusCode::INTERNAL_SERVER_ERROR, "Failed to store chunks")
+        }
+    }
+
+    (http::StatusCode::OK, "NICE")
+}
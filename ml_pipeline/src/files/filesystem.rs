@@ -82,6 +82,21 @@ impl Filesystem<Init> {
     }
 
 
+    /// Copies a stored file to another `<id>/<name>` path, creating its parent directory.
+    pub async fn copy(&self, source: &str, target: &str) -> io::Result<()> {
+        let target_path: PathBuf = BASE_PATH.join(target);
+        let parent_dir: &Path = target_path.parent()
+        .ok_or_else(|| io::Error::new(
+            io::ErrorKind::InvalidInput,
+             "Filename must contain a parent directory"
+            )
+        )?;
+
+        tokio::fs::create_dir_all(parent_dir).await?;
+        tokio::fs::copy(BASE_PATH.join(source), target_path).await?;
+        Ok(())
+    }
+
     pub async fn remove_user(&self, user_id: i64) -> io::Result<()> {
         remove_dir_all(BASE_PATH.join(user_id.to_string())).await
     }
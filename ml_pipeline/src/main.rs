@@ -9,7 +9,7 @@ use tokio::{
 };
 
 use ml_pipeline::{
-    db::{delete_user, Database, Init, DATABASE_CONNECTION}, documents::{delete_documents, process_pdf}, files::{Filesystem, Init as FSInit}, init_rake, message::{delete_message, history, inference, upload_message}, AppState
+    db::{delete_user, Database, Init, DATABASE_CONNECTION}, documents::{delete_documents, link_document, process_pdf, process_text}, files::{Filesystem, Init as FSInit}, init_rake, message::{delete_message, history, inference, upload_message}, AppState
 };
 
 use tower_http::trace::TraceLayer;
@@ -56,6 +56,9 @@ async fn entrypoint() {
     let router: Router = Router::new()
     .route("/api/document/upload", post(process_pdf))
     .layer(DefaultBodyLimit::max(200 << 20))
+    .route("/api/document/upload_text", post(process_text))
+    .layer(DefaultBodyLimit::max(200 << 20))
+    .route("/api/document/link", post(link_document))
     .route("/api/message/upload", post(upload_message))
     .with_state(app_state.clone())
     .route("/api/message/delete", delete(delete_message))
@@ -5,7 +5,7 @@ use surrealdb::Error;
 
 use crate::{
     db::delete_message as delete,
-    message::{extract_id, MessageError}, AppState
+    message::{extract_conversation, extract_id, MessageError}, AppState
 };
 
 pub enum MessageDeletionError {
@@ -33,7 +33,10 @@ pub async fn delete_message(
     let id: i64 = extract_id(&headers)
     .map_err(|err| MessageDeletionError::HeaderError(err))?;
 
-    delete(&state.db, id).await
+    let conversation_id: i64 = extract_conversation(&headers)
+    .map_err(|err| MessageDeletionError::HeaderError(err))?;
+
+    delete(&state.db, id, conversation_id).await
     .map_err(|err| MessageDeletionError::DBError(err))?;
     Ok((StatusCode::OK, "Successfully deleted"))
 }
@@ -6,7 +6,7 @@ use axum::{
 };
 use crate::{
     db::{get_history, MessageHistoryRecord},
-    message::extract_id, AppState
+    message::{extract_conversation, extract_id}, AppState
 };
 use surrealdb::Error;
 use super::MessageError;
@@ -32,7 +32,8 @@ pub async fn history(
 ) -> Result<(StatusCode, Json<Vec<MessageHistoryRecord>>), MessageHistoryError>
 {
     let id: i64 = extract_id(&headers).map_err(|err| MessageHistoryError::MessageError(err))?;
-    let history: Vec<MessageHistoryRecord> = get_history(&app_state.db, id)
+    let conversation_id: i64 = extract_conversation(&headers).map_err(|err| MessageHistoryError::MessageError(err))?;
+    let history: Vec<MessageHistoryRecord> = get_history(&app_state.db, id, conversation_id)
     .await
     .map_err(|err| MessageHistoryError::DbError(err))?;
 
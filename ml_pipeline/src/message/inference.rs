@@ -1,9 +1,13 @@
-use axum::{extract::State, http::{HeaderMap, StatusCode}, response::IntoResponse, Json};
+use axum::{
+    body::Body, extract::State,
+    http::{header, HeaderMap, StatusCode},
+    response::{IntoResponse, Response}, Json
+};
 use serde::{Deserialize, Serialize};
 use tracing::{instrument, info};
 use std::sync::Arc;
 use crate::{
-    db::Kind, extract_header, message::{extract_id, Message, MessageError}, reasoning::{deep_think, normal_think, LLMResponse, ReasoningError}, AppState, HeaderError
+    db::{Kind, SharedDocument}, extract_header, message::{extract_conversation, extract_id, Message, MessageError}, reasoning::{deep_think, deep_think_stream, normal_think, normal_think_stream, LLMResponse, LLMStream, ReasoningError}, AppState, HeaderError
 };
 
 
@@ -11,7 +15,8 @@ use crate::{
 pub enum InferenceError {
     MessageError(MessageError),
     ReasoningError(ReasoningError),
-    HeaderError(HeaderError<String>)
+    HeaderError(HeaderError<String>),
+    InvalidDeepThink(String)
 }
 
 impl IntoResponse for InferenceError {
@@ -19,7 +24,10 @@ impl IntoResponse for InferenceError {
         match self {
             Self::ReasoningError(err) => err.into_response(),
             Self::MessageError(err) => err.into_response(),
-            Self::HeaderError(err) => err.into_response()
+            Self::HeaderError(err) => err.into_response(),
+            Self::InvalidDeepThink(value) => (
+                StatusCode::BAD_REQUEST, format!("Deep_think must be 'True' or 'False', got '{value}'")
+            ).into_response()
         }
     }
 }
@@ -34,7 +42,9 @@ pub struct MessageInference {
     #[serde(rename="Model")]
     pub model: String,
     #[serde(rename="Preprompt")]
-    pub pre_prompt: String
+    pub pre_prompt: String,
+    #[serde(rename="SharedDocuments", default)]
+    pub shared_documents: Vec<SharedDocument>
 }
 
 impl Into<Message> for MessageInference {
@@ -45,51 +55,116 @@ impl Into<Message> for MessageInference {
 
 
 
+/// Content type of streamed answers: one LLMChunk per line
+const NDJSON: &str = "application/x-ndjson";
+
+/// Whether the client asked for a streamed answer ("Stream: True" or "Accept: application/x-ndjson")
+fn stream_requested(headers: &HeaderMap) -> bool {
+    let stream_header: bool = headers.get("Stream")
+    .and_then(|value| value.to_str().ok())
+    .is_some_and(|value| value == "True");
+
+    let accepts_ndjson: bool = headers.get(header::ACCEPT)
+    .and_then(|value| value.to_str().ok())
+    .is_some_and(|value| value.contains(NDJSON));
+
+    stream_header || accepts_ndjson
+}
+
+
+/// Answers a message.
+///
+/// Without streaming the complete answer is returned as a single LLMResponse.
+/// Streamed answers are sent as application/x-ndjson, one LLMChunk per line,
+/// forwarded from Ollama as they are generated; the last line has done set.
 #[axum::debug_handler]
-#[instrument(skip(headers, app_state))]
+#[instrument(skip_all)]
 pub async fn inference(
     headers: HeaderMap, 
     State(app_state): State<Arc<AppState>>,
     Json(message): Json<MessageInference>,
-) -> Result<(StatusCode, Json<LLMResponse>), InferenceError> {
+) -> Result<Response, InferenceError> {
     let id: i64 = extract_id(&headers)
     .map_err(|err| InferenceError::MessageError(err))?;
 
+    let conversation_id: i64 = extract_conversation(&headers)
+    .map_err(|err| InferenceError::MessageError(err))?;
+
     let deep_think_header: String = extract_header(&headers, "Deep_think")
     .map_err(|err| InferenceError::HeaderError(err))?;
 
+    let deep: bool = match deep_think_header.as_str() {
+        "True" => true,
+        "False" => false,
+        _ => return Err(InferenceError::InvalidDeepThink(deep_think_header))
+    };
+
     let model: String = message.model.clone();
     let pre_prompt: String = message.pre_prompt.clone();
+    let shared: Vec<SharedDocument> = message.shared_documents.clone();
 
-    info!("Received pre_prompt: {}", pre_prompt);
+    // Only sizes are logged, messages and pre-prompts are user content
+    info!(
+        user = id, conversation = conversation_id, model = %model, deep,
+        message_length = message.message.len(), pre_prompt_length = pre_prompt.len(),
+        "Received inference request"
+    );
 
-    let response: Result<LLMResponse, ReasoningError> = match deep_think_header.as_str() {
-        "True" => {
-            deep_think(
+    if stream_requested(&headers) {
+        let stream: Result<LLMStream, ReasoningError> = if deep {
+            deep_think_stream(
                 &model, 
-                id, message.into(), 
+                id, conversation_id, message.into(), 
+                shared,
                 &app_state.db, 
                 app_state.clone()
             ).await
-        },
-        "False" => {
-            normal_think(
+        } else {
+            normal_think_stream(
                 &model,
                 id,
+                conversation_id,
                 pre_prompt, 
                 message.into(), 
+                shared,
                 &app_state.db, 
                 app_state.clone()
             ).await
-        },
-        _ => panic!("Fuck")
+        };
+
+        let stream: LLMStream = stream.map_err(|err| InferenceError::ReasoningError(err))?;
+
+        return Ok((
+            StatusCode::OK,
+            [(header::CONTENT_TYPE, NDJSON)],
+            Body::from_stream(stream)
+        ).into_response())
+    }
+
+    let response: Result<LLMResponse, ReasoningError> = if deep {
+        deep_think(
+            &model, 
+            id, conversation_id, message.into(), 
+            shared,
+            &app_state.db, 
+            app_state.clone()
+        ).await
+    } else {
+        normal_think(
+            &model,
+            id,
+            conversation_id,
+            pre_prompt, 
+            message.into(), 
+            shared,
+            &app_state.db, 
+            app_state.clone()
+        ).await
     };
 
     let json: Json<LLMResponse> = Json(
         response.map_err(|err| InferenceError::ReasoningError(err))?
     );
 
-    Ok((StatusCode::OK, json))
+    Ok((StatusCode::OK, json).into_response())
 }
-
-
@@ -54,4 +54,19 @@ pub fn extract_id(headers: &HeaderMap) -> Result<i64, MessageError> {
         },
         None => return Err(MessageError::IDHeaderMissing)
     }
-}
\ No newline at end of file
+}
+
+/// Reads the optional "Conversation" header.
+/// Requests without it address the legacy single chat, conversation 0.
+pub fn extract_conversation(headers: &HeaderMap) -> Result<i64, MessageError> {
+    match headers.get("Conversation") {
+        Some(value) => match value.to_str() {
+            Ok(value) => match value.parse::<i64>() {
+                Ok(conversation_id) => Ok(conversation_id),
+                Err(err) => Err(MessageError::InvalidHeader(Box::new(err)))
+            },
+            Err(err) => Err(MessageError::InvalidHeader(Box::new(err)))
+        },
+        None => Ok(0)
+    }
+}
@@ -11,7 +11,7 @@ use axum::{
 
 use crate::{
     AppState,
-    message::{Message, extract_id},
+    message::{Message, extract_conversation, extract_id},
     db::{MessageRecord, write_message},
 };
 
@@ -49,7 +49,7 @@ impl IntoResponse for UploadError {
 }
 
 
-#[instrument(skip(app))]
+#[instrument(skip_all)]
 pub async fn upload_message(
     header: HeaderMap, 
     State(app): State<Arc<AppState>>, 
@@ -57,6 +57,7 @@ pub async fn upload_message(
 ) -> Result<impl IntoResponse, UploadError>
 {
     let id: i64 = extract_id(&header).map_err(|_| UploadError::HeaderMissing)?;  
+    let conversation_id: i64 = extract_conversation(&header).map_err(|_| UploadError::HeaderMissing)?;
     
     let embedder: Arc<AppState> = app.clone();
     let (message, embedding) = spawn_blocking(move || {
@@ -72,6 +73,7 @@ pub async fn upload_message(
 
     let msg: MessageRecord = MessageRecord::new(
         id, 
+        conversation_id,
         message.kind, 
         message.message,
         embedding
@@ -2,9 +2,9 @@ use std::sync::Arc;
 use tokio::task::spawn_blocking;
 
 use crate::{
-    db::{related_messages, ChunkRecord, Database, Init, MessageRecordDB}, 
+    db::{related_messages, ChunkRecord, Database, Init, MessageRecordDB, SharedDocument}, 
     message::Message, 
-    reasoning::{prompt_llm, LLMResponse, ReasoningError}, AppState
+    reasoning::{prompt_llm, prompt_llm_stream, LLMResponse, LLMStream, ReasoningError}, AppState
 };
 
 
@@ -72,10 +72,41 @@ fn deep_think_prompt<'a>(
 pub async fn deep_think(
     model: &str, 
     id: i64, 
-    mut message: Message, 
+    conversation_id: i64,
+    message: Message, 
+    shared: Vec<SharedDocument>,
     db: &Database<Init>,
     embedder: Arc<AppState>
 ) -> Result<LLMResponse, ReasoningError> {
+    let prompt: String = reasoning_prompt(model, id, conversation_id, message, shared, db, embedder).await?;
+    prompt_llm(model, &prompt).await
+}
+
+/// Same as deep_think, but streams the final answer as it is generated.
+/// The intermediate reasoning steps are not streamed.
+pub async fn deep_think_stream(
+    model: &str, 
+    id: i64, 
+    conversation_id: i64,
+    message: Message, 
+    shared: Vec<SharedDocument>,
+    db: &Database<Init>,
+    embedder: Arc<AppState>
+) -> Result<LLMStream, ReasoningError> {
+    let prompt: String = reasoning_prompt(model, id, conversation_id, message, shared, db, embedder).await?;
+    prompt_llm_stream(model, &prompt).await
+}
+
+/// Runs the reasoning steps and returns the prompt for the final answer
+async fn reasoning_prompt(
+    model: &str, 
+    id: i64, 
+    conversation_id: i64,
+    mut message: Message, 
+    shared: Vec<SharedDocument>,
+    db: &Database<Init>,
+    embedder: Arc<AppState>
+) -> Result<String, ReasoningError> {
     let cloned_version: Arc<AppState> = embedder.clone();
     let (embedding, ret_message) = spawn_blocking(move || {
         let embedding: Vec<f32> = cloned_version.embedder.embed(vec![&message.message], None)
@@ -93,10 +124,10 @@ pub async fn deep_think(
     let mut thought_chain: Vec<String> = Vec::with_capacity(5);
 
     for _ in 0..5 {
-        let related_messages: Vec<crate::db::MessageRecordDB> = related_messages(db, id, rc.clone())
+        let related_messages: Vec<crate::db::MessageRecordDB> = related_messages(db, id, conversation_id, rc.clone())
         .await.map_err(|err| ReasoningError::DBError(err))?;
 
-        let related_documents: Vec<crate::db::ChunkRecord> = ChunkRecord::most_related(db, id, rc.clone())
+        let related_documents: Vec<crate::db::ChunkRecord> = ChunkRecord::most_related(db, id, &shared, rc.clone())
         .await.map_err(|err| ReasoningError::ChunkError(err))?;
 
         let reasoning: &str = deep_think_prompt(
@@ -127,13 +158,13 @@ pub async fn deep_think(
         prompt.clear();
     }
 
-    let related_messages: Vec<crate::db::MessageRecordDB> = related_messages(db, id, rc.clone())
+    let related_messages: Vec<crate::db::MessageRecordDB> = related_messages(db, id, conversation_id, rc.clone())
     .await.map_err(|err| ReasoningError::DBError(err))?;
 
-    let related_documents: Vec<crate::db::ChunkRecord> = ChunkRecord::most_related(db, id, rc.clone())
+    let related_documents: Vec<crate::db::ChunkRecord> = ChunkRecord::most_related(db, id, &shared, rc.clone())
     .await.map_err(|err| ReasoningError::ChunkError(err))?;
 
-    let reasoning: &str = deep_think_prompt(
+    deep_think_prompt(
         &mut prompt,
         &message.message,
         &thought_chain,
@@ -141,5 +172,5 @@ pub async fn deep_think(
         &related_documents, 
     );
 
-    prompt_llm(model, reasoning).await
+    Ok(prompt)
 }
\ No newline at end of file
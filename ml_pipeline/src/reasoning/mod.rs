@@ -3,15 +3,16 @@ mod normal;
 
 
 use crate::db::{ChunkError, ChunkRecord, MessageHistoryRecord, MessageRecordDB};
-use std::{sync::LazyLock, fmt::Write};
-use axum::response::IntoResponse;
+use std::{io, sync::LazyLock, fmt::Write};
+use axum::{body::Bytes, response::IntoResponse};
+use futures::stream::{self, BoxStream, StreamExt};
 use reqwest::{Client, StatusCode};
 use serde::{Deserialize, Serialize};
 use tokio::task::JoinError;
 
 
-pub use deep_think::deep_think;
-pub use normal::normal_think;
+pub use deep_think::{deep_think, deep_think_stream};
+pub use normal::{normal_think, normal_think_stream};
 
 
 
@@ -153,6 +154,32 @@ pub struct LLMResponse {
     response: String
 }
 
+/// One line of a streamed answer.
+///
+/// Ollama sends the generated text piece by piece, the last line has done set
+/// and carries the statistics of the generation. Errors during the generation
+/// arrive as a line with only error set.
+#[derive(Deserialize, Serialize, Default, Debug)]
+pub struct LLMChunk {
+    #[serde(default)]
+    pub response: String,
+    #[serde(default)]
+    pub done: bool,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub model: Option<String>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub total_duration: Option<i64>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub prompt_eval_count: Option<i64>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub eval_count: Option<i64>,
+    #[serde(default, skip_serializing)]
+    pub error: Option<String>,
+}
+
+/// Streamed answer of the LLM: LLMChunk objects, one per line (application/x-ndjson)
+pub type LLMStream = BoxStream<'static, Result<Bytes, io::Error>>;
+
 #[derive(Serialize)]
 pub struct Options {
     temperature: f32,  // 0.3 für strikte Einhaltung
@@ -180,4 +207,121 @@ pub async fn prompt_llm(model: &str, prompt: &str) -> Result<LLMResponse, Reason
 
 
     response.json().await.map_err(|err| ReasoningError::RequestError(err))
-}
\ No newline at end of file
+}
+
+
+/// Prompts the LLM and streams the answer as it is generated.
+///
+/// Errors before the generation started (request failed, status not OK) are
+/// returned directly. Errors afterwards end the stream with an io::Error, which
+/// aborts the response so the client can tell it apart from a complete answer.
+pub async fn prompt_llm_stream(model: &str, prompt: &str) -> Result<LLMStream, ReasoningError> {
+    let request: LLMRequest = LLMRequest { 
+        model, 
+        prompt, 
+        stream: true, 
+        think: false,
+    };
+
+    let response: reqwest::Response = HTTPCLIENT.post(RESPONSE_GENERATION_URL)
+    .json(&request).send().await.map_err(|err| ReasoningError::RequestError(err))?;
+
+    if response.status() != StatusCode::OK {
+        let error: String = response.text().await.map_err(|err| ReasoningError::RequestError(err))?;
+        return Err(ReasoningError::LLMError(error))
+    }
+
+    Ok(ndjson_stream(response).boxed())
+}
+
+/// Splits the body of a streamed Ollama response into lines and forwards each as LLMChunk.
+///
+/// The stream ends after the chunk with done set, after the body ended or after the first error.
+fn ndjson_stream(response: reqwest::Response) -> impl futures::Stream<Item = Result<Bytes, io::Error>> + Send {
+    stream::unfold(Some((response, Vec::<u8>::new())), |state| async move {
+        let Some((mut response, mut buffer)) = state else { return None };
+
+        loop {
+            if let Some(position) = buffer.iter().position(|byte| *byte == b'\n') {
+                let line: Vec<u8> = buffer.drain(..=position).collect();
+
+                match forward_line(&line) {
+                    Ok(None) => continue,
+                    Ok(Some((bytes, true))) => return Some((Ok(bytes), None)),
+                    Ok(Some((bytes, false))) => return Some((Ok(bytes), Some((response, buffer)))),
+                    Err(err) => return Some((Err(err), None)),
+                }
+            }
+
+            match response.chunk().await {
+                Ok(Some(bytes)) => buffer.extend_from_slice(&bytes),
+                Ok(None) if buffer.trim_ascii().is_empty() => return None,
+                Ok(None) => buffer.push(b'\n'), // Last line without line feed
+                Err(err) => return Some((Err(io::Error::other(err)), None)),
+            }
+        }
+    })
+}
+
+/// Converts one line of an Ollama response into a line of the answer.
+///
+/// Returns:
+///   - None for blank lines
+///   - The serialized LLMChunk with a trailing line feed and whether it is the last one
+///   - An error for malformed lines and errors reported by Ollama
+pub(crate) fn forward_line(line: &[u8]) -> Result<Option<(Bytes, bool)>, io::Error> {
+    let line: &[u8] = line.trim_ascii();
+    if line.is_empty() {
+        return Ok(None)
+    }
+
+    let chunk: LLMChunk = serde_json::from_slice(line).map_err(|err| io::Error::new(io::ErrorKind::InvalidData, err))?;
+
+    if let Some(error) = chunk.error {
+        return Err(io::Error::other(error))
+    }
+
+    let mut bytes: Vec<u8> = serde_json::to_vec(&chunk).map_err(|err| io::Error::new(io::ErrorKind::InvalidData, err))?;
+    bytes.push(b'\n');
+
+    Ok(Some((Bytes::from(bytes), chunk.done)))
+}
+
+
+#[cfg(test)]
+mod streaming {
+    use crate::reasoning::{forward_line, LLMChunk};
+
+    #[test]
+    fn test_forward_token() {
+        let (bytes, done) = forward_line(br#"{"model":"m","created_at":"2025-01-01T00:00:00Z","response":"Hal","done":false}"#)
+        .unwrap().unwrap();
+
+        assert!(!done);
+        assert!(bytes.ends_with(b"\n"));
+
+        let chunk: LLMChunk = serde_json::from_slice(&bytes).unwrap();
+        assert_eq!(chunk.response, "Hal");
+        assert!(!chunk.done);
+    }
+
+    #[test]
+    fn test_forward_last_chunk() {
+        let (bytes, done) = forward_line(
+            br#"{"model":"m","response":"","done":true,"context":[1,2,3],"total_duration":10,"prompt_eval_count":2,"eval_count":3}"#
+        ).unwrap().unwrap();
+
+        assert!(done);
+
+        let text: &str = std::str::from_utf8(&bytes).unwrap();
+        assert!(!text.contains("context"), "context is not forwarded: {text}");
+        assert!(text.contains(r#""eval_count":3"#));
+    }
+
+    #[test]
+    fn test_forward_blank_and_invalid_lines() {
+        assert!(forward_line(b"  \r\n").unwrap().is_none());
+        assert!(forward_line(b"{not json").is_err());
+        assert!(forward_line(br#"{"error":"model not found"}"#).is_err());
+    }
+}
@@ -2,9 +2,9 @@ use std::sync::Arc;
 use tokio::task::spawn_blocking;
 
 use crate::{
-    db::{get_last_10, related_messages, ChunkRecord, Database, Init, MessageHistoryRecord, MessageRecordDB}, 
+    db::{get_last_10, related_messages, ChunkRecord, Database, Init, MessageHistoryRecord, MessageRecordDB, SharedDocument}, 
     message::Message, 
-    reasoning::{build_dynamic_prompt, prompt_llm, LLMResponse, ReasoningError}, 
+    reasoning::{build_dynamic_prompt, prompt_llm, prompt_llm_stream, LLMResponse, LLMStream, ReasoningError}, 
     AppState
 };
 
@@ -14,11 +14,42 @@ use crate::{
 pub async fn normal_think(
     model: &str, 
     id: i64,
+    conversation_id: i64,
     pre_prompt: String,
     message: Message, 
+    shared: Vec<SharedDocument>,
     db: &Database<Init>,
     embedder: Arc<AppState>
 ) -> Result<LLMResponse, ReasoningError> {
+    let prompt: String = normal_prompt(id, conversation_id, pre_prompt, message, shared, db, embedder).await?;
+    prompt_llm(model, &prompt).await
+}
+
+/// Same as normal_think, but streams the answer as it is generated
+pub async fn normal_think_stream(
+    model: &str, 
+    id: i64,
+    conversation_id: i64,
+    pre_prompt: String,
+    message: Message, 
+    shared: Vec<SharedDocument>,
+    db: &Database<Init>,
+    embedder: Arc<AppState>
+) -> Result<LLMStream, ReasoningError> {
+    let prompt: String = normal_prompt(id, conversation_id, pre_prompt, message, shared, db, embedder).await?;
+    prompt_llm_stream(model, &prompt).await
+}
+
+/// Builds the prompt from the message, related messages and documents and the recent history
+async fn normal_prompt(
+    id: i64,
+    conversation_id: i64,
+    pre_prompt: String,
+    message: Message, 
+    shared: Vec<SharedDocument>,
+    db: &Database<Init>,
+    embedder: Arc<AppState>
+) -> Result<String, ReasoningError> {
     let (embedding, message) =  spawn_blocking(move || {
         let embedding: Vec<f32> = embedder.embedder.embed(vec![&message.message], None)
         .map_err(|err| ReasoningError::Embedding(err))?
@@ -28,14 +59,14 @@ pub async fn normal_think(
 
     let shared_embedding: Arc<Vec<f32>> = Arc::new(embedding);
 
-    let related_messages: Vec<MessageRecordDB> = related_messages(db, id, shared_embedding.clone())
+    let related_messages: Vec<MessageRecordDB> = related_messages(db, id, conversation_id, shared_embedding.clone())
     .await.map_err(|err| ReasoningError::DBError(err))?;
 
-    let related_documents: Vec<ChunkRecord> = ChunkRecord::most_related(db, id, shared_embedding)
+    let related_documents: Vec<ChunkRecord> = ChunkRecord::most_related(db, id, &shared, shared_embedding)
     .await.map_err(|err| ReasoningError::ChunkError(err))?;
 
 
-    let last_10_messages: Vec<MessageHistoryRecord> = get_last_10(db, id)
+    let last_10_messages: Vec<MessageHistoryRecord> = get_last_10(db, id, conversation_id)
     .await.map_err(|err| ReasoningError::DBError(err))?;
 
     let prompt: String = build_dynamic_prompt(
@@ -46,8 +77,5 @@ pub async fn normal_think(
         &message.message
     );
 
-    println!("Prompt: {}", prompt);
-
-
-    prompt_llm(model, &prompt).await
+    Ok(prompt)
 }
\ No newline at end of file